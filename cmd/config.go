@@ -0,0 +1,467 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/yxuechao007/claude_sync/internal/config"
+	"github.com/yxuechao007/claude_sync/internal/mergetool"
+)
+
+const configUsage = `Usage: claude_sync config <subcommand> [options]
+
+Subcommands:
+  list                                  List current sync items (same as --list)
+  add-item --name N --path P [--type file|directory] [--gist-file F] [--disabled]
+  remove <item>                         Remove a sync item
+  enable <item>                         Enable a sync item
+  disable <item>                        Disable a sync item
+  set <key> <value>                     Set conflict_strategy, github_token_env, gist_id,
+                                        mergetool, device_name, match_git_remote,
+                                        mcp_project_servers (local, project, promote),
+                                        or <item>.local_path|gist_file|type
+  filter add-exclude <item> <field>     Exclude a JSON field from an item
+  filter add-include <item> <field>     Only sync the listed JSON fields
+  filter remove-exclude <item> <field>
+  filter remove-include <item> <field>
+  merge-rule <item> <path> <strategy>   Set a pull merge rule (union-arrays, map-merge-by-key,
+                                        prefer-local, prefer-remote, ask, max-number, synced-set,
+                                        mcp-servers, hooks; none removes it)
+  local-pattern add <name> <regex>      Add a machine-specific content pattern
+  local-pattern remove <name>
+  local-action <item> <path> <action>   What push does with machine-specific content below a path
+                                        (exclude, warn, ignore; none removes it)
+  project-map add <from> <to>           Map project paths of other machines (prefix <from>) to <to>
+  project-map remove <from>
+  mcp-server set <name|glob|tag:T> [--sync always|never|pull-only|push-only] [--only-on linux,<device>] [--tags T,...] [--promote]
+                                        Set how an MCP server of ~/.claude.json is synced
+  mcp-server remove <name|glob|tag:T>
+  promote-mcp add <project|glob|*>      Copy a project's MCP servers into the global mcpServers on push
+  promote-mcp remove <project|glob|*>
+  validate                              Check config.json for mistakes
+  migrate [--dry-run]                   Run pending schema migrations`
+
+func cmdConfig(args []string) {
+	// migrate 需要在 config.Load 之前处理，否则 Load 会先自动迁移
+	if len(args) > 0 && args[0] == "migrate" {
+		cmdConfigMigrate(args[1:])
+		return
+	}
+
+	sub := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		sub, args = args[0], args[1:]
+	}
+
+	switch sub {
+	case "":
+		fs := flag.NewFlagSet("config", flag.ExitOnError)
+		list := fs.Bool("list", false, "List current sync items")
+		fs.Usage = func() { fmt.Println(configUsage) }
+		fs.Parse(args)
+		if !*list {
+			fs.Usage()
+			return
+		}
+		printConfig(loadConfigOrExit())
+	case "list":
+		printConfig(loadConfigOrExit())
+	case "add-item":
+		cmdConfigAddItem(args)
+	case "remove", "enable", "disable":
+		if len(args) != 1 {
+			exitWithError(fmt.Errorf("usage: claude_sync config %s <item>", sub))
+		}
+		editConfig(func(cfg *config.Config) error {
+			switch sub {
+			case "remove":
+				return cfg.RemoveItem(args[0])
+			case "enable":
+				return cfg.SetEnabled(args[0], true)
+			default:
+				return cfg.SetEnabled(args[0], false)
+			}
+		})
+		fmt.Printf("✓ %s: %s\n", sub, args[0])
+	case "set":
+		if len(args) != 2 {
+			exitWithError(fmt.Errorf("usage: claude_sync config set <key> <value>\nkeys: %s", strings.Join(config.SettableKeys(), ", ")))
+		}
+		editConfig(func(cfg *config.Config) error {
+			return cfg.Set(args[0], args[1])
+		})
+		fmt.Printf("✓ %s = %s\n", args[0], args[1])
+	case "filter":
+		cmdConfigFilter(args)
+	case "merge-rule":
+		if len(args) != 3 {
+			exitWithError(fmt.Errorf("usage: claude_sync config merge-rule <item> <path> <strategy|none>"))
+		}
+		strategy := args[2]
+		if strategy == "none" {
+			strategy = ""
+		}
+		editConfig(func(cfg *config.Config) error {
+			return cfg.SetMergeRule(args[0], args[1], strategy)
+		})
+		fmt.Printf("✓ %s merge rule %s: %s\n", args[0], args[1], args[2])
+	case "local-pattern":
+		cmdConfigLocalPattern(args)
+	case "local-action":
+		if len(args) != 3 {
+			exitWithError(fmt.Errorf("usage: claude_sync config local-action <item> <path> <exclude|warn|ignore|none>"))
+		}
+		action := args[2]
+		if action == "none" {
+			action = ""
+		}
+		editConfig(func(cfg *config.Config) error {
+			return cfg.SetLocalAction(args[0], args[1], action)
+		})
+		fmt.Printf("✓ %s local action %s: %s\n", args[0], args[1], args[2])
+	case "project-map":
+		cmdConfigProjectMap(args)
+	case "mcp-server":
+		cmdConfigMCPServer(args)
+	case "promote-mcp":
+		cmdConfigPromoteMCP(args)
+	case "validate":
+		cmdConfigValidate()
+	default:
+		fmt.Printf("Unknown config subcommand: %s\n\n", sub)
+		fmt.Println(configUsage)
+		os.Exit(1)
+	}
+}
+
+func loadConfigOrExit() *config.Config {
+	cfg, err := config.Load()
+	if err != nil {
+		exitWithError(err)
+	}
+	return cfg
+}
+
+func exitWithError(err error) {
+	fmt.Printf("Error: %v\n", err)
+	os.Exit(1)
+}
+
+// editConfig loads the config, applies edit and saves it, refusing to save
+// when the edit introduces validation errors.
+func editConfig(edit func(cfg *config.Config) error) {
+	cfg := loadConfigOrExit()
+
+	before := make(map[string]bool)
+	for _, issue := range cfg.Validate() {
+		before[issue.String()] = true
+	}
+
+	if err := edit(cfg); err != nil {
+		exitWithError(err)
+	}
+
+	var introduced []config.Issue
+	for _, issue := range cfg.Validate() {
+		if issue.Severity == config.SeverityError && !before[issue.String()] {
+			introduced = append(introduced, issue)
+		}
+	}
+	if len(introduced) > 0 {
+		fmt.Println("Config not saved, the change would make it invalid:")
+		for _, issue := range introduced {
+			fmt.Printf("  %s\n", issue)
+		}
+		os.Exit(1)
+	}
+
+	if err := cfg.Save(); err != nil {
+		exitWithError(err)
+	}
+}
+
+func printConfig(cfg *config.Config) {
+	fmt.Printf("Gist ID: %s\n", cfg.GistID)
+	fmt.Printf("Token Env: %s\n", cfg.GitHubTokenEnv)
+	fmt.Printf("Conflict Strategy: %s\n", cfg.ConflictStrategy)
+	if tool := mergetool.Resolve(cfg.MergeTool); tool != "" {
+		fmt.Printf("Merge Tool: %s\n", tool)
+	}
+	fmt.Printf("Device: %s\n", cfg.Device())
+	fmt.Println()
+
+	if len(cfg.LocalPatterns) > 0 {
+		fmt.Println("Local Patterns:")
+		for _, p := range cfg.LocalPatterns {
+			fmt.Printf("  %-20s %s\n", p.Name, p.Regex)
+		}
+		fmt.Println()
+	}
+
+	if len(cfg.ProjectMappings) > 0 || cfg.MatchGitRemote {
+		fmt.Println("Project Mappings:")
+		for _, m := range cfg.ProjectMappings {
+			fmt.Printf("  %s → %s\n", m.From, m.To)
+		}
+		if cfg.MatchGitRemote {
+			fmt.Println("  (projects with the same git remote are matched)")
+		}
+		fmt.Println()
+	}
+
+	fmt.Printf("MCP Project Servers: %s\n", cfg.MCPProjectServers())
+	for _, project := range cfg.PromoteMCPProjects {
+		if project != "*" {
+			fmt.Printf("  promoted: %s\n", project)
+		}
+	}
+	fmt.Println()
+
+	if len(cfg.MCPServers) > 0 {
+		fmt.Println("MCP Server Rules:")
+		keys := make([]string, 0, len(cfg.MCPServers))
+		for key := range cfg.MCPServers {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Printf("  %-20s %s\n", key, formatMCPServerRule(cfg.MCPServers[key]))
+		}
+		fmt.Println()
+	}
+
+	fmt.Println("Sync Items:")
+	fmt.Printf("%-20s %-10s %-8s %s\n", "NAME", "TYPE", "ENABLED", "PATH")
+	fmt.Println(strings.Repeat("-", 70))
+
+	for _, item := range cfg.SyncItems {
+		enabled := "yes"
+		if !item.Enabled {
+			enabled = "no"
+		}
+		itemType := item.Type
+		if itemType == "" {
+			itemType = "file"
+		}
+		fmt.Printf("%-20s %-10s %-8s %s\n", item.Name, itemType, enabled, item.LocalPath)
+	}
+}
+
+func cmdConfigAddItem(args []string) {
+	fs := flag.NewFlagSet("config add-item", flag.ExitOnError)
+	name := fs.String("name", "", "Item name")
+	path := fs.String("path", "", "Local path, e.g. ~/.claude/agents")
+	itemType := fs.String("type", "", "file or directory (inferred from the path if omitted)")
+	gistFile := fs.String("gist-file", "", "File name in the gist (default <name>.tar.gz or <name><ext>)")
+	disabled := fs.Bool("disabled", false, "Add the item disabled")
+	fs.Parse(args)
+
+	item, err := config.NewItem(*name, *path, *itemType, *gistFile)
+	if err != nil {
+		exitWithError(err)
+	}
+	item.Enabled = !*disabled
+
+	editConfig(func(cfg *config.Config) error {
+		return cfg.AddItem(item)
+	})
+	fmt.Printf("✓ Added %s (%s) → %s\n", item.Name, item.Type, item.GistFile)
+}
+
+func cmdConfigFilter(args []string) {
+	if len(args) != 3 {
+		exitWithError(fmt.Errorf("usage: claude_sync config filter add-exclude|add-include|remove-exclude|remove-include <item> <field>"))
+	}
+	action, name, field := args[0], args[1], args[2]
+
+	editConfig(func(cfg *config.Config) error {
+		switch action {
+		case "add-exclude":
+			return cfg.AddFilterField(name, false, field)
+		case "add-include":
+			return cfg.AddFilterField(name, true, field)
+		case "remove-exclude":
+			return cfg.RemoveFilterField(name, false, field)
+		case "remove-include":
+			return cfg.RemoveFilterField(name, true, field)
+		default:
+			return fmt.Errorf("unknown filter action %q", action)
+		}
+	})
+	fmt.Printf("✓ %s %s: %s\n", action, name, field)
+}
+
+func cmdConfigLocalPattern(args []string) {
+	if len(args) < 2 {
+		exitWithError(fmt.Errorf("usage: claude_sync config local-pattern add <name> <regex> | remove <name>"))
+	}
+	switch args[0] {
+	case "add":
+		if len(args) != 3 {
+			exitWithError(fmt.Errorf("usage: claude_sync config local-pattern add <name> <regex>"))
+		}
+		editConfig(func(cfg *config.Config) error {
+			return cfg.AddLocalPattern(args[1], args[2])
+		})
+		fmt.Printf("✓ Added local pattern %s: %s\n", args[1], args[2])
+	case "remove":
+		editConfig(func(cfg *config.Config) error {
+			return cfg.RemoveLocalPattern(args[1])
+		})
+		fmt.Printf("✓ Removed local pattern %s\n", args[1])
+	default:
+		exitWithError(fmt.Errorf("unknown local-pattern action %q", args[0]))
+	}
+}
+
+func cmdConfigProjectMap(args []string) {
+	if len(args) < 2 {
+		exitWithError(fmt.Errorf("usage: claude_sync config project-map add <from> <to> | remove <from>"))
+	}
+	switch args[0] {
+	case "add":
+		if len(args) != 3 {
+			exitWithError(fmt.Errorf("usage: claude_sync config project-map add <from> <to>"))
+		}
+		editConfig(func(cfg *config.Config) error {
+			return cfg.AddProjectMapping(args[1], args[2])
+		})
+		fmt.Printf("✓ Added project mapping %s → %s\n", args[1], args[2])
+	case "remove":
+		editConfig(func(cfg *config.Config) error {
+			return cfg.RemoveProjectMapping(args[1])
+		})
+		fmt.Printf("✓ Removed project mapping %s\n", args[1])
+	default:
+		exitWithError(fmt.Errorf("unknown project-map action %q", args[0]))
+	}
+}
+
+func cmdConfigMCPServer(args []string) {
+	if len(args) < 2 {
+		exitWithError(fmt.Errorf("usage: claude_sync config mcp-server set <name|glob|tag:T> [options] | remove <name|glob|tag:T>"))
+	}
+	switch args[0] {
+	case "set":
+		fs := flag.NewFlagSet("config mcp-server set", flag.ExitOnError)
+		sync := fs.String("sync", "", "always, never, pull-only or push-only")
+		onlyOn := fs.String("only-on", "", "Comma-separated OS names (linux, darwin, windows) or device names to sync on")
+		tags := fs.String("tags", "", "Comma-separated tags; tag:<tag> rules apply to the server")
+		promote := fs.Bool("promote", false, "Copy the server from any project into the global mcpServers on push")
+		key := parseNamed(fs, args[1:], "name|glob|tag:T")[0]
+		rule := config.MCPServerRule{Sync: *sync, OnlyOn: splitComma(*onlyOn), Tags: splitComma(*tags), Promote: *promote}
+		if rule.Sync == "" && len(rule.OnlyOn) == 0 && len(rule.Tags) == 0 && !rule.Promote {
+			exitWithError(fmt.Errorf("mcp-server set needs --sync, --only-on, --tags or --promote"))
+		}
+		editConfig(func(cfg *config.Config) error {
+			return cfg.SetMCPServerRule(key, rule)
+		})
+		fmt.Printf("✓ MCP server rule %s: %s\n", key, formatMCPServerRule(rule))
+	case "remove":
+		editConfig(func(cfg *config.Config) error {
+			return cfg.SetMCPServerRule(args[1], config.MCPServerRule{})
+		})
+		fmt.Printf("✓ Removed MCP server rule %s\n", args[1])
+	default:
+		exitWithError(fmt.Errorf("unknown mcp-server action %q", args[0]))
+	}
+}
+
+func formatMCPServerRule(rule config.MCPServerRule) string {
+	var parts []string
+	if rule.Sync != "" {
+		parts = append(parts, "sync="+rule.Sync)
+	}
+	if len(rule.OnlyOn) > 0 {
+		parts = append(parts, "only_on="+strings.Join(rule.OnlyOn, ","))
+	}
+	if len(rule.Tags) > 0 {
+		parts = append(parts, "tags="+strings.Join(rule.Tags, ","))
+	}
+	if rule.Promote {
+		parts = append(parts, "promote")
+	}
+	return strings.Join(parts, " ")
+}
+
+func cmdConfigPromoteMCP(args []string) {
+	if len(args) != 2 {
+		exitWithError(fmt.Errorf("usage: claude_sync config promote-mcp add|remove <project|glob|*>"))
+	}
+	switch args[0] {
+	case "add":
+		editConfig(func(cfg *config.Config) error {
+			return cfg.AddPromoteMCPProject(args[1])
+		})
+		fmt.Printf("✓ MCP servers of %s are copied into the global mcpServers on push\n", args[1])
+	case "remove":
+		editConfig(func(cfg *config.Config) error {
+			return cfg.RemovePromoteMCPProject(args[1])
+		})
+		fmt.Printf("✓ MCP servers of %s stay in the project\n", args[1])
+	default:
+		exitWithError(fmt.Errorf("unknown promote-mcp action %q", args[0]))
+	}
+}
+
+func splitComma(s string) []string {
+	var values []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
+
+func cmdConfigValidate() {
+	cfg := loadConfigOrExit()
+	issues := cfg.Validate()
+	if len(issues) == 0 {
+		fmt.Println("✓ Config is valid")
+		return
+	}
+
+	for _, issue := range issues {
+		fmt.Printf("  %s\n", issue)
+	}
+	if config.HasErrors(issues) {
+		os.Exit(1)
+	}
+}
+
+func cmdConfigMigrate(args []string) {
+	fs := flag.NewFlagSet("config migrate", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "Show pending migrations without writing")
+	fs.Parse(args)
+
+	results, err := config.Migrate(*dryRun)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	if *dryRun {
+		fmt.Println("Dry run - no changes will be made")
+		fmt.Println()
+	}
+
+	for _, r := range results {
+		if !r.Pending() {
+			fmt.Printf("%s: schema v%d, up to date\n", r.File, r.To)
+			continue
+		}
+		fmt.Printf("%s: schema v%d → v%d\n", r.File, r.From, r.To)
+		for _, step := range r.Steps {
+			fmt.Printf("  %s\n", step)
+		}
+		for _, change := range r.Changes {
+			fmt.Printf("    - %s\n", change)
+		}
+		if r.Backup != "" {
+			fmt.Printf("  backup: %s\n", r.Backup)
+		}
+	}
+}
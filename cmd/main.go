@@ -10,8 +10,10 @@ import (
 
 	"github.com/yxuechao007/claude_sync/internal/auth"
 	"github.com/yxuechao007/claude_sync/internal/config"
+	"github.com/yxuechao007/claude_sync/internal/diff"
 	"github.com/yxuechao007/claude_sync/internal/gist"
 	"github.com/yxuechao007/claude_sync/internal/mcp"
+	"github.com/yxuechao007/claude_sync/internal/mergetool"
 	"github.com/yxuechao007/claude_sync/internal/sync"
 )
 
@@ -32,10 +34,20 @@ func main() {
 		cmdPull(os.Args[2:])
 	case "status":
 		cmdStatus(os.Args[2:])
+	case "diff":
+		cmdDiff(os.Args[2:])
 	case "config":
 		cmdConfig(os.Args[2:])
+	case "mcp":
+		cmdMCP(os.Args[2:])
 	case "mcp-apply":
 		cmdMCPApply(os.Args[2:])
+	case "permissions":
+		cmdPermissions(os.Args[2:])
+	case "projects":
+		cmdProjects(os.Args[2:])
+	case "scan":
+		cmdScan(os.Args[2:])
 	case "version":
 		fmt.Printf("claude_sync version %s\n", version)
 	case "help", "-h", "--help":
@@ -54,14 +66,19 @@ Usage:
   claude_sync <command> [options]
 
 Commands:
-  init       Initialize sync with a GitHub Gist
-  push       Push local configuration to Gist
-  pull       Pull configuration from Gist to local
-  status     Show sync status for all items
-  config     Manage sync configuration
-  mcp-apply  Apply global MCP config to current project
-  version    Show version information
-  help       Show this help message
+  init         Initialize sync with a GitHub Gist
+  push         Push local configuration to Gist
+  pull         Pull configuration from Gist to local
+  status       Show sync status for all items
+  diff         Show differences for an item (local/remote/base/revision)
+  config       Manage sync configuration
+  mcp          List, add, remove, rename, enable or disable MCP servers
+  mcp-apply    Apply global MCP config to current project
+  permissions  List or prune synced permission entries by origin device
+  projects     List, show or prune project entries in ~/.claude.json
+  scan         Report machine-specific content (home paths, localhost ports...)
+  version      Show version information
+  help         Show this help message
 
 Options (pull/mcp-apply only):
   -y, --yes  Auto-confirm all changes (skip diff confirmation)
@@ -69,11 +86,27 @@ Options (pull/mcp-apply only):
 Examples:
   claude_sync init --token ghp_xxxx
   claude_sync push
+  claude_sync push --dry-run --json  # Preview, including filtered paths
   claude_sync pull --force
   claude_sync pull -y              # Auto-confirm all changes
+  claude_sync pull --mergetool     # Resolve conflicts with the merge tool
+  claude_sync mcp list             # MCP servers and project overrides
+  claude_sync mcp add github --command npx --arg -y --arg @mcp/github --push
+  claude_sync mcp check            # Which MCP servers start on this machine
+  claude_sync mcp export --format cursor --merge
   claude_sync mcp-apply            # Apply MCP to current project
   claude_sync mcp-apply --overwrite
+  claude_sync mcp-apply --all      # Apply MCP to every known project
+  claude_sync mcp-apply --glob '~/code/*' --discover
+  claude_sync mcp-apply --target mcp-json --strip-secrets  # Write the repo's .mcp.json
   claude_sync status
+  claude_sync diff settings        # What pull would change locally
+  claude_sync diff --remote        # What push would change remotely
+  claude_sync config migrate --dry-run
+  claude_sync permissions list     # Permission entries by origin device
+  claude_sync permissions prune --device old-laptop
+  claude_sync scan                 # Find machine-specific paths before pushing
+  claude_sync projects prune --missing
 
 Run 'claude_sync <command> -h' for more information on a command.`)
 }
@@ -249,6 +282,7 @@ func cmdPush(args []string) {
 	fs := flag.NewFlagSet("push", flag.ExitOnError)
 	dryRun := fs.Bool("dry-run", false, "Preview changes without actually pushing")
 	force := fs.Bool("force", false, "Force push even if there are conflicts")
+	jsonOutput := fs.Bool("json", false, "Print results as JSON")
 	fs.Parse(args)
 
 	cfg, err := config.Load()
@@ -269,7 +303,7 @@ func cmdPush(args []string) {
 		os.Exit(1)
 	}
 
-	if *dryRun {
+	if *dryRun && !*jsonOutput {
 		fmt.Println("Dry run - no changes will be made")
 		fmt.Println()
 	}
@@ -280,6 +314,18 @@ func cmdPush(args []string) {
 		os.Exit(1)
 	}
 
+	if *jsonOutput {
+		data, err := json.MarshalIndent(struct {
+			DryRun  bool              `json:"dry_run"`
+			Results []sync.ItemStatus `json:"results"`
+		}{*dryRun, results}, "", "  ")
+		if err != nil {
+			exitWithError(err)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
 	printResults("Push", results, *dryRun)
 }
 
@@ -294,6 +340,8 @@ func cmdPull(args []string) {
 	applyMCPOverwrite := fs.Bool("apply-mcp-overwrite", false, "Overwrite project MCP config when applying")
 	useRemote := fs.Bool("use-remote", false, "Use remote config (overwrite local)")
 	keepLocal := fs.Bool("keep-local", false, "Keep local config (only add new items from remote)")
+	useMergeTool := fs.Bool("mergetool", false, "Resolve conflicting file items with the external merge tool")
+	toolName := fs.String("tool", "", "Merge tool to use (vimdiff, meld, kdiff3, opendiff, vscode or a custom command)")
 	fs.Parse(args)
 
 	// 合并 -y 和 --yes
@@ -372,6 +420,20 @@ func cmdPull(args []string) {
 	// 设置合并策略
 	engine.SetMergeStrategy(mergeStrategy)
 
+	// 外部合并工具: --tool > $CLAUDE_SYNC_MERGETOOL > config.mergetool
+	mergeTool := mergetool.Resolve(cfg.MergeTool)
+	if *toolName != "" {
+		mergeTool = *toolName
+		*useMergeTool = true
+	}
+	if *useMergeTool {
+		if mergeTool == "" {
+			fmt.Printf("Error: no merge tool configured, set %s or \"mergetool\" in config.json\n", mergetool.EnvVar)
+			os.Exit(1)
+		}
+		engine.SetMergeTool(mergeTool)
+	}
+
 	// Check for conflicts if not forcing
 	if !*force && !*dryRun {
 		statuses, err := engine.GetStatus()
@@ -388,22 +450,30 @@ func cmdPull(args []string) {
 			}
 		}
 
-		if hasConflicts && cfg.ConflictStrategy == "ask" {
+		if hasConflicts && cfg.ConflictStrategy == "ask" && !*useMergeTool {
 			fmt.Println("Conflicts detected:")
 			for _, s := range statuses {
 				if s.Status == sync.StatusConflict {
 					fmt.Printf("  - %s\n", s.Name)
 				}
 			}
-			fmt.Print("\nOverwrite local changes? [y/N]: ")
+			if mergeTool != "" {
+				fmt.Printf("\nOverwrite local changes? [y/N/m=merge with %s]: ", mergeTool)
+			} else {
+				fmt.Print("\nOverwrite local changes? [y/N]: ")
+			}
 			reader := bufio.NewReader(os.Stdin)
 			response, _ := reader.ReadString('\n')
 			response = strings.TrimSpace(strings.ToLower(response))
-			if response != "y" && response != "yes" {
+			switch {
+			case response == "y" || response == "yes":
+				*force = true
+			case (response == "m" || response == "merge") && mergeTool != "":
+				engine.SetMergeTool(mergeTool)
+			default:
 				fmt.Println("Aborted.")
 				os.Exit(0)
 			}
-			*force = true
 		}
 	}
 
@@ -415,15 +485,18 @@ func cmdPull(args []string) {
 			for _, w := range warnings {
 				fmt.Printf("   配置: %s\n", w.ItemName)
 				fmt.Printf("   Hook 类型: %v\n", w.HookTypes)
+				for _, hook := range w.LocalHooks {
+					fmt.Printf("     · %s\n", hook)
+				}
 				fmt.Println("   检测到:")
 				for _, match := range w.LocalMatches {
 					fmt.Printf("     - %s\n", match)
 				}
 			}
 			fmt.Println("\n如何处理 hooks?")
-			fmt.Println("  [1] 覆盖本地 hooks (使用远程配置)")
+			fmt.Println("  [1] 覆盖本地 hooks (使用远程配置，保留本机设备特定的 hook)")
 			fmt.Println("  [2] 保留本地 hooks (只同步其他设置)")
-			fmt.Println("  [3] 智能合并 (只覆盖不含本地内容的 hooks)")
+			fmt.Println("  [3] 智能合并 (按 hook 条目取并集，保留本地独有的 hook，跳过远程含本地内容的 hook)")
 			fmt.Println("  [4] 取消")
 			fmt.Print("\n请选择 [1/2/3/4]: ")
 
@@ -452,6 +525,10 @@ func cmdPull(args []string) {
 	}
 
 	printResults("Pull", results, *dryRun)
+	printProjectRemaps(engine.ProjectRemaps())
+	for _, warning := range engine.Warnings() {
+		fmt.Printf("⚠️  %s\n", warning)
+	}
 
 	// 如果指定了 --apply-mcp，同步 MCP 到当前项目
 	if *applyMCP && !*dryRun {
@@ -462,7 +539,35 @@ func cmdPull(args []string) {
 	}
 }
 
-// cmdMCPApply 将全局 MCP 配置应用到当前项目
+// printProjectRemaps lists pulled projects that were mapped to another
+// local path or skipped because this machine has no such project
+func printProjectRemaps(remaps []mcp.ProjectRemap) {
+	if len(remaps) == 0 {
+		return
+	}
+	fmt.Println("\nProjects from other machines:")
+	for _, r := range remaps {
+		if r.To == "" {
+			fmt.Printf("  skipped %s (no local project, add a mapping with 'claude_sync config project-map add')\n", r.From)
+		} else {
+			fmt.Printf("  %s → %s\n", r.From, r.To)
+		}
+	}
+}
+
+// stringList is a repeatable string flag
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// cmdMCPApply 将全局 MCP 配置应用到当前项目，或用 --all/--project/--glob 应用到多个项目
 func cmdMCPApply(args []string) {
 	fs := flag.NewFlagSet("mcp-apply", flag.ExitOnError)
 	autoYes := fs.Bool("y", false, "Auto-confirm changes")
@@ -470,15 +575,36 @@ func cmdMCPApply(args []string) {
 	silent := fs.Bool("q", false, "Quiet/silent mode: no output if already synced")
 	silentLong := fs.Bool("silent", false, "Quiet/silent mode: no output if already synced")
 	overwrite := fs.Bool("overwrite", false, "Overwrite project MCP config (default merges)")
+	target := fs.String("target", mcp.TargetClaudeJSON, "Where to write: claude-json (~/.claude.json) or mcp-json (.mcp.json in the repository root)")
+	stripSecrets := fs.Bool("strip-secrets", false, "With --target mcp-json, replace secret env values and headers with ${ENV} references")
+	var targets mcp.ProjectTargets
+	fs.BoolVar(&targets.All, "all", false, "Apply to every project in ~/.claude.json whose directory exists")
+	fs.Var((*stringList)(&targets.Paths), "project", "Apply to this project directory (repeatable)")
+	fs.Var((*stringList)(&targets.Globs), "glob", "Apply to known projects matching a glob, e.g. '~/code/*' (repeatable)")
+	fs.BoolVar(&targets.Discover, "discover", false, "With --glob, also include git repositories on disk that are not known projects yet")
 	fs.Parse(args)
 
 	opts := mcp.SyncOptions{
-		AutoYes:   *autoYes || *autoYesLong,
-		Silent:    *silent || *silentLong,
-		Overwrite: *overwrite,
+		AutoYes:      *autoYes || *autoYesLong,
+		Silent:       *silent || *silentLong,
+		Overwrite:    *overwrite,
+		Target:       *target,
+		StripSecrets: *stripSecrets,
+	}
+	if opts.Target != mcp.TargetClaudeJSON && opts.Target != mcp.TargetMCPJSON {
+		exitWithError(fmt.Errorf("--target must be %s or %s", mcp.TargetClaudeJSON, mcp.TargetMCPJSON))
+	}
+	if opts.StripSecrets && opts.Target != mcp.TargetMCPJSON {
+		exitWithError(fmt.Errorf("--strip-secrets only applies to --target %s", mcp.TargetMCPJSON))
 	}
 
-	if err := mcp.SyncMCPToCurrentProjectWithOptions(opts); err != nil {
+	var err error
+	if targets.All || len(targets.Paths) > 0 || len(targets.Globs) > 0 {
+		err = applyMCPToTargets(targets, opts)
+	} else {
+		err = mcp.SyncMCPToCurrentProjectWithOptions(opts)
+	}
+	if err != nil {
 		if !opts.Silent {
 			fmt.Printf("Error: %v\n", err)
 		}
@@ -486,6 +612,31 @@ func cmdMCPApply(args []string) {
 	}
 }
 
+func applyMCPToTargets(targets mcp.ProjectTargets, opts mcp.SyncOptions) error {
+	path, err := mcp.ClaudeJSONPath()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取 ~/.claude.json 失败: %w", err)
+	}
+	projects, err := mcp.ResolveProjects(data, targets)
+	if err != nil {
+		return err
+	}
+	if len(projects) == 0 {
+		if !opts.Silent {
+			fmt.Println("没有匹配的项目")
+		}
+		return nil
+	}
+	if opts.Target == mcp.TargetMCPJSON {
+		return mcp.ApplyMCPToMCPJSON(projects, opts)
+	}
+	return mcp.ApplyMCPToProjects(projects, opts)
+}
+
 func cmdStatus(args []string) {
 	cfg, err := config.Load()
 	if err != nil {
@@ -540,10 +691,58 @@ func cmdStatus(args []string) {
 		synced, localAhead, remoteAhead, conflicts, errors)
 }
 
-func cmdConfig(args []string) {
-	fs := flag.NewFlagSet("config", flag.ExitOnError)
-	list := fs.Bool("list", false, "List current sync items")
+func cmdDiff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	remote := fs.Bool("remote", false, "Compare remote content with what push would upload")
+	base := fs.Bool("base", false, "Compare last-synced content with what push would upload")
+	rev := fs.String("rev", "", "Compare a gist revision (SHA) with what push would upload")
+	semantic := fs.Bool("semantic", false, "Force JSON semantic diff")
+	unified := fs.Bool("unified", false, "Force line-based unified diff")
+	noColor := fs.Bool("no-color", false, "Disable colored output")
+	fs.Usage = func() {
+		fmt.Println("Usage: claude_sync diff [item] [--remote|--base|--rev SHA] [--semantic|--unified]")
+		fmt.Println()
+		fmt.Println("Without a direction flag, shows what 'claude_sync pull' would write locally.")
+		fmt.Println()
+		fs.PrintDefaults()
+	}
+
+	// 允许 item 名称出现在 flag 之前: claude_sync diff settings --remote
+	itemName := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		itemName = args[0]
+		args = args[1:]
+	}
 	fs.Parse(args)
+	if itemName == "" && fs.NArg() > 0 {
+		itemName = fs.Arg(0)
+	}
+
+	target := sync.DiffPull
+	selected := 0
+	if *remote {
+		target = sync.DiffRemote
+		selected++
+	}
+	if *base {
+		target = sync.DiffBase
+		selected++
+	}
+	if *rev != "" {
+		target = sync.DiffRevision
+		selected++
+	}
+	if selected > 1 {
+		fmt.Println("Error: --remote, --base and --rev are mutually exclusive")
+		os.Exit(1)
+	}
+
+	mode := diff.ModeAuto
+	if *semantic {
+		mode = diff.ModeSemantic
+	} else if *unified {
+		mode = diff.ModeUnified
+	}
 
 	cfg, err := config.Load()
 	if err != nil {
@@ -551,30 +750,30 @@ func cmdConfig(args []string) {
 		os.Exit(1)
 	}
 
-	if *list {
-		fmt.Printf("Gist ID: %s\n", cfg.GistID)
-		fmt.Printf("Token Env: %s\n", cfg.GitHubTokenEnv)
-		fmt.Printf("Conflict Strategy: %s\n\n", cfg.ConflictStrategy)
+	token, err := cfg.GetGitHubToken()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 
-		fmt.Println("Sync Items:")
-		fmt.Printf("%-20s %-10s %-8s %s\n", "NAME", "TYPE", "ENABLED", "PATH")
-		fmt.Println(strings.Repeat("-", 70))
+	engine, err := sync.NewEngine(cfg, token)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 
-		for _, item := range cfg.SyncItems {
-			enabled := "yes"
-			if !item.Enabled {
-				enabled = "no"
-			}
-			itemType := item.Type
-			if itemType == "" {
-				itemType = "file"
-			}
-			fmt.Printf("%-20s %-10s %-8s %s\n", item.Name, itemType, enabled, item.LocalPath)
-		}
-		return
+	diffs, err := engine.Diff(itemName, target, *rev)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
 
-	fs.Usage()
+	for i, d := range diffs {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Print(sync.FormatItemDiff(d, mode, !*noColor))
+	}
 }
 
 func printResults(operation string, results []sync.ItemStatus, dryRun bool) {
@@ -586,6 +785,9 @@ func printResults(operation string, results []sync.ItemStatus, dryRun bool) {
 
 	for _, r := range results {
 		fmt.Println(sync.FormatColoredStatus(r))
+		for _, line := range sync.FormatFiltered(r.Filtered) {
+			fmt.Printf("    %s\n", line)
+		}
 	}
 
 	// Count results
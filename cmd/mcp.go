@@ -0,0 +1,654 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yxuechao007/claude_sync/internal/config"
+	"github.com/yxuechao007/claude_sync/internal/diff"
+	"github.com/yxuechao007/claude_sync/internal/fileutil"
+	"github.com/yxuechao007/claude_sync/internal/jsondoc"
+	"github.com/yxuechao007/claude_sync/internal/mcp"
+	"github.com/yxuechao007/claude_sync/internal/sync"
+)
+
+const mcpUsage = `Usage: claude_sync mcp <subcommand> [options]
+
+Subcommands:
+  list                          List MCP servers and the projects that override them
+  show <name>                   Print the config of one server
+  add <name> [server options]   Add a server
+  remove <name>                 Remove a server
+  rename <old> <new>            Rename a server
+  enable <name>                 Enable a server for a project
+  disable <name>                Disable a server for a project (disabledMcpServers)
+  check [name...] [--timeout d] Start each server and run the MCP handshake
+  import-repo [dir]             Import the servers of a repository's .mcp.json into the global ones
+  export --format <client>      Translate servers to another client's config (stdout, --output or --merge)
+  import --format <client>      Import the servers of another client's config
+                                Clients: claude-desktop, cursor, vscode, windsurf
+
+Scope:
+  --project <path>   Edit the project's mcpServers instead of the global ones
+                     (enable/disable default to the current directory)
+
+Server options (add):
+  --command <cmd> [--arg <arg>]... [--env KEY=VALUE]...   stdio server
+  --url <url> [--type http|sse] [--header 'Name: value']... remote server
+  --json '<config>'                                       raw server config
+  --force                                                 replace an existing server
+
+Options (add/remove/rename/enable/disable):
+  -y      Auto-confirm changes
+  --push  Push to the Gist after writing ~/.claude.json`
+
+func cmdMCP(args []string) {
+	if len(args) == 0 {
+		fmt.Println(mcpUsage)
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list":
+		cmdMCPList(args[1:])
+	case "show":
+		cmdMCPShow(args[1:])
+	case "add":
+		cmdMCPAdd(args[1:])
+	case "remove":
+		cmdMCPRemove(args[1:])
+	case "rename":
+		cmdMCPRename(args[1:])
+	case "enable":
+		cmdMCPEnable(args[1:], true)
+	case "disable":
+		cmdMCPEnable(args[1:], false)
+	case "check":
+		cmdMCPCheck(args[1:])
+	case "import-repo":
+		cmdMCPImportRepo(args[1:])
+	case "export":
+		cmdMCPExport(args[1:])
+	case "import":
+		cmdMCPImport(args[1:])
+	case "-h", "--help", "help":
+		fmt.Println(mcpUsage)
+	default:
+		fmt.Printf("Unknown mcp subcommand: %s\n\n", args[0])
+		fmt.Println(mcpUsage)
+		os.Exit(1)
+	}
+}
+
+// parseNamed parses "<name>... [flags]": the leading names are taken
+// before the flags, since the flag package stops at the first argument
+func parseNamed(fs *flag.FlagSet, args []string, names ...string) []string {
+	var values []string
+	for len(values) < len(names) && len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		values = append(values, args[0])
+		args = args[1:]
+	}
+	fs.Parse(args)
+	values = append(values, fs.Args()...)
+	if len(values) != len(names) {
+		placeholders := make([]string, len(names))
+		for i, name := range names {
+			placeholders[i] = "<" + name + ">"
+		}
+		exitWithError(fmt.Errorf("usage: claude_sync %s %s [options]", fs.Name(), strings.Join(placeholders, " ")))
+	}
+	return values
+}
+
+// mcpEditFlags are the flags shared by the subcommands that write ~/.claude.json
+type mcpEditFlags struct {
+	project *string
+	autoYes *bool
+	push    *bool
+}
+
+func addMCPEditFlags(fs *flag.FlagSet) mcpEditFlags {
+	return mcpEditFlags{
+		project: fs.String("project", "", "Project directory to edit instead of the global servers"),
+		autoYes: fs.Bool("y", false, "Auto-confirm changes"),
+		push:    fs.Bool("push", false, "Push to the Gist after writing"),
+	}
+}
+
+// projectScope resolves --project to the key used in ~/.claude.json;
+// the empty string selects the global servers
+func projectScope(project string) string {
+	if project == "" {
+		return ""
+	}
+	expanded, err := config.ExpandPath(project)
+	if err != nil {
+		exitWithError(err)
+	}
+	abs, err := filepath.Abs(expanded)
+	if err != nil {
+		exitWithError(err)
+	}
+	return abs
+}
+
+// writeClaudeJSONEdit shows the change to ~/.claude.json, asks for
+// confirmation, writes it, prints done and optionally pushes
+func writeClaudeJSONEdit(path string, data, updated []byte, snap fileutil.Snapshot, flags mcpEditFlags, done string) {
+	if !writeFileEdit(path, data, updated, snap, *flags.autoYes) {
+		return
+	}
+	fmt.Println(done)
+	if *flags.push {
+		pushAfterEdit()
+	}
+}
+
+// writeFileEdit shows the change to a file, asks for confirmation and
+// writes it. It reports whether the file was written.
+func writeFileEdit(path string, data, updated []byte, snap fileutil.Snapshot, autoYes bool) bool {
+	diff.ShowDiff(path, string(data), string(updated))
+	if diff.Confirm(path, path, string(updated), &autoYes) != diff.ConfirmYes {
+		fmt.Printf("Cancelled, %s not modified\n", path)
+		return false
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		exitWithError(err)
+	}
+	if err := fileutil.WriteFileIfUnchanged(path, updated, 0644, snap); err != nil {
+		exitWithError(fmt.Errorf("failed to write %s: %w", path, err))
+	}
+	return true
+}
+
+func pushAfterEdit() {
+	cfg := loadConfigOrExit()
+	token, err := cfg.GetGitHubToken()
+	if err != nil {
+		exitWithError(err)
+	}
+	engine, err := sync.NewEngine(cfg, token)
+	if err != nil {
+		exitWithError(err)
+	}
+	results, err := engine.Push(false, false)
+	if err != nil {
+		exitWithError(err)
+	}
+	fmt.Println()
+	printResults("Push", results, false)
+}
+
+func cmdMCPList(args []string) {
+	fs := flag.NewFlagSet("mcp list", flag.ExitOnError)
+	fs.Parse(args)
+
+	_, data, _ := readClaudeJSON()
+	servers, err := mcp.ListServers(data)
+	if err != nil {
+		exitWithError(err)
+	}
+	if len(servers) == 0 {
+		fmt.Println("No MCP servers in ~/.claude.json")
+		return
+	}
+
+	heading := ""
+	for _, s := range servers {
+		section := "Project-only MCP servers:"
+		if s.Global {
+			section = "Global MCP servers:"
+		}
+		if section != heading {
+			if heading != "" {
+				fmt.Println()
+			}
+			fmt.Println(section)
+			heading = section
+		}
+
+		summary := "-"
+		if s.Config != nil {
+			summary = mcp.ServerSummary(s.Config)
+		}
+		fmt.Printf("  %s  %s\n", s.Name, summary)
+		for _, o := range s.Overrides {
+			switch {
+			case !s.Global:
+				fmt.Printf("      defined in %s\n", o.Project)
+			case len(o.Changes) == 0:
+				fmt.Printf("      same in %s\n", o.Project)
+			default:
+				fmt.Printf("      overridden in %s:\n", o.Project)
+				for _, c := range o.Changes {
+					fmt.Printf("        %s\n", diff.FormatJSONChange(c))
+				}
+			}
+		}
+		for _, project := range s.DisabledIn {
+			fmt.Printf("      disabled in %s\n", project)
+		}
+	}
+}
+
+func cmdMCPShow(args []string) {
+	fs := flag.NewFlagSet("mcp show", flag.ExitOnError)
+	project := fs.String("project", "", "Show the server of this project instead of the global one")
+	name := parseNamed(fs, args, "name")[0]
+
+	_, data, _ := readClaudeJSON()
+	scope := projectScope(*project)
+	server, ok, err := mcp.GetServer(data, scope, name)
+	if err != nil {
+		exitWithError(err)
+	}
+	if !ok {
+		exitWithError(fmt.Errorf("MCP server %q not found", name))
+	}
+	content, err := jsondoc.MarshalIndent(server)
+	if err != nil {
+		exitWithError(err)
+	}
+	fmt.Println(string(content))
+}
+
+func cmdMCPAdd(args []string) {
+	fs := flag.NewFlagSet("mcp add", flag.ExitOnError)
+	flags := addMCPEditFlags(fs)
+	command := fs.String("command", "", "Command of a stdio server")
+	url := fs.String("url", "", "URL of an http or sse server")
+	transport := fs.String("type", "", "Transport of a remote server: http or sse")
+	rawJSON := fs.String("json", "", "Raw server config as JSON")
+	force := fs.Bool("force", false, "Replace an existing server with the same name")
+	var serverArgs, env, headers stringList
+	fs.Var(&serverArgs, "arg", "Argument of the command (repeatable)")
+	fs.Var(&env, "env", "Environment variable KEY=VALUE (repeatable)")
+	fs.Var(&headers, "header", "HTTP header 'Name: value' (repeatable)")
+	name := parseNamed(fs, args, "name")[0]
+
+	server, err := buildServerConfig(*command, serverArgs, env, *url, *transport, headers, *rawJSON)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	path, data, snap := readClaudeJSON()
+	scope := projectScope(*flags.project)
+	updated, err := mcp.AddServer(data, scope, name, server, *force)
+	if err != nil {
+		exitWithError(err)
+	}
+	writeClaudeJSONEdit(path, data, updated, snap, flags, fmt.Sprintf("✓ Added MCP server %s", name))
+}
+
+// buildServerConfig assembles a server entry from the add flags
+func buildServerConfig(command string, args, env []string, url, transport string, headers []string, rawJSON string) (map[string]interface{}, error) {
+	if rawJSON != "" {
+		if command != "" || url != "" {
+			return nil, fmt.Errorf("--json cannot be combined with --command or --url")
+		}
+		var server map[string]interface{}
+		if err := json.Unmarshal([]byte(rawJSON), &server); err != nil {
+			return nil, fmt.Errorf("invalid --json: %w", err)
+		}
+		return server, nil
+	}
+
+	server := make(map[string]interface{})
+	switch {
+	case command != "" && url != "":
+		return nil, fmt.Errorf("use either --command or --url, not both")
+	case command != "":
+		if len(headers) > 0 || transport != "" {
+			return nil, fmt.Errorf("--header and --type only apply to --url servers")
+		}
+		server["type"] = "stdio"
+		server["command"] = command
+		list := make([]interface{}, len(args))
+		for i, arg := range args {
+			list[i] = arg
+		}
+		server["args"] = list
+		vars, err := keyValues(env, "=", "--env")
+		if err != nil {
+			return nil, err
+		}
+		if len(vars) > 0 {
+			server["env"] = vars
+		}
+	case url != "":
+		if len(args) > 0 || len(env) > 0 {
+			return nil, fmt.Errorf("--arg and --env only apply to --command servers")
+		}
+		if transport == "" {
+			transport = "http"
+		}
+		if transport != "http" && transport != "sse" {
+			return nil, fmt.Errorf("--type must be http or sse")
+		}
+		server["type"] = transport
+		server["url"] = url
+		values, err := keyValues(headers, ":", "--header")
+		if err != nil {
+			return nil, err
+		}
+		if len(values) > 0 {
+			server["headers"] = values
+		}
+	default:
+		return nil, fmt.Errorf("specify --command, --url or --json")
+	}
+	return server, nil
+}
+
+func keyValues(items []string, sep, flagName string) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(items))
+	for _, item := range items {
+		key, value, ok := strings.Cut(item, sep)
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid %s %q", flagName, item)
+		}
+		values[key] = strings.TrimSpace(value)
+	}
+	return values, nil
+}
+
+func cmdMCPRemove(args []string) {
+	fs := flag.NewFlagSet("mcp remove", flag.ExitOnError)
+	flags := addMCPEditFlags(fs)
+	name := parseNamed(fs, args, "name")[0]
+
+	path, data, snap := readClaudeJSON()
+	updated, err := mcp.RemoveServer(data, projectScope(*flags.project), name)
+	if err != nil {
+		exitWithError(err)
+	}
+	writeClaudeJSONEdit(path, data, updated, snap, flags, fmt.Sprintf("✓ Removed MCP server %s", name))
+}
+
+func cmdMCPRename(args []string) {
+	fs := flag.NewFlagSet("mcp rename", flag.ExitOnError)
+	flags := addMCPEditFlags(fs)
+	names := parseNamed(fs, args, "old", "new")
+
+	path, data, snap := readClaudeJSON()
+	updated, err := mcp.RenameServer(data, projectScope(*flags.project), names[0], names[1])
+	if err != nil {
+		exitWithError(err)
+	}
+	writeClaudeJSONEdit(path, data, updated, snap, flags, fmt.Sprintf("✓ Renamed MCP server %s to %s", names[0], names[1]))
+}
+
+func cmdMCPEnable(args []string, enabled bool) {
+	action := "disable"
+	if enabled {
+		action = "enable"
+	}
+	fs := flag.NewFlagSet("mcp "+action, flag.ExitOnError)
+	flags := addMCPEditFlags(fs)
+	name := parseNamed(fs, args, "name")[0]
+
+	project := *flags.project
+	if project == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			exitWithError(err)
+		}
+		project = cwd
+	}
+	project = projectScope(project)
+
+	path, data, snap := readClaudeJSON()
+	updated, changed, err := mcp.SetServerEnabled(data, project, name, enabled)
+	if err != nil {
+		exitWithError(err)
+	}
+	if !changed {
+		fmt.Printf("MCP server %s is already %sd for %s\n", name, action, project)
+		return
+	}
+	writeClaudeJSONEdit(path, data, updated, snap, flags, fmt.Sprintf("✓ MCP server %s %sd for %s", name, action, project))
+}
+
+func cmdMCPCheck(args []string) {
+	fs := flag.NewFlagSet("mcp check", flag.ExitOnError)
+	project := fs.String("project", "", "Check the servers of this project instead of the global ones")
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout per server")
+	names := parseNames(fs, args)
+
+	_, data, _ := readClaudeJSON()
+	results, err := mcp.CheckServers(data, projectScope(*project), names, *timeout)
+	if err != nil {
+		exitWithError(err)
+	}
+	if len(results) == 0 {
+		fmt.Println("No MCP servers to check")
+		return
+	}
+
+	width := 0
+	for _, r := range results {
+		if len(r.Name) > width {
+			width = len(r.Name)
+		}
+	}
+	failed := 0
+	for _, r := range results {
+		if !r.OK() {
+			failed++
+			fmt.Printf("✗ %-*s  %-5s  %v\n", width, r.Name, r.Transport, r.Err)
+			continue
+		}
+		fmt.Printf("✓ %-*s  %-5s  protocol %s, %d tools (%s)\n",
+			width, r.Name, r.Transport, r.ProtocolVersion, r.Tools, r.Duration.Round(time.Millisecond))
+	}
+	fmt.Printf("\n%d OK, %d failing\n", len(results)-failed, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func cmdMCPImportRepo(args []string) {
+	fs := flag.NewFlagSet("mcp import-repo", flag.ExitOnError)
+	overwrite := fs.Bool("overwrite", false, "Replace global servers that have the same name")
+	autoYes := fs.Bool("y", false, "Auto-confirm changes")
+	var dir string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		dir, args = args[0], args[1:]
+	}
+	fs.Parse(args)
+	if dir == "" && fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+	if dir == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			exitWithError(err)
+		}
+		dir = cwd
+	}
+
+	opts := mcp.SyncOptions{AutoYes: *autoYes, Overwrite: *overwrite}
+	if err := mcp.ImportMCPJSON(projectScope(dir), opts); err != nil {
+		exitWithError(err)
+	}
+}
+
+// parseNames parses "[name...] [flags]" for subcommands that take any
+// number of server names
+func parseNames(fs *flag.FlagSet, args []string) []string {
+	var names []string
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		names = append(names, args[0])
+		args = args[1:]
+	}
+	fs.Parse(args)
+	return append(names, fs.Args()...)
+}
+
+func printWarnings(warnings []string) {
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+}
+
+func clientFormatFlag(fs *flag.FlagSet) *string {
+	return fs.String("format", "", "Client format: "+strings.Join(mcp.ClientFormatNames(), ", "))
+}
+
+func lookupClientFormat(name string) mcp.ClientFormat {
+	if name == "" {
+		exitWithError(fmt.Errorf("--format is required (%s)", strings.Join(mcp.ClientFormatNames(), ", ")))
+	}
+	format, err := mcp.LookupClientFormat(name)
+	if err != nil {
+		exitWithError(err)
+	}
+	return format
+}
+
+// readClientConfig reads a client's config file, treating a missing file as
+// an empty object
+func readClientConfig(path string) ([]byte, fileutil.Snapshot) {
+	data, snap, err := fileutil.ReadFile(path)
+	if err != nil {
+		exitWithError(fmt.Errorf("failed to read %s: %w", path, err))
+	}
+	if !snap.Exists {
+		data = []byte("{}\n")
+	}
+	return data, snap
+}
+
+func cmdMCPExport(args []string) {
+	fs := flag.NewFlagSet("mcp export", flag.ExitOnError)
+	formatName := clientFormatFlag(fs)
+	project := fs.String("project", "", "Export the servers of this project instead of the global ones")
+	output := fs.String("output", "", "Write the client config to this file")
+	merge := fs.Bool("merge", false, "Merge into the client's config file")
+	configPath := fs.String("config", "", "With --merge, the client config file to merge into (default: the client's user config)")
+	overwrite := fs.Bool("overwrite", false, "With --merge, replace servers that already exist with a different config")
+	autoYes := fs.Bool("y", false, "Auto-confirm changes")
+	names := parseNames(fs, args)
+
+	format := lookupClientFormat(*formatName)
+	if *output != "" && *merge {
+		exitWithError(fmt.Errorf("use either --output or --merge"))
+	}
+
+	_, data, _ := readClaudeJSON()
+	scope := projectScope(*project)
+	all, err := mcp.ReadServers(data, scope)
+	if err != nil {
+		exitWithError(err)
+	}
+	servers, err := mcp.SelectServers(all, names)
+	if err != nil {
+		exitWithError(err)
+	}
+	exported, warnings := mcp.ExportServers(servers, format)
+	printWarnings(warnings)
+
+	if !*merge {
+		content, err := jsondoc.MarshalIndent(map[string]interface{}{format.ServersKey: exported})
+		if err != nil {
+			exitWithError(err)
+		}
+		content = append(content, '\n')
+		if *output == "" {
+			os.Stdout.Write(content)
+			return
+		}
+		path := projectScope(*output)
+		current, snap, err := fileutil.ReadFile(path)
+		if err != nil {
+			exitWithError(fmt.Errorf("failed to read %s: %w", path, err))
+		}
+		if writeFileEdit(path, current, content, snap, *autoYes) {
+			fmt.Printf("✓ Exported %d MCP servers to %s\n", len(exported), path)
+		}
+		return
+	}
+
+	path := *configPath
+	if path == "" {
+		if path, err = format.ConfigPath(); err != nil {
+			exitWithError(err)
+		}
+	}
+	path = projectScope(path)
+	current, snap := readClientConfig(path)
+	updated, merged, skipped, err := mcp.MergeServers(current, []string{format.ServersKey}, exported, *overwrite)
+	if err != nil {
+		exitWithError(fmt.Errorf("failed to merge into %s: %w", path, err))
+	}
+	if len(skipped) > 0 {
+		fmt.Printf("Skipped servers that differ in %s (use --overwrite): %s\n", path, strings.Join(skipped, ", "))
+	}
+	if len(merged) == 0 {
+		fmt.Printf("%s is up to date\n", path)
+		return
+	}
+	if !snap.Exists {
+		current = nil
+	}
+	if writeFileEdit(path, current, updated, snap, *autoYes) {
+		fmt.Printf("✓ Merged %s into %s\n", strings.Join(merged, ", "), path)
+	}
+}
+
+func cmdMCPImport(args []string) {
+	fs := flag.NewFlagSet("mcp import", flag.ExitOnError)
+	formatName := clientFormatFlag(fs)
+	configPath := fs.String("config", "", "Client config file to import from (default: the client's user config)")
+	overwrite := fs.Bool("overwrite", false, "Replace servers that already exist with a different config")
+	flags := addMCPEditFlags(fs)
+	names := parseNames(fs, args)
+
+	format := lookupClientFormat(*formatName)
+	source := *configPath
+	if source == "" {
+		var err error
+		if source, err = format.ConfigPath(); err != nil {
+			exitWithError(err)
+		}
+	}
+	source = projectScope(source)
+	sourceData, err := os.ReadFile(source)
+	if err != nil {
+		exitWithError(fmt.Errorf("failed to read %s config: %w", format.Name, err))
+	}
+	all, warnings, err := mcp.ImportServers(sourceData, format)
+	if err != nil {
+		exitWithError(err)
+	}
+	printWarnings(warnings)
+	servers, err := mcp.SelectServers(all, names)
+	if err != nil {
+		exitWithError(err)
+	}
+	if len(servers) == 0 {
+		fmt.Printf("No MCP servers in %s\n", source)
+		return
+	}
+
+	path, data, snap := readClaudeJSON()
+	scope := projectScope(*flags.project)
+	updated, merged, skipped, err := mcp.MergeServers(data, mcp.ServersPath(scope), servers, *overwrite)
+	if err != nil {
+		exitWithError(err)
+	}
+	if len(skipped) > 0 {
+		fmt.Printf("Skipped servers that already exist with a different config (use --overwrite): %s\n", strings.Join(skipped, ", "))
+	}
+	if len(merged) == 0 {
+		fmt.Println("Nothing to import")
+		return
+	}
+	writeClaudeJSONEdit(path, data, updated, snap, flags, fmt.Sprintf("✓ Imported %s from %s", strings.Join(merged, ", "), source))
+}
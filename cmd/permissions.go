@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/yxuechao007/claude_sync/internal/config"
+	"github.com/yxuechao007/claude_sync/internal/diff"
+	"github.com/yxuechao007/claude_sync/internal/fileutil"
+	"github.com/yxuechao007/claude_sync/internal/jsondoc"
+	"github.com/yxuechao007/claude_sync/internal/ledger"
+)
+
+const permissionsUsage = `Usage: claude_sync permissions <subcommand> [options]
+
+Subcommands:
+  list [--list allow|deny|ask] [--removed]     List entries grouped by the device that added them
+  prune [--list L] [--device D] [-y] [entry...] Remove entries from local settings.json
+                                               (run 'claude_sync push' to propagate the removal)`
+
+const (
+	originUnknown  = "(unknown)"
+	originUnpushed = "(local, not pushed)"
+)
+
+func cmdPermissions(args []string) {
+	if len(args) == 0 {
+		fmt.Println(permissionsUsage)
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list":
+		cmdPermissionsList(args[1:])
+	case "prune":
+		cmdPermissionsPrune(args[1:])
+	case "-h", "--help", "help":
+		fmt.Println(permissionsUsage)
+	default:
+		fmt.Printf("Unknown permissions subcommand: %s\n\n", args[0])
+		fmt.Println(permissionsUsage)
+		os.Exit(1)
+	}
+}
+
+// permissionEntry is one entry of a local permission list
+type permissionEntry struct {
+	list   string // permissions.allow 等
+	value  string
+	origin string
+}
+
+// localPermissions reads settings.json and the synced ledger
+type localPermissions struct {
+	path   string
+	data   []byte
+	snap   fileutil.Snapshot // 读取时的状态，写回前检测并发修改
+	doc    map[string]interface{}
+	synced *ledger.Ledger
+}
+
+func loadLocalPermissions(cfg *config.Config) (*localPermissions, error) {
+	item := cfg.FindItem("settings")
+	if item == nil {
+		return nil, fmt.Errorf("sync item \"settings\" not found")
+	}
+	path, err := config.ExpandPath(item.LocalPath)
+	if err != nil {
+		return nil, err
+	}
+	data, snap, err := fileutil.ReadFile(path)
+	if err == nil && !snap.Exists {
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc map[string]interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	synced, err := ledger.LoadSynced()
+	if err != nil {
+		return nil, err
+	}
+	return &localPermissions{path: path, data: data, snap: snap, doc: doc, synced: synced}, nil
+}
+
+// entries returns the entries of a list (e.g. "allow") in file order
+func (p *localPermissions) entries(list string) []permissionEntry {
+	perms, _ := p.doc["permissions"].(map[string]interface{})
+	values, _ := perms[list].([]interface{})
+	path := "permissions." + list
+	known := p.synced.Entries(ledger.SetKey("settings", path))
+
+	var entries []permissionEntry
+	for _, value := range ledger.Strings(values) {
+		origin := originUnpushed
+		if entry, ok := known[value]; ok && entry.Present {
+			origin = entry.Origin
+			if origin == "" {
+				origin = originUnknown
+			}
+		}
+		entries = append(entries, permissionEntry{list: path, value: value, origin: origin})
+	}
+	return entries
+}
+
+func permissionLists(list string) ([]string, error) {
+	all := []string{"allow", "deny", "ask"}
+	if list == "" {
+		return all, nil
+	}
+	for _, name := range all {
+		if name == list {
+			return []string{list}, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid list %q, expected allow, deny or ask", list)
+}
+
+func cmdPermissionsList(args []string) {
+	fs := flag.NewFlagSet("permissions list", flag.ExitOnError)
+	list := fs.String("list", "", "Only show allow, deny or ask")
+	removed := fs.Bool("removed", false, "Also show entries removed on any device")
+	fs.Parse(args)
+
+	lists, err := permissionLists(*list)
+	if err != nil {
+		exitWithError(err)
+	}
+	perms, err := loadLocalPermissions(loadConfigOrExit())
+	if err != nil {
+		exitWithError(err)
+	}
+
+	for _, name := range lists {
+		entries := perms.entries(name)
+		fmt.Printf("permissions.%s (%d)\n", name, len(entries))
+
+		byOrigin := make(map[string][]string)
+		var origins []string
+		for _, entry := range entries {
+			if _, ok := byOrigin[entry.origin]; !ok {
+				origins = append(origins, entry.origin)
+			}
+			byOrigin[entry.origin] = append(byOrigin[entry.origin], entry.value)
+		}
+		sort.Strings(origins)
+		for _, origin := range origins {
+			fmt.Printf("  %s:\n", origin)
+			for _, value := range byOrigin[origin] {
+				fmt.Printf("    %s\n", value)
+			}
+		}
+
+		if *removed {
+			set := perms.synced.Entries(ledger.SetKey("settings", "permissions."+name))
+			var values []string
+			for value, entry := range set {
+				if !entry.Present {
+					values = append(values, value)
+				}
+			}
+			sort.Strings(values)
+			if len(values) > 0 {
+				fmt.Println("  removed:")
+			}
+			for _, value := range values {
+				entry := set[value]
+				fmt.Printf("    %s (by %s, %s)\n", value, entry.Device, entry.UpdatedAt.Local().Format("2006-01-02 15:04"))
+			}
+		}
+		fmt.Println()
+	}
+}
+
+func cmdPermissionsPrune(args []string) {
+	fs := flag.NewFlagSet("permissions prune", flag.ExitOnError)
+	list := fs.String("list", "", "Only prune from allow, deny or ask")
+	device := fs.String("device", "", "Prune every entry added by this device")
+	autoYes := fs.Bool("y", false, "Auto-confirm changes")
+	fs.Parse(args)
+
+	if *device == "" && fs.NArg() == 0 {
+		exitWithError(fmt.Errorf("specify entries to prune or --device NAME"))
+	}
+	lists, err := permissionLists(*list)
+	if err != nil {
+		exitWithError(err)
+	}
+	perms, err := loadLocalPermissions(loadConfigOrExit())
+	if err != nil {
+		exitWithError(err)
+	}
+
+	wanted := make(map[string]bool)
+	for _, value := range fs.Args() {
+		wanted[value] = true
+	}
+
+	permsObj, _ := perms.doc["permissions"].(map[string]interface{})
+	pruned := 0
+	for _, name := range lists {
+		var keep []interface{}
+		for _, v := range toSlice(permsObj[name]) {
+			value, ok := v.(string)
+			if ok && matchesPrune(perms, name, value, wanted, *device) {
+				pruned++
+				continue
+			}
+			keep = append(keep, v)
+		}
+		if permsObj != nil && permsObj[name] != nil {
+			if keep == nil {
+				keep = []interface{}{}
+			}
+			permsObj[name] = keep
+		}
+	}
+	if pruned == 0 {
+		fmt.Println("No matching permission entries")
+		return
+	}
+
+	// 保持 settings.json 原有的键顺序和格式，diff 只显示被删除的条目
+	updated, err := jsondoc.MarshalIndent(perms.doc)
+	if err == nil {
+		updated, err = jsondoc.Rewrite(perms.data, updated)
+	}
+	if err != nil {
+		exitWithError(err)
+	}
+	diff.ShowDiff(perms.path, string(perms.data), string(updated))
+	if diff.Confirm(perms.path, perms.path, string(updated), autoYes) != diff.ConfirmYes {
+		fmt.Println("Cancelled, settings.json not modified")
+		return
+	}
+
+	backup, err := fileutil.Backup(perms.path, perms.data)
+	if err != nil {
+		exitWithError(err)
+	}
+	if err := fileutil.WriteFileIfUnchanged(perms.path, updated, 0644, perms.snap); err != nil {
+		exitWithError(fmt.Errorf("failed to write %s: %w", perms.path, err))
+	}
+	fmt.Printf("✓ Pruned %d entries (backup: %s), run 'claude_sync push' to propagate the removal\n", pruned, backup)
+}
+
+func matchesPrune(perms *localPermissions, list, value string, wanted map[string]bool, device string) bool {
+	if len(wanted) > 0 && !wanted[value] {
+		return false
+	}
+	if device == "" {
+		return true
+	}
+	for _, entry := range perms.entries(list) {
+		if entry.value == value {
+			return strings.EqualFold(entry.origin, device)
+		}
+	}
+	return false
+}
+
+func toSlice(v interface{}) []interface{} {
+	values, _ := v.([]interface{})
+	return values
+}
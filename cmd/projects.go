@@ -0,0 +1,169 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yxuechao007/claude_sync/internal/diff"
+	"github.com/yxuechao007/claude_sync/internal/fileutil"
+	"github.com/yxuechao007/claude_sync/internal/jsondoc"
+	"github.com/yxuechao007/claude_sync/internal/mcp"
+)
+
+const projectsUsage = `Usage: claude_sync projects <subcommand> [options]
+
+Subcommands:
+  list [--missing]                   List projects in ~/.claude.json with their MCP servers
+  show <path>                        Print the config of one project
+  prune [--missing] [-y] [path...]   Remove project entries (a backup of ~/.claude.json is kept)`
+
+func cmdProjects(args []string) {
+	if len(args) == 0 {
+		fmt.Println(projectsUsage)
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list":
+		cmdProjectsList(args[1:])
+	case "show":
+		cmdProjectsShow(args[1:])
+	case "prune":
+		cmdProjectsPrune(args[1:])
+	case "-h", "--help", "help":
+		fmt.Println(projectsUsage)
+	default:
+		fmt.Printf("Unknown projects subcommand: %s\n\n", args[0])
+		fmt.Println(projectsUsage)
+		os.Exit(1)
+	}
+}
+
+// readClaudeJSON reads ~/.claude.json with a snapshot for a later write
+func readClaudeJSON() (string, []byte, fileutil.Snapshot) {
+	path, err := mcp.ClaudeJSONPath()
+	if err != nil {
+		exitWithError(err)
+	}
+	data, snap, err := fileutil.ReadFile(path)
+	if err != nil {
+		exitWithError(fmt.Errorf("failed to read %s: %w", path, err))
+	}
+	if !snap.Exists {
+		exitWithError(fmt.Errorf("%s not found", path))
+	}
+	return path, data, snap
+}
+
+func cmdProjectsList(args []string) {
+	fs := flag.NewFlagSet("projects list", flag.ExitOnError)
+	missing := fs.Bool("missing", false, "Only list projects whose directory does not exist here")
+	fs.Parse(args)
+
+	_, data, _ := readClaudeJSON()
+	projects, err := mcp.ReadProjects(data)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	shown, absent := 0, 0
+	for _, p := range projects {
+		if !p.Exists {
+			absent++
+		}
+		if *missing && p.Exists {
+			continue
+		}
+		shown++
+		mark := "✓"
+		if !p.Exists {
+			mark = "✗"
+		}
+		servers := "-"
+		if len(p.MCPServers) > 0 {
+			servers = strings.Join(p.MCPServers, ", ")
+		}
+		fmt.Printf("%s %s\n    mcpServers: %s\n", mark, p.Path, servers)
+	}
+	if shown > 0 {
+		fmt.Println()
+	}
+	fmt.Printf("%d projects, %d missing on this machine\n", len(projects), absent)
+	if absent > 0 {
+		fmt.Println("Remove them with 'claude_sync projects prune --missing'")
+	}
+}
+
+func cmdProjectsShow(args []string) {
+	if len(args) != 1 {
+		exitWithError(fmt.Errorf("usage: claude_sync projects show <path>"))
+	}
+	_, data, _ := readClaudeJSON()
+	project := projectScope(args[0])
+	entry, ok, err := mcp.ProjectConfig(data, project)
+	if err != nil {
+		exitWithError(err)
+	}
+	if !ok {
+		exitWithError(fmt.Errorf("project %s not found in ~/.claude.json", project))
+	}
+	content, err := jsondoc.MarshalIndent(entry)
+	if err != nil {
+		exitWithError(err)
+	}
+	fmt.Println(string(content))
+}
+
+func cmdProjectsPrune(args []string) {
+	fs := flag.NewFlagSet("projects prune", flag.ExitOnError)
+	missing := fs.Bool("missing", false, "Prune every project whose directory does not exist here")
+	autoYes := fs.Bool("y", false, "Auto-confirm changes")
+	fs.Parse(args)
+
+	if !*missing && fs.NArg() == 0 {
+		exitWithError(fmt.Errorf("specify project paths to prune or --missing"))
+	}
+
+	path, data, snap := readClaudeJSON()
+	var targets []string
+	for _, arg := range fs.Args() {
+		targets = append(targets, projectScope(arg))
+	}
+	if *missing {
+		projects, err := mcp.ReadProjects(data)
+		if err != nil {
+			exitWithError(err)
+		}
+		for _, p := range projects {
+			if !p.Exists {
+				targets = append(targets, p.Path)
+			}
+		}
+	}
+
+	updated, removed, err := mcp.RemoveProjects(data, targets)
+	if err != nil {
+		exitWithError(err)
+	}
+	if removed == 0 {
+		fmt.Println("No matching projects")
+		return
+	}
+
+	diff.ShowDiff(path, string(data), string(updated))
+	if diff.Confirm(path, path, string(updated), autoYes) != diff.ConfirmYes {
+		fmt.Println("Cancelled, ~/.claude.json not modified")
+		return
+	}
+
+	backup, err := fileutil.Backup(path, data)
+	if err != nil {
+		exitWithError(err)
+	}
+	if err := fileutil.WriteFileIfUnchanged(path, updated, 0644, snap); err != nil {
+		exitWithError(fmt.Errorf("failed to write %s: %w", path, err))
+	}
+	fmt.Printf("✓ Pruned %d projects (backup: %s)\n", removed, backup)
+}
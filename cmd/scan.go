@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/yxuechao007/claude_sync/internal/config"
+	"github.com/yxuechao007/claude_sync/internal/filter"
+	"github.com/yxuechao007/claude_sync/internal/sync"
+)
+
+// cmdScan reports machine-specific content in local items without syncing
+func cmdScan(args []string) {
+	cfg := loadConfigOrExit()
+	if len(args) > 0 {
+		item := cfg.FindItem(args[0])
+		if item == nil {
+			exitWithError(fmt.Errorf("unknown sync item: %s", args[0]))
+		}
+		// 只扫描指定条目（即使已禁用）
+		only := *item
+		only.Enabled = true
+		cfg.SyncItems = []config.SyncItem{only}
+	}
+
+	// 扫描只读取本地文件，不需要 token
+	engine, err := sync.NewEngine(cfg, "")
+	if err != nil {
+		exitWithError(err)
+	}
+	findings, err := engine.ScanLocal()
+	if err != nil {
+		exitWithError(err)
+	}
+
+	if len(findings) == 0 {
+		fmt.Println("✓ No machine-specific content found")
+		return
+	}
+	printFindings(findings)
+	fmt.Println("\nAdjust with 'claude_sync config local-action <item> <path> exclude|warn|ignore'")
+	fmt.Println("or 'claude_sync config local-pattern add|remove'.")
+}
+
+// printFindings lists machine-specific matches per item and JSON path
+func printFindings(findings map[string][]filter.Finding) {
+	names := make([]string, 0, len(findings))
+	for name := range findings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Println("Machine-specific content:")
+	for _, name := range names {
+		fmt.Printf("  %s:\n", name)
+		for _, f := range findings[name] {
+			fmt.Printf("    %s\n", f)
+		}
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/yxuechao007/claude_sync/internal/fileutil"
 )
 
 // PackDirectory packs a directory into a base64-encoded tar.gz string
@@ -113,6 +115,9 @@ func PackDirectory(dirPath string) (string, error) {
 }
 
 // UnpackDirectory unpacks a base64-encoded tar.gz string to a directory
+// The archive is extracted into a staging copy of the directory which is then
+// swapped in, so an interrupted pull never leaves a half-written directory.
+// Existing files that are not part of the archive are kept.
 func UnpackDirectory(encoded string, dirPath string) error {
 	if encoded == "" {
 		// Empty archive, create empty directory
@@ -125,6 +130,18 @@ func UnpackDirectory(encoded string, dirPath string) error {
 		return fmt.Errorf("failed to decode base64: %w", err)
 	}
 
+	return fileutil.ReplaceDir(dirPath, func(staging string) error {
+		if _, err := os.Stat(dirPath); err == nil {
+			if err := fileutil.CopyDir(dirPath, staging); err != nil {
+				return fmt.Errorf("failed to copy existing directory: %w", err)
+			}
+		}
+		return extractTarGz(data, staging)
+	})
+}
+
+// extractTarGz extracts gzip-compressed tar data into dirPath
+func extractTarGz(data []byte, dirPath string) error {
 	// Create gzip reader
 	gzReader, err := gzip.NewReader(bytes.NewReader(data))
 	if err != nil {
@@ -135,11 +152,6 @@ func UnpackDirectory(encoded string, dirPath string) error {
 	// Create tar reader
 	tarReader := tar.NewReader(gzReader)
 
-	// Create target directory
-	if err := os.MkdirAll(dirPath, 0755); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
-	}
-
 	// Extract files
 	for {
 		header, err := tarReader.Next()
@@ -173,6 +185,8 @@ func UnpackDirectory(encoded string, dirPath string) error {
 				return fmt.Errorf("failed to create parent directory: %w", err)
 			}
 
+			// Remove first so a copied symlink is replaced rather than followed
+			os.Remove(targetPath)
 			file, err := os.OpenFile(targetPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
 			if err != nil {
 				return fmt.Errorf("failed to create file: %w", err)
@@ -182,6 +196,10 @@ func UnpackDirectory(encoded string, dirPath string) error {
 				file.Close()
 				return fmt.Errorf("failed to write file content: %w", err)
 			}
+			if err := file.Sync(); err != nil {
+				file.Close()
+				return fmt.Errorf("failed to sync file: %w", err)
+			}
 			file.Close()
 		}
 	}
@@ -189,6 +207,47 @@ func UnpackDirectory(encoded string, dirPath string) error {
 	return nil
 }
 
+// ReadArchive decodes a base64-encoded tar.gz string into a map of
+// relative file path to content. Directories are not included.
+func ReadArchive(encoded string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	if encoded == "" {
+		return files, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode base64: %w", err)
+	}
+
+	gzReader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	defer gzReader.Close()
+
+	tarReader := tar.NewReader(gzReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar header: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := io.ReadAll(tarReader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file content: %w", err)
+		}
+		files[filepath.ToSlash(header.Name)] = content
+	}
+
+	return files, nil
+}
+
 // GetDirectoryHash calculates a hash for a directory's contents
 // Used for detecting changes
 func GetDirectoryHash(dirPath string) (string, error) {
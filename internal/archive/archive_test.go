@@ -76,3 +76,33 @@ func TestUnpackDirectoryWritesFiles(t *testing.T) {
 		t.Fatalf("content = %q, want %q", string(data), "hello")
 	}
 }
+
+func TestUnpackDirectoryKeepsExistingFiles(t *testing.T) {
+	encoded, err := buildTarGz(map[string]string{
+		"ok.txt": "new",
+	})
+	if err != nil {
+		t.Fatalf("build archive: %v", err)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".hidden"), []byte("keep"), 0600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ok.txt"), []byte("old"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	if err := UnpackDirectory(encoded, dir); err != nil {
+		t.Fatalf("unpack: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, ".hidden"))
+	if err != nil || string(data) != "keep" {
+		t.Fatalf(".hidden = %q (%v), want keep", string(data), err)
+	}
+	data, _ = os.ReadFile(filepath.Join(dir, "ok.txt"))
+	if string(data) != "new" {
+		t.Fatalf("ok.txt = %q, want new", string(data))
+	}
+}
@@ -7,12 +7,16 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/yxuechao007/claude_sync/internal/fileutil"
+	"github.com/yxuechao007/claude_sync/internal/merge"
 )
 
 const (
 	ConfigDir  = ".claude_sync"
 	ConfigFile = "config.json"
 	StateFile  = "state.json"
+	BaseDir    = "base"
 	RepoURL    = "https://github.com/yxuechao007/claude_sync"
 )
 
@@ -30,22 +34,57 @@ type SyncItem struct {
 	Enabled   bool          `json:"enabled"`
 	Type      string        `json:"type,omitempty"` // "file" or "directory"
 	Filter    *FilterConfig `json:"filter,omitempty"`
+	// MergeRules maps JSON paths to pull merge strategies,
+	// e.g. {"permissions.allow": "union-arrays"}
+	MergeRules map[string]string `json:"merge_rules,omitempty"`
+	// LocalActions maps JSON paths to what push does when a local pattern
+	// matches below them: "exclude", "warn" (default) or "ignore"
+	LocalActions map[string]string `json:"local_actions,omitempty"`
+}
+
+// LocalPattern is a named regular expression matching machine-specific
+// content such as home directories or localhost ports
+type LocalPattern struct {
+	Name  string `json:"name"`
+	Regex string `json:"regex"`
 }
 
 // Config holds the main configuration
 type Config struct {
+	SchemaVersion    int        `json:"schema_version"`
 	GistID           string     `json:"gist_id"`
 	GitHubTokenEnv   string     `json:"github_token_env"`
 	SyncItems        []SyncItem `json:"sync_items"`
 	LastSync         *time.Time `json:"last_sync,omitempty"`
-	ConflictStrategy string     `json:"conflict_strategy"` // "ask", "local", "remote"
+	ConflictStrategy string     `json:"conflict_strategy"`     // "ask", "local", "remote"
+	MergeTool        string     `json:"mergetool,omitempty"`   // 外部三方合并工具，如 "vimdiff"、"meld" 或自定义命令
+	DeviceName       string     `json:"device_name,omitempty"` // 本机在同步历史中的名称，默认为主机名
+	// LocalPatterns detect machine-specific content in every synced item
+	LocalPatterns []LocalPattern `json:"local_patterns,omitempty"`
+	// ProjectMappings map ~/.claude.json project paths of other machines to this one
+	ProjectMappings []ProjectMapping `json:"project_mappings,omitempty"`
+	// MatchGitRemote maps other machines' projects to local repos with the same git remote
+	MatchGitRemote bool `json:"match_git_remote,omitempty"`
+	// MCPServers holds per-server sync rules for ~/.claude.json mcpServers
+	MCPServers map[string]MCPServerRule `json:"mcp_servers,omitempty"`
+	// PromoteMCPProjects lists projects (paths or globs, * for all) whose MCP
+	// servers are copied into the global mcpServers on push
+	PromoteMCPProjects []string `json:"promote_mcp_projects,omitempty"`
+}
+
+// ProjectMapping rewrites a project path prefix used on other machines,
+// e.g. /Users/alice/code → ~/src, when pulling per-project config
+type ProjectMapping struct {
+	From string `json:"from"` // 其他设备上的路径前缀
+	To   string `json:"to"`   // 本机对应的路径前缀，支持 ~
 }
 
 // SyncState tracks the state of each synced item
 type SyncState struct {
-	Items    map[string]ItemState `json:"items"`
-	LastSync *time.Time           `json:"last_sync,omitempty"`
-	Version  int                  `json:"version,omitempty"`
+	SchemaVersion int                  `json:"schema_version,omitempty"`
+	Items         map[string]ItemState `json:"items"`
+	LastSync      *time.Time           `json:"last_sync,omitempty"`
+	Version       int                  `json:"version,omitempty"`
 }
 
 // ItemState tracks the hash and sync time for an item
@@ -82,27 +121,25 @@ func GetStatePath() (string, error) {
 	return filepath.Join(dir, StateFile), nil
 }
 
-// Load loads the configuration from disk
+// Load loads the configuration from disk, running pending schema migrations.
+// The pre-migration file is kept as config.json.v<old>.<timestamp>.bak.
 func Load() (*Config, error) {
-	path, err := GetConfigPath()
+	cfg, data, err := readConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	data, err := os.ReadFile(path)
+	result, err := migrateConfig(cfg)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("config not found, run 'claude_sync init' first")
-		}
-		return nil, fmt.Errorf("failed to read config: %w", err)
+		return nil, err
 	}
-
-	var cfg Config
-	if err := json.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config: %w", err)
+	if result.Pending() {
+		if _, err := saveMigratedConfig(cfg, data, result.From); err != nil {
+			return nil, err
+		}
 	}
 
-	return &cfg, nil
+	return cfg, nil
 }
 
 // Save saves the configuration to disk
@@ -126,38 +163,31 @@ func (c *Config) Save() error {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
 
-	if err := os.WriteFile(path, data, 0600); err != nil {
+	if err := fileutil.WriteFile(path, data, 0600); err != nil {
 		return fmt.Errorf("failed to write config: %w", err)
 	}
 
 	return nil
 }
 
-// LoadState loads the sync state from disk
+// LoadState loads the sync state from disk, running pending schema migrations
 func LoadState() (*SyncState, error) {
-	path, err := GetStatePath()
+	state, data, err := readState()
 	if err != nil {
 		return nil, err
 	}
 
-	data, err := os.ReadFile(path)
+	result, err := migrateState(state)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return &SyncState{Items: make(map[string]ItemState)}, nil
-		}
-		return nil, fmt.Errorf("failed to read state: %w", err)
-	}
-
-	var state SyncState
-	if err := json.Unmarshal(data, &state); err != nil {
-		return nil, fmt.Errorf("failed to parse state: %w", err)
+		return nil, err
 	}
-
-	if state.Items == nil {
-		state.Items = make(map[string]ItemState)
+	if result.Pending() && data != nil {
+		if _, err := saveMigratedState(state, data, result.From); err != nil {
+			return nil, err
+		}
 	}
 
-	return &state, nil
+	return state, nil
 }
 
 // Save saves the sync state to disk
@@ -181,13 +211,51 @@ func (s *SyncState) Save() error {
 		return fmt.Errorf("failed to marshal state: %w", err)
 	}
 
-	if err := os.WriteFile(path, data, 0600); err != nil {
+	if err := fileutil.WriteFile(path, data, 0600); err != nil {
 		return fmt.Errorf("failed to write state: %w", err)
 	}
 
 	return nil
 }
 
+// GetBasePath returns where the last-synced content of an item is stored
+func GetBasePath(itemName string) (string, error) {
+	dir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, BaseDir, itemName), nil
+}
+
+// SaveBase records the content of an item as of the last successful sync
+func SaveBase(itemName, content string) error {
+	path, err := GetBasePath(itemName)
+	if err != nil {
+		return err
+	}
+	if err := fileutil.WriteFile(path, []byte(content), 0600); err != nil {
+		return fmt.Errorf("failed to write base: %w", err)
+	}
+	return nil
+}
+
+// LoadBase loads the last-synced content of an item.
+// The boolean is false if no base has been recorded yet.
+func LoadBase(itemName string) (string, bool, error) {
+	path, err := GetBasePath(itemName)
+	if err != nil {
+		return "", false, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("failed to read base: %w", err)
+	}
+	return string(data), true, nil
+}
+
 // ExpandPath expands ~ to home directory
 func ExpandPath(path string) (string, error) {
 	if len(path) == 0 {
@@ -213,9 +281,11 @@ func ExpandPath(path string) (string, error) {
 // DefaultConfig returns a config with default sync items
 func DefaultConfig(gistID string) *Config {
 	return &Config{
+		SchemaVersion:    ConfigSchemaVersion,
 		GistID:           gistID,
 		GitHubTokenEnv:   "GITHUB_TOKEN",
 		ConflictStrategy: "ask",
+		LocalPatterns:    DefaultLocalPatterns(),
 		SyncItems: []SyncItem{
 			{
 				Name:      "settings",
@@ -227,6 +297,8 @@ func DefaultConfig(gistID string) *Config {
 					// 同步偏好和 hooks，排除 env（设备特定环境变量）
 					ExcludeFields: []string{"env"},
 				},
+				MergeRules:   DefaultSettingsMergeRules(),
+				LocalActions: DefaultSettingsLocalActions(),
 			},
 			{
 				Name:      "output-styles",
@@ -265,6 +337,7 @@ func DefaultConfig(gistID string) *Config {
 						"mcpServers",
 					},
 				},
+				MergeRules: DefaultClaudeJSONMergeRules(),
 			},
 			{
 				Name:      "plugins-list",
@@ -280,10 +353,124 @@ func DefaultConfig(gistID string) *Config {
 				Enabled:   true,
 				Type:      "directory",
 			},
+			{
+				Name:      "claude-md",
+				LocalPath: "~/.claude/CLAUDE.md",
+				GistFile:  "CLAUDE.md",
+				Enabled:   true,
+				Type:      "file",
+			},
+			{
+				Name:      "agents",
+				LocalPath: "~/.claude/agents",
+				GistFile:  "agents.tar.gz",
+				Enabled:   true,
+				Type:      "directory",
+			},
+			{
+				Name:      "commands",
+				LocalPath: "~/.claude/commands",
+				GistFile:  "commands.tar.gz",
+				Enabled:   true,
+				Type:      "directory",
+			},
+			{
+				Name:      "plugins-installed",
+				LocalPath: "~/.claude/plugins/installed_plugins.json",
+				GistFile:  "installed_plugins.json",
+				Enabled:   false, // 默认禁用，包含本机的插件安装路径
+				Type:      "file",
+			},
 		},
 	}
 }
 
+// PermissionPaths are the settings.json lists synced as sets
+var PermissionPaths = []string{"permissions.allow", "permissions.deny", "permissions.ask"}
+
+// DefaultSettingsMergeRules syncs the permission lists as sets with
+// per-entry history, so entries added or removed on any machine propagate
+// instead of being overwritten by pull, and merges hooks with the pull's
+// hooks strategy
+func DefaultSettingsMergeRules() map[string]string {
+	rules := make(map[string]string, len(PermissionPaths)+1)
+	for _, path := range PermissionPaths {
+		rules[path] = string(merge.SyncedSet)
+	}
+	rules[HooksField] = string(merge.Hooks)
+	return rules
+}
+
+// HooksField is the settings.json field merged with the hooks strategy
+const HooksField = "hooks"
+
+// MCPServersField is the global MCP server table of ~/.claude.json
+const MCPServersField = "mcpServers"
+
+// DefaultClaudeJSONMergeRules merges the global and project MCP server
+// tables of ~/.claude.json server by server
+func DefaultClaudeJSONMergeRules() map[string]string {
+	return map[string]string{
+		MCPServersField: string(merge.MCPServers),
+		ProjectMCPField: string(merge.MCPServers),
+	}
+}
+
+// DefaultLocalPatterns are the built-in machine-specific content patterns
+func DefaultLocalPatterns() []LocalPattern {
+	return []LocalPattern{
+		{Name: "localhost-port", Regex: `localhost:\d+`},     // localhost:59948
+		{Name: "loopback-port", Regex: `127\.0\.0\.1:\d+`},   // 127.0.0.1:8080
+		{Name: "any-address-port", Regex: `0\.0\.0\.0:\d+`},  // 0.0.0.0:3000
+		{Name: "macos-home", Regex: `/Users/[^/]+/`},         // macOS 用户路径
+		{Name: "linux-home", Regex: `/home/[^/]+/`},          // Linux 用户路径
+		{Name: "windows-home", Regex: `C:\\Users\\[^\\]+\\`}, // Windows 用户路径
+		{Name: "home-var", Regex: `\$\{?HOME\}?`},            // $HOME 变量
+		{Name: "tilde-path", Regex: `~/`},                    // ~ 路径
+	}
+}
+
+// DefaultSettingsLocalActions keeps hooks that reference this machine out
+// of the gist; other machine-specific values are only reported
+func DefaultSettingsLocalActions() map[string]string {
+	return map[string]string{"hooks.*": "exclude"}
+}
+
+// Device returns the name recorded for this machine in sync history:
+// device_name if set, otherwise the hostname
+func (c *Config) Device() string {
+	if c.DeviceName != "" {
+		return c.DeviceName
+	}
+	if host, err := os.Hostname(); err == nil && host != "" {
+		return host
+	}
+	return "unknown"
+}
+
+// AddDefaultItems appends the named default sync items that are not in the
+// config yet, so migrations can give existing users items added in newer
+// versions. An item is skipped when its name or gist file is already taken.
+// Returns the names of the added items.
+func (c *Config) AddDefaultItems(only []string) []string {
+	names := make(map[string]bool)
+	gistFiles := make(map[string]bool)
+	for _, item := range c.SyncItems {
+		names[item.Name] = true
+		gistFiles[item.GistFile] = true
+	}
+
+	var added []string
+	for _, item := range DefaultConfig(c.GistID).SyncItems {
+		if names[item.Name] || gistFiles[item.GistFile] || !contains(only, item.Name) {
+			continue
+		}
+		c.SyncItems = append(c.SyncItems, item)
+		added = append(added, item.Name)
+	}
+	return added
+}
+
 // GetEnabledItems returns only enabled sync items
 func (c *Config) GetEnabledItems() []SyncItem {
 	var items []SyncItem
@@ -30,3 +30,41 @@ func TestExpandPathHome(t *testing.T) {
 		}
 	}
 }
+
+func TestAddDefaultItems(t *testing.T) {
+	cfg := &Config{
+		SyncItems: []SyncItem{
+			{Name: "settings", LocalPath: "~/.claude/settings.json", GistFile: "settings.json", Enabled: true},
+			// 用户自定义的同名 gist 文件不应被默认项覆盖
+			{Name: "my-memory", LocalPath: "~/notes/CLAUDE.md", GistFile: "CLAUDE.md", Enabled: true},
+			{Name: "agents", LocalPath: "~/.claude/agents", GistFile: "agents.tar.gz", Enabled: false, Type: "directory"},
+		},
+	}
+
+	names := []string{"settings", "claude-md", "agents", "commands", "skills", "claude-json"}
+	added := cfg.AddDefaultItems(names)
+	addedSet := make(map[string]bool)
+	for _, name := range added {
+		addedSet[name] = true
+	}
+
+	for _, name := range []string{"commands", "skills", "claude-json"} {
+		if !addedSet[name] {
+			t.Fatalf("expected %s to be added, got %v", name, added)
+		}
+	}
+	for _, name := range []string{"settings", "claude-md", "agents"} {
+		if addedSet[name] {
+			t.Fatalf("%s should not be added, got %v", name, added)
+		}
+	}
+	for _, item := range cfg.SyncItems {
+		if item.Name == "agents" && item.Enabled {
+			t.Fatalf("existing disabled item was re-enabled")
+		}
+	}
+
+	if again := cfg.AddDefaultItems(names); len(again) != 0 {
+		t.Fatalf("second call added %v, want nothing", again)
+	}
+}
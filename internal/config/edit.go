@@ -0,0 +1,408 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/yxuechao007/claude_sync/internal/jsonpath"
+	"github.com/yxuechao007/claude_sync/internal/merge"
+)
+
+// ConflictStrategies lists the accepted values of conflict_strategy
+var ConflictStrategies = []string{"ask", "local", "remote"}
+
+// LocalActions lists the accepted local_actions values
+var LocalActions = []string{"exclude", "warn", "ignore"}
+
+// settableKeys maps top-level keys accepted by 'config set' to their setters
+var settableKeys = map[string]func(c *Config, value string) error{
+	"conflict_strategy": func(c *Config, value string) error {
+		if !contains(ConflictStrategies, value) {
+			return fmt.Errorf("invalid conflict_strategy %q, expected one of %s", value, strings.Join(ConflictStrategies, ", "))
+		}
+		c.ConflictStrategy = value
+		return nil
+	},
+	"github_token_env": func(c *Config, value string) error {
+		if value == "" {
+			return fmt.Errorf("github_token_env cannot be empty")
+		}
+		c.GitHubTokenEnv = value
+		return nil
+	},
+	"gist_id": func(c *Config, value string) error {
+		c.GistID = value
+		return nil
+	},
+	"mergetool": func(c *Config, value string) error {
+		c.MergeTool = value
+		return nil
+	},
+	"device_name": func(c *Config, value string) error {
+		c.DeviceName = value
+		return nil
+	},
+	"match_git_remote": func(c *Config, value string) error {
+		switch value {
+		case "true":
+			c.MatchGitRemote = true
+		case "false":
+			c.MatchGitRemote = false
+		default:
+			return fmt.Errorf("invalid match_git_remote %q, expected true or false", value)
+		}
+		return nil
+	},
+	"mcp_project_servers": func(c *Config, value string) error {
+		return c.SetMCPProjectServers(value)
+	},
+}
+
+// itemKeys maps per-item keys accepted by 'config set <item>.<key>'
+var itemKeys = map[string]func(item *SyncItem, value string) error{
+	"local_path": func(item *SyncItem, value string) error {
+		item.LocalPath = value
+		return nil
+	},
+	"gist_file": func(item *SyncItem, value string) error {
+		item.GistFile = value
+		return nil
+	},
+	"type": func(item *SyncItem, value string) error {
+		if value != "file" && value != "directory" {
+			return fmt.Errorf("invalid type %q, expected file or directory", value)
+		}
+		item.Type = value
+		return nil
+	},
+}
+
+// SettableKeys returns the keys accepted by Set, for usage messages
+func SettableKeys() []string {
+	var keys []string
+	for key := range settableKeys {
+		keys = append(keys, key)
+	}
+	for key := range itemKeys {
+		keys = append(keys, "<item>."+key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// FindItem returns the sync item with the given name, or nil
+func (c *Config) FindItem(name string) *SyncItem {
+	for i := range c.SyncItems {
+		if c.SyncItems[i].Name == name {
+			return &c.SyncItems[i]
+		}
+	}
+	return nil
+}
+
+// NewItem builds a sync item from a name and local path.
+// An empty itemType is inferred from the path (existing directory → "directory"),
+// and an empty gistFile defaults to <name>.tar.gz for directories or
+// <name><ext> for files.
+func NewItem(name, localPath, itemType, gistFile string) (SyncItem, error) {
+	if name == "" || localPath == "" {
+		return SyncItem{}, fmt.Errorf("name and path are required")
+	}
+
+	if itemType == "" {
+		itemType = "file"
+		if expanded, err := ExpandPath(localPath); err == nil {
+			if info, err := os.Stat(expanded); err == nil && info.IsDir() {
+				itemType = "directory"
+			}
+		}
+	}
+	if itemType != "file" && itemType != "directory" {
+		return SyncItem{}, fmt.Errorf("invalid type %q, expected file or directory", itemType)
+	}
+
+	if gistFile == "" {
+		if itemType == "directory" {
+			gistFile = name + ".tar.gz"
+		} else {
+			gistFile = name + filepath.Ext(localPath)
+		}
+	}
+
+	return SyncItem{
+		Name:      name,
+		LocalPath: localPath,
+		GistFile:  gistFile,
+		Enabled:   true,
+		Type:      itemType,
+	}, nil
+}
+
+// AddItem appends a new sync item; names must be unique
+func (c *Config) AddItem(item SyncItem) error {
+	if c.FindItem(item.Name) != nil {
+		return fmt.Errorf("sync item %q already exists", item.Name)
+	}
+	c.SyncItems = append(c.SyncItems, item)
+	return nil
+}
+
+// RemoveItem deletes a sync item by name
+func (c *Config) RemoveItem(name string) error {
+	for i, item := range c.SyncItems {
+		if item.Name == name {
+			c.SyncItems = append(c.SyncItems[:i], c.SyncItems[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("sync item %q not found", name)
+}
+
+// SetEnabled enables or disables a sync item
+func (c *Config) SetEnabled(name string, enabled bool) error {
+	item := c.FindItem(name)
+	if item == nil {
+		return fmt.Errorf("sync item %q not found", name)
+	}
+	item.Enabled = enabled
+	return nil
+}
+
+// Set updates a top-level key such as conflict_strategy, or an item key
+// written as <item>.<key> (e.g. skills.local_path)
+func (c *Config) Set(key, value string) error {
+	if setter, ok := settableKeys[key]; ok {
+		return setter(c, value)
+	}
+
+	if idx := strings.LastIndex(key, "."); idx > 0 {
+		name, field := key[:idx], key[idx+1:]
+		if setter, ok := itemKeys[field]; ok {
+			item := c.FindItem(name)
+			if item == nil {
+				return fmt.Errorf("sync item %q not found", name)
+			}
+			return setter(item, value)
+		}
+	}
+
+	return fmt.Errorf("unknown config key %q, expected one of %s", key, strings.Join(SettableKeys(), ", "))
+}
+
+// AddFilterField adds a field to an item's include or exclude list
+func (c *Config) AddFilterField(name string, include bool, field string) error {
+	item := c.FindItem(name)
+	if item == nil {
+		return fmt.Errorf("sync item %q not found", name)
+	}
+	if field == "" {
+		return fmt.Errorf("filter field cannot be empty")
+	}
+	if item.Filter == nil {
+		item.Filter = &FilterConfig{}
+	}
+
+	list := &item.Filter.ExcludeFields
+	if include {
+		list = &item.Filter.IncludeFields
+	}
+	if contains(*list, field) {
+		return fmt.Errorf("%q is already in the filter of %s", field, name)
+	}
+	*list = append(*list, field)
+	return nil
+}
+
+// RemoveFilterField removes a field from an item's include or exclude list.
+// The filter is dropped entirely once both lists are empty.
+func (c *Config) RemoveFilterField(name string, include bool, field string) error {
+	item := c.FindItem(name)
+	if item == nil {
+		return fmt.Errorf("sync item %q not found", name)
+	}
+	if item.Filter == nil {
+		return fmt.Errorf("sync item %q has no filter", name)
+	}
+
+	list := &item.Filter.ExcludeFields
+	if include {
+		list = &item.Filter.IncludeFields
+	}
+	for i, existing := range *list {
+		if existing == field {
+			*list = append((*list)[:i], (*list)[i+1:]...)
+			if len(item.Filter.IncludeFields) == 0 && len(item.Filter.ExcludeFields) == 0 {
+				item.Filter = nil
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("%q is not in the filter of %s", field, name)
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// SetMergeRule sets the merge strategy for a JSON path of an item.
+// An empty strategy removes the rule.
+func (c *Config) SetMergeRule(name, path, strategy string) error {
+	item := c.FindItem(name)
+	if item == nil {
+		return fmt.Errorf("sync item %q not found", name)
+	}
+	if _, err := jsonpath.Parse(path); err != nil {
+		return err
+	}
+
+	if strategy == "" {
+		if _, ok := item.MergeRules[path]; !ok {
+			return fmt.Errorf("%s has no merge rule for %s", name, path)
+		}
+		delete(item.MergeRules, path)
+		if len(item.MergeRules) == 0 {
+			item.MergeRules = nil
+		}
+		return nil
+	}
+
+	if !merge.ValidStrategy(strategy) {
+		var names []string
+		for _, s := range merge.Strategies {
+			names = append(names, string(s))
+		}
+		return fmt.Errorf("invalid merge strategy %q, expected one of %s", strategy, strings.Join(names, ", "))
+	}
+	if item.MergeRules == nil {
+		item.MergeRules = make(map[string]string)
+	}
+	item.MergeRules[path] = strategy
+	return nil
+}
+
+// AddLocalPattern adds a named machine-specific content pattern
+func (c *Config) AddLocalPattern(name, regex string) error {
+	if name == "" || regex == "" {
+		return fmt.Errorf("pattern name and regex are required")
+	}
+	if _, err := regexp.Compile(regex); err != nil {
+		return fmt.Errorf("invalid regex for %s: %w", name, err)
+	}
+	for _, p := range c.LocalPatterns {
+		if p.Name == name {
+			return fmt.Errorf("local pattern %q already exists", name)
+		}
+	}
+	c.LocalPatterns = append(c.LocalPatterns, LocalPattern{Name: name, Regex: regex})
+	return nil
+}
+
+// RemoveLocalPattern deletes a local pattern by name
+func (c *Config) RemoveLocalPattern(name string) error {
+	for i, p := range c.LocalPatterns {
+		if p.Name == name {
+			c.LocalPatterns = append(c.LocalPatterns[:i], c.LocalPatterns[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("local pattern %q not found", name)
+}
+
+// SetLocalAction sets what push does with machine-specific content below a
+// JSON path of an item. An empty action removes the entry.
+func (c *Config) SetLocalAction(name, path, action string) error {
+	item := c.FindItem(name)
+	if item == nil {
+		return fmt.Errorf("sync item %q not found", name)
+	}
+	if _, err := jsonpath.Parse(path); err != nil {
+		return err
+	}
+
+	if action == "" {
+		if _, ok := item.LocalActions[path]; !ok {
+			return fmt.Errorf("%s has no local action for %s", name, path)
+		}
+		delete(item.LocalActions, path)
+		if len(item.LocalActions) == 0 {
+			item.LocalActions = nil
+		}
+		return nil
+	}
+
+	if !contains(LocalActions, action) {
+		return fmt.Errorf("invalid local action %q, expected one of %s", action, strings.Join(LocalActions, ", "))
+	}
+	if item.LocalActions == nil {
+		item.LocalActions = make(map[string]string)
+	}
+	item.LocalActions[path] = action
+	return nil
+}
+
+// AddProjectMapping maps project paths starting with from (on other
+// machines) to the same relative path under to (on this machine)
+func (c *Config) AddProjectMapping(from, to string) error {
+	from = strings.TrimRight(from, `/\`)
+	to = strings.TrimRight(to, `/\`)
+	if from == "" || to == "" {
+		return fmt.Errorf("both path prefixes are required")
+	}
+	for _, m := range c.ProjectMappings {
+		if m.From == from {
+			return fmt.Errorf("project mapping for %s already exists (→ %s)", from, m.To)
+		}
+	}
+	c.ProjectMappings = append(c.ProjectMappings, ProjectMapping{From: from, To: to})
+	return nil
+}
+
+// AddPromoteMCPProject opts a project path or glob (* for all projects)
+// into copying its MCP servers to the global mcpServers on push
+func (c *Config) AddPromoteMCPProject(project string) error {
+	project = strings.TrimRight(project, `/\`)
+	if project == "" {
+		return fmt.Errorf("project path is required")
+	}
+	if contains(c.PromoteMCPProjects, project) {
+		return fmt.Errorf("MCP servers of %s are already promoted", project)
+	}
+	c.PromoteMCPProjects = append(c.PromoteMCPProjects, project)
+	return nil
+}
+
+// RemovePromoteMCPProject stops promoting the MCP servers of a project
+func (c *Config) RemovePromoteMCPProject(project string) error {
+	project = strings.TrimRight(project, `/\`)
+	for i, existing := range c.PromoteMCPProjects {
+		if existing == project {
+			c.PromoteMCPProjects = append(c.PromoteMCPProjects[:i], c.PromoteMCPProjects[i+1:]...)
+			if len(c.PromoteMCPProjects) == 0 {
+				c.PromoteMCPProjects = nil
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("MCP servers of %s are not promoted", project)
+}
+
+// RemoveProjectMapping deletes the mapping of a path prefix
+func (c *Config) RemoveProjectMapping(from string) error {
+	from = strings.TrimRight(from, `/\`)
+	for i, m := range c.ProjectMappings {
+		if m.From == from {
+			c.ProjectMappings = append(c.ProjectMappings[:i], c.ProjectMappings[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("project mapping for %s not found", from)
+}
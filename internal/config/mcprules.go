@@ -0,0 +1,307 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// MCP server sync modes
+const (
+	MCPSyncAlways   = "always"    // 默认：push 和 pull 都同步
+	MCPSyncNever    = "never"     // 不上传（并从 Gist 中移除），pull 时不改动本地
+	MCPSyncPullOnly = "pull-only" // 只从 Gist 拉取，push 时保留 Gist 中的版本
+	MCPSyncPushOnly = "push-only" // 只上传，pull 时保留本地版本
+)
+
+var mcpSyncModes = []string{MCPSyncAlways, MCPSyncNever, MCPSyncPullOnly, MCPSyncPushOnly}
+
+// mcp_project_servers modes: how project-scoped MCP servers of
+// ~/.claude.json reach other machines
+const (
+	MCPProjectLocal   = "local"   // 不同步项目级 server
+	MCPProjectProject = "project" // 作为项目条目同步，pull 时按 project_mappings 映射路径
+	MCPProjectPromote = "promote" // push 时复制到全局 mcpServers（旧版行为）
+)
+
+// MCPProjectModes lists the accepted mcp_project_servers values
+var MCPProjectModes = []string{MCPProjectLocal, MCPProjectProject, MCPProjectPromote}
+
+// ProjectMCPField is the claude-json include field that syncs project
+// servers as project entries
+const ProjectMCPField = "projects.*.mcpServers"
+
+// promoteAll in promote_mcp_projects promotes the servers of every project
+const promoteAll = "*"
+
+// tagRulePrefix marks rules that apply to every server with a tag
+const tagRulePrefix = "tag:"
+
+// MCPServerRule controls how one MCP server of ~/.claude.json is synced.
+// Rules are keyed by server name, a glob such as "local-*", or
+// "tag:<tag>" for every server whose own rule lists that tag.
+type MCPServerRule struct {
+	Sync   string   `json:"sync,omitempty"`    // always、never、pull-only 或 push-only
+	OnlyOn []string `json:"only_on,omitempty"` // 只在这些系统（linux、darwin、windows）或设备名上同步
+	Tags   []string `json:"tags,omitempty"`
+	// Promote copies the server from any project into the global mcpServers on push
+	Promote bool `json:"promote,omitempty"`
+}
+
+// isEmpty reports whether the rule changes nothing
+func (r MCPServerRule) isEmpty() bool {
+	return (r.Sync == "" || r.Sync == MCPSyncAlways) && len(r.OnlyOn) == 0
+}
+
+// appliesHere reports whether only_on includes this machine
+func (r MCPServerRule) appliesHere(device string) bool {
+	if len(r.OnlyOn) == 0 {
+		return true
+	}
+	for _, target := range r.OnlyOn {
+		if strings.EqualFold(target, runtime.GOOS) || strings.EqualFold(target, device) {
+			return true
+		}
+	}
+	return false
+}
+
+// MCPServerPolicy answers which MCP servers take part in push and pull on
+// this machine
+type MCPServerPolicy struct {
+	rules    map[string]MCPServerRule
+	device   string
+	promoted []string // 展开 ~ 后的 promote_mcp_projects
+}
+
+// MCPServerPolicy returns the policy for the configured rules on this device
+func (c *Config) MCPServerPolicy() MCPServerPolicy {
+	policy := MCPServerPolicy{rules: c.MCPServers, device: c.Device()}
+	for _, pattern := range c.PromoteMCPProjects {
+		if expanded, err := ExpandPath(pattern); err == nil {
+			policy.promoted = append(policy.promoted, expanded)
+		}
+	}
+	return policy
+}
+
+// Rule returns the rule of a server: its own rule (exact name, then the
+// longest matching glob) unless that leaves sync at the default, otherwise
+// the first tag rule for one of its tags
+func (p MCPServerPolicy) Rule(name string) (MCPServerRule, bool) {
+	own, ok := p.ownRule(name)
+	if ok && !own.isEmpty() {
+		return own, true
+	}
+	for _, tag := range own.Tags {
+		if rule, found := p.rules[tagRulePrefix+tag]; found {
+			return rule, true
+		}
+	}
+	return own, ok
+}
+
+// ownRule returns the rule keyed by the server name or the longest glob
+// matching it
+func (p MCPServerPolicy) ownRule(name string) (MCPServerRule, bool) {
+	if rule, ok := p.rules[name]; ok {
+		return rule, true
+	}
+	var own MCPServerRule
+	best, ok := "", false
+	for key, rule := range p.rules {
+		if strings.HasPrefix(key, tagRulePrefix) {
+			continue
+		}
+		if matched, _ := path.Match(key, name); matched && len(key) > len(best) {
+			best, own, ok = key, rule, true
+		}
+	}
+	return own, ok
+}
+
+// Push reports whether this machine's version of a server is uploaded
+func (p MCPServerPolicy) Push(name string) bool {
+	rule, _ := p.Rule(name)
+	switch rule.Sync {
+	case MCPSyncNever, MCPSyncPullOnly:
+		return false
+	}
+	return rule.appliesHere(p.device)
+}
+
+// Pull reports whether the gist's version of a server is written locally
+func (p MCPServerPolicy) Pull(name string) bool {
+	rule, _ := p.Rule(name)
+	switch rule.Sync {
+	case MCPSyncNever, MCPSyncPushOnly:
+		return false
+	}
+	return rule.appliesHere(p.device)
+}
+
+// Strip reports whether a server is removed from the gist on push rather
+// than keeping the gist's version
+func (p MCPServerPolicy) Strip(name string) bool {
+	rule, _ := p.Rule(name)
+	return rule.Sync == MCPSyncNever
+}
+
+// Promote reports whether a server of a project is copied into the global
+// mcpServers on push: the server's rule or promote_mcp_projects opts it in
+func (p MCPServerPolicy) Promote(project, name string) bool {
+	if !p.Push(name) {
+		return false
+	}
+	if own, _ := p.ownRule(name); own.Promote {
+		return true
+	}
+	if rule, _ := p.Rule(name); rule.Promote {
+		return true
+	}
+	for _, pattern := range p.promoted {
+		if pattern == promoteAll || pattern == project {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern, project); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Empty reports whether no rules are configured
+func (p MCPServerPolicy) Empty() bool {
+	return len(p.rules) == 0
+}
+
+// ClaudeJSONItem returns the file item syncing ~/.claude.json, whatever its
+// name: the item at that path, otherwise the first one whose file is named
+// .claude.json
+func (c *Config) ClaudeJSONItem() *SyncItem {
+	want, err := ExpandPath("~/.claude.json")
+	if err != nil {
+		return nil
+	}
+	var found *SyncItem
+	for i := range c.SyncItems {
+		item := &c.SyncItems[i]
+		if item.Type == "directory" || filepath.Base(item.LocalPath) != ".claude.json" {
+			continue
+		}
+		if path, err := ExpandPath(item.LocalPath); err == nil && filepath.Clean(path) == filepath.Clean(want) {
+			return item
+		}
+		if found == nil {
+			found = item
+		}
+	}
+	return found
+}
+
+// MCPProjectServers returns the mcp_project_servers mode implied by the
+// ~/.claude.json filter and promote_mcp_projects; promotion of single
+// projects or servers is not a mode of its own and reports as local or
+// project
+func (c *Config) MCPProjectServers() string {
+	if item := c.ClaudeJSONItem(); item != nil && item.Filter != nil && contains(item.Filter.IncludeFields, ProjectMCPField) {
+		return MCPProjectProject
+	}
+	if contains(c.PromoteMCPProjects, promoteAll) {
+		return MCPProjectPromote
+	}
+	return MCPProjectLocal
+}
+
+// SetMCPProjectServers switches how project MCP servers are synced by
+// editing the ~/.claude.json include_fields and promote_mcp_projects
+func (c *Config) SetMCPProjectServers(mode string) error {
+	if !contains(MCPProjectModes, mode) {
+		return fmt.Errorf("invalid mcp_project_servers %q, expected one of %s", mode, strings.Join(MCPProjectModes, ", "))
+	}
+	item := c.ClaudeJSONItem()
+	if item == nil {
+		return fmt.Errorf("no sync item for ~/.claude.json")
+	}
+	if item.Filter == nil || len(item.Filter.IncludeFields) == 0 {
+		return fmt.Errorf("%s has no include_fields, so every project is synced as is; edit its filter instead", item.Name)
+	}
+
+	included := contains(item.Filter.IncludeFields, ProjectMCPField)
+	if mode == MCPProjectProject && !included {
+		item.Filter.IncludeFields = append(item.Filter.IncludeFields, ProjectMCPField)
+	}
+	if mode != MCPProjectProject && included {
+		if err := c.RemoveFilterField(item.Name, true, ProjectMCPField); err != nil {
+			return err
+		}
+	}
+
+	promoted := contains(c.PromoteMCPProjects, promoteAll)
+	if mode == MCPProjectPromote && !promoted {
+		return c.AddPromoteMCPProject(promoteAll)
+	}
+	if mode != MCPProjectPromote && promoted {
+		return c.RemovePromoteMCPProject(promoteAll)
+	}
+	return nil
+}
+
+// SetMCPServerRule stores the rule of a server name, glob or tag:<tag>;
+// an empty rule removes it
+func (c *Config) SetMCPServerRule(key string, rule MCPServerRule) error {
+	if key == "" || key == tagRulePrefix {
+		return fmt.Errorf("MCP server rule needs a server name, glob or tag:<tag>")
+	}
+	if rule.isEmpty() && len(rule.Tags) == 0 && !rule.Promote {
+		if _, ok := c.MCPServers[key]; !ok {
+			return fmt.Errorf("no MCP server rule for %s", key)
+		}
+		delete(c.MCPServers, key)
+		if len(c.MCPServers) == 0 {
+			c.MCPServers = nil
+		}
+		return nil
+	}
+	if c.MCPServers == nil {
+		c.MCPServers = make(map[string]MCPServerRule)
+	}
+	c.MCPServers[key] = rule
+	return nil
+}
+
+func validatePromoteMCPProjects(projects []string) []Issue {
+	var issues []Issue
+	for _, project := range projects {
+		if _, err := filepath.Match(project, ""); err != nil {
+			issues = append(issues, Issue{Severity: SeverityError, Message: fmt.Sprintf("promote_mcp_projects: invalid glob %q: %v", project, err)})
+		}
+	}
+	return issues
+}
+
+func validateMCPServerRules(rules map[string]MCPServerRule) []Issue {
+	var issues []Issue
+	keys := make([]string, 0, len(rules))
+	for key := range rules {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		rule := rules[key]
+		if rule.Sync != "" && !contains(mcpSyncModes, rule.Sync) {
+			issues = append(issues, Issue{Severity: SeverityError, Message: fmt.Sprintf("mcp_servers.%s: unknown sync %q (use %s)", key, rule.Sync, strings.Join(mcpSyncModes, ", "))})
+		}
+		if !strings.HasPrefix(key, tagRulePrefix) {
+			if _, err := path.Match(key, ""); err != nil {
+				issues = append(issues, Issue{Severity: SeverityError, Message: fmt.Sprintf("mcp_servers.%s: invalid glob: %v", key, err)})
+			}
+		} else if len(rule.Tags) > 0 {
+			issues = append(issues, Issue{Severity: SeverityWarning, Message: fmt.Sprintf("mcp_servers.%s: tags of a tag rule are ignored", key)})
+		}
+	}
+	return issues
+}
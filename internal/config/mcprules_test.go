@@ -0,0 +1,141 @@
+package config
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestMCPServerPolicy(t *testing.T) {
+	other := "plan9"
+	if runtime.GOOS == other {
+		other = "linux"
+	}
+	cfg := &Config{
+		DeviceName: "laptop",
+		MCPServers: map[string]MCPServerRule{
+			"secrets":      {Sync: MCPSyncNever},
+			"local-*":      {Sync: MCPSyncPullOnly},
+			"local-db-*":   {Sync: MCPSyncPushOnly},
+			"gpu":          {OnlyOn: []string{other}},
+			"mine":         {OnlyOn: []string{"LAPTOP"}},
+			"browser":      {Tags: []string{"desktop"}},
+			"tag:desktop":  {Sync: MCPSyncNever},
+			"tag:untagged": {Sync: MCPSyncNever},
+		},
+	}
+	policy := cfg.MCPServerPolicy()
+
+	tests := []struct {
+		name       string
+		push, pull bool
+		strip      bool
+	}{
+		{name: "github", push: true, pull: true},
+		{name: "secrets", strip: true},
+		{name: "local-files", pull: true},
+		{name: "local-db-main", push: true},
+		{name: "gpu"},
+		{name: "mine", push: true, pull: true},
+		{name: "browser", strip: true},
+	}
+	for _, tt := range tests {
+		if got := policy.Push(tt.name); got != tt.push {
+			t.Errorf("Push(%s) = %v, want %v", tt.name, got, tt.push)
+		}
+		if got := policy.Pull(tt.name); got != tt.pull {
+			t.Errorf("Pull(%s) = %v, want %v", tt.name, got, tt.pull)
+		}
+		if got := policy.Strip(tt.name); got != tt.strip {
+			t.Errorf("Strip(%s) = %v, want %v", tt.name, got, tt.strip)
+		}
+	}
+}
+
+func TestSetMCPServerRule(t *testing.T) {
+	cfg := &Config{}
+	if err := cfg.SetMCPServerRule("db", MCPServerRule{Sync: "sometimes"}); err != nil {
+		t.Fatalf("SetMCPServerRule: %v", err)
+	}
+	if err := cfg.SetMCPServerRule("[bad", MCPServerRule{Sync: MCPSyncNever}); err != nil {
+		t.Fatalf("SetMCPServerRule: %v", err)
+	}
+	messages := issueMessages(validateMCPServerRules(cfg.MCPServers))
+	if !strings.Contains(messages, `mcp_servers.db: unknown sync "sometimes"`) || !strings.Contains(messages, "mcp_servers.[bad: invalid glob") {
+		t.Errorf("issues:\n%s", messages)
+	}
+
+	if err := cfg.SetMCPServerRule("db", MCPServerRule{}); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := cfg.SetMCPServerRule("[bad", MCPServerRule{}); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if cfg.MCPServers != nil {
+		t.Errorf("rules not removed: %v", cfg.MCPServers)
+	}
+	if err := cfg.SetMCPServerRule("db", MCPServerRule{}); err == nil {
+		t.Error("removing a missing rule should fail")
+	}
+}
+
+func TestMCPServerPolicyPromote(t *testing.T) {
+	cfg := &Config{
+		MCPServers: map[string]MCPServerRule{
+			"github":     {Promote: true},
+			"vault":      {Sync: MCPSyncNever, Promote: true},
+			"docs":       {Tags: []string{"shared"}},
+			"tag:shared": {Promote: true},
+		},
+		PromoteMCPProjects: []string{"/work/team-*"},
+	}
+	policy := cfg.MCPServerPolicy()
+
+	tests := []struct {
+		project, name string
+		want          bool
+	}{
+		{"/work/client", "github", true},
+		{"/work/client", "docs", true},
+		{"/work/client", "private", false},
+		{"/work/team-api", "private", true},
+		{"/work/team-api", "vault", false}, // 不上传的 server 不会被提升
+	}
+	for _, tt := range tests {
+		if got := policy.Promote(tt.project, tt.name); got != tt.want {
+			t.Errorf("Promote(%s, %s) = %v, want %v", tt.project, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSetMCPProjectServers(t *testing.T) {
+	cfg := DefaultConfig("")
+	if got := cfg.MCPProjectServers(); got != MCPProjectLocal {
+		t.Fatalf("default mode = %s", got)
+	}
+
+	for _, mode := range []string{MCPProjectProject, MCPProjectPromote, MCPProjectLocal, MCPProjectProject} {
+		if err := cfg.Set("mcp_project_servers", mode); err != nil {
+			t.Fatalf("set %s: %v", mode, err)
+		}
+		if got := cfg.MCPProjectServers(); got != mode {
+			t.Errorf("after set %s: mode = %s", mode, got)
+		}
+	}
+	item := cfg.FindItem("claude-json")
+	if !contains(item.Filter.IncludeFields, ProjectMCPField) || len(cfg.PromoteMCPProjects) != 0 {
+		t.Errorf("include_fields = %v, promote_mcp_projects = %v", item.Filter.IncludeFields, cfg.PromoteMCPProjects)
+	}
+	if err := cfg.Set("mcp_project_servers", "flatten"); err == nil {
+		t.Error("unknown mode accepted")
+	}
+
+	// 条目按 ~/.claude.json 路径查找，重命名不影响
+	item.Name = "my-claude"
+	if got := cfg.MCPProjectServers(); got != MCPProjectProject {
+		t.Errorf("renamed item: mode = %s", got)
+	}
+	if err := cfg.SetMCPProjectServers(MCPProjectLocal); err != nil || contains(item.Filter.IncludeFields, ProjectMCPField) {
+		t.Errorf("renamed item: err = %v, include_fields = %v", err, item.Filter.IncludeFields)
+	}
+}
@@ -0,0 +1,363 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/yxuechao007/claude_sync/internal/fileutil"
+	"github.com/yxuechao007/claude_sync/internal/merge"
+)
+
+// ConfigSchemaVersion is the schema version written by this build
+const ConfigSchemaVersion = 7
+
+// StateSchemaVersion is the state.json schema version written by this build
+const StateSchemaVersion = 1
+
+// configMigration upgrades a config from version-1 to version.
+// apply returns a human-readable line for every change it made.
+type configMigration struct {
+	version     int
+	description string
+	apply       func(*Config) []string
+}
+
+type stateMigration struct {
+	version     int
+	description string
+	apply       func(*SyncState) []string
+}
+
+// configMigrations must stay ordered by version; never edit a released one,
+// add a new version instead.
+var configMigrations = []configMigration{
+	{
+		version:     1,
+		description: "补充新版本加入的默认同步项",
+		apply: func(c *Config) []string {
+			var changes []string
+			// 固定为 v1 时的默认条目；之后新增的默认条目需要新的迁移
+			v1Items := []string{
+				"settings", "output-styles", "plans", "todos", "claude-json", "plugins-list",
+				"skills", "claude-md", "agents", "commands", "plugins-installed",
+			}
+			for _, name := range c.AddDefaultItems(v1Items) {
+				changes = append(changes, fmt.Sprintf("add sync item %q", name))
+			}
+			return changes
+		},
+	},
+	{
+		version:     2,
+		description: "补充缺失的顶层默认值",
+		apply: func(c *Config) []string {
+			var changes []string
+			defaults := DefaultConfig(c.GistID)
+			if c.ConflictStrategy == "" {
+				c.ConflictStrategy = defaults.ConflictStrategy
+				changes = append(changes, fmt.Sprintf("set conflict_strategy to %q", c.ConflictStrategy))
+			}
+			if c.GitHubTokenEnv == "" {
+				c.GitHubTokenEnv = defaults.GitHubTokenEnv
+				changes = append(changes, fmt.Sprintf("set github_token_env to %q", c.GitHubTokenEnv))
+			}
+			return changes
+		},
+	},
+	{
+		version:     3,
+		description: "为 settings 添加默认的 permissions 合并规则",
+		apply: func(c *Config) []string {
+			item := c.FindItem("settings")
+			if item == nil || item.MergeRules != nil {
+				return nil
+			}
+			item.MergeRules = map[string]string{
+				"permissions.allow": "union-arrays",
+				"permissions.deny":  "union-arrays",
+				"permissions.ask":   "union-arrays",
+			}
+			return []string{"add merge_rules to \"settings\": permissions.allow/deny/ask union-arrays"}
+		},
+	},
+	{
+		version:     4,
+		description: "permissions 列表改为带增删历史的 synced-set",
+		apply: func(c *Config) []string {
+			item := c.FindItem("settings")
+			if item == nil {
+				return nil
+			}
+			var changes []string
+			for _, path := range PermissionPaths {
+				// 只替换旧的默认值，用户自定义的规则保持不变
+				if item.MergeRules[path] == "union-arrays" {
+					item.MergeRules[path] = "synced-set"
+					changes = append(changes, fmt.Sprintf("settings merge rule %s: union-arrays → synced-set", path))
+				}
+			}
+			return changes
+		},
+	},
+	{
+		version:     5,
+		description: "设备特定内容检测改为可配置的 local_patterns 和 local_actions",
+		apply: func(c *Config) []string {
+			var changes []string
+			if len(c.LocalPatterns) == 0 {
+				c.LocalPatterns = DefaultLocalPatterns()
+				changes = append(changes, fmt.Sprintf("add %d default local_patterns", len(c.LocalPatterns)))
+			}
+			// 之前的版本固定过滤 settings 中包含本地内容的 hooks
+			if item := c.FindItem("settings"); item != nil && item.LocalActions == nil {
+				item.LocalActions = DefaultSettingsLocalActions()
+				changes = append(changes, "add local_actions to \"settings\": hooks.* exclude")
+			}
+			return changes
+		},
+	},
+	{
+		version:     6,
+		description: "MCP server 和 hooks 的合并改由 merge_rules 的 mcp-servers、hooks 策略选择",
+		apply: func(c *Config) []string {
+			var changes []string
+			for i := range c.SyncItems {
+				item := &c.SyncItems[i]
+				if item.Type == "directory" {
+					continue
+				}
+				// 之前的版本按条目名或文件名固定做这两种合并
+				var rules map[string]string
+				if item.Name == "claude-json" || filepath.Base(item.LocalPath) == ".claude.json" {
+					rules = DefaultClaudeJSONMergeRules()
+				} else if item.Name == "settings" {
+					rules = map[string]string{HooksField: string(merge.Hooks)}
+				}
+				for _, path := range sortedKeys(rules) {
+					if _, ok := item.MergeRules[path]; ok {
+						continue
+					}
+					if item.MergeRules == nil {
+						item.MergeRules = make(map[string]string)
+					}
+					item.MergeRules[path] = rules[path]
+					changes = append(changes, fmt.Sprintf("%s merge rule %s: %s", item.Name, path, rules[path]))
+				}
+			}
+			return changes
+		},
+	},
+	{
+		version:     7,
+		description: "plans 和 todos 改为默认禁用",
+		apply: func(c *Config) []string {
+			var changes []string
+			// 早期版本默认启用这两个条目；只修改仍与旧默认值完全一致的条目
+			for _, old := range []SyncItem{
+				{Name: "plans", LocalPath: "~/.claude/plans", GistFile: "plans.tar.gz", Type: "directory"},
+				{Name: "todos", LocalPath: "~/.claude/todos", GistFile: "todos.tar.gz", Type: "directory"},
+			} {
+				item := c.FindItem(old.Name)
+				if item == nil || !item.Enabled || item.LocalPath != old.LocalPath || item.GistFile != old.GistFile ||
+					item.Type != old.Type || item.Filter != nil || item.MergeRules != nil || item.LocalActions != nil {
+					continue
+				}
+				item.Enabled = false
+				changes = append(changes, fmt.Sprintf("disable %q (old default; run 'claude_sync config enable %s' to keep syncing it)", old.Name, old.Name))
+			}
+			return changes
+		},
+	},
+}
+
+var stateMigrations = []stateMigration{
+	{
+		version:     1,
+		description: "移除没有 hash 记录的条目",
+		apply: func(s *SyncState) []string {
+			var changes []string
+			for name, item := range s.Items {
+				if item.LocalHash == "" && item.RemoteHash == "" {
+					delete(s.Items, name)
+					changes = append(changes, fmt.Sprintf("drop empty state for %q", name))
+				}
+			}
+			return changes
+		},
+	},
+}
+
+// MigrationResult describes the migrations applied (or pending) for one file
+type MigrationResult struct {
+	File    string   // config.json 或 state.json
+	From    int      // 迁移前的 schema 版本
+	To      int      // 迁移后的 schema 版本
+	Steps   []string // 每个迁移步骤的描述
+	Changes []string // 具体修改
+	Backup  string   // 旧文件的备份路径，dry-run 时为空
+}
+
+// Pending reports whether the file needed migrating
+func (r MigrationResult) Pending() bool {
+	return r.From < r.To
+}
+
+func migrateConfig(c *Config) (MigrationResult, error) {
+	result := MigrationResult{File: ConfigFile, From: c.SchemaVersion, To: c.SchemaVersion}
+	if c.SchemaVersion > ConfigSchemaVersion {
+		return result, fmt.Errorf("config schema_version %d is newer than this claude_sync supports (%d), please upgrade", c.SchemaVersion, ConfigSchemaVersion)
+	}
+	for _, m := range configMigrations {
+		if m.version <= c.SchemaVersion {
+			continue
+		}
+		result.Steps = append(result.Steps, fmt.Sprintf("v%d: %s", m.version, m.description))
+		result.Changes = append(result.Changes, m.apply(c)...)
+		c.SchemaVersion = m.version
+	}
+	result.To = c.SchemaVersion
+	return result, nil
+}
+
+func migrateState(s *SyncState) (MigrationResult, error) {
+	result := MigrationResult{File: StateFile, From: s.SchemaVersion, To: s.SchemaVersion}
+	if s.SchemaVersion > StateSchemaVersion {
+		return result, fmt.Errorf("state schema_version %d is newer than this claude_sync supports (%d), please upgrade", s.SchemaVersion, StateSchemaVersion)
+	}
+	for _, m := range stateMigrations {
+		if m.version <= s.SchemaVersion {
+			continue
+		}
+		result.Steps = append(result.Steps, fmt.Sprintf("v%d: %s", m.version, m.description))
+		result.Changes = append(result.Changes, m.apply(s)...)
+		s.SchemaVersion = m.version
+	}
+	result.To = s.SchemaVersion
+	return result, nil
+}
+
+// backupFile copies the file about to be migrated to
+// <path>.v<version>.<timestamp>.bak, never overwriting an earlier backup
+// (e.g. one taken before a downgrade and re-migration)
+func backupFile(path string, data []byte, version int) (string, error) {
+	return fileutil.Backup(fmt.Sprintf("%s.v%d", path, version), data)
+}
+
+// Migrate runs pending migrations on config.json and state.json.
+// With dryRun it only reports what would change and writes nothing.
+// Load and LoadState run the same migrations automatically.
+func Migrate(dryRun bool) ([]MigrationResult, error) {
+	var results []MigrationResult
+
+	cfg, data, err := readConfig()
+	if err != nil {
+		return nil, err
+	}
+	result, err := migrateConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if result.Pending() && !dryRun {
+		if result.Backup, err = saveMigratedConfig(cfg, data, result.From); err != nil {
+			return nil, err
+		}
+	}
+	results = append(results, result)
+
+	state, data, err := readState()
+	if err != nil {
+		return nil, err
+	}
+	result, err = migrateState(state)
+	if err != nil {
+		return nil, err
+	}
+	if result.Pending() && !dryRun && data != nil {
+		if result.Backup, err = saveMigratedState(state, data, result.From); err != nil {
+			return nil, err
+		}
+	}
+	results = append(results, result)
+
+	return results, nil
+}
+
+func saveMigratedConfig(cfg *Config, original []byte, from int) (string, error) {
+	path, err := GetConfigPath()
+	if err != nil {
+		return "", err
+	}
+	backup, err := backupFile(path, original, from)
+	if err != nil {
+		return "", err
+	}
+	if err := cfg.Save(); err != nil {
+		return "", err
+	}
+	return backup, nil
+}
+
+func saveMigratedState(state *SyncState, original []byte, from int) (string, error) {
+	path, err := GetStatePath()
+	if err != nil {
+		return "", err
+	}
+	backup, err := backupFile(path, original, from)
+	if err != nil {
+		return "", err
+	}
+	if err := state.Save(); err != nil {
+		return "", err
+	}
+	return backup, nil
+}
+
+// readConfig reads config.json without migrating it
+func readConfig() (*Config, []byte, error) {
+	path, err := GetConfigPath()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, fmt.Errorf("config not found, run 'claude_sync init' first")
+		}
+		return nil, nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	return &cfg, data, nil
+}
+
+// readState reads state.json without migrating it.
+// A missing state file yields an empty, current-version state and nil data.
+func readState() (*SyncState, []byte, error) {
+	path, err := GetStatePath()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &SyncState{Items: make(map[string]ItemState), SchemaVersion: StateSchemaVersion}, nil, nil
+		}
+		return nil, nil, fmt.Errorf("failed to read state: %w", err)
+	}
+
+	var state SyncState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse state: %w", err)
+	}
+	if state.Items == nil {
+		state.Items = make(map[string]ItemState)
+	}
+	return &state, data, nil
+}
@@ -0,0 +1,241 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestConfig(t *testing.T, home string, content string) string {
+	t.Helper()
+	dir := filepath.Join(home, ConfigDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	path := filepath.Join(dir, ConfigFile)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+// migrationBackups lists the backups taken of path before migrating from version
+func migrationBackups(t *testing.T, path string, version int) []string {
+	t.Helper()
+	backups, err := filepath.Glob(fmt.Sprintf("%s.v%d.*.bak", path, version))
+	if err != nil {
+		t.Fatalf("glob: %v", err)
+	}
+	return backups
+}
+
+const legacyConfig = `{
+  "gist_id": "abc",
+  "sync_items": [
+    {"name": "settings", "local_path": "~/.claude/settings.json", "gist_file": "settings.json", "enabled": true}
+  ]
+}`
+
+func TestMigrateDryRunWritesNothing(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	path := writeTestConfig(t, home, legacyConfig)
+
+	results, err := Migrate(true)
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if !results[0].Pending() || results[0].From != 0 || results[0].To != ConfigSchemaVersion {
+		t.Fatalf("config result = %+v, want pending 0 → %d", results[0], ConfigSchemaVersion)
+	}
+	if len(results[0].Changes) == 0 {
+		t.Fatalf("expected changes in dry run")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read config: %v", err)
+	}
+	if string(data) != legacyConfig {
+		t.Fatalf("dry run modified config")
+	}
+	if backups := migrationBackups(t, path, 0); len(backups) != 0 {
+		t.Fatalf("dry run created a backup: %v", backups)
+	}
+}
+
+func TestLoadMigratesAndBacksUp(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	path := writeTestConfig(t, home, legacyConfig)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.SchemaVersion != ConfigSchemaVersion {
+		t.Fatalf("SchemaVersion = %d, want %d", cfg.SchemaVersion, ConfigSchemaVersion)
+	}
+	if cfg.ConflictStrategy != "ask" || cfg.GitHubTokenEnv != "GITHUB_TOKEN" {
+		t.Fatalf("top-level defaults not filled: %+v", cfg)
+	}
+
+	backups := migrationBackups(t, path, 0)
+	if len(backups) != 1 {
+		t.Fatalf("backups = %v, want one", backups)
+	}
+	backup, err := os.ReadFile(backups[0])
+	if err != nil {
+		t.Fatalf("backup missing: %v", err)
+	}
+	if string(backup) != legacyConfig {
+		t.Fatalf("backup does not match original config")
+	}
+
+	var saved Config
+	data, _ := os.ReadFile(path)
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("parse saved config: %v", err)
+	}
+	if saved.SchemaVersion != ConfigSchemaVersion || len(saved.SyncItems) <= 1 {
+		t.Fatalf("migrated config not saved: version=%d items=%d", saved.SchemaVersion, len(saved.SyncItems))
+	}
+
+	// 已是最新版本时不再迁移
+	results, err := Migrate(false)
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if results[0].Pending() {
+		t.Fatalf("config still pending after Load: %+v", results[0])
+	}
+
+	// 降级后再次迁移不覆盖之前的备份
+	writeTestConfig(t, home, legacyConfig)
+	if _, err := Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if backups := migrationBackups(t, path, 0); len(backups) != 2 {
+		t.Fatalf("backups = %v, want both kept", backups)
+	}
+}
+
+func TestLoadRejectsNewerSchema(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	writeTestConfig(t, home, `{"schema_version": 999, "gist_id": "abc"}`)
+
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for newer schema version")
+	}
+}
+
+func TestLoadStateMigration(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	writeTestConfig(t, home, legacyConfig)
+	statePath := filepath.Join(home, ConfigDir, StateFile)
+	legacyState := `{"items": {"settings": {"local_hash": "a", "remote_hash": "a"}, "stale": {"local_hash": "", "remote_hash": ""}}}`
+	if err := os.WriteFile(statePath, []byte(legacyState), 0600); err != nil {
+		t.Fatalf("write state: %v", err)
+	}
+
+	state, err := LoadState()
+	if err != nil {
+		t.Fatalf("LoadState: %v", err)
+	}
+	if state.SchemaVersion != StateSchemaVersion {
+		t.Fatalf("SchemaVersion = %d, want %d", state.SchemaVersion, StateSchemaVersion)
+	}
+	if _, ok := state.Items["stale"]; ok {
+		t.Fatalf("empty state entry not dropped")
+	}
+	if _, ok := state.Items["settings"]; !ok {
+		t.Fatalf("settings state lost")
+	}
+	if backups := migrationBackups(t, statePath, 0); len(backups) != 1 {
+		t.Fatalf("state backups = %v, want one", backups)
+	}
+}
+
+func TestMigrateV4SwitchesPermissionRulesToSyncedSet(t *testing.T) {
+	cfg := &Config{
+		SchemaVersion: 3,
+		SyncItems: []SyncItem{{
+			Name: "settings",
+			MergeRules: map[string]string{
+				"permissions.allow": "union-arrays",
+				"permissions.deny":  "prefer-local",
+			},
+		}},
+	}
+	result, err := migrateConfig(cfg)
+	if err != nil {
+		t.Fatalf("migrateConfig: %v", err)
+	}
+	if result.From != 3 || result.To != ConfigSchemaVersion || !strings.Contains(strings.Join(result.Changes, "\n"), "permissions.allow: union-arrays → synced-set") {
+		t.Fatalf("result = %+v", result)
+	}
+	rules := cfg.SyncItems[0].MergeRules
+	// 只替换旧默认值，自定义规则不变
+	if rules["permissions.allow"] != "synced-set" || rules["permissions.deny"] != "prefer-local" {
+		t.Fatalf("rules = %v", rules)
+	}
+}
+
+func TestMigrateV6DeclaresMCPAndHooksRules(t *testing.T) {
+	cfg := &Config{
+		SchemaVersion: 5,
+		SyncItems: []SyncItem{
+			{Name: "settings", LocalPath: "~/.claude/settings.json", Type: "file"},
+			{Name: "my-claude", LocalPath: "~/.claude.json", Type: "file", MergeRules: map[string]string{"mcpServers": "prefer-local"}},
+			{Name: "notes", LocalPath: "~/notes.json", Type: "file"},
+		},
+	}
+	if _, err := migrateConfig(cfg); err != nil {
+		t.Fatalf("migrateConfig: %v", err)
+	}
+	if got := cfg.SyncItems[0].MergeRules["hooks"]; got != "hooks" {
+		t.Fatalf("settings hooks rule = %q, want hooks", got)
+	}
+	// 重命名的条目按文件名识别，已有的规则保持不变
+	rules := cfg.SyncItems[1].MergeRules
+	if rules["mcpServers"] != "prefer-local" || rules[ProjectMCPField] != "mcp-servers" {
+		t.Fatalf("claude.json rules = %v", rules)
+	}
+	if cfg.SyncItems[2].MergeRules != nil {
+		t.Fatalf("unrelated item got rules: %v", cfg.SyncItems[2].MergeRules)
+	}
+}
+
+func TestMigrateV7DisablesOldDefaultPlansAndTodos(t *testing.T) {
+	cfg := &Config{
+		SchemaVersion: 6,
+		SyncItems: []SyncItem{
+			{Name: "plans", LocalPath: "~/.claude/plans", GistFile: "plans.tar.gz", Enabled: true, Type: "directory"},
+			// 用户改过的条目不是旧默认值，保持启用
+			{Name: "todos", LocalPath: "~/work/todos", GistFile: "todos.tar.gz", Enabled: true, Type: "directory"},
+		},
+	}
+	result, err := migrateConfig(cfg)
+	if err != nil {
+		t.Fatalf("migrateConfig: %v", err)
+	}
+	if cfg.SyncItems[0].Enabled || !cfg.SyncItems[1].Enabled {
+		t.Fatalf("enabled = %v, %v; want false, true", cfg.SyncItems[0].Enabled, cfg.SyncItems[1].Enabled)
+	}
+	if len(result.Changes) != 1 || !strings.Contains(result.Changes[0], `disable "plans"`) {
+		t.Fatalf("changes = %v", result.Changes)
+	}
+}
+
+func TestMigrateV1AddsOnlyItsOwnDefaults(t *testing.T) {
+	cfg := &Config{SyncItems: []SyncItem{{Name: "settings", LocalPath: "~/.claude/settings.json", GistFile: "settings.json", Enabled: true}}}
+	added := cfg.AddDefaultItems([]string{"skills", "not-a-default"})
+	if len(added) != 1 || added[0] != "skills" || len(cfg.SyncItems) != 2 {
+		t.Fatalf("added = %v, items = %d", added, len(cfg.SyncItems))
+	}
+}
@@ -0,0 +1,276 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/yxuechao007/claude_sync/internal/jsonpath"
+	"github.com/yxuechao007/claude_sync/internal/merge"
+)
+
+// reservedGistFiles are gist files managed by claude_sync itself
+var reservedGistFiles = map[string]bool{
+	"claude_sync.meta.json":   true,
+	"claude_sync.ledger.json": true,
+}
+
+// Severity of a validation issue
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Issue is a single problem found by Validate
+type Issue struct {
+	Severity Severity
+	Item     string // 为空表示顶层配置
+	Message  string
+}
+
+func (i Issue) String() string {
+	if i.Item == "" {
+		return fmt.Sprintf("%s: %s", i.Severity, i.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", i.Severity, i.Item, i.Message)
+}
+
+// HasErrors reports whether any issue is an error (warnings don't count)
+func HasErrors(issues []Issue) bool {
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the config for mistakes that usually come from editing
+// config.json by hand: duplicate names or gist files, missing local paths,
+// type/path disagreement and filters that cannot work.
+func (c *Config) Validate() []Issue {
+	var issues []Issue
+	add := func(severity Severity, item, format string, args ...interface{}) {
+		issues = append(issues, Issue{Severity: severity, Item: item, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if c.ConflictStrategy != "" && !contains(ConflictStrategies, c.ConflictStrategy) {
+		add(SeverityError, "", "invalid conflict_strategy %q, expected one of %s", c.ConflictStrategy, strings.Join(ConflictStrategies, ", "))
+	}
+	if c.GitHubTokenEnv == "" {
+		add(SeverityWarning, "", "github_token_env is empty")
+	}
+
+	names := make(map[string]bool)
+	gistFiles := make(map[string]string)
+	for _, item := range c.SyncItems {
+		label := item.Name
+		if item.Name == "" {
+			label = item.LocalPath
+			add(SeverityError, label, "name is empty")
+		} else if names[item.Name] {
+			add(SeverityError, label, "duplicate item name")
+		}
+		names[item.Name] = true
+
+		switch {
+		case item.GistFile == "":
+			add(SeverityError, label, "gist_file is empty")
+		case strings.ContainsAny(item.GistFile, `/\`):
+			add(SeverityError, label, "gist_file %q cannot contain path separators", item.GistFile)
+		case reservedGistFiles[item.GistFile]:
+			add(SeverityError, label, "gist_file %q is reserved by claude_sync", item.GistFile)
+		case gistFiles[item.GistFile] != "":
+			add(SeverityError, label, "gist_file %q is also used by %s", item.GistFile, gistFiles[item.GistFile])
+		default:
+			gistFiles[item.GistFile] = label
+		}
+
+		issues = append(issues, validateItemPath(item, label)...)
+		issues = append(issues, validateFilter(item, label)...)
+		issues = append(issues, validateMergeRules(item, label)...)
+		issues = append(issues, validateLocalActions(item, label)...)
+	}
+
+	issues = append(issues, validateLocalPatterns(c.LocalPatterns)...)
+	issues = append(issues, validateProjectMappings(c.ProjectMappings)...)
+	issues = append(issues, validateMCPServerRules(c.MCPServers)...)
+	issues = append(issues, validatePromoteMCPProjects(c.PromoteMCPProjects)...)
+	return issues
+}
+
+func validateItemPath(item SyncItem, label string) []Issue {
+	var issues []Issue
+	add := func(severity Severity, format string, args ...interface{}) {
+		issues = append(issues, Issue{Severity: severity, Item: label, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if item.Type != "" && item.Type != "file" && item.Type != "directory" {
+		add(SeverityError, "invalid type %q, expected file or directory", item.Type)
+		return issues
+	}
+	if item.Type == "directory" && !strings.HasSuffix(item.GistFile, ".tar.gz") {
+		add(SeverityWarning, "directory item gist_file %q should end with .tar.gz", item.GistFile)
+	}
+	if item.LocalPath == "" {
+		add(SeverityError, "local_path is empty")
+		return issues
+	}
+
+	path, err := ExpandPath(item.LocalPath)
+	if err != nil {
+		add(SeverityError, "cannot expand local_path: %v", err)
+		return issues
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// 缺失的路径在 pull 时会被创建，只在启用时提醒
+			if item.Enabled {
+				add(SeverityWarning, "local_path %s does not exist", item.LocalPath)
+			}
+		} else {
+			add(SeverityError, "cannot stat local_path: %v", err)
+		}
+		return issues
+	}
+
+	switch {
+	case item.Type == "directory" && !info.IsDir():
+		add(SeverityError, "type is directory but %s is a file", item.LocalPath)
+	case item.Type != "directory" && info.IsDir():
+		add(SeverityError, "type is file but %s is a directory", item.LocalPath)
+	}
+	return issues
+}
+
+func validateFilter(item SyncItem, label string) []Issue {
+	if item.Filter == nil {
+		return nil
+	}
+
+	var issues []Issue
+	add := func(severity Severity, format string, args ...interface{}) {
+		issues = append(issues, Issue{Severity: severity, Item: label, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if item.Type == "directory" {
+		add(SeverityError, "filter is only supported on JSON file items")
+		return issues
+	}
+	if ext := strings.ToLower(filepath.Ext(item.LocalPath)); ext != ".json" {
+		add(SeverityWarning, "filter on %s: only JSON files can be filtered", item.LocalPath)
+	}
+	if len(item.Filter.IncludeFields) == 0 && len(item.Filter.ExcludeFields) == 0 {
+		add(SeverityWarning, "filter has no include_fields or exclude_fields")
+	}
+
+	check := func(kind string, fields []string) {
+		seen := make(map[string]bool)
+		for _, field := range fields {
+			if strings.TrimSpace(field) == "" {
+				add(SeverityError, "%s contains an empty field", kind)
+				continue
+			}
+			if _, err := jsonpath.Parse(field); err != nil {
+				add(SeverityError, "%s: %v", kind, err)
+			}
+			if seen[field] {
+				add(SeverityWarning, "%s lists %q more than once", kind, field)
+			}
+			seen[field] = true
+		}
+	}
+	check("include_fields", item.Filter.IncludeFields)
+	check("exclude_fields", item.Filter.ExcludeFields)
+
+	return issues
+}
+
+func validateMergeRules(item SyncItem, label string) []Issue {
+	if len(item.MergeRules) == 0 {
+		return nil
+	}
+
+	var issues []Issue
+	add := func(severity Severity, format string, args ...interface{}) {
+		issues = append(issues, Issue{Severity: severity, Item: label, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if item.Type == "directory" {
+		add(SeverityError, "merge_rules are only supported on JSON file items")
+		return issues
+	}
+	for _, path := range sortedKeys(item.MergeRules) {
+		if _, err := jsonpath.Parse(path); err != nil {
+			add(SeverityError, "merge_rules: %v", err)
+		}
+		if strategy := item.MergeRules[path]; !merge.ValidStrategy(strategy) {
+			add(SeverityError, "merge_rules: unknown strategy %q for %s", strategy, path)
+		}
+	}
+	return issues
+}
+
+func validateLocalActions(item SyncItem, label string) []Issue {
+	var issues []Issue
+	for _, path := range sortedKeys(item.LocalActions) {
+		if _, err := jsonpath.Parse(path); err != nil {
+			issues = append(issues, Issue{Severity: SeverityError, Item: label, Message: fmt.Sprintf("local_actions: %v", err)})
+		}
+		if action := item.LocalActions[path]; !contains(LocalActions, action) {
+			issues = append(issues, Issue{Severity: SeverityError, Item: label, Message: fmt.Sprintf("local_actions: unknown action %q for %s, expected one of %s", action, path, strings.Join(LocalActions, ", "))})
+		}
+	}
+	if len(item.LocalActions) > 0 && item.Type == "directory" {
+		issues = append(issues, Issue{Severity: SeverityWarning, Item: label, Message: "local_actions have no effect on directory items, matches are only reported"})
+	}
+	return issues
+}
+
+func validateLocalPatterns(patterns []LocalPattern) []Issue {
+	var issues []Issue
+	names := make(map[string]bool)
+	for _, p := range patterns {
+		switch {
+		case p.Name == "":
+			issues = append(issues, Issue{Severity: SeverityError, Message: fmt.Sprintf("local_patterns: pattern %q has no name", p.Regex)})
+		case names[p.Name]:
+			issues = append(issues, Issue{Severity: SeverityError, Message: fmt.Sprintf("local_patterns: duplicate name %q", p.Name)})
+		}
+		names[p.Name] = true
+		if _, err := regexp.Compile(p.Regex); err != nil {
+			issues = append(issues, Issue{Severity: SeverityError, Message: fmt.Sprintf("local_patterns: %s: %v", p.Name, err)})
+		}
+	}
+	return issues
+}
+
+func validateProjectMappings(mappings []ProjectMapping) []Issue {
+	var issues []Issue
+	seen := make(map[string]bool)
+	for _, m := range mappings {
+		switch {
+		case m.From == "" || m.To == "":
+			issues = append(issues, Issue{Severity: SeverityError, Message: fmt.Sprintf("project_mappings: %q → %q needs both from and to", m.From, m.To)})
+		case seen[m.From]:
+			issues = append(issues, Issue{Severity: SeverityError, Message: fmt.Sprintf("project_mappings: duplicate from %q", m.From)})
+		}
+		seen[m.From] = true
+	}
+	return issues
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
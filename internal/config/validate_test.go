@@ -0,0 +1,105 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func issueMessages(issues []Issue) string {
+	var lines []string
+	for _, issue := range issues {
+		lines = append(lines, issue.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestValidateFindsCommonMistakes(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "settings.json")
+	if err := os.WriteFile(file, []byte("{}"), 0600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	cfg := &Config{
+		GitHubTokenEnv:   "GITHUB_TOKEN",
+		ConflictStrategy: "sometimes",
+		SyncItems: []SyncItem{
+			{Name: "settings", LocalPath: file, GistFile: "settings.json", Enabled: true, Type: "file"},
+			{Name: "copy", LocalPath: file, GistFile: "settings.json", Enabled: true, Type: "directory"},
+			{Name: "skills", LocalPath: dir, GistFile: "skills.tar.gz", Enabled: true, Type: "file"},
+			{Name: "filtered", LocalPath: file, GistFile: "filtered.json", Enabled: true,
+				Filter: &FilterConfig{IncludeFields: []string{"a", ""}, ExcludeFields: []string{"b..c"}}},
+			{Name: "meta", LocalPath: file, GistFile: "claude_sync.meta.json", Enabled: true},
+		},
+	}
+
+	issues := cfg.Validate()
+	if !HasErrors(issues) {
+		t.Fatalf("expected errors, got:\n%s", issueMessages(issues))
+	}
+
+	got := issueMessages(issues)
+	for _, want := range []string{
+		"invalid conflict_strategy",
+		`copy: gist_file "settings.json" is also used by settings`,
+		"copy: type is directory but",
+		"skills: type is file but",
+		"filtered: include_fields contains an empty field",
+		`filtered: exclude_fields: invalid path "b..c": empty segment`,
+		"meta: gist_file \"claude_sync.meta.json\" is reserved",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("missing issue %q in:\n%s", want, got)
+		}
+	}
+}
+
+func TestValidateDefaultConfigHasNoErrors(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if issues := DefaultConfig("abc").Validate(); HasErrors(issues) {
+		t.Fatalf("default config has errors:\n%s", issueMessages(issues))
+	}
+}
+
+func TestConfigEditing(t *testing.T) {
+	cfg := DefaultConfig("abc")
+
+	if err := cfg.Set("conflict_strategy", "remote"); err != nil || cfg.ConflictStrategy != "remote" {
+		t.Fatalf("Set conflict_strategy: %v", err)
+	}
+	if err := cfg.Set("conflict_strategy", "bogus"); err == nil {
+		t.Fatalf("expected error for invalid conflict_strategy")
+	}
+	if err := cfg.Set("skills.local_path", "~/other/skills"); err != nil || cfg.FindItem("skills").LocalPath != "~/other/skills" {
+		t.Fatalf("Set item key: %v", err)
+	}
+
+	if err := cfg.AddFilterField("settings", false, "env.FOO"); err != nil {
+		t.Fatalf("AddFilterField: %v", err)
+	}
+	if err := cfg.AddFilterField("settings", false, "env.FOO"); err == nil {
+		t.Fatalf("expected duplicate filter field error")
+	}
+	if err := cfg.RemoveFilterField("settings", false, "env.FOO"); err != nil {
+		t.Fatalf("RemoveFilterField: %v", err)
+	}
+
+	item, err := NewItem("notes", "~/notes", "directory", "")
+	if err != nil || item.GistFile != "notes.tar.gz" {
+		t.Fatalf("NewItem = %+v, %v", item, err)
+	}
+	if err := cfg.AddItem(item); err != nil {
+		t.Fatalf("AddItem: %v", err)
+	}
+	if err := cfg.AddItem(item); err == nil {
+		t.Fatalf("expected duplicate item error")
+	}
+	if err := cfg.SetEnabled("notes", false); err != nil || cfg.FindItem("notes").Enabled {
+		t.Fatalf("SetEnabled: %v", err)
+	}
+	if err := cfg.RemoveItem("notes"); err != nil || cfg.FindItem("notes") != nil {
+		t.Fatalf("RemoveItem: %v", err)
+	}
+}
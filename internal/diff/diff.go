@@ -27,58 +27,111 @@ const (
 	ConfirmPreview                      // 预览完整内容
 )
 
+// Mode 差异显示模式
+type Mode int
+
+const (
+	ModeAuto     Mode = iota // 两边都是 JSON 时使用语义 diff，否则使用 unified diff
+	ModeUnified              // 基于行的 unified diff
+	ModeSemantic             // 基于 key 路径的 JSON 语义 diff
+)
+
 // ShowDiff 显示两个字符串的差异
 func ShowDiff(filename, oldContent, newContent string) {
+	ShowDiffMode(filename, oldContent, newContent, ModeAuto)
+}
+
+// ShowDiffMode 按指定模式显示两个字符串的差异
+func ShowDiffMode(filename, oldContent, newContent string, mode Mode) {
 	fmt.Println()
 	fmt.Printf("%s━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━%s\n", colorCyan, colorReset)
 	fmt.Printf("%s文件: %s%s\n", colorYellow, filename, colorReset)
 	fmt.Printf("%s━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━%s\n", colorCyan, colorReset)
 
-	oldLines := strings.Split(oldContent, "\n")
-	newLines := strings.Split(newContent, "\n")
+	fmt.Print(RenderDiff(oldContent, newContent, mode, true))
+
+	fmt.Printf("%s━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━%s\n", colorCyan, colorReset)
+}
 
-	// 简单的逐行对比
-	maxLines := len(oldLines)
-	if len(newLines) > maxLines {
-		maxLines = len(newLines)
+// RenderDiff 渲染差异文本，color 为 true 时带 ANSI 颜色
+func RenderDiff(oldContent, newContent string, mode Mode, color bool) string {
+	useSemantic := mode == ModeSemantic
+	if mode == ModeAuto {
+		useSemantic = IsJSON([]byte(oldContent)) && IsJSON([]byte(newContent))
+	}
+	if useSemantic {
+		if out, err := renderSemantic(oldContent, newContent, color); err == nil {
+			return out
+		}
 	}
+	return renderUnified(oldContent, newContent, color)
+}
 
-	// 限制显示行数
-	displayLimit := 30
-	changes := 0
-	displayed := 0
+func renderSemantic(oldContent, newContent string, color bool) (string, error) {
+	changes, err := SemanticDiff([]byte(oldContent), []byte(newContent))
+	if err != nil {
+		return "", err
+	}
+	if len(changes) == 0 {
+		return paint(colorGray, "  (无语义差异)", color) + "\n", nil
+	}
 
-	for i := 0; i < maxLines && displayed < displayLimit; i++ {
-		var oldLine, newLine string
-		if i < len(oldLines) {
-			oldLine = oldLines[i]
-		}
-		if i < len(newLines) {
-			newLine = newLines[i]
+	var sb strings.Builder
+	for _, c := range changes {
+		lineColor := colorYellow
+		switch c.Kind {
+		case ChangeAdded:
+			lineColor = colorGreen
+		case ChangeRemoved:
+			lineColor = colorRed
 		}
+		sb.WriteString(paint(lineColor, FormatJSONChange(c), color) + "\n")
+	}
+	return sb.String(), nil
+}
 
-		if oldLine != newLine {
-			changes++
-			if oldLine != "" {
-				fmt.Printf("%s- %s%s\n", colorRed, truncateLine(oldLine, 80), colorReset)
-				displayed++
+func renderUnified(oldContent, newContent string, color bool) string {
+	hunks := Hunks(LineDiff(unifiedLines(oldContent), unifiedLines(newContent)), DefaultContext)
+	if len(hunks) == 0 {
+		return paint(colorGray, "  (内容相同)", color) + "\n"
+	}
+
+	var sb strings.Builder
+	for _, h := range hunks {
+		sb.WriteString(paint(colorCyan, h.Header(), color) + "\n")
+		for _, line := range h.Lines {
+			lineText, marked := splitMarker(line.Text)
+			text := linePrefix(line.Kind) + " " + lineText
+			switch line.Kind {
+			case OpInsert:
+				sb.WriteString(paint(colorGreen, text, color) + "\n")
+			case OpDelete:
+				sb.WriteString(paint(colorRed, text, color) + "\n")
+			default:
+				sb.WriteString(paint(colorGray, text, color) + "\n")
 			}
-			if newLine != "" {
-				fmt.Printf("%s+ %s%s\n", colorGreen, truncateLine(newLine, 80), colorReset)
-				displayed++
+			if marked {
+				sb.WriteString(paint(colorGray, noNewlineMarker, color) + "\n")
 			}
-		} else if changes > 0 && displayed < displayLimit {
-			// 显示上下文
-			fmt.Printf("%s  %s%s\n", colorGray, truncateLine(oldLine, 80), colorReset)
-			displayed++
 		}
 	}
+	return sb.String()
+}
 
-	if maxLines > displayLimit {
-		fmt.Printf("%s... 还有更多变更 ...%s\n", colorGray, colorReset)
+func paint(code, text string, color bool) string {
+	if !color {
+		return text
 	}
+	return code + text + colorReset
+}
 
+// ShowDirectoryChange 显示目录将被远端归档更新的提示
+func ShowDirectoryChange(dirname string) {
+	fmt.Println()
+	fmt.Printf("%s━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━%s\n", colorCyan, colorReset)
+	fmt.Printf("%s目录: %s%s\n", colorYellow, dirname, colorReset)
 	fmt.Printf("%s━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━%s\n", colorCyan, colorReset)
+	fmt.Printf("%s  目录内容将使用远端归档更新%s\n", colorGray, colorReset)
 }
 
 // ConfirmChange 询问用户是否确认修改
@@ -108,6 +161,24 @@ func ConfirmChange(filename string, autoYes bool) ConfirmResult {
 	}
 }
 
+// Confirm asks whether to apply newContent to filename until the user
+// decides: preview shows the full content and asks again, and "all" sets
+// *autoYes so that later changes apply without asking. It returns
+// ConfirmYes, ConfirmNo or ConfirmQuit.
+func Confirm(label, filename, newContent string, autoYes *bool) ConfirmResult {
+	for {
+		switch result := ConfirmChange(label, *autoYes); result {
+		case ConfirmAll:
+			*autoYes = true
+			return ConfirmYes
+		case ConfirmPreview:
+			ShowPreview(filename, newContent)
+		default:
+			return result
+		}
+	}
+}
+
 // ShowPreview 显示完整内容预览
 func ShowPreview(filename, content string) {
 	fmt.Printf("\n%s完整内容预览: %s%s\n", colorYellow, filename, colorReset)
@@ -123,8 +194,9 @@ func ShowPreview(filename, content string) {
 
 // truncateLine 截断过长的行
 func truncateLine(line string, maxLen int) string {
-	if len(line) > maxLen {
-		return line[:maxLen-3] + "..."
+	runes := []rune(line)
+	if len(runes) > maxLen {
+		return string(runes[:maxLen-3]) + "..."
 	}
 	return line
 }
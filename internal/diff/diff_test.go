@@ -0,0 +1,219 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLineDiffSingleInsertion(t *testing.T) {
+	old := []string{"a", "b", "c", "d"}
+	new := []string{"a", "x", "b", "c", "d"}
+
+	lines := LineDiff(old, new)
+	added, removed := CountChanges(lines)
+	if added != 1 || removed != 0 {
+		t.Fatalf("added=%d removed=%d, want 1 and 0", added, removed)
+	}
+	if lines[1].Kind != OpInsert || lines[1].Text != "x" {
+		t.Fatalf("lines[1] = %+v, want insert x", lines[1])
+	}
+}
+
+func TestUnifiedHunks(t *testing.T) {
+	var oldLines, newLines []string
+	for i := 1; i <= 20; i++ {
+		line := string(rune('a' + i - 1))
+		oldLines = append(oldLines, line)
+		if i == 10 {
+			newLines = append(newLines, "X")
+			continue
+		}
+		newLines = append(newLines, line)
+	}
+
+	out := Unified("local", "remote", strings.Join(oldLines, "\n"), strings.Join(newLines, "\n"), 3)
+	want := strings.Join([]string{
+		"--- local",
+		"+++ remote",
+		"@@ -7,7 +7,7 @@",
+		" g",
+		" h",
+		" i",
+		"-j",
+		"+X",
+		" k",
+		" l",
+		" m",
+		"",
+	}, "\n")
+	if out != want {
+		t.Fatalf("Unified =\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestUnifiedIdentical(t *testing.T) {
+	if out := Unified("a", "b", "same\n", "same\n", 3); out != "" {
+		t.Fatalf("Unified = %q, want empty", out)
+	}
+}
+
+func TestSemanticDiffIgnoresFormattingAndOrder(t *testing.T) {
+	old := []byte(`{"b": 1, "a": {"x": true}}`)
+	new := []byte("{\n  \"a\": {\"x\": true},\n  \"b\": 1\n}")
+
+	changes, err := SemanticDiff(old, new)
+	if err != nil {
+		t.Fatalf("SemanticDiff: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("changes = %v, want none", changes)
+	}
+}
+
+func TestSemanticDiffPaths(t *testing.T) {
+	old := []byte(`{"mcpServers":{"foo":{"args":["x","a"]}},"projects":{"/work/a":{}}}`)
+	new := []byte(`{"mcpServers":{"foo":{"args":["x","b"]},"bar":{}},"projects":{}}`)
+
+	changes, err := SemanticDiff(old, new)
+	if err != nil {
+		t.Fatalf("SemanticDiff: %v", err)
+	}
+
+	var got []string
+	for _, c := range changes {
+		got = append(got, FormatJSONChange(c))
+	}
+	want := []string{
+		`+ mcpServers.bar: {}`,
+		`~ mcpServers.foo.args[1]: "a" → "b"`,
+		`- projects["/work/a"]: {}`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("changes =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSideBySidePairsChanges(t *testing.T) {
+	rows := SideBySide(LineDiff([]string{"a", "b", "c"}, []string{"a", "B", "c", "d"}))
+	if len(rows) != 4 {
+		t.Fatalf("rows = %d, want 4", len(rows))
+	}
+	if rows[1].Left.Text != "b" || rows[1].Right.Text != "B" {
+		t.Fatalf("rows[1] = %v/%v, want b/B", rows[1].Left, rows[1].Right)
+	}
+	if rows[3].Left != nil || rows[3].Right.Text != "d" {
+		t.Fatalf("rows[3] = %v/%v, want nil/d", rows[3].Left, rows[3].Right)
+	}
+}
+
+// lcsLength 用动态规划计算最长公共子序列长度，作为最短编辑距离的参照
+func lcsLength(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func TestLineDiffIsMinimal(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, rng.Intn(12))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(4)))
+		}
+		return lines
+	}
+	for i := 0; i < 2000; i++ {
+		a, b := randomLines(), randomLines()
+		lines := LineDiff(a, b)
+
+		var gotA, gotB []string
+		for _, line := range lines {
+			if line.Kind != OpInsert {
+				gotA = append(gotA, line.Text)
+			}
+			if line.Kind != OpDelete {
+				gotB = append(gotB, line.Text)
+			}
+		}
+		if strings.Join(gotA, ",") != strings.Join(a, ",") || strings.Join(gotB, ",") != strings.Join(b, ",") {
+			t.Fatalf("LineDiff(%q, %q) does not reproduce the inputs: %+v", a, b, lines)
+		}
+		added, removed := CountChanges(lines)
+		if want := len(a) + len(b) - 2*lcsLength(a, b); added+removed != want {
+			t.Fatalf("LineDiff(%q, %q) uses %d edits, want %d", a, b, added+removed, want)
+		}
+	}
+}
+
+// largeInput 返回 n 行内容，另一份中每 every 行改动一行
+func largeInput(n, every int) ([]string, []string) {
+	a := make([]string, n)
+	b := make([]string, n)
+	for i := range a {
+		a[i] = fmt.Sprintf("line %d", i)
+		b[i] = a[i]
+		if i%every == 0 {
+			b[i] = fmt.Sprintf("changed %d", i)
+		}
+	}
+	return a, b
+}
+
+func TestLineDiffLargeInput(t *testing.T) {
+	// 旧实现每轮保存一份完整的状态数组，8k 行改动就占用数 GB 内存
+	a, b := largeInput(100000, 50)
+	added, removed := CountChanges(LineDiff(a, b))
+	if added != 2000 || removed != 2000 {
+		t.Fatalf("added=%d removed=%d, want 2000 each", added, removed)
+	}
+
+	// 超过搜索上限时退化为整段替换，但仍然能还原两边的内容
+	a, b = largeInput(40000, 2)
+	start := time.Now()
+	lines := LineDiff(a, b)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("LineDiff took %v", elapsed)
+	}
+	added, removed = CountChanges(lines)
+	if added < 20000 || added != removed || len(lines)-added != len(a) {
+		t.Fatalf("added=%d removed=%d lines=%d", added, removed, len(lines))
+	}
+}
+
+func BenchmarkLineDiffLarge(b *testing.B) {
+	old, new := largeInput(20000, 3)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		LineDiff(old, new)
+	}
+}
+
+func TestUnifiedTrailingNewline(t *testing.T) {
+	out := Unified("a", "b", "x\ny\n", "x\ny", 3)
+	want := "--- a\n+++ b\n@@ -1,2 +1,2 @@\n x\n-y\n+y\n\\ No newline at end of file\n"
+	if out != want {
+		t.Fatalf("Unified =\n%q\nwant\n%q", out, want)
+	}
+	if out := Unified("a", "b", "x", "x", 3); out != "" {
+		t.Fatalf("Unified = %q, want empty", out)
+	}
+	if out := RenderDiff("x\n", "x", ModeUnified, false); !strings.Contains(out, "\\ No newline at end of file") {
+		t.Fatalf("RenderDiff = %q", out)
+	}
+}
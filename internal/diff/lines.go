@@ -0,0 +1,327 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OpKind 行级差异操作类型
+type OpKind int
+
+const (
+	OpEqual  OpKind = iota // 两边相同
+	OpDelete               // 仅旧内容有
+	OpInsert               // 仅新内容有
+)
+
+// Line 表示差异结果中的一行
+type Line struct {
+	Kind OpKind
+	Text string
+}
+
+// Hunk 表示 unified diff 中的一个变更块
+type Hunk struct {
+	OldStart int // 旧内容起始行（从 1 开始）
+	OldLines int
+	NewStart int // 新内容起始行（从 1 开始）
+	NewLines int
+	Lines    []Line
+}
+
+// DefaultContext unified diff 默认的上下文行数
+const DefaultContext = 3
+
+// LineDiff 使用 Myers 算法计算两组行之间的最短编辑序列
+// 采用线性空间的分治版本（middle snake），内存与输入长度成正比
+func LineDiff(a, b []string) []Line {
+	result := make([]Line, 0, len(a)+len(b))
+	return diffLines(result, a, b)
+}
+
+// diffLines 将 a 到 b 的编辑序列追加到 result
+func diffLines(result []Line, a, b []string) []Line {
+	// 先去掉公共前缀和后缀，缩小需要计算的范围
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	result = append(result, linesOf(OpEqual, a[:prefix])...)
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	switch {
+	case len(midA) == 0:
+		result = append(result, linesOf(OpInsert, midB)...)
+	case len(midB) == 0:
+		result = append(result, linesOf(OpDelete, midA)...)
+	default:
+		// 两侧都非空且首尾不同，编辑距离至少为 2，两半的编辑距离都严格变小
+		x, y, u, v, ok := middleSnake(midA, midB)
+		if !ok {
+			// 差异过大时不再寻找最短编辑序列，整段显示为删除加新增
+			result = append(result, linesOf(OpDelete, midA)...)
+			result = append(result, linesOf(OpInsert, midB)...)
+			break
+		}
+		result = diffLines(result, midA[:x], midB[:y])
+		result = append(result, linesOf(OpEqual, midA[x:u])...)
+		result = diffLines(result, midA[u:], midB[v:])
+	}
+	return append(result, linesOf(OpEqual, a[len(a)-suffix:])...)
+}
+
+// maxSnakeCost 限制 middleSnake 每个方向的搜索轮数（约为编辑距离的一半），
+// 超过时放弃寻找最短编辑序列，避免很大的差异耗时过长
+const maxSnakeCost = 2048
+
+// middleSnake 同时从两端搜索最短编辑路径，返回路径中间的公共段
+// a[x:u] == b[y:v]，只使用 O(len(a)+len(b)) 的内存。编辑距离超过
+// 2*maxSnakeCost 时 ok 为 false。
+func middleSnake(a, b []string) (x, y, u, v int, ok bool) {
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta%2 != 0
+	maxD := (n + m + 1) / 2
+	if maxD > maxSnakeCost {
+		maxD = maxSnakeCost
+	}
+	offset := maxD + 1
+	forward := make([]int, 2*maxD+3)  // 正向：每条对角线 k=x-y 上到达的最大 x
+	backward := make([]int, 2*maxD+3) // 反向：从末尾倒着走的最大步数
+
+	for d := 0; d <= maxD; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x0 int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x0 = forward[offset+k+1]
+			} else {
+				x0 = forward[offset+k-1] + 1
+			}
+			y0 := x0 - k
+			x, y := x0, y0
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			// 总编辑距离为奇数时，在正向搜索中与上一轮的反向路径相遇
+			if kb := delta - k; odd && kb >= -(d-1) && kb <= d-1 && x+backward[offset+kb] >= n {
+				return x0, y0, x, y, true
+			}
+		}
+		for k := -d; k <= d; k += 2 {
+			var x0 int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x0 = backward[offset+k+1]
+			} else {
+				x0 = backward[offset+k-1] + 1
+			}
+			y0 := x0 - k
+			x, y := x0, y0
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			if kf := delta - k; !odd && kf >= -d && kf <= d && x+forward[offset+kf] >= n {
+				return n - x, m - y, n - x0, m - y0, true
+			}
+		}
+	}
+	return 0, 0, 0, 0, false
+}
+
+func linesOf(kind OpKind, texts []string) []Line {
+	result := make([]Line, len(texts))
+	for i, text := range texts {
+		result[i] = Line{Kind: kind, Text: text}
+	}
+	return result
+}
+
+// SplitLines 按行拆分内容，忽略结尾换行产生的空行
+func SplitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// noNewlineMarker 标记没有结尾换行的最后一行，与 diff/git 的输出一致
+const noNewlineMarker = "\\ No newline at end of file"
+
+// unifiedLines 与 SplitLines 相同，但缺少结尾换行时给最后一行加上标记，
+// 使仅结尾换行不同的内容也能产生差异
+func unifiedLines(content string) []string {
+	lines := SplitLines(content)
+	if len(lines) > 0 && !strings.HasSuffix(content, "\n") {
+		lines[len(lines)-1] += "\n" + noNewlineMarker
+	}
+	return lines
+}
+
+// splitMarker 拆出行尾的 no-newline 标记
+func splitMarker(text string) (string, bool) {
+	if trimmed := strings.TrimSuffix(text, "\n"+noNewlineMarker); trimmed != text {
+		return trimmed, true
+	}
+	return text, false
+}
+
+// Hunks 将编辑序列分组为带上下文的变更块
+func Hunks(lines []Line, context int) []Hunk {
+	// 计算每个变更附带上下文后的区间，并合并重叠的区间
+	type span struct{ start, end int }
+	var spans []span
+	for i, line := range lines {
+		if line.Kind == OpEqual {
+			continue
+		}
+		start, end := i-context, i+context+1
+		if start < 0 {
+			start = 0
+		}
+		if end > len(lines) {
+			end = len(lines)
+		}
+		if len(spans) > 0 && start <= spans[len(spans)-1].end {
+			spans[len(spans)-1].end = end
+			continue
+		}
+		spans = append(spans, span{start, end})
+	}
+
+	var hunks []Hunk
+	oldLine, newLine := 1, 1
+	pos := 0
+	for _, sp := range spans {
+		for ; pos < sp.start; pos++ {
+			oldLine, newLine = advance(lines[pos].Kind, oldLine, newLine)
+		}
+		h := Hunk{OldStart: oldLine, NewStart: newLine, Lines: lines[sp.start:sp.end]}
+		for _, line := range h.Lines {
+			if line.Kind != OpInsert {
+				h.OldLines++
+			}
+			if line.Kind != OpDelete {
+				h.NewLines++
+			}
+		}
+		hunks = append(hunks, h)
+	}
+	return hunks
+}
+
+func advance(kind OpKind, oldLine, newLine int) (int, int) {
+	switch kind {
+	case OpDelete:
+		return oldLine + 1, newLine
+	case OpInsert:
+		return oldLine, newLine + 1
+	default:
+		return oldLine + 1, newLine + 1
+	}
+}
+
+// Header 返回块的 @@ 头
+func (h Hunk) Header() string {
+	oldStart, newStart := h.OldStart, h.NewStart
+	if h.OldLines == 0 {
+		oldStart--
+	}
+	if h.NewLines == 0 {
+		newStart--
+	}
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", oldStart, h.OldLines, newStart, h.NewLines)
+}
+
+// Unified 生成不带颜色的 unified diff 文本，内容相同时返回空字符串
+func Unified(oldName, newName, oldContent, newContent string, context int) string {
+	hunks := Hunks(LineDiff(unifiedLines(oldContent), unifiedLines(newContent)), context)
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", oldName, newName))
+	for _, h := range hunks {
+		sb.WriteString(h.Header() + "\n")
+		for _, line := range h.Lines {
+			text, marked := splitMarker(line.Text)
+			sb.WriteString(linePrefix(line.Kind) + text + "\n")
+			if marked {
+				sb.WriteString(noNewlineMarker + "\n")
+			}
+		}
+	}
+	return sb.String()
+}
+
+// CountChanges 统计新增和删除的行数
+func CountChanges(lines []Line) (added, removed int) {
+	for _, line := range lines {
+		switch line.Kind {
+		case OpInsert:
+			added++
+		case OpDelete:
+			removed++
+		}
+	}
+	return added, removed
+}
+
+func linePrefix(kind OpKind) string {
+	switch kind {
+	case OpInsert:
+		return "+"
+	case OpDelete:
+		return "-"
+	default:
+		return " "
+	}
+}
+
+// SideBySideRow 并排 diff 中的一行，Left/Right 为 nil 表示该侧没有对应行
+type SideBySideRow struct {
+	Left  *Line
+	Right *Line
+}
+
+// SideBySide 将编辑序列排成左右两栏，相邻的删除和新增行成对放在同一行
+func SideBySide(lines []Line) []SideBySideRow {
+	var rows []SideBySideRow
+	var deletes, inserts []Line
+
+	flush := func() {
+		for i := 0; i < len(deletes) || i < len(inserts); i++ {
+			var row SideBySideRow
+			if i < len(deletes) {
+				row.Left = &deletes[i]
+			}
+			if i < len(inserts) {
+				row.Right = &inserts[i]
+			}
+			rows = append(rows, row)
+		}
+		deletes, inserts = nil, nil
+	}
+
+	for i := range lines {
+		line := lines[i]
+		switch line.Kind {
+		case OpDelete:
+			deletes = append(deletes, line)
+		case OpInsert:
+			inserts = append(inserts, line)
+		default:
+			flush()
+			rows = append(rows, SideBySideRow{Left: &line, Right: &line})
+		}
+	}
+	flush()
+	return rows
+}
@@ -0,0 +1,161 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ChangeKind JSON 语义差异的类型
+type ChangeKind string
+
+const (
+	ChangeAdded    ChangeKind = "added"
+	ChangeRemoved  ChangeKind = "removed"
+	ChangeModified ChangeKind = "modified"
+)
+
+// JSONChange 表示某个 JSON 路径上的一处变化
+type JSONChange struct {
+	Path string
+	Kind ChangeKind
+	Old  interface{}
+	New  interface{}
+}
+
+var identPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$-]*$`)
+
+// SemanticDiff 按 key 路径比较两个 JSON 文档，忽略格式和 key 顺序
+// 任一内容不是合法 JSON 时返回错误；空内容视为 null
+func SemanticDiff(oldData, newData []byte) ([]JSONChange, error) {
+	oldVal, err := decodeJSON(oldData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse old JSON: %w", err)
+	}
+	newVal, err := decodeJSON(newData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse new JSON: %w", err)
+	}
+
+	var changes []JSONChange
+	compareValues("", oldVal, newVal, &changes)
+	return changes, nil
+}
+
+// IsJSON 判断内容是否为合法 JSON（空内容不算）
+func IsJSON(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	return len(trimmed) > 0 && json.Valid(trimmed)
+}
+
+func decodeJSON(data []byte) (interface{}, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+	var v interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func compareValues(path string, oldVal, newVal interface{}, changes *[]JSONChange) {
+	oldMap, oldIsMap := oldVal.(map[string]interface{})
+	newMap, newIsMap := newVal.(map[string]interface{})
+	if oldIsMap && newIsMap {
+		keys := make(map[string]bool)
+		for key := range oldMap {
+			keys[key] = true
+		}
+		for key := range newMap {
+			keys[key] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+
+		for _, key := range sorted {
+			childPath := JoinPath(path, key)
+			oldChild, inOld := oldMap[key]
+			newChild, inNew := newMap[key]
+			switch {
+			case !inOld:
+				*changes = append(*changes, JSONChange{Path: childPath, Kind: ChangeAdded, New: newChild})
+			case !inNew:
+				*changes = append(*changes, JSONChange{Path: childPath, Kind: ChangeRemoved, Old: oldChild})
+			default:
+				compareValues(childPath, oldChild, newChild, changes)
+			}
+		}
+		return
+	}
+
+	oldArr, oldIsArr := oldVal.([]interface{})
+	newArr, newIsArr := newVal.([]interface{})
+	if oldIsArr && newIsArr {
+		for i := 0; i < len(oldArr) || i < len(newArr); i++ {
+			childPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(oldArr):
+				*changes = append(*changes, JSONChange{Path: childPath, Kind: ChangeAdded, New: newArr[i]})
+			case i >= len(newArr):
+				*changes = append(*changes, JSONChange{Path: childPath, Kind: ChangeRemoved, Old: oldArr[i]})
+			default:
+				compareValues(childPath, oldArr[i], newArr[i], changes)
+			}
+		}
+		return
+	}
+
+	if reflect.DeepEqual(oldVal, newVal) {
+		return
+	}
+	*changes = append(*changes, JSONChange{Path: path, Kind: ChangeModified, Old: oldVal, New: newVal})
+}
+
+// JoinPath 拼接 JSON key 路径，非标识符 key 使用 ["..."] 形式
+func JoinPath(parent, key string) string {
+	if identPattern.MatchString(key) {
+		if parent == "" {
+			return key
+		}
+		return parent + "." + key
+	}
+	quoted, _ := json.Marshal(key)
+	return parent + "[" + string(quoted) + "]"
+}
+
+// FormatJSONChange 格式化单个语义变化，如 `mcpServers.foo.args[1]: "a" → "b"`
+func FormatJSONChange(c JSONChange) string {
+	path := c.Path
+	if path == "" {
+		path = "(root)"
+	}
+	switch c.Kind {
+	case ChangeAdded:
+		return fmt.Sprintf("+ %s: %s", path, CompactJSON(c.New, 80))
+	case ChangeRemoved:
+		return fmt.Sprintf("- %s: %s", path, CompactJSON(c.Old, 80))
+	default:
+		return fmt.Sprintf("~ %s: %s → %s", path, CompactJSON(c.Old, 60), CompactJSON(c.New, 60))
+	}
+}
+
+// CompactJSON 将值编码为单行 JSON（不转义 HTML 字符），并截断到 maxLen
+func CompactJSON(v interface{}, maxLen int) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return truncateLine(strings.TrimSpace(buf.String()), maxLen)
+}
@@ -0,0 +1,293 @@
+package fileutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrModified is returned when a file changed on disk between read and write
+var ErrModified = errors.New("file was modified by another process")
+
+// Snapshot records the state of a file at the time it was read.
+// It is used to detect concurrent updates (e.g. Claude Code rewriting
+// ~/.claude.json) before a write replaces the file.
+type Snapshot struct {
+	Path   string
+	Exists bool
+	Hash   [sha256.Size]byte
+}
+
+// ReadFile reads a file and returns its content together with a snapshot.
+// A missing file is not an error; the snapshot records that it did not exist.
+func ReadFile(path string) ([]byte, Snapshot, error) {
+	snap := Snapshot{Path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, snap, nil
+		}
+		return nil, snap, err
+	}
+	snap.Exists = true
+	snap.Hash = sha256.Sum256(data)
+	return data, snap, nil
+}
+
+// Changed reports whether the file differs from the snapshot
+func (s Snapshot) Changed() (bool, error) {
+	current, err := os.ReadFile(s.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s.Exists, nil
+		}
+		return false, err
+	}
+	if !s.Exists {
+		return true, nil
+	}
+	return sha256.Sum256(current) != s.Hash, nil
+}
+
+// WriteFile atomically replaces path with data.
+// The content is written to a temp file in the same directory, fsynced and
+// renamed over the target. An existing file keeps its permissions; perm is
+// only used for new files. Symlinked targets are resolved so the link stays.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	target := path
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		target = resolved
+	}
+
+	mode := perm
+	if info, err := os.Stat(target); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	dir := filepath.Dir(target)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create parent directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(target)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := io.Copy(tmp, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+	if err := os.Rename(tmpPath, target); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", target, err)
+	}
+	committed = true
+
+	syncDir(dir)
+	return nil
+}
+
+// WriteFileIfUnchanged atomically writes data only if the file still matches snap.
+// It returns ErrModified if another process updated the file in between.
+func WriteFileIfUnchanged(path string, data []byte, perm os.FileMode, snap Snapshot) error {
+	changed, err := snap.Changed()
+	if err != nil {
+		return err
+	}
+	if changed {
+		return fmt.Errorf("%s: %w", path, ErrModified)
+	}
+	return WriteFile(path, data, perm)
+}
+
+// Backup copies data, the current content of path, to
+// <path>.<timestamp>.bak next to it and returns the backup path.
+// Backups taken within the same second get a -1, -2, ... suffix instead of
+// overwriting each other.
+func Backup(path string, data []byte) (string, error) {
+	stamp := time.Now().Format("20060102-150405")
+	for i := 0; ; i++ {
+		backup := fmt.Sprintf("%s.%s.bak", path, stamp)
+		if i > 0 {
+			backup = fmt.Sprintf("%s.%s-%d.bak", path, stamp, i)
+		}
+		f, err := os.OpenFile(backup, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to back up %s: %w", path, err)
+		}
+		_, err = f.Write(data)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(backup)
+			return "", fmt.Errorf("failed to back up %s: %w", path, err)
+		}
+		return backup, nil
+	}
+}
+
+// ReplaceDir atomically replaces dir with a directory populated by fill.
+// fill receives an empty staging directory next to dir. On success the old
+// directory is swapped out and removed; on failure dir is left untouched.
+// A symlinked dir keeps its link: the directory it points to is replaced.
+func ReplaceDir(dir string, fill func(staging string) error) error {
+	dir, err := resolveDir(dir)
+	if err != nil {
+		return err
+	}
+	parent := filepath.Dir(dir)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return fmt.Errorf("failed to create parent directory: %w", err)
+	}
+
+	staging, err := os.MkdirTemp(parent, "."+filepath.Base(dir)+".staging-*")
+	if err != nil {
+		return fmt.Errorf("failed to create staging directory: %w", err)
+	}
+
+	if err := fill(staging); err != nil {
+		os.RemoveAll(staging)
+		return err
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			os.RemoveAll(staging)
+			return fmt.Errorf("failed to stat directory: %w", err)
+		}
+		if err := os.Chmod(staging, 0755); err != nil {
+			os.RemoveAll(staging)
+			return fmt.Errorf("failed to set permissions: %w", err)
+		}
+		if err := os.Rename(staging, dir); err != nil {
+			os.RemoveAll(staging)
+			return fmt.Errorf("failed to move staging directory: %w", err)
+		}
+		syncDir(parent)
+		return nil
+	}
+
+	if err := os.Chmod(staging, info.Mode().Perm()); err != nil {
+		os.RemoveAll(staging)
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+
+	backup := staging + ".old"
+	if err := os.Rename(dir, backup); err != nil {
+		os.RemoveAll(staging)
+		return fmt.Errorf("failed to move old directory aside: %w", err)
+	}
+	if err := os.Rename(staging, dir); err != nil {
+		// 恢复原目录
+		os.Rename(backup, dir)
+		os.RemoveAll(staging)
+		return fmt.Errorf("failed to move staging directory: %w", err)
+	}
+	syncDir(parent)
+
+	return os.RemoveAll(backup)
+}
+
+// resolveDir follows symlinks in dir so that it can be staged and swapped
+// next to the real directory; a missing dir is returned cleaned
+func resolveDir(dir string) (string, error) {
+	dir = filepath.Clean(dir)
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return dir, nil
+		}
+		return "", fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+	return resolved, nil
+}
+
+// CopyDir recursively copies src into dst, preserving file modes.
+// A symlinked src is followed; symlinks inside it are recreated rather
+// than followed.
+func CopyDir(src, dst string) error {
+	src, err := resolveDir(src)
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		default:
+			return nil
+		}
+	})
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// syncDir fsyncs a directory so a rename inside it is durable.
+// Errors are ignored: not every platform supports syncing directories.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
@@ -0,0 +1,187 @@
+package fileutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFilePreservesMode(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "claude.json")
+	if err := os.WriteFile(path, []byte(`{}`), 0600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	if err := WriteFile(path, []byte(`{"a":1}`), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("mode = %v, want 0600", info.Mode().Perm())
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != `{"a":1}` {
+		t.Fatalf("content = %s, want %s", data, `{"a":1}`)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("temp files left behind: %v", entries)
+	}
+}
+
+func TestWriteFileIfUnchangedDetectsModification(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "claude.json")
+	if err := os.WriteFile(path, []byte(`{"v":1}`), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	_, snap, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	// 模拟其他进程的并发写入
+	if err := os.WriteFile(path, []byte(`{"v":2}`), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	err = WriteFileIfUnchanged(path, []byte(`{"v":3}`), 0644, snap)
+	if !errors.Is(err, ErrModified) {
+		t.Fatalf("err = %v, want ErrModified", err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != `{"v":2}` {
+		t.Fatalf("content = %s, want concurrent update preserved", data)
+	}
+}
+
+func TestReplaceDirKeepsOriginalOnFailure(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "skills")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.md"), []byte("old"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	err := ReplaceDir(dir, func(staging string) error {
+		os.WriteFile(filepath.Join(staging, "a.md"), []byte("partial"), 0644)
+		return errors.New("boom")
+	})
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, "a.md"))
+	if string(data) != "old" {
+		t.Fatalf("content = %s, want old", data)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(dir))
+	if len(entries) != 1 {
+		t.Fatalf("staging directory left behind: %v", entries)
+	}
+}
+
+func TestReplaceDirSwapsContent(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "skills")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "old.md"), []byte("old"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	err := ReplaceDir(dir, func(staging string) error {
+		return os.WriteFile(filepath.Join(staging, "new.md"), []byte("new"), 0644)
+	})
+	if err != nil {
+		t.Fatalf("ReplaceDir: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "old.md")); !os.IsNotExist(err) {
+		t.Fatalf("old.md should be gone, stat err = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new.md")); err != nil {
+		t.Fatalf("new.md missing: %v", err)
+	}
+	info, _ := os.Stat(dir)
+	if info.Mode().Perm() != 0700 {
+		t.Fatalf("mode = %v, want 0700", info.Mode().Perm())
+	}
+}
+
+func TestReplaceDirFollowsSymlinkedDir(t *testing.T) {
+	root := t.TempDir()
+	real := filepath.Join(root, "dotfiles", "skills")
+	if err := os.MkdirAll(real, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(real, "old.md"), []byte("old"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	link := filepath.Join(root, "claude", "skills")
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.Symlink(real, link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	err := ReplaceDir(link, func(staging string) error {
+		return os.WriteFile(filepath.Join(staging, "new.md"), []byte("new"), 0644)
+	})
+	if err != nil {
+		t.Fatalf("ReplaceDir: %v", err)
+	}
+
+	// 链接保持不变，被替换的是链接指向的目录
+	info, err := os.Lstat(link)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("symlink replaced: %v, %v", info, err)
+	}
+	if _, err := os.Stat(filepath.Join(real, "new.md")); err != nil {
+		t.Fatalf("new.md missing in target: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(real, "old.md")); !os.IsNotExist(err) {
+		t.Fatalf("old.md should be gone, stat err = %v", err)
+	}
+	for _, dir := range []string{filepath.Dir(link), filepath.Dir(real)} {
+		if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+			t.Fatalf("staging directory left in %s: %v", dir, entries)
+		}
+	}
+
+	copied := filepath.Join(root, "copy")
+	if err := CopyDir(link, copied); err != nil {
+		t.Fatalf("CopyDir: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(copied, "new.md")); err != nil || string(data) != "new" {
+		t.Fatalf("CopyDir did not follow the symlink: %q, %v", data, err)
+	}
+}
+
+func TestBackupDoesNotOverwriteSameSecond(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".claude.json")
+	seen := make(map[string]bool)
+	for _, content := range []string{"a", "b", "c"} {
+		backup, err := Backup(path, []byte(content))
+		if err != nil {
+			t.Fatalf("Backup: %v", err)
+		}
+		if seen[backup] {
+			t.Fatalf("backup %s reused", backup)
+		}
+		seen[backup] = true
+		if data, _ := os.ReadFile(backup); string(data) != content {
+			t.Fatalf("%s = %q, want %q", backup, data, content)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package filter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yxuechao007/claude_sync/internal/config"
+	"github.com/yxuechao007/claude_sync/internal/jsondoc"
+	"github.com/yxuechao007/claude_sync/internal/jsonpath"
+)
+
+// Actions taken for machine-specific content found by a Detector,
+// see config.LocalActions
+const (
+	ActionExclude = "exclude" // 从 push 的内容中移除
+	ActionWarn    = "warn"    // 照常 push，只报告
+	ActionIgnore  = "ignore"  // 不报告
+)
+
+// maxScanSize skips large files when scanning directory items
+const maxScanSize = 1 << 20
+
+// Finding is one machine-specific match in an item
+type Finding struct {
+	Path    string // JSON 路径，如 mcpServers.chrome.args[1]；目录或文本文件为 文件:行号
+	Pattern string // 匹配的 local_patterns 名称
+	Match   string // 匹配到的文本
+	Action  string // exclude、warn 或 ignore
+}
+
+// String formats a finding for display
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %q (%s) → %s", f.Path, f.Match, f.Pattern, f.Action)
+}
+
+type namedPattern struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// Detector finds machine-specific content using configured patterns
+type Detector struct {
+	patterns []namedPattern
+}
+
+// NewDetector compiles the configured local patterns
+func NewDetector(patterns []config.LocalPattern) (*Detector, error) {
+	d := &Detector{}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid local pattern %q: %w", p.Name, err)
+		}
+		d.patterns = append(d.patterns, namedPattern{name: p.Name, re: re})
+	}
+	return d, nil
+}
+
+// DefaultDetector uses the built-in patterns
+func DefaultDetector() *Detector {
+	d, _ := NewDetector(config.DefaultLocalPatterns())
+	return d
+}
+
+// MatchString reports whether s contains machine-specific content
+func (d *Detector) MatchString(s string) bool {
+	for _, p := range d.patterns {
+		if p.re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches returns the distinct matches in s, in pattern order
+func (d *Detector) matches(s string) []Finding {
+	var found []Finding
+	for _, p := range d.patterns {
+		for _, m := range p.re.FindAllString(s, -1) {
+			dup := false
+			for _, f := range found {
+				if f.Match == m {
+					dup = true
+					break
+				}
+			}
+			if !dup {
+				found = append(found, Finding{Pattern: p.name, Match: m})
+			}
+		}
+	}
+	return found
+}
+
+type actionRule struct {
+	path   jsonpath.Path
+	action string
+}
+
+func parseActionRules(actions map[string]string) ([]actionRule, error) {
+	var rules []actionRule
+	for pattern, action := range actions {
+		path, err := jsonpath.Parse(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid local_actions path: %w", err)
+		}
+		if !containsString(config.LocalActions, action) {
+			return nil, fmt.Errorf("invalid local action %q for %s", action, pattern)
+		}
+		rules = append(rules, actionRule{path: path, action: action})
+	}
+	// 较短的路径优先，使 exclude 作用于规则所在的整个节点
+	sort.Slice(rules, func(i, j int) bool {
+		if len(rules[i].path) != len(rules[j].path) {
+			return len(rules[i].path) < len(rules[j].path)
+		}
+		return strings.Join(rules[i].path, ".") < strings.Join(rules[j].path, ".")
+	})
+	return rules, nil
+}
+
+// actionFor returns the action for a value at path and the length of the
+// path prefix the matching rule covers (0 when no rule matched)
+func actionFor(rules []actionRule, path []string) (string, int) {
+	for _, r := range rules {
+		if len(r.path) > len(path) {
+			continue
+		}
+		if full, _ := jsonpath.Match([]jsonpath.Path{r.path}, path[:len(r.path)]); full {
+			return r.action, len(r.path)
+		}
+	}
+	return ActionWarn, 0
+}
+
+// Apply scans a JSON document, removes the nodes whose action is exclude
+// and returns the resulting content with every finding. Array elements are
+// addressed by their index in actions paths (e.g. "hooks.*.0").
+// Content that is not a JSON object is scanned line by line and never modified.
+func (d *Detector) Apply(data []byte, actions map[string]string) ([]byte, []Finding, error) {
+	rules, err := parseActionRules(actions)
+	if err != nil {
+		return data, nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var obj map[string]interface{}
+	if err := decoder.Decode(&obj); err != nil || obj == nil {
+		return data, d.scanText("", data), nil
+	}
+
+	// 标准格式的 hooks 按单个 hook 条目排除，而不是整个 hook 类型
+	_, hookEntries := FlattenHooks(obj["hooks"])
+
+	var findings []Finding
+	excluded := make(map[string]bool)
+	var walk func(value interface{}, path []string, display string)
+	walk = func(value interface{}, path []string, display string) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				walk(v[key], appendPath(path, key), joinDisplay(display, key))
+			}
+		case []interface{}:
+			for i, child := range v {
+				walk(child, appendPath(path, strconv.Itoa(i)), fmt.Sprintf("%s[%d]", display, i))
+			}
+		case string:
+			found := d.matches(v)
+			if len(found) == 0 {
+				return
+			}
+			action, depth := actionFor(rules, path)
+			if action == ActionIgnore {
+				return
+			}
+			if action == ActionExclude {
+				if hookEntries && depth <= hookEntryDepth && isHookEntryPath(path) {
+					depth = hookEntryDepth
+				}
+				excluded[strings.Join(path[:depth], "\x00")] = true
+			}
+			for _, f := range found {
+				f.Path = display
+				f.Action = action
+				findings = append(findings, f)
+			}
+		}
+	}
+	walk(obj, nil, "")
+
+	if len(excluded) == 0 {
+		return data, findings, nil
+	}
+	pruned, _ := pruneExcluded(obj, nil, excluded)
+	if hookEntries {
+		dropEmptyHookGroups(pruned.(map[string]interface{}))
+	}
+	result, err := jsondoc.MarshalIndent(pruned)
+	if err != nil {
+		return data, findings, err
+	}
+	return result, findings, nil
+}
+
+// pruneExcluded rebuilds value without the excluded paths.
+// Objects and arrays left empty by the removal are dropped as well.
+func pruneExcluded(value interface{}, path []string, excluded map[string]bool) (interface{}, bool) {
+	if len(path) > 0 && excluded[strings.Join(path, "\x00")] {
+		return nil, false
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		removed := false
+		for key, child := range v {
+			if kept, ok := pruneExcluded(child, appendPath(path, key), excluded); ok {
+				result[key] = kept
+			} else {
+				removed = true
+			}
+		}
+		if removed && len(result) == 0 && len(path) > 0 {
+			return nil, false
+		}
+		return result, true
+	case []interface{}:
+		result := make([]interface{}, 0, len(v))
+		for i, child := range v {
+			if kept, ok := pruneExcluded(child, appendPath(path, strconv.Itoa(i)), excluded); ok {
+				result = append(result, kept)
+			}
+		}
+		if len(result) == 0 && len(v) > 0 {
+			return nil, false
+		}
+		return result, true
+	}
+	return value, true
+}
+
+// hookEntryDepth is the path length of a single hook:
+// hooks.<type>.<group index>.hooks.<hook index>
+const hookEntryDepth = 5
+
+func isHookEntryPath(path []string) bool {
+	if len(path) < hookEntryDepth || path[0] != "hooks" || path[3] != "hooks" {
+		return false
+	}
+	_, err1 := strconv.Atoi(path[2])
+	_, err2 := strconv.Atoi(path[4])
+	return err1 == nil && err2 == nil
+}
+
+// dropEmptyHookGroups removes matcher groups whose hooks were all excluded,
+// then hook types and the hooks key left empty
+func dropEmptyHookGroups(obj map[string]interface{}) {
+	hooks, ok := obj["hooks"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for hookType, value := range hooks {
+		groups, ok := value.([]interface{})
+		if !ok {
+			continue
+		}
+		kept := make([]interface{}, 0, len(groups))
+		for _, g := range groups {
+			if group, ok := g.(map[string]interface{}); ok {
+				if _, has := group["hooks"]; !has {
+					continue
+				}
+			}
+			kept = append(kept, g)
+		}
+		if len(kept) == 0 {
+			delete(hooks, hookType)
+		} else {
+			hooks[hookType] = kept
+		}
+	}
+	if len(hooks) == 0 {
+		delete(obj, "hooks")
+	}
+}
+
+// scanText reports matches in a non-JSON file as <name>:<line>
+func (d *Detector) scanText(name string, data []byte) []Finding {
+	var findings []Finding
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), maxScanSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		for _, f := range d.matches(scanner.Text()) {
+			f.Path = fmt.Sprintf("line %d", line)
+			if name != "" {
+				f.Path = fmt.Sprintf("%s:%d", name, line)
+			}
+			f.Action = ActionWarn
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// ScanDir reports matches in the text files of a directory item.
+// Directory content is archived as is, so findings are only reported.
+func (d *Detector) ScanDir(root string) ([]Finding, error) {
+	var findings []Finding
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || info.Size() > maxScanSize || !info.Mode().IsRegular() {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if bytes.IndexByte(data, 0) >= 0 {
+			return nil // 跳过二进制文件
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		findings = append(findings, d.scanText(filepath.ToSlash(rel), data)...)
+		return nil
+	})
+	return findings, err
+}
+
+func joinDisplay(parent, key string) string {
+	if strings.ContainsAny(key, ".[]\"") || key == "" {
+		quoted, _ := json.Marshal(key)
+		return parent + "[" + string(quoted) + "]"
+	}
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
@@ -0,0 +1,104 @@
+package filter
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/yxuechao007/claude_sync/internal/config"
+)
+
+func TestDetectorApply(t *testing.T) {
+	data := `{
+		"hooks": {
+			"PreToolUse": [{"hooks": [{"command": "/Users/me/bin/check"}]}],
+			"Stop": [{"hooks": [{"command": "notify"}]}]
+		},
+		"mcpServers": {"chrome": {"command": "npx", "args": ["--port", "http://localhost:9222"]}},
+		"statusLine": {"command": "~/bin/status"},
+		"model": "opus"
+	}`
+	actions := map[string]string{"hooks.*": "exclude", "statusLine": "ignore"}
+
+	out, findings, err := DefaultDetector().Apply([]byte(data), actions)
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	want := []Finding{
+		{Path: "hooks.PreToolUse[0].hooks[0].command", Pattern: "macos-home", Match: "/Users/me/", Action: "exclude"},
+		{Path: "mcpServers.chrome.args[1]", Pattern: "localhost-port", Match: "localhost:9222", Action: "warn"},
+	}
+	if !reflect.DeepEqual(findings, want) {
+		t.Fatalf("findings = %+v\nwant %+v", findings, want)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	hooks := got["hooks"].(map[string]interface{})
+	if _, ok := hooks["PreToolUse"]; ok {
+		t.Fatalf("PreToolUse not excluded: %v", hooks)
+	}
+	if _, ok := hooks["Stop"]; !ok {
+		t.Fatalf("Stop hook lost: %v", hooks)
+	}
+	if got["statusLine"] == nil || got["mcpServers"] == nil {
+		t.Fatalf("warn/ignore values must be kept: %v", got)
+	}
+}
+
+func TestDetectorApplyUnchangedWithoutExclusions(t *testing.T) {
+	data := []byte(`{"b": 1, "a": "/home/me/x"}`)
+	out, findings, err := DefaultDetector().Apply(data, nil)
+	if err != nil || string(out) != string(data) {
+		t.Fatalf("Apply = %s, %v; want input unchanged", out, err)
+	}
+	if len(findings) != 1 || findings[0].Action != "warn" {
+		t.Fatalf("findings = %+v", findings)
+	}
+}
+
+func TestDetectorCustomPatternsAndText(t *testing.T) {
+	d, err := NewDetector([]config.LocalPattern{{Name: "docker", Regex: `/var/run/docker\.sock`}})
+	if err != nil {
+		t.Fatalf("NewDetector: %v", err)
+	}
+	out, findings, err := d.Apply([]byte("# notes\nmount /var/run/docker.sock\n/Users/me/\n"), nil)
+	if err != nil || len(out) == 0 {
+		t.Fatalf("Apply: %v", err)
+	}
+	want := []Finding{{Path: "line 2", Pattern: "docker", Match: "/var/run/docker.sock", Action: "warn"}}
+	if !reflect.DeepEqual(findings, want) {
+		t.Fatalf("findings = %+v, want %+v", findings, want)
+	}
+
+	if _, err := NewDetector([]config.LocalPattern{{Name: "bad", Regex: "("}}); err == nil {
+		t.Fatalf("expected error for invalid regex")
+	}
+}
+
+func TestDetectorScanDir(t *testing.T) {
+	dir := t.TempDir()
+	skill := filepath.Join(dir, "review", "SKILL.md")
+	if err := os.MkdirAll(filepath.Dir(skill), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(skill, []byte("Run\nnode /home/me/tools/review.js\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "blob.bin"), []byte("/home/me/\x00"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	findings, err := DefaultDetector().ScanDir(dir)
+	if err != nil {
+		t.Fatalf("ScanDir: %v", err)
+	}
+	if len(findings) != 1 || findings[0].Path != "review/SKILL.md:2" || findings[0].Match != "/home/me/" {
+		t.Fatalf("findings = %+v", findings)
+	}
+}
@@ -0,0 +1,238 @@
+package filter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/yxuechao007/claude_sync/internal/jsondoc"
+)
+
+// HookEntry is a single hook command together with the hook type and
+// matcher group it belongs to, e.g. PreToolUse / "Bash" / {"command": ...}
+type HookEntry struct {
+	Type       string
+	Matcher    string
+	HasMatcher bool        // 原 matcher 分组是否带有 matcher 字段
+	Hook       interface{} // 单个 hook，如 {"type": "command", "command": "..."}
+	ID         string
+}
+
+// HookID identifies a hook entry by type, matcher and a hash of its command,
+// so the same hook is recognised on every machine regardless of its position
+func HookID(hookType, matcher string, hook interface{}) string {
+	command := ""
+	if m, ok := hook.(map[string]interface{}); ok {
+		command, _ = m["command"].(string)
+	}
+	if command == "" {
+		data, _ := json.Marshal(hook)
+		command = string(data)
+	}
+	sum := sha256.Sum256([]byte(command))
+	return fmt.Sprintf("%s/%s/%s", hookType, matcher, hex.EncodeToString(sum[:])[:12])
+}
+
+// Describe returns a short human-readable label for the entry
+func (h HookEntry) Describe() string {
+	label := h.Type
+	if h.Matcher != "" {
+		label += "[" + h.Matcher + "]"
+	}
+	if m, ok := h.Hook.(map[string]interface{}); ok {
+		if command, ok := m["command"].(string); ok {
+			return label + ": " + command
+		}
+	}
+	return label
+}
+
+// FlattenHooks splits a settings "hooks" value into entries, ordered by hook
+// type then position. ok is false when the value is not in the standard
+// {type: [{matcher, hooks: [...]}]} format.
+func FlattenHooks(hooks interface{}) ([]HookEntry, bool) {
+	if hooks == nil {
+		return nil, true
+	}
+	hooksMap, ok := hooks.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	types := make([]string, 0, len(hooksMap))
+	for hookType := range hooksMap {
+		types = append(types, hookType)
+	}
+	sort.Strings(types)
+
+	var entries []HookEntry
+	for _, hookType := range types {
+		groups, ok := hooksMap[hookType].([]interface{})
+		if !ok {
+			return nil, false
+		}
+		for _, g := range groups {
+			group, ok := g.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			matcher, hasMatcher := group["matcher"].(string)
+			list, ok := group["hooks"].([]interface{})
+			if !ok {
+				return nil, false
+			}
+			for _, hook := range list {
+				entries = append(entries, HookEntry{
+					Type:       hookType,
+					Matcher:    matcher,
+					HasMatcher: hasMatcher,
+					Hook:       hook,
+					ID:         HookID(hookType, matcher, hook),
+				})
+			}
+		}
+	}
+	return entries, true
+}
+
+// BuildHooks groups entries back into the settings "hooks" format.
+// Entries with the same type and matcher share one group, in first-seen order.
+// It returns nil when there are no entries.
+func BuildHooks(entries []HookEntry) map[string]interface{} {
+	if len(entries) == 0 {
+		return nil
+	}
+	hooks := make(map[string]interface{})
+	groups := make(map[string]map[string]interface{})
+	for _, entry := range entries {
+		key := entry.Type + "\x00" + entry.Matcher
+		group, ok := groups[key]
+		if !ok {
+			group = map[string]interface{}{"hooks": []interface{}{}}
+			if entry.HasMatcher || entry.Matcher != "" {
+				group["matcher"] = entry.Matcher
+			}
+			groups[key] = group
+			list, _ := hooks[entry.Type].([]interface{})
+			hooks[entry.Type] = append(list, group)
+		}
+		group["hooks"] = append(group["hooks"].([]interface{}), entry.Hook)
+	}
+	return hooks
+}
+
+// IsLocalHook reports whether a hook entry contains machine-specific content
+func (d *Detector) IsLocalHook(entry HookEntry) bool {
+	return d.containsLocal(entry.Hook)
+}
+
+// containsLocal checks the string values of v, so escaping in the JSON
+// encoding (e.g. Windows backslashes) does not affect matching
+func (d *Detector) containsLocal(v interface{}) bool {
+	switch val := v.(type) {
+	case string:
+		return d.MatchString(val)
+	case map[string]interface{}:
+		for _, child := range val {
+			if d.containsLocal(child) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, child := range val {
+			if d.containsLocal(child) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MergeHookEntries merges remote hooks into local hooks by entry identity:
+// the result is the union of both sides, and a remote entry replaces the local
+// entry with the same ID.
+// With skipRemoteLocal, machine-specific remote entries that local does not
+// already have are skipped. ok is false when either side is not in the
+// standard hooks format; a nil result means no hooks remain.
+func (d *Detector) MergeHookEntries(localHooks, remoteHooks interface{}, skipRemoteLocal bool) (interface{}, bool) {
+	return d.mergeHookEntries(localHooks, remoteHooks, skipRemoteLocal, func(HookEntry) bool { return true })
+}
+
+// mergeHookEntries places remote entries first, then appends the local
+// entries missing from the remote for which keepLocal returns true
+func (d *Detector) mergeHookEntries(localHooks, remoteHooks interface{}, skipRemoteLocal bool, keepLocal func(HookEntry) bool) (interface{}, bool) {
+	local, ok1 := FlattenHooks(localHooks)
+	remote, ok2 := FlattenHooks(remoteHooks)
+	if !ok1 || !ok2 {
+		return nil, false
+	}
+
+	localIDs := make(map[string]bool, len(local))
+	for _, entry := range local {
+		localIDs[entry.ID] = true
+	}
+
+	var merged []HookEntry
+	seen := make(map[string]bool)
+	for _, entry := range remote {
+		if seen[entry.ID] {
+			continue
+		}
+		if skipRemoteLocal && !localIDs[entry.ID] && d.IsLocalHook(entry) {
+			continue
+		}
+		seen[entry.ID] = true
+		merged = append(merged, entry)
+	}
+	for _, entry := range local {
+		if seen[entry.ID] || !keepLocal(entry) {
+			continue
+		}
+		seen[entry.ID] = true
+		merged = append(merged, entry)
+	}
+
+	if hooks := BuildHooks(merged); hooks != nil {
+		return hooks, true
+	}
+	return nil, true
+}
+
+// KeepLocalHookEntries adds the machine-specific hook entries of local to
+// remote, so overwriting hooks on pull does not drop entries push kept local.
+func (d *Detector) KeepLocalHookEntries(local, remote []byte) ([]byte, error) {
+	var localObj, remoteObj map[string]interface{}
+	if err := json.Unmarshal(local, &localObj); err != nil || localObj["hooks"] == nil {
+		return remote, nil
+	}
+	if err := json.Unmarshal(remote, &remoteObj); err != nil {
+		return remote, nil
+	}
+
+	localEntries, ok1 := FlattenHooks(localObj["hooks"])
+	remoteEntries, ok2 := FlattenHooks(remoteObj["hooks"])
+	if !ok1 || !ok2 {
+		return remote, nil
+	}
+	remoteIDs := make(map[string]bool, len(remoteEntries))
+	for _, entry := range remoteEntries {
+		remoteIDs[entry.ID] = true
+	}
+	missing := false
+	for _, entry := range localEntries {
+		if !remoteIDs[entry.ID] && d.IsLocalHook(entry) {
+			missing = true
+			break
+		}
+	}
+	if !missing {
+		// 没有需要保留的本地条目时不改写远端内容
+		return remote, nil
+	}
+
+	hooks, _ := d.mergeHookEntries(localObj["hooks"], remoteObj["hooks"], false, d.IsLocalHook)
+	remoteObj["hooks"] = hooks
+	return jsondoc.MarshalIndent(remoteObj)
+}
@@ -0,0 +1,132 @@
+package filter
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/yxuechao007/claude_sync/internal/config"
+)
+
+func hooksOf(t *testing.T, data []byte) interface{} {
+	t.Helper()
+	var obj map[string]interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		t.Fatalf("unmarshal %s: %v", data, err)
+	}
+	return obj["hooks"]
+}
+
+func decodeHooks(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("unmarshal %s: %v", s, err)
+	}
+	return v
+}
+
+func TestApplyExcludesSingleHookEntries(t *testing.T) {
+	data := `{"hooks": {
+		"PreToolUse": [
+			{"matcher": "Bash", "hooks": [
+				{"type": "command", "command": "/Users/me/bin/guard.sh"},
+				{"type": "command", "command": "npx lint-staged"}
+			]},
+			{"matcher": "Edit", "hooks": [{"type": "command", "command": "/Users/me/bin/fmt.sh"}]}
+		],
+		"Stop": [{"hooks": [{"type": "command", "command": "say done"}]}]
+	}}`
+
+	out, findings, err := DefaultDetector().Apply([]byte(data), config.DefaultSettingsLocalActions())
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if len(findings) != 2 {
+		t.Fatalf("findings = %+v, want 2", findings)
+	}
+
+	want := decodeHooks(t, `{
+		"PreToolUse": [{"matcher": "Bash", "hooks": [{"type": "command", "command": "npx lint-staged"}]}],
+		"Stop": [{"hooks": [{"type": "command", "command": "say done"}]}]
+	}`)
+	if got := hooksOf(t, out); !reflect.DeepEqual(got, want) {
+		t.Fatalf("hooks = %v\nwant %v", got, want)
+	}
+}
+
+func TestMergeHookEntriesByIdentity(t *testing.T) {
+	local := decodeHooks(t, `{"PreToolUse": [{"matcher": "Bash", "hooks": [
+		{"type": "command", "command": "/home/me/guard.sh"},
+		{"type": "command", "command": "old-portable"},
+		{"type": "command", "command": "npx lint-staged", "timeout": 5}
+	]}]}`)
+	remote := decodeHooks(t, `{"PreToolUse": [{"matcher": "Bash", "hooks": [
+		{"type": "command", "command": "npx lint-staged", "timeout": 30},
+		{"type": "command", "command": "/Users/other/hook.sh"}
+	]}], "Stop": [{"hooks": [{"type": "command", "command": "say done"}]}]}`)
+
+	got, ok := DefaultDetector().MergeHookEntries(local, remote, true)
+	if !ok {
+		t.Fatalf("MergeHookEntries: not standard format")
+	}
+	// 远端条目按身份覆盖本地，本地独有条目保留，远端其他设备的本地条目跳过
+	want := decodeHooks(t, `{
+		"PreToolUse": [{"matcher": "Bash", "hooks": [
+			{"type": "command", "command": "npx lint-staged", "timeout": 30},
+			{"type": "command", "command": "/home/me/guard.sh"},
+			{"type": "command", "command": "old-portable"}
+		]}],
+		"Stop": [{"hooks": [{"type": "command", "command": "say done"}]}]
+	}`)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("merged = %v\nwant %v", got, want)
+	}
+}
+
+func TestMergeHooksSelectivelyKeepsLocalPortableHooks(t *testing.T) {
+	local := []byte(`{"hooks": {"Stop": [{"hooks": [{"type": "command", "command": "echo local-portable"}]}]}}`)
+	remote := []byte(`{"hooks": {"PreToolUse": [{"matcher": "Bash", "hooks": [{"type": "command", "command": "npx lint-staged"}]}]}}`)
+
+	out, err := DefaultDetector().MergeHooksSelectively(local, remote, true)
+	if err != nil {
+		t.Fatalf("MergeHooksSelectively: %v", err)
+	}
+	want := decodeHooks(t, `{
+		"PreToolUse": [{"matcher": "Bash", "hooks": [{"type": "command", "command": "npx lint-staged"}]}],
+		"Stop": [{"hooks": [{"type": "command", "command": "echo local-portable"}]}]
+	}`)
+	if got := hooksOf(t, out); !reflect.DeepEqual(got, want) {
+		t.Fatalf("hooks = %v\nwant %v", got, want)
+	}
+}
+
+func TestKeepLocalHookEntries(t *testing.T) {
+	d := DefaultDetector()
+	remote := []byte(`{"hooks": {"Stop": [{"hooks": [{"command": "say done"}]}]}, "model": "opus"}`)
+
+	out, err := d.KeepLocalHookEntries([]byte(`{"hooks": {"Stop": [{"hooks": [{"command": "say bye"}]}]}}`), remote)
+	if err != nil || string(out) != string(remote) {
+		t.Fatalf("KeepLocalHookEntries = %s, %v; want remote unchanged", out, err)
+	}
+
+	out, err = d.KeepLocalHookEntries([]byte(`{"hooks": {"Stop": [{"hooks": [{"command": "~/bin/notify"}]}]}}`), remote)
+	if err != nil {
+		t.Fatalf("KeepLocalHookEntries: %v", err)
+	}
+	want := decodeHooks(t, `{"Stop": [{"hooks": [{"command": "say done"}, {"command": "~/bin/notify"}]}]}`)
+	if got := hooksOf(t, out); !reflect.DeepEqual(got, want) {
+		t.Fatalf("hooks = %v\nwant %v", got, want)
+	}
+}
+
+func TestHookIDIgnoresPosition(t *testing.T) {
+	hook := map[string]interface{}{"type": "command", "command": "npx lint-staged"}
+	other := map[string]interface{}{"type": "command", "command": "npx lint-staged", "timeout": 5.0}
+	if HookID("PreToolUse", "Bash", hook) != HookID("PreToolUse", "Bash", other) {
+		t.Fatalf("same command should share an identity")
+	}
+	if HookID("PreToolUse", "Bash", hook) == HookID("PreToolUse", "Edit", hook) {
+		t.Fatalf("matcher must be part of the identity")
+	}
+}
@@ -2,31 +2,21 @@ package filter
 
 import (
 	"encoding/json"
-	"regexp"
 	"strings"
-)
 
-// LocalPatterns 用于检测设备特定内容的正则模式
-var LocalPatterns = []*regexp.Regexp{
-	regexp.MustCompile(`localhost:\d+`),           // localhost:59948
-	regexp.MustCompile(`127\.0\.0\.1:\d+`),        // 127.0.0.1:8080
-	regexp.MustCompile(`0\.0\.0\.0:\d+`),          // 0.0.0.0:3000
-	regexp.MustCompile(`/Users/[^/]+/`),           // macOS 用户路径
-	regexp.MustCompile(`/home/[^/]+/`),            // Linux 用户路径
-	regexp.MustCompile(`C:\\Users\\[^\\]+\\`),     // Windows 用户路径
-	regexp.MustCompile(`\$\{?HOME\}?`),            // $HOME 变量
-	regexp.MustCompile(`~\/`),                     // ~ 路径
-}
+	"github.com/yxuechao007/claude_sync/internal/jsondoc"
+)
 
 // HooksAnalysis hooks 分析结果
 type HooksAnalysis struct {
 	HasLocalContent bool     // 是否包含本地特定内容
 	LocalMatches    []string // 匹配到的本地内容
-	HookTypes       []string // hooks 类型列表
+	HookTypes       []string // 包含本地内容的 hooks 类型列表
+	LocalHooks      []string // 包含本地内容的 hook 条目
 }
 
 // AnalyzeHooks 分析 hooks 配置，检测是否包含设备特定内容
-func AnalyzeHooks(data []byte) (*HooksAnalysis, error) {
+func (d *Detector) AnalyzeHooks(data []byte) (*HooksAnalysis, error) {
 	var obj map[string]interface{}
 	if err := json.Unmarshal(data, &obj); err != nil {
 		return nil, err
@@ -47,9 +37,21 @@ func AnalyzeHooks(data []byte) (*HooksAnalysis, error) {
 		return analysis, nil
 	}
 
-	// 收集 hook 类型
-	for hookType := range hooksMap {
-		analysis.HookTypes = append(analysis.HookTypes, hookType)
+	// 按条目收集包含本地内容的 hook；非标准格式时列出全部类型
+	if entries, ok := FlattenHooks(hooksMap); ok {
+		for _, entry := range entries {
+			if !d.IsLocalHook(entry) {
+				continue
+			}
+			analysis.LocalHooks = append(analysis.LocalHooks, entry.Describe())
+			if !containsString(analysis.HookTypes, entry.Type) {
+				analysis.HookTypes = append(analysis.HookTypes, entry.Type)
+			}
+		}
+	} else {
+		for hookType := range hooksMap {
+			analysis.HookTypes = append(analysis.HookTypes, hookType)
+		}
 	}
 
 	// 序列化 hooks 部分来检查内容
@@ -61,13 +63,10 @@ func AnalyzeHooks(data []byte) (*HooksAnalysis, error) {
 	hooksStr := string(hooksJSON)
 
 	// 检测本地特定模式
-	for _, pattern := range LocalPatterns {
-		matches := pattern.FindAllString(hooksStr, -1)
-		for _, match := range matches {
-			if !containsString(analysis.LocalMatches, match) {
-				analysis.LocalMatches = append(analysis.LocalMatches, match)
-				analysis.HasLocalContent = true
-			}
+	for _, found := range d.matches(hooksStr) {
+		if !containsString(analysis.LocalMatches, found.Match) {
+			analysis.LocalMatches = append(analysis.LocalMatches, found.Match)
+			analysis.HasLocalContent = true
 		}
 	}
 
@@ -86,12 +85,13 @@ func ExtractHooks(data []byte) ([]byte, error) {
 		return []byte("{}"), nil
 	}
 
-	return json.MarshalIndent(hooks, "", "  ")
+	return jsondoc.MarshalIndent(hooks)
 }
 
 // MergeHooksSelectively 选择性合并 hooks
-// 如果 skipLocal 为 true，则跳过包含本地内容的 hooks
-func MergeHooksSelectively(local, remote []byte, skipLocalContent bool) ([]byte, error) {
+// 按 hook 条目（类型 + matcher + 命令）取并集：同一条目远端覆盖本地，
+// 本地独有的条目保留；skipLocalContent 为 true 时跳过远端含本地内容的条目
+func (d *Detector) MergeHooksSelectively(local, remote []byte, skipLocalContent bool) ([]byte, error) {
 	var localObj, remoteObj map[string]interface{}
 
 	if err := json.Unmarshal(local, &localObj); err != nil {
@@ -101,6 +101,28 @@ func MergeHooksSelectively(local, remote []byte, skipLocalContent bool) ([]byte,
 		return local, nil
 	}
 
+	if hooks, ok := d.MergeHookEntries(localObj["hooks"], remoteObj["hooks"], skipLocalContent); ok {
+		if hooks == nil {
+			delete(localObj, "hooks")
+		} else {
+			localObj["hooks"] = hooks
+		}
+	} else {
+		d.mergeHookTypes(localObj, remoteObj, skipLocalContent)
+	}
+
+	// 合并其他字段（非 hooks）
+	for key, value := range remoteObj {
+		if key != "hooks" {
+			localObj[key] = value
+		}
+	}
+
+	return jsondoc.MarshalIndent(localObj)
+}
+
+// mergeHookTypes 按 hook 类型合并，用于无法按条目解析的非标准 hooks 格式
+func (d *Detector) mergeHookTypes(localObj, remoteObj map[string]interface{}, skipLocalContent bool) {
 	localHooks, _ := localObj["hooks"].(map[string]interface{})
 	remoteHooks, _ := remoteObj["hooks"].(map[string]interface{})
 
@@ -108,44 +130,16 @@ func MergeHooksSelectively(local, remote []byte, skipLocalContent bool) ([]byte,
 		localHooks = make(map[string]interface{})
 	}
 
-	if remoteHooks == nil {
-		localObj["hooks"] = localHooks
-		return json.MarshalIndent(localObj, "", "  ")
-	}
-
-	// 合并远程 hooks 到本地
 	for hookType, hookConfig := range remoteHooks {
 		hookJSON, _ := json.Marshal(hookConfig)
-		hookStr := string(hookJSON)
-
-		// 检查是否包含本地特定内容
-		hasLocal := false
-		if skipLocalContent {
-			for _, pattern := range LocalPatterns {
-				if pattern.MatchString(hookStr) {
-					hasLocal = true
-					break
-				}
-			}
-		}
-
-		if !hasLocal {
-			// 不包含本地内容，直接使用远程版本
-			localHooks[hookType] = hookConfig
+		if skipLocalContent && d.MatchString(string(hookJSON)) {
+			// 包含本地内容，保留本地版本
+			continue
 		}
-		// 如果包含本地内容且 skipLocalContent=true，保留本地版本
+		localHooks[hookType] = hookConfig
 	}
 
 	localObj["hooks"] = localHooks
-
-	// 合并其他字段（非 hooks）
-	for key, value := range remoteObj {
-		if key != "hooks" {
-			localObj[key] = value
-		}
-	}
-
-	return json.MarshalIndent(localObj, "", "  ")
 }
 
 // FormatLocalMatches 格式化本地匹配内容用于显示
@@ -172,59 +166,3 @@ func containsString(slice []string, s string) bool {
 	}
 	return false
 }
-
-// FilterLocalHooks 过滤掉包含本地特定内容的 hooks（用于 push）
-// 返回过滤后的 JSON 数据和被过滤的 hook 类型列表
-func FilterLocalHooks(data []byte) ([]byte, []string, error) {
-	var obj map[string]interface{}
-	if err := json.Unmarshal(data, &obj); err != nil {
-		return data, nil, err
-	}
-
-	hooks, ok := obj["hooks"]
-	if !ok {
-		return data, nil, nil
-	}
-
-	hooksMap, ok := hooks.(map[string]interface{})
-	if !ok {
-		return data, nil, nil
-	}
-
-	var filteredTypes []string
-	filteredHooks := make(map[string]interface{})
-
-	for hookType, hookConfig := range hooksMap {
-		hookJSON, _ := json.Marshal(hookConfig)
-		hookStr := string(hookJSON)
-
-		// 检查是否包含本地特定内容
-		hasLocal := false
-		for _, pattern := range LocalPatterns {
-			if pattern.MatchString(hookStr) {
-				hasLocal = true
-				break
-			}
-		}
-
-		if hasLocal {
-			filteredTypes = append(filteredTypes, hookType)
-		} else {
-			filteredHooks[hookType] = hookConfig
-		}
-	}
-
-	// 更新 hooks
-	if len(filteredHooks) > 0 {
-		obj["hooks"] = filteredHooks
-	} else {
-		delete(obj, "hooks")
-	}
-
-	result, err := json.MarshalIndent(obj, "", "  ")
-	if err != nil {
-		return data, nil, err
-	}
-
-	return result, filteredTypes, nil
-}
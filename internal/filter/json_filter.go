@@ -3,25 +3,35 @@ package filter
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 
 	"github.com/yxuechao007/claude_sync/internal/config"
+	"github.com/yxuechao007/claude_sync/internal/jsondoc"
+	"github.com/yxuechao007/claude_sync/internal/jsonpath"
 )
 
 // FilterJSON filters a JSON object based on the filter configuration
-// If filter is nil, returns the original JSON unchanged
+// If filter is nil, returns the original JSON unchanged.
+// Fields are dotted paths with optional wildcards, e.g. "env.OPENAI_*" or
+// "mcpServers.*.env". Include is applied first, then exclude.
 func FilterJSON(data []byte, filter *config.FilterConfig) ([]byte, error) {
 	if filter == nil {
 		return data, nil
 	}
 
+	rules, err := parseRules(filter)
+	if err != nil {
+		return nil, err
+	}
+
 	var obj map[string]interface{}
 	if err := json.Unmarshal(data, &obj); err != nil {
 		return nil, fmt.Errorf("failed to parse JSON: %w", err)
 	}
 
-	filtered := filterObject(obj, filter)
+	filtered := rules.selectObject(obj)
 
-	result, err := json.MarshalIndent(filtered, "", "  ")
+	result, err := jsondoc.MarshalIndent(filtered)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal filtered JSON: %w", err)
 	}
@@ -29,54 +39,221 @@ func FilterJSON(data []byte, filter *config.FilterConfig) ([]byte, error) {
 	return result, nil
 }
 
-// filterObject filters a map based on include/exclude rules
-func filterObject(obj map[string]interface{}, filter *config.FilterConfig) map[string]interface{} {
-	result := make(map[string]interface{})
+// filterRules holds the parsed include/exclude paths of a FilterConfig
+type filterRules struct {
+	include []jsonpath.Path
+	exclude []jsonpath.Path
+}
+
+func parseRules(filter *config.FilterConfig) (filterRules, error) {
+	include, err := jsonpath.ParseAll(filter.IncludeFields)
+	if err != nil {
+		return filterRules{}, fmt.Errorf("invalid include_fields: %w", err)
+	}
+	exclude, err := jsonpath.ParseAll(filter.ExcludeFields)
+	if err != nil {
+		return filterRules{}, fmt.Errorf("invalid exclude_fields: %w", err)
+	}
+	return filterRules{include: include, exclude: exclude}, nil
+}
+
+// scope reports how the value at path relates to the synced region:
+// in=true means the whole subtree is synced, out=true means none of it is,
+// and neither means the subtree has to be walked.
+func (r filterRules) scope(path []string) (in, out bool) {
+	excFull, excPartial := jsonpath.Match(r.exclude, path)
+	if excFull {
+		return false, true
+	}
+	incFull, incPartial := true, false
+	if len(r.include) > 0 {
+		incFull, incPartial = jsonpath.Match(r.include, path)
+	}
+	switch {
+	case !incFull && !incPartial:
+		return false, true
+	case incFull && !excPartial:
+		return true, false
+	}
+	return false, false
+}
 
-	// If include_fields is specified, only include those fields
-	if len(filter.IncludeFields) > 0 {
-		includeSet := make(map[string]bool)
-		for _, field := range filter.IncludeFields {
-			includeSet[field] = true
+// selectObject returns the synced part of obj
+func (r filterRules) selectObject(obj map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	for key, value := range obj {
+		if v, ok := r.selectValue(value, []string{key}); ok {
+			result[key] = v
 		}
+	}
+	return result
+}
 
-		for key, value := range obj {
-			if includeSet[key] {
-				result[key] = value
-			}
+func (r filterRules) selectValue(value interface{}, path []string) (interface{}, bool) {
+	in, out := r.scope(path)
+	if in {
+		return value, true
+	}
+	if out {
+		return nil, false
+	}
+
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		// include 指向更深的路径但这里不是对象：没有可同步的内容；
+		// exclude 指向更深的路径但这里不是对象：整个值都同步
+		incFull, _ := jsonpath.Match(r.include, path)
+		return value, len(r.include) == 0 || incFull
+	}
+
+	result := make(map[string]interface{})
+	for key, child := range obj {
+		if v, ok := r.selectValue(child, appendPath(path, key)); ok {
+			result[key] = v
 		}
+	}
+	incFull, _ := jsonpath.Match(r.include, path)
+	if len(result) == 0 && len(r.include) > 0 && !incFull {
+		return nil, false
+	}
+	return result, true
+}
+
+// unincluded returns the part of obj outside the include paths,
+// i.e. local data that pull must leave untouched
+func (r filterRules) unincluded(obj map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	if len(r.include) == 0 {
 		return result
 	}
+	for key, value := range obj {
+		if v, ok := r.unincludedValue(value, []string{key}); ok {
+			result[key] = v
+		}
+	}
+	return result
+}
 
-	// If exclude_fields is specified, include everything except those fields
-	if len(filter.ExcludeFields) > 0 {
-		excludeSet := make(map[string]bool)
-		for _, field := range filter.ExcludeFields {
-			excludeSet[field] = true
+func (r filterRules) unincludedValue(value interface{}, path []string) (interface{}, bool) {
+	full, partial := jsonpath.Match(r.include, path)
+	if full {
+		return nil, false
+	}
+	if !partial {
+		return value, true
+	}
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return value, true
+	}
+	result := make(map[string]interface{})
+	for key, child := range obj {
+		if v, ok := r.unincludedValue(child, appendPath(path, key)); ok {
+			result[key] = v
 		}
+	}
+	if len(result) == 0 {
+		return nil, false
+	}
+	return result, true
+}
 
-		for key, value := range obj {
-			if !excludeSet[key] {
-				result[key] = value
+// restoreExcluded copies values matching exclude paths from local into dst,
+// and drops them from dst when local has none. Values are only restored
+// under objects that still exist in dst, so an entry deleted remotely is not
+// brought back just because it had a local-only field.
+func (r filterRules) restoreExcluded(dst, local map[string]interface{}) {
+	for _, pattern := range r.exclude {
+		restorePath(dst, local, pattern)
+	}
+}
+
+func restorePath(dst, local map[string]interface{}, pattern jsonpath.Path) {
+	segment := pattern[0]
+	keys := make(map[string]bool)
+	for key := range dst {
+		keys[key] = true
+	}
+	for key := range local {
+		keys[key] = true
+	}
+
+	for key := range keys {
+		if !jsonpath.MatchSegment(segment, key) {
+			continue
+		}
+		if len(pattern) == 1 {
+			if value, ok := local[key]; ok {
+				dst[key] = value
+			} else {
+				delete(dst, key)
 			}
+			continue
 		}
-		return result
+		dstChild, ok1 := dst[key].(map[string]interface{})
+		localChild, ok2 := local[key].(map[string]interface{})
+		if !ok1 {
+			continue
+		}
+		if !ok2 {
+			localChild = map[string]interface{}{}
+		}
+		restorePath(dstChild, localChild, pattern[1:])
 	}
+}
 
-	// No filter rules, return original
-	return obj
+func appendPath(path []string, key string) []string {
+	next := make([]string, len(path)+1)
+	copy(next, path)
+	next[len(path)] = key
+	return next
+}
+
+// deepMerge copies src into dst, merging nested objects
+func deepMerge(dst, src map[string]interface{}) {
+	for key, value := range src {
+		dstObj, ok1 := dst[key].(map[string]interface{})
+		srcObj, ok2 := value.(map[string]interface{})
+		if ok1 && ok2 {
+			deepMerge(dstObj, srcObj)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+// addMissing copies keys from src that dst lacks, at any depth
+func addMissing(dst, src map[string]interface{}) {
+	for key, value := range src {
+		existing, exists := dst[key]
+		if !exists {
+			dst[key] = value
+			continue
+		}
+		dstObj, ok1 := existing.(map[string]interface{})
+		srcObj, ok2 := value.(map[string]interface{})
+		if ok1 && ok2 {
+			addMissing(dstObj, srcObj)
+		}
+	}
 }
 
 // MergeJSON merges filtered JSON back into the original file
 // This is used when pulling: we want to update only the synced fields
-// while preserving other fields in the local file
+// while preserving other fields in the local file (including fields
+// removed by nested exclude paths such as "mcpServers.*.env")
 func MergeJSON(original, filtered []byte, filter *config.FilterConfig) ([]byte, error) {
 	if filter == nil {
 		return filtered, nil
 	}
 
+	rules, err := parseRules(filter)
+	if err != nil {
+		return nil, err
+	}
+
 	var origObj map[string]interface{}
-	if err := json.Unmarshal(original, &origObj); err != nil {
+	if err := json.Unmarshal(original, &origObj); err != nil || origObj == nil {
 		// If original is empty or invalid, just return filtered
 		origObj = make(map[string]interface{})
 	}
@@ -86,12 +263,19 @@ func MergeJSON(original, filtered []byte, filter *config.FilterConfig) ([]byte,
 		return nil, fmt.Errorf("failed to parse filtered JSON: %w", err)
 	}
 
-	// Merge filtered fields into original
-	for key, value := range filteredObj {
-		origObj[key] = value
+	// Merge filtered fields into original, then put back the local parts of
+	// those fields that are outside the include paths or match exclude paths
+	merged := make(map[string]interface{}, len(origObj))
+	for key, value := range origObj {
+		merged[key] = value
+	}
+	for key, value := range rules.selectObject(filteredObj) {
+		merged[key] = value
 	}
+	deepMerge(merged, rules.unincluded(origObj))
+	rules.restoreExcluded(merged, origObj)
 
-	result, err := json.MarshalIndent(origObj, "", "  ")
+	result, err := jsondoc.MarshalIndent(merged)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal merged JSON: %w", err)
 	}
@@ -106,8 +290,13 @@ func MergeJSONKeepLocal(original, filtered []byte, filter *config.FilterConfig)
 		return original, nil
 	}
 
+	rules, err := parseRules(filter)
+	if err != nil {
+		return nil, err
+	}
+
 	var origObj map[string]interface{}
-	if err := json.Unmarshal(original, &origObj); err != nil {
+	if err := json.Unmarshal(original, &origObj); err != nil || origObj == nil {
 		origObj = make(map[string]interface{})
 	}
 
@@ -116,14 +305,10 @@ func MergeJSONKeepLocal(original, filtered []byte, filter *config.FilterConfig)
 		return nil, fmt.Errorf("failed to parse filtered JSON: %w", err)
 	}
 
-	// Only add fields that don't exist in original
-	for key, value := range filteredObj {
-		if _, exists := origObj[key]; !exists {
-			origObj[key] = value
-		}
-	}
+	// Only add synced fields that don't exist in original
+	addMissing(origObj, rules.selectObject(filteredObj))
 
-	result, err := json.MarshalIndent(origObj, "", "  ")
+	result, err := jsondoc.MarshalIndent(origObj)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal merged JSON: %w", err)
 	}
@@ -131,21 +316,23 @@ func MergeJSONKeepLocal(original, filtered []byte, filter *config.FilterConfig)
 	return result, nil
 }
 
-// ExtractFields extracts specific fields from JSON
+// ExtractFields extracts specific fields from JSON. Fields are dotted paths
+// with optional wildcards, like the include_fields of a filter; the result
+// keeps the nesting of the extracted values.
 func ExtractFields(data []byte, fields []string) (map[string]interface{}, error) {
 	var obj map[string]interface{}
 	if err := json.Unmarshal(data, &obj); err != nil {
 		return nil, fmt.Errorf("failed to parse JSON: %w", err)
 	}
-
-	result := make(map[string]interface{})
-	for _, field := range fields {
-		if value, ok := obj[field]; ok {
-			result[field] = value
-		}
+	if len(fields) == 0 {
+		return make(map[string]interface{}), nil
 	}
 
-	return result, nil
+	rules, err := parseRules(&config.FilterConfig{IncludeFields: fields})
+	if err != nil {
+		return nil, err
+	}
+	return rules.selectObject(obj), nil
 }
 
 // CompareFiltered compares two JSON objects considering only the filtered fields
@@ -175,3 +362,72 @@ func CompareFiltered(data1, data2 []byte, filter *config.FilterConfig) (bool, er
 
 	return string(norm1) == string(norm2), nil
 }
+
+// Removal describes a value FilterJSON leaves out and the rule responsible
+type Removal struct {
+	Path   string
+	Reason string
+}
+
+// FilterRemovals lists the values of data that FilterJSON drops. Excluded
+// values are listed at the path the exclude rule matched; values outside
+// include_fields are listed at the shallowest key not covered.
+func FilterRemovals(data []byte, filter *config.FilterConfig) ([]Removal, error) {
+	if filter == nil {
+		return nil, nil
+	}
+	rules, err := parseRules(filter)
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+
+	var removals []Removal
+	var walk func(value interface{}, path []string, display string)
+	walk = func(value interface{}, path []string, display string) {
+		in, out := rules.scope(path)
+		if in {
+			return
+		}
+		if out {
+			removals = append(removals, Removal{Path: display, Reason: rules.reason(path, filter)})
+			return
+		}
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			if incFull, _ := jsonpath.Match(rules.include, path); len(rules.include) > 0 && !incFull {
+				removals = append(removals, Removal{Path: display, Reason: "not in include_fields"})
+			}
+			return
+		}
+		for _, key := range sortedMapKeys(m) {
+			walk(m[key], appendPath(path, key), joinDisplay(display, key))
+		}
+	}
+	for _, key := range sortedMapKeys(obj) {
+		walk(obj[key], []string{key}, joinDisplay("", key))
+	}
+	return removals, nil
+}
+
+// reason names the filter rule that leaves path out
+func (r filterRules) reason(path []string, filter *config.FilterConfig) string {
+	for i, pattern := range r.exclude {
+		if full, _ := jsonpath.Match([]jsonpath.Path{pattern}, path); full {
+			return "exclude_fields: " + filter.ExcludeFields[i]
+		}
+	}
+	return "not in include_fields"
+}
+
+func sortedMapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,144 @@
+package filter
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/yxuechao007/claude_sync/internal/config"
+)
+
+func decode(t *testing.T, data []byte) map[string]interface{} {
+	t.Helper()
+	var obj map[string]interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		t.Fatalf("decode %s: %v", data, err)
+	}
+	return obj
+}
+
+func assertJSON(t *testing.T, got []byte, want string) {
+	t.Helper()
+	if !reflect.DeepEqual(decode(t, got), decode(t, []byte(want))) {
+		t.Fatalf("got %s\nwant %s", got, want)
+	}
+}
+
+func TestFilterJSONNestedPaths(t *testing.T) {
+	data := []byte(`{
+		"model": "opus",
+		"env": {"OPENAI_API_KEY": "k", "OPENAI_BASE": "b", "PATH": "/bin"},
+		"mcpServers": {"foo": {"command": "npx", "env": {"TOKEN": "t"}}},
+		"projects": {"/work/a.b": {"allowedTools": ["Bash"], "history": [1]}}
+	}`)
+	filter := &config.FilterConfig{
+		IncludeFields: []string{"env.OPENAI_*", "mcpServers", "projects.*.allowedTools"},
+		ExcludeFields: []string{"mcpServers.*.env"},
+	}
+
+	got, err := FilterJSON(data, filter)
+	if err != nil {
+		t.Fatalf("FilterJSON: %v", err)
+	}
+	assertJSON(t, got, `{
+		"env": {"OPENAI_API_KEY": "k", "OPENAI_BASE": "b"},
+		"mcpServers": {"foo": {"command": "npx"}},
+		"projects": {"/work/a.b": {"allowedTools": ["Bash"]}}
+	}`)
+}
+
+func TestFilterJSONTopLevelExcludeUnchanged(t *testing.T) {
+	got, err := FilterJSON([]byte(`{"env": {"A": "1"}, "hooks": {}}`), &config.FilterConfig{ExcludeFields: []string{"env"}})
+	if err != nil {
+		t.Fatalf("FilterJSON: %v", err)
+	}
+	assertJSON(t, got, `{"hooks": {}}`)
+}
+
+func TestExtractFieldsNestedPaths(t *testing.T) {
+	data := []byte(`{"model": "opus", "env": {"OPENAI_API_KEY": "k", "PATH": "/bin"}, "theme": "dark"}`)
+	got, err := ExtractFields(data, []string{"model", "env.OPENAI_*"})
+	if err != nil {
+		t.Fatalf("ExtractFields: %v", err)
+	}
+	want := map[string]interface{}{"model": "opus", "env": map[string]interface{}{"OPENAI_API_KEY": "k"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestMergeJSONKeepsExcludedAndUnincludedLocalFields(t *testing.T) {
+	local := []byte(`{
+		"env": {"OPENAI_API_KEY": "old", "PATH": "/bin"},
+		"mcpServers": {"foo": {"command": "old", "env": {"TOKEN": "local"}}, "gone": {"command": "x", "env": {"A": "1"}}},
+		"other": true
+	}`)
+	remote := []byte(`{
+		"env": {"OPENAI_API_KEY": "new"},
+		"mcpServers": {"foo": {"command": "new"}, "bar": {"command": "bar"}}
+	}`)
+	filter := &config.FilterConfig{
+		IncludeFields: []string{"env.OPENAI_*", "mcpServers"},
+		ExcludeFields: []string{"mcpServers.*.env"},
+	}
+
+	got, err := MergeJSON(local, remote, filter)
+	if err != nil {
+		t.Fatalf("MergeJSON: %v", err)
+	}
+	// gone 在远端被删除，不应因为本地的 env 而被恢复
+	assertJSON(t, got, `{
+		"env": {"OPENAI_API_KEY": "new", "PATH": "/bin"},
+		"mcpServers": {"foo": {"command": "new", "env": {"TOKEN": "local"}}, "bar": {"command": "bar"}},
+		"other": true
+	}`)
+
+	equal, err := CompareFiltered(local, got, &config.FilterConfig{ExcludeFields: []string{"mcpServers", "env.OPENAI_*"}})
+	if err != nil || !equal {
+		t.Fatalf("CompareFiltered = %v, %v; want unsynced parts untouched", equal, err)
+	}
+}
+
+func TestMergeJSONKeepLocalAddsNestedFields(t *testing.T) {
+	local := []byte(`{"mcpServers": {"foo": {"command": "local", "env": {"T": "1"}}}}`)
+	remote := []byte(`{"mcpServers": {"foo": {"command": "remote", "env": {"T": "2"}}, "bar": {"command": "bar", "env": {"T": "3"}}}}`)
+	filter := &config.FilterConfig{
+		IncludeFields: []string{"mcpServers"},
+		ExcludeFields: []string{"mcpServers.*.env"},
+	}
+
+	got, err := MergeJSONKeepLocal(local, remote, filter)
+	if err != nil {
+		t.Fatalf("MergeJSONKeepLocal: %v", err)
+	}
+	assertJSON(t, got, `{"mcpServers": {"foo": {"command": "local", "env": {"T": "1"}}, "bar": {"command": "bar"}}}`)
+}
+
+func TestFilterRemovals(t *testing.T) {
+	data := []byte(`{
+		"model": "opus",
+		"env": {"OPENAI_API_KEY": "k", "PATH": "/bin"},
+		"mcpServers": {"foo": {"command": "npx", "env": {"TOKEN": "t"}}}
+	}`)
+	filter := &config.FilterConfig{
+		IncludeFields: []string{"env.OPENAI_*", "mcpServers"},
+		ExcludeFields: []string{"mcpServers.*.env"},
+	}
+
+	got, err := FilterRemovals(data, filter)
+	if err != nil {
+		t.Fatalf("FilterRemovals: %v", err)
+	}
+	want := []Removal{
+		{Path: "env.PATH", Reason: "not in include_fields"},
+		{Path: "mcpServers.foo.env", Reason: "exclude_fields: mcpServers.*.env"},
+		{Path: "model", Reason: "not in include_fields"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("removals = %+v\nwant %+v", got, want)
+	}
+
+	if removals, err := FilterRemovals(data, nil); err != nil || removals != nil {
+		t.Fatalf("nil filter = %+v, %v", removals, err)
+	}
+}
@@ -39,6 +39,13 @@ type Gist struct {
 	Files       map[string]GistFile `json:"files"`
 	CreatedAt   time.Time           `json:"created_at,omitempty"`
 	UpdatedAt   time.Time           `json:"updated_at,omitempty"`
+	History     []GistHistory       `json:"history,omitempty"`
+}
+
+// GistHistory is one revision in a gist's history
+type GistHistory struct {
+	Version     string    `json:"version"`
+	CommittedAt time.Time `json:"committed_at"`
 }
 
 // CreateGistRequest is the request body for creating a gist
@@ -147,6 +154,31 @@ func (c *Client) Get(gistID string) (*Gist, error) {
 	return &gist, nil
 }
 
+// GetRevision retrieves a specific revision of a gist
+func (c *Client) GetRevision(gistID, sha string) (*Gist, error) {
+	resp, err := c.doRequest("GET", apiBaseURL+"/gists/"+gistID+"/"+sha, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("gist revision not found: %s", sha)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to get gist revision: %s - %s", resp.Status, string(body))
+	}
+
+	var gist Gist
+	if err := json.NewDecoder(resp.Body).Decode(&gist); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &gist, nil
+}
+
 // Update updates an existing gist
 func (c *Client) Update(gistID string, files map[string]string) (*Gist, error) {
 	gistFiles := make(map[string]GistFile)
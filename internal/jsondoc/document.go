@@ -0,0 +1,254 @@
+package jsondoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// defaultIndent matches what Claude Code writes
+const defaultIndent = "  "
+
+// Document is a JSON object file that is edited in place and written back
+// with its original key order, indentation and trailing newline
+type Document struct {
+	root            *Object
+	indent          string
+	trailingNewline bool
+}
+
+// ParseDocument parses a JSON object and records its layout
+func ParseDocument(data []byte) (*Document, error) {
+	value, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	root, ok := value.(*Object)
+	if !ok {
+		return nil, fmt.Errorf("JSON document is not an object")
+	}
+	return &Document{
+		root:            root,
+		indent:          detectIndent(data),
+		trailingNewline: bytes.HasSuffix(bytes.TrimRight(data, " \t\r"), []byte("\n")),
+	}, nil
+}
+
+// Root returns the top-level object
+func (d *Document) Root() *Object {
+	return d.root
+}
+
+// Get returns the value at path, a list of literal object keys
+func (d *Document) Get(path []string) (interface{}, bool) {
+	var value interface{} = d.root
+	for _, key := range path {
+		obj, ok := value.(*Object)
+		if !ok {
+			return nil, false
+		}
+		if value, ok = obj.Get(key); !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// Set stores value at path, creating missing objects along the way.
+// An existing value is updated in place, so unchanged keys below path keep
+// their order; new keys are appended.
+func (d *Document) Set(path []string, value interface{}) error {
+	if len(path) == 0 {
+		obj, ok := Update(d.root, value).(*Object)
+		if !ok {
+			return fmt.Errorf("JSON document must stay an object")
+		}
+		d.root = obj
+		return nil
+	}
+	parent, err := d.parent(path, true)
+	if err != nil {
+		return err
+	}
+	key := path[len(path)-1]
+	old, _ := parent.Get(key)
+	parent.Set(key, Update(old, value))
+	return nil
+}
+
+// Delete removes the value at path and reports whether it existed
+func (d *Document) Delete(path []string) bool {
+	if len(path) == 0 {
+		return false
+	}
+	parent, err := d.parent(path, false)
+	if err != nil || parent == nil {
+		return false
+	}
+	return parent.Delete(path[len(path)-1])
+}
+
+func (d *Document) parent(path []string, create bool) (*Object, error) {
+	obj := d.root
+	for i, key := range path[:len(path)-1] {
+		value, ok := obj.Get(key)
+		if !ok {
+			if !create {
+				return nil, nil
+			}
+			child := NewObject()
+			obj.Set(key, child)
+			obj = child
+			continue
+		}
+		child, ok := value.(*Object)
+		if !ok {
+			return nil, fmt.Errorf("%s is not an object", joinPath(path[:i+1]))
+		}
+		obj = child
+	}
+	return obj, nil
+}
+
+// Bytes encodes the document in its original layout
+func (d *Document) Bytes() ([]byte, error) {
+	data, err := Marshal(d.root, d.indent)
+	if err != nil {
+		return nil, err
+	}
+	if d.trailingNewline {
+		data = append(data, '\n')
+	}
+	return data, nil
+}
+
+// Update returns updated in the layout of old: keys of old objects keep
+// their order, keys missing from updated are dropped and new keys follow
+// in updated's order (sorted for plain maps). Numbers equal to the old value
+// keep their original spelling. The result is equal in content to updated.
+func Update(old, updated interface{}) interface{} {
+	switch val := updated.(type) {
+	case *Object, map[string]interface{}:
+		oldObj, _ := old.(*Object)
+		keys, get := objectEntries(val)
+		result := NewObject()
+		present := make(map[string]bool, len(keys))
+		for _, key := range keys {
+			present[key] = true
+		}
+		if oldObj != nil {
+			for _, key := range oldObj.keys {
+				if present[key] {
+					result.Set(key, Update(oldObj.values[key], get(key)))
+				}
+			}
+		}
+		for _, key := range keys {
+			if _, done := result.values[key]; !done {
+				var prev interface{}
+				if oldObj != nil {
+					prev = oldObj.values[key]
+				}
+				result.Set(key, Update(prev, get(key)))
+			}
+		}
+		return result
+	case []interface{}:
+		oldList, _ := old.([]interface{})
+		result := make([]interface{}, len(val))
+		for i, child := range val {
+			var prev interface{}
+			if i < len(oldList) {
+				prev = oldList[i]
+			}
+			result[i] = Update(prev, child)
+		}
+		return result
+	}
+	if oldNum, ok := old.(json.Number); ok && sameNumber(oldNum, updated) {
+		return oldNum
+	}
+	return updated
+}
+
+// objectEntries returns the keys of an *Object or plain map with a getter
+func objectEntries(v interface{}) ([]string, func(string) interface{}) {
+	switch val := v.(type) {
+	case *Object:
+		return val.keys, func(key string) interface{} { return val.values[key] }
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return keys, func(key string) interface{} { return val[key] }
+	}
+	return nil, nil
+}
+
+func sameNumber(old json.Number, v interface{}) bool {
+	a, err := old.Float64()
+	if err != nil {
+		return false
+	}
+	switch n := v.(type) {
+	case json.Number:
+		b, err := n.Float64()
+		return err == nil && a == b
+	case float64:
+		return a == n
+	case int:
+		return a == float64(n)
+	case int64:
+		return a == float64(n)
+	}
+	return false
+}
+
+// Rewrite returns updated laid out like original, so only the values that
+// actually changed differ. If either side is not a JSON object, updated is
+// returned unchanged.
+func Rewrite(original, updated []byte) ([]byte, error) {
+	doc, err := ParseDocument(original)
+	if err != nil {
+		return updated, nil
+	}
+	value, err := Parse(updated)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse updated JSON: %w", err)
+	}
+	if _, ok := value.(*Object); !ok {
+		return updated, nil
+	}
+	if err := doc.Set(nil, value); err != nil {
+		return nil, err
+	}
+	return doc.Bytes()
+}
+
+// detectIndent returns the indentation of the first indented line, the
+// empty string for compact single-line documents, or two spaces
+func detectIndent(data []byte) string {
+	trimmed := bytes.TrimSpace(data)
+	if !bytes.Contains(trimmed, []byte("\n")) {
+		if len(trimmed) > len("{}") {
+			return ""
+		}
+		return defaultIndent
+	}
+	for _, line := range bytes.Split(trimmed, []byte("\n"))[1:] {
+		trimmed := bytes.TrimLeft(line, " \t")
+		if len(trimmed) == 0 || len(trimmed) == len(line) {
+			continue
+		}
+		return string(line[:len(line)-len(trimmed)])
+	}
+	return defaultIndent
+}
+
+func joinPath(path []string) string {
+	return strings.Join(path, ".")
+}
@@ -0,0 +1,254 @@
+// Package jsondoc edits JSON documents without disturbing their layout.
+//
+// Objects keep the key order of the source file, numbers keep their
+// original spelling and strings are written without HTML escaping, so
+// rewriting a file only changes the keys that were actually edited.
+package jsondoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Object is a JSON object that remembers the order of its keys
+type Object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// NewObject returns an empty object
+func NewObject() *Object {
+	return &Object{values: make(map[string]interface{})}
+}
+
+// Keys returns the keys in document order
+func (o *Object) Keys() []string {
+	return append([]string(nil), o.keys...)
+}
+
+// Len returns the number of keys
+func (o *Object) Len() int {
+	return len(o.keys)
+}
+
+// Get returns the value of key
+func (o *Object) Get(key string) (interface{}, bool) {
+	v, ok := o.values[key]
+	return v, ok
+}
+
+// Set replaces the value of key, appending the key when it is new
+func (o *Object) Set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// Delete removes key and reports whether it existed
+func (o *Object) Delete(key string) bool {
+	if _, ok := o.values[key]; !ok {
+		return false
+	}
+	delete(o.values, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Rename moves the value of oldKey to newKey at the same position.
+// It reports false when oldKey is missing or newKey already exists.
+func (o *Object) Rename(oldKey, newKey string) bool {
+	value, ok := o.values[oldKey]
+	if !ok {
+		return false
+	}
+	if _, exists := o.values[newKey]; exists {
+		return false
+	}
+	delete(o.values, oldKey)
+	o.values[newKey] = value
+	for i, k := range o.keys {
+		if k == oldKey {
+			o.keys[i] = newKey
+			break
+		}
+	}
+	return true
+}
+
+// Parse decodes JSON into ordered values: *Object, []interface{}, string,
+// json.Number, bool or nil
+func Parse(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	value, err := parseValue(decoder)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return value, nil
+}
+
+func parseValue(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return token, nil
+	}
+	switch delim {
+	case '{':
+		obj := NewObject()
+		for decoder.More() {
+			keyToken, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, ok := keyToken.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid object key %v", keyToken)
+			}
+			value, err := parseValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			obj.Set(key, value)
+		}
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		return obj, nil
+	case '[':
+		list := []interface{}{}
+		for decoder.More() {
+			value, err := parseValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("unexpected delimiter %v", delim)
+}
+
+// Marshal encodes v with the given indent (compact when empty) and without
+// HTML escaping. Plain maps are written with sorted keys, like encoding/json.
+func Marshal(v interface{}, indent string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeValue(&buf, v, indent, 0); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalIndent is a drop-in for json.MarshalIndent(v, "", "  ") that does
+// not escape &, < and >
+func MarshalIndent(v interface{}) ([]byte, error) {
+	return Marshal(v, "  ")
+}
+
+func writeValue(buf *bytes.Buffer, v interface{}, indent string, depth int) error {
+	switch val := v.(type) {
+	case *Object:
+		return writeObject(buf, val.keys, func(key string) interface{} { return val.values[key] }, indent, depth)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return writeObject(buf, keys, func(key string) interface{} { return val[key] }, indent, depth)
+	case []interface{}:
+		if len(val) == 0 {
+			buf.WriteString("[]")
+			return nil
+		}
+		buf.WriteByte('[')
+		for i, child := range val {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			newline(buf, indent, depth+1)
+			if err := writeValue(buf, child, indent, depth+1); err != nil {
+				return err
+			}
+		}
+		newline(buf, indent, depth)
+		buf.WriteByte(']')
+		return nil
+	case json.Number:
+		buf.WriteString(val.String())
+		return nil
+	}
+	return writeScalar(buf, v, indent, depth)
+}
+
+func writeObject(buf *bytes.Buffer, keys []string, get func(string) interface{}, indent string, depth int) error {
+	if len(keys) == 0 {
+		buf.WriteString("{}")
+		return nil
+	}
+	buf.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		newline(buf, indent, depth+1)
+		if err := writeScalar(buf, key, "", 0); err != nil {
+			return err
+		}
+		buf.WriteByte(':')
+		if indent != "" {
+			buf.WriteByte(' ')
+		}
+		if err := writeValue(buf, get(key), indent, depth+1); err != nil {
+			return err
+		}
+	}
+	newline(buf, indent, depth)
+	buf.WriteByte('}')
+	return nil
+}
+
+// writeScalar encodes strings, numbers, booleans and any other Go value
+// through encoding/json with HTML escaping disabled
+func writeScalar(buf *bytes.Buffer, v interface{}, indent string, depth int) error {
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if indent != "" {
+		encoder.SetIndent(strings.Repeat(indent, depth), indent)
+	}
+	if err := encoder.Encode(v); err != nil {
+		return err
+	}
+	buf.Write(bytes.TrimSuffix(out.Bytes(), []byte("\n")))
+	return nil
+}
+
+func newline(buf *bytes.Buffer, indent string, depth int) {
+	if indent == "" {
+		return
+	}
+	buf.WriteByte('\n')
+	for i := 0; i < depth; i++ {
+		buf.WriteString(indent)
+	}
+}
@@ -0,0 +1,107 @@
+package jsondoc
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRewriteKeepsLayout(t *testing.T) {
+	original := `{
+    "zeta": 1.0,
+    "hooks": {
+        "Stop": [{"command": "a && b"}]
+    },
+    "alpha": "x",
+    "gone": true
+}
+`
+	updated := `{"alpha": "y", "hooks": {"Stop": [{"command": "a && b"}]}, "new": [], "zeta": 1}`
+
+	got, err := Rewrite([]byte(original), []byte(updated))
+	if err != nil {
+		t.Fatalf("Rewrite: %v", err)
+	}
+	want := `{
+    "zeta": 1.0,
+    "hooks": {
+        "Stop": [
+            {
+                "command": "a && b"
+            }
+        ]
+    },
+    "alpha": "y",
+    "new": []
+}
+`
+	if string(got) != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRewriteIsStableForUnchangedContent(t *testing.T) {
+	original := "{\n  \"b\": {\n    \"x\": \"<tag>\"\n  },\n  \"a\": [\n    1,\n    2\n  ]\n}"
+	var v map[string]interface{}
+	if err := json.Unmarshal([]byte(original), &v); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	updated, _ := json.MarshalIndent(v, "", "  ")
+
+	got, err := Rewrite([]byte(original), updated)
+	if err != nil {
+		t.Fatalf("Rewrite: %v", err)
+	}
+	if string(got) != original {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, original)
+	}
+}
+
+func TestDocumentEditsByPath(t *testing.T) {
+	doc, err := ParseDocument([]byte(`{"projects":{"/b":{"x":1},"/a":{"mcpServers":{"z":{},"y":{}}}}}`))
+	if err != nil {
+		t.Fatalf("ParseDocument: %v", err)
+	}
+	if err := doc.Set([]string{"projects", "/a", "mcpServers"}, map[string]interface{}{
+		"y": map[string]interface{}{"url": "http://x?a=1&b=2"},
+		"z": map[string]interface{}{},
+		"w": map[string]interface{}{},
+	}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := doc.Set([]string{"projects", "/c", "allowedTools"}, []interface{}{"Bash"}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if !doc.Delete([]string{"projects", "/b"}) || doc.Delete([]string{"missing", "key"}) {
+		t.Fatalf("Delete reported wrong result")
+	}
+	if _, ok := doc.Get([]string{"projects", "/c", "allowedTools"}); !ok {
+		t.Fatalf("Get: created path not found")
+	}
+
+	got, err := doc.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+	want := `{"projects":{"/a":{"mcpServers":{"z":{},"y":{"url":"http://x?a=1&b=2"},"w":{}}},"/c":{"allowedTools":["Bash"]}}}`
+	if string(got) != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+
+	if err := doc.Set([]string{"projects", "/a", "mcpServers", "z", "k"}, 1); err != nil {
+		t.Fatalf("Set nested: %v", err)
+	}
+	if err := doc.Set([]string{"projects", "/c", "allowedTools", "k"}, 1); err == nil {
+		t.Fatalf("expected error setting a key below an array")
+	}
+}
+
+func TestMarshalIndentDoesNotEscapeHTML(t *testing.T) {
+	got, err := MarshalIndent(map[string]interface{}{"b": "<a> && c", "a": []interface{}{}})
+	if err != nil {
+		t.Fatalf("MarshalIndent: %v", err)
+	}
+	want := "{\n  \"a\": [],\n  \"b\": \"<a> && c\"\n}"
+	if string(got) != want {
+		t.Fatalf("got %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,160 @@
+// Package jsonpath parses the dotted key paths used by filters and merge
+// rules, e.g. "permissions.allow", "mcpServers.*.env" or
+// `projects["/work/my.app"].allowedTools`.
+package jsonpath
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Path is a parsed key path; each segment may contain * and ? wildcards
+type Path []string
+
+// Parse splits a dotted path into segments. Keys containing dots or
+// brackets can be written as ["..."] with JSON string quoting.
+func Parse(s string) (Path, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+
+	var path Path
+	i := 0
+	for i < len(s) {
+		if s[i] == '[' {
+			// 找到与开头引号配对的结尾，允许 key 中出现转义引号
+			end := -1
+			if i+1 < len(s) && s[i+1] == '"' {
+				end = closingBracket(s, i)
+			}
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q: unterminated [\"...\"]", s)
+			}
+			var key string
+			if err := json.Unmarshal([]byte(s[i+1:end]), &key); err != nil {
+				return nil, fmt.Errorf("invalid path %q: %v", s, err)
+			}
+			path = append(path, key)
+			i = end + 1
+			if i < len(s) && s[i] == '.' {
+				i++
+				if i == len(s) {
+					return nil, fmt.Errorf("invalid path %q: trailing dot", s)
+				}
+			}
+			continue
+		}
+
+		end := strings.IndexAny(s[i:], ".[")
+		if end < 0 {
+			end = len(s)
+		} else {
+			end += i
+		}
+		segment := s[i:end]
+		if segment == "" {
+			return nil, fmt.Errorf("invalid path %q: empty segment", s)
+		}
+		path = append(path, segment)
+		i = end
+		if i < len(s) && s[i] == '.' {
+			i++
+			if i == len(s) {
+				return nil, fmt.Errorf("invalid path %q: trailing dot", s)
+			}
+		}
+	}
+	return path, nil
+}
+
+// closingBracket returns the index of the ']' closing the ["..."] at start
+func closingBracket(s string, start int) int {
+	escaped := false
+	for i := start + 2; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case s[i] == '\\':
+			escaped = true
+		case s[i] == '"':
+			if i+1 < len(s) && s[i+1] == ']' {
+				return i + 1
+			}
+			return -1
+		}
+	}
+	return -1
+}
+
+// ParseAll parses a list of paths, returning the first error
+func ParseAll(paths []string) ([]Path, error) {
+	parsed := make([]Path, 0, len(paths))
+	for _, p := range paths {
+		path, err := Parse(p)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, path)
+	}
+	return parsed, nil
+}
+
+// MatchSegment reports whether key matches a segment pattern.
+// * matches any run of characters (including '/' and '.'), ? matches one.
+func MatchSegment(pattern, key string) bool {
+	if !strings.ContainsAny(pattern, "*?") {
+		return pattern == key
+	}
+	p, k := []rune(pattern), []rune(key)
+	// 经典的通配符匹配，记录最近一个 * 的位置用于回溯
+	pi, ki, star, mark := 0, 0, -1, 0
+	for ki < len(k) {
+		switch {
+		case pi < len(p) && (p[pi] == '?' || p[pi] == k[ki]):
+			pi++
+			ki++
+		case pi < len(p) && p[pi] == '*':
+			star, mark = pi, ki
+			pi++
+		case star >= 0:
+			pi = star + 1
+			mark++
+			ki = mark
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
+
+// Match compares a concrete key path against patterns.
+// full is true when some pattern matches the path or one of its ancestors
+// (the whole subtree is covered); partial is true when the path is a proper
+// prefix of some pattern, so only part of its subtree is covered.
+func Match(patterns []Path, path []string) (full, partial bool) {
+	for _, pattern := range patterns {
+		n := len(pattern)
+		if len(path) < n {
+			n = len(path)
+		}
+		matched := true
+		for i := 0; i < n; i++ {
+			if !MatchSegment(pattern[i], path[i]) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		if len(path) >= len(pattern) {
+			return true, false
+		}
+		partial = true
+	}
+	return false, partial
+}
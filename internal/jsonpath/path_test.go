@@ -0,0 +1,64 @@
+package jsonpath
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		input string
+		want  Path
+	}{
+		{input: "env", want: Path{"env"}},
+		{input: "mcpServers.*.env", want: Path{"mcpServers", "*", "env"}},
+		{input: `projects["/work/my.app"].allowedTools`, want: Path{"projects", "/work/my.app", "allowedTools"}},
+		{input: `a["x\"]y"]`, want: Path{"a", `x"]y`}},
+	}
+	for _, tc := range cases {
+		got, err := Parse(tc.input)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tc.input, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("Parse(%q) = %q, want %q", tc.input, got, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"", "a..b", "a.", `a["x`, "a[b]"} {
+		if _, err := Parse(bad); err == nil {
+			t.Fatalf("Parse(%q) should fail", bad)
+		}
+	}
+}
+
+func TestMatchSegment(t *testing.T) {
+	cases := []struct {
+		pattern, key string
+		want         bool
+	}{
+		{"OPENAI_*", "OPENAI_API_KEY", true},
+		{"OPENAI_*", "ANTHROPIC_KEY", false},
+		{"*", "/work/my.app", true},
+		{"?b*", "abc", true},
+		{"a*c", "ab", false},
+	}
+	for _, tc := range cases {
+		if got := MatchSegment(tc.pattern, tc.key); got != tc.want {
+			t.Fatalf("MatchSegment(%q, %q) = %v, want %v", tc.pattern, tc.key, got, tc.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	patterns := []Path{{"mcpServers", "*", "env"}}
+	if full, partial := Match(patterns, []string{"mcpServers"}); full || !partial {
+		t.Fatalf("mcpServers: full=%v partial=%v, want partial", full, partial)
+	}
+	if full, _ := Match(patterns, []string{"mcpServers", "foo", "env", "KEY"}); !full {
+		t.Fatalf("descendant of a match should be full")
+	}
+	if full, partial := Match(patterns, []string{"projects"}); full || partial {
+		t.Fatalf("projects should not match")
+	}
+}
@@ -0,0 +1,284 @@
+// Package ledger tracks string sets synced across machines (such as
+// permissions.allow) with per-entry add/remove history, so that removals
+// propagate instead of being undone by the next union.
+package ledger
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yxuechao007/claude_sync/internal/config"
+	"github.com/yxuechao007/claude_sync/internal/fileutil"
+)
+
+// GistFile is the gist file holding the shared ledger
+const GistFile = "claude_sync.ledger.json"
+
+// syncedFile keeps the ledger as of the last sync in ~/.claude_sync
+const syncedFile = "ledger.json"
+
+// maxHistory caps the events kept per entry
+const maxHistory = 10
+
+// Op is a set operation
+type Op string
+
+const (
+	OpAdd    Op = "add"
+	OpRemove Op = "remove"
+)
+
+// Event is one recorded add or remove of an entry
+type Event struct {
+	Op     Op        `json:"op"`
+	Device string    `json:"device,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// Entry is the current state of one value in a set
+type Entry struct {
+	Present   bool      `json:"present"`
+	Device    string    `json:"device,omitempty"` // 最后一次修改的设备
+	Origin    string    `json:"origin,omitempty"` // 最早添加该条目的设备
+	UpdatedAt time.Time `json:"updated_at"`
+	History   []Event   `json:"history,omitempty"`
+}
+
+// Ledger holds every tracked set, keyed by "<item>:<json path>"
+type Ledger struct {
+	Version int                          `json:"version"`
+	Sets    map[string]map[string]*Entry `json:"sets"`
+}
+
+// New returns an empty ledger
+func New() *Ledger {
+	return &Ledger{Version: 1, Sets: make(map[string]map[string]*Entry)}
+}
+
+// SetKey names the set for a JSON path of a sync item
+func SetKey(item, path string) string {
+	return item + ":" + path
+}
+
+// Parse reads a ledger from gist content; empty content yields an empty ledger
+func Parse(content string) (*Ledger, error) {
+	if strings.TrimSpace(content) == "" {
+		return New(), nil
+	}
+	var l Ledger
+	if err := json.Unmarshal([]byte(content), &l); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", GistFile, err)
+	}
+	if l.Sets == nil {
+		l.Sets = make(map[string]map[string]*Entry)
+	}
+	if l.Version == 0 {
+		l.Version = 1
+	}
+	return &l, nil
+}
+
+// Marshal returns the ledger as indented JSON
+func (l *Ledger) Marshal() (string, error) {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Clone returns a deep copy
+func (l *Ledger) Clone() *Ledger {
+	clone := New()
+	clone.Version = l.Version
+	for key, set := range l.Sets {
+		copied := make(map[string]*Entry, len(set))
+		for value, entry := range set {
+			e := *entry
+			e.History = append([]Event(nil), entry.History...)
+			copied[value] = &e
+		}
+		clone.Sets[key] = copied
+	}
+	return clone
+}
+
+// Has reports whether the set exists in the ledger
+func (l *Ledger) Has(key string) bool {
+	_, ok := l.Sets[key]
+	return ok
+}
+
+// Entries returns the entries of a set (nil if unknown)
+func (l *Ledger) Entries(key string) map[string]*Entry {
+	return l.Sets[key]
+}
+
+// Record applies an add or remove. Events older than the entry's last
+// update are kept in history but do not change its state (last writer wins).
+func (l *Ledger) Record(key, value string, op Op, device string, at time.Time) {
+	set, ok := l.Sets[key]
+	if !ok {
+		set = make(map[string]*Entry)
+		l.Sets[key] = set
+	}
+	entry, ok := set[value]
+	if !ok {
+		entry = &Entry{}
+		set[value] = entry
+	}
+
+	entry.History = append(entry.History, Event{Op: op, Device: device, At: at})
+	if len(entry.History) > maxHistory {
+		entry.History = entry.History[len(entry.History)-maxHistory:]
+	}
+	if entry.Origin == "" && op == OpAdd {
+		entry.Origin = device
+	}
+	if !at.Before(entry.UpdatedAt) {
+		entry.Present = op == OpAdd
+		entry.Device = device
+		entry.UpdatedAt = at
+	}
+}
+
+// Bootstrap adds values of a set that the ledger has never seen, e.g. the
+// remote array written by a client without a ledger. They get a zero
+// timestamp so any recorded event wins over them.
+func (l *Ledger) Bootstrap(key string, values []string) {
+	for _, value := range values {
+		if set, ok := l.Sets[key]; ok {
+			if _, known := set[value]; known {
+				continue
+			}
+		}
+		l.Record(key, value, OpAdd, "", time.Time{})
+	}
+}
+
+// Changes compares the local values of a set with the last-synced ledger.
+// Values present locally but not in synced are adds; values present in
+// synced but missing locally are removes.
+func Changes(synced *Ledger, key string, local []string) (adds, removes []string) {
+	localSet := make(map[string]bool, len(local))
+	for _, value := range local {
+		localSet[value] = true
+	}
+	syncedSet := synced.Entries(key)
+	for _, value := range local {
+		if entry, ok := syncedSet[value]; !ok || !entry.Present {
+			adds = append(adds, value)
+		}
+	}
+	for _, value := range sortedValues(syncedSet) {
+		if syncedSet[value].Present && !localSet[value] {
+			removes = append(removes, value)
+		}
+	}
+	return adds, removes
+}
+
+// Apply records local changes since the last sync into l
+func (l *Ledger) Apply(synced *Ledger, key string, local []string, device string, at time.Time) {
+	adds, removes := Changes(synced, key, local)
+	for _, value := range adds {
+		l.Record(key, value, OpAdd, device, at)
+	}
+	for _, value := range removes {
+		l.Record(key, value, OpRemove, device, at)
+	}
+}
+
+// Present returns the values currently in the set. Values keep the order
+// of the preferred lists (first local, then remote), remaining ones sorted.
+func (l *Ledger) Present(key string, preferred ...[]string) []string {
+	set := l.Sets[key]
+	result := []string{}
+	seen := make(map[string]bool)
+	for _, list := range preferred {
+		for _, value := range list {
+			if entry, ok := set[value]; ok && entry.Present && !seen[value] {
+				seen[value] = true
+				result = append(result, value)
+			}
+		}
+	}
+	for _, value := range sortedValues(set) {
+		if set[value].Present && !seen[value] {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// SetKeys returns the names of all sets, sorted
+func (l *Ledger) SetKeys() []string {
+	keys := make([]string, 0, len(l.Sets))
+	for key := range l.Sets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedValues(set map[string]*Entry) []string {
+	values := make([]string, 0, len(set))
+	for value := range set {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return values
+}
+
+func syncedPath() (string, error) {
+	dir, err := config.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, syncedFile), nil
+}
+
+// LoadSynced reads the ledger as of the last sync; missing means empty
+func LoadSynced() (*Ledger, error) {
+	path, err := syncedPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return New(), nil
+		}
+		return nil, err
+	}
+	return Parse(string(data))
+}
+
+// SaveSynced stores l as the last-synced ledger
+func SaveSynced(l *Ledger) error {
+	path, err := syncedPath()
+	if err != nil {
+		return err
+	}
+	content, err := l.Marshal()
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteFile(path, []byte(content), 0600)
+}
+
+// Strings returns the string elements of a JSON array value
+func Strings(values []interface{}) []string {
+	var result []string
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
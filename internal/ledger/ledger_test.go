@@ -0,0 +1,79 @@
+package ledger
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecordLastWriterWins(t *testing.T) {
+	l := New()
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.Record("s", "a", OpAdd, "laptop", t0)
+	l.Record("s", "a", OpRemove, "desktop", t0.Add(2*time.Hour))
+	// 较早的事件只进入历史，不改变状态
+	l.Record("s", "a", OpAdd, "laptop", t0.Add(time.Hour))
+
+	entry := l.Entries("s")["a"]
+	if entry.Present || entry.Device != "desktop" || entry.Origin != "laptop" {
+		t.Fatalf("entry = %+v, want removed by desktop, origin laptop", entry)
+	}
+	if len(entry.History) != 3 {
+		t.Fatalf("history = %v, want 3 events", entry.History)
+	}
+}
+
+func TestChangesAndPresent(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	synced := New()
+	synced.Record("s", "a", OpAdd, "laptop", t0)
+	synced.Record("s", "b", OpAdd, "laptop", t0)
+
+	adds, removes := Changes(synced, "s", []string{"c", "a"})
+	if !reflect.DeepEqual(adds, []string{"c"}) || !reflect.DeepEqual(removes, []string{"b"}) {
+		t.Fatalf("Changes = %v, %v", adds, removes)
+	}
+
+	remote := synced.Clone()
+	remote.Record("s", "z", OpAdd, "desktop", t0.Add(time.Minute))
+	remote.Apply(synced, "s", []string{"c", "a"}, "laptop", t0.Add(time.Hour))
+
+	got := remote.Present("s", []string{"c", "a"})
+	if want := []string{"c", "a", "z"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Present = %v, want %v", got, want)
+	}
+	if synced.Entries("s")["c"] != nil {
+		t.Fatalf("Clone shares entries with the original")
+	}
+}
+
+func TestBootstrapKeepsRecordedRemovals(t *testing.T) {
+	l := New()
+	l.Record("s", "a", OpRemove, "laptop", time.Now())
+	l.Bootstrap("s", []string{"a", "b"})
+
+	if got := l.Present("s"); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Fatalf("Present = %v, want [b]", got)
+	}
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	l := New()
+	l.Record("settings:permissions.deny", "Bash(rm:*)", OpAdd, "laptop", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	content, err := l.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	parsed, err := Parse(content)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if !reflect.DeepEqual(parsed, l) {
+		t.Fatalf("round trip = %+v, want %+v", parsed, l)
+	}
+
+	empty, err := Parse("")
+	if err != nil || len(empty.Sets) != 0 {
+		t.Fatalf("Parse empty = %+v, %v", empty, err)
+	}
+}
@@ -0,0 +1,642 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// checkProtocolVersion is the MCP protocol version offered in initialize
+const checkProtocolVersion = "2025-06-18"
+
+// CheckResult is the outcome of an MCP handshake with one server
+type CheckResult struct {
+	Name            string
+	Transport       string // stdio, http 或 sse
+	ProtocolVersion string // 服务端在 initialize 中返回的协议版本
+	ServerName      string // serverInfo.name
+	Tools           int    // tools/list 返回的工具数量
+	Duration        time.Duration
+	Err             error
+}
+
+// OK reports whether the handshake succeeded
+func (r CheckResult) OK() bool {
+	return r.Err == nil
+}
+
+// CheckServers runs the initialize and tools/list handshake against the
+// servers of the global scope, or of one project when project is set.
+// names restricts the check to those servers. Servers are checked in
+// parallel, each with its own timeout; results are sorted by name.
+func CheckServers(data []byte, project string, names []string, timeout time.Duration) ([]CheckResult, error) {
+	all, err := ReadServers(data, project)
+	if err != nil {
+		return nil, err
+	}
+	servers, err := SelectServers(all, names)
+	if err != nil {
+		return nil, err
+	}
+	names = sortedKeys(servers)
+
+	results := make([]CheckResult, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		config, _ := servers[name].(map[string]interface{})
+		wg.Add(1)
+		go func(i int, name string, config map[string]interface{}) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			results[i] = CheckServer(ctx, name, config)
+		}(i, name, config)
+	}
+	wg.Wait()
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return results, nil
+}
+
+// CheckServer performs the MCP handshake with one server until ctx expires
+func CheckServer(ctx context.Context, name string, config map[string]interface{}) CheckResult {
+	start := time.Now()
+	result := CheckResult{Name: name, Transport: serverTransport(config)}
+
+	var session rpcSession
+	var err error
+	switch result.Transport {
+	case "stdio":
+		session, err = startStdio(ctx, config)
+	case "http":
+		session, err = newHTTPSession(ctx, config)
+	case "sse":
+		session, err = startSSE(ctx, config)
+	default:
+		err = fmt.Errorf("unsupported transport %q", result.Transport)
+	}
+	if err == nil {
+		defer session.Close()
+		err = handshake(session, &result)
+	}
+	if err != nil && ctx.Err() != nil {
+		err = fmt.Errorf("timed out: %w", err)
+	}
+	result.Err = err
+	result.Duration = time.Since(start)
+	return result
+}
+
+// serverTransport returns the transport of a server entry: an explicit
+// type, otherwise http for url entries and stdio for command entries
+func serverTransport(config map[string]interface{}) string {
+	if transport, _ := config["type"].(string); transport != "" {
+		return transport
+	}
+	if _, ok := config["url"].(string); ok {
+		return "http"
+	}
+	return "stdio"
+}
+
+// rpcSession sends JSON-RPC messages to a server. Call returns the
+// result of a request, Notify sends a message without an id.
+type rpcSession interface {
+	Call(id int, method string, params interface{}) (json.RawMessage, error)
+	Notify(method string, params interface{}) error
+	Close()
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcResponse struct {
+	ID     *json.RawMessage `json:"id"`
+	Result json.RawMessage  `json:"result"`
+	Error  *rpcError        `json:"error"`
+}
+
+func rpcMessage(id int, method string, params interface{}) ([]byte, error) {
+	msg := map[string]interface{}{"jsonrpc": "2.0", "method": method}
+	if id > 0 {
+		msg["id"] = id
+	}
+	if params != nil {
+		msg["params"] = params
+	}
+	return json.Marshal(msg)
+}
+
+// matchResponse decodes line and returns the result when it answers id.
+// Notifications and responses to other requests return ok=false.
+func matchResponse(line []byte, id int) (json.RawMessage, bool, error) {
+	var resp rpcResponse
+	if err := json.Unmarshal(line, &resp); err != nil || resp.ID == nil {
+		return nil, false, nil
+	}
+	if string(*resp.ID) != fmt.Sprint(id) {
+		return nil, false, nil
+	}
+	if resp.Error != nil {
+		return nil, true, fmt.Errorf("%s (code %d)", resp.Error.Message, resp.Error.Code)
+	}
+	return resp.Result, true, nil
+}
+
+func handshake(session rpcSession, result *CheckResult) error {
+	raw, err := session.Call(1, "initialize", map[string]interface{}{
+		"protocolVersion": checkProtocolVersion,
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      map[string]interface{}{"name": "claude_sync", "version": "check"},
+	})
+	if err != nil {
+		return fmt.Errorf("initialize: %w", err)
+	}
+	var init struct {
+		ProtocolVersion string                 `json:"protocolVersion"`
+		Capabilities    map[string]interface{} `json:"capabilities"`
+		ServerInfo      struct {
+			Name string `json:"name"`
+		} `json:"serverInfo"`
+	}
+	if err := json.Unmarshal(raw, &init); err != nil {
+		return fmt.Errorf("initialize: invalid result: %w", err)
+	}
+	result.ProtocolVersion = init.ProtocolVersion
+	result.ServerName = init.ServerInfo.Name
+
+	if err := session.Notify("notifications/initialized", nil); err != nil {
+		return fmt.Errorf("initialized: %w", err)
+	}
+	if _, ok := init.Capabilities["tools"]; !ok {
+		return nil // 服务端不提供工具
+	}
+
+	raw, err = session.Call(2, "tools/list", map[string]interface{}{})
+	if err != nil {
+		return fmt.Errorf("tools/list: %w", err)
+	}
+	var tools struct {
+		Tools []json.RawMessage `json:"tools"`
+	}
+	if err := json.Unmarshal(raw, &tools); err != nil {
+		return fmt.Errorf("tools/list: invalid result: %w", err)
+	}
+	result.Tools = len(tools.Tools)
+	return nil
+}
+
+// stdioSession talks newline-delimited JSON-RPC to a child process
+type stdioSession struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	lines   chan []byte
+	stderr  *tailBuffer
+	ctx     context.Context
+	exited  chan struct{} // 进程退出且 stderr 读完后关闭
+	waitErr error
+}
+
+func startStdio(ctx context.Context, config map[string]interface{}) (rpcSession, error) {
+	command, _ := config["command"].(string)
+	if command == "" {
+		return nil, fmt.Errorf("no command configured")
+	}
+	cmd := exec.CommandContext(ctx, os.ExpandEnv(command), expandAll(stringValues(config["args"]))...)
+	cmd.Env = os.Environ()
+	if env, ok := config["env"].(map[string]interface{}); ok {
+		for _, key := range sortedKeys(env) {
+			cmd.Env = append(cmd.Env, key+"="+os.ExpandEnv(fmt.Sprint(env[key])))
+		}
+	}
+	if dir, _ := config["cwd"].(string); dir != "" {
+		cmd.Dir = os.ExpandEnv(dir)
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	// 不用 StdoutPipe：Wait 会关闭它，而这里需要在读取的同时等待进程退出
+	stdout, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout = stdoutWriter
+	stderr := &tailBuffer{limit: 2048}
+	cmd.Stderr = stderr
+	// npx 等启动器的子进程可能在被 kill 后仍持有 stderr，限制 Wait 的等待时间
+	cmd.WaitDelay = time.Second
+	err = cmd.Start()
+	stdoutWriter.Close()
+	if err != nil {
+		stdout.Close()
+		return nil, err
+	}
+
+	s := &stdioSession{cmd: cmd, stdin: stdin, lines: make(chan []byte), stderr: stderr, ctx: ctx, exited: make(chan struct{})}
+	go func() {
+		s.waitErr = cmd.Wait()
+		close(s.exited)
+	}()
+	go func() {
+		defer stdout.Close()
+		defer close(s.lines)
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			line := append([]byte(nil), scanner.Bytes()...)
+			select {
+			case s.lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return s, nil
+}
+
+func expandAll(values []string) []string {
+	for i, v := range values {
+		values[i] = os.ExpandEnv(v)
+	}
+	return values
+}
+
+func (s *stdioSession) send(msg []byte) error {
+	_, err := s.stdin.Write(append(msg, '\n'))
+	return err
+}
+
+func (s *stdioSession) Call(id int, method string, params interface{}) (json.RawMessage, error) {
+	msg, err := rpcMessage(id, method, params)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.send(msg); err != nil {
+		return nil, s.exitError(err)
+	}
+	for {
+		select {
+		case line, ok := <-s.lines:
+			if !ok {
+				return nil, s.exitError(fmt.Errorf("server closed stdout"))
+			}
+			if result, done, err := matchResponse(line, id); done {
+				return result, err
+			}
+		case <-s.ctx.Done():
+			return nil, s.ctx.Err()
+		}
+	}
+}
+
+func (s *stdioSession) Notify(method string, params interface{}) error {
+	msg, err := rpcMessage(0, method, params)
+	if err != nil {
+		return err
+	}
+	return s.send(msg)
+}
+
+// exitError adds the tail of stderr, which usually explains why the
+// server died, or else its exit status
+func (s *stdioSession) exitError(err error) error {
+	select {
+	case <-s.exited:
+	case <-time.After(time.Second):
+	case <-s.ctx.Done():
+	}
+	if tail := strings.TrimSpace(s.stderr.String()); tail != "" {
+		lines := strings.Split(tail, "\n")
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(lines[len(lines)-1]))
+	}
+	select {
+	case <-s.exited:
+		if s.waitErr != nil {
+			return fmt.Errorf("%w (%v)", err, s.waitErr)
+		}
+	default:
+	}
+	return err
+}
+
+func (s *stdioSession) Close() {
+	s.stdin.Close()
+	s.cmd.Process.Kill()
+	<-s.exited
+}
+
+// tailBuffer keeps the last limit bytes written to it
+type tailBuffer struct {
+	mu    sync.Mutex
+	limit int
+	buf   []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.limit {
+		b.buf = b.buf[len(b.buf)-b.limit:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
+
+// httpSession implements the streamable HTTP transport: every message is
+// a POST whose response is either JSON or an event stream
+type httpSession struct {
+	ctx       context.Context
+	url       string
+	headers   map[string]string
+	sessionID string
+}
+
+func newHTTPSession(ctx context.Context, config map[string]interface{}) (rpcSession, error) {
+	endpoint, _ := config["url"].(string)
+	if endpoint == "" {
+		return nil, fmt.Errorf("no url configured")
+	}
+	return &httpSession{ctx: ctx, url: os.ExpandEnv(endpoint), headers: serverHeaders(config)}, nil
+}
+
+func serverHeaders(config map[string]interface{}) map[string]string {
+	headers := make(map[string]string)
+	if values, ok := config["headers"].(map[string]interface{}); ok {
+		for key, value := range values {
+			headers[key] = os.ExpandEnv(fmt.Sprint(value))
+		}
+	}
+	return headers
+}
+
+func (s *httpSession) post(msg []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, s.url, bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	req.Header.Set("MCP-Protocol-Version", checkProtocolVersion)
+	if s.sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", s.sessionID)
+	}
+	for key, value := range s.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("HTTP %s", resp.Status)
+	}
+	if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+		s.sessionID = id
+	}
+	return resp, nil
+}
+
+func (s *httpSession) Call(id int, method string, params interface{}) (json.RawMessage, error) {
+	msg, err := rpcMessage(id, method, params)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.post(msg)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		events := readEvents(s.ctx, resp.Body)
+		for event := range events {
+			if result, done, err := matchResponse([]byte(event.data), id); done {
+				return result, err
+			}
+		}
+		return nil, fmt.Errorf("event stream ended without a response")
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	result, done, err := matchResponse(body, id)
+	if !done {
+		return nil, fmt.Errorf("unexpected response: %s", truncate(string(body), 200))
+	}
+	return result, err
+}
+
+func (s *httpSession) Notify(method string, params interface{}) error {
+	msg, err := rpcMessage(0, method, params)
+	if err != nil {
+		return err
+	}
+	resp, err := s.post(msg)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *httpSession) Close() {}
+
+// sseSession implements the legacy HTTP+SSE transport: responses arrive on
+// a GET event stream, requests are POSTed to the endpoint it announces
+type sseSession struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	endpoint string
+	headers  map[string]string
+	events   <-chan sseEvent
+}
+
+type sseEvent struct {
+	name string
+	data string
+}
+
+func startSSE(ctx context.Context, config map[string]interface{}) (rpcSession, error) {
+	raw, _ := config["url"].(string)
+	if raw == "" {
+		return nil, fmt.Errorf("no url configured")
+	}
+	streamURL, err := url.Parse(os.ExpandEnv(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	headers := serverHeaders(config)
+
+	ctx, cancel := context.WithCancel(ctx)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamURL.String(), nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("HTTP %s", resp.Status)
+	}
+
+	s := &sseSession{ctx: ctx, cancel: cancel, headers: headers}
+	events := readEvents(ctx, resp.Body)
+	s.events = events
+	go func() {
+		<-ctx.Done()
+		resp.Body.Close()
+	}()
+
+	// 第一个 endpoint 事件给出 POST 地址
+	for event := range events {
+		if event.name != "endpoint" {
+			continue
+		}
+		endpoint, err := streamURL.Parse(strings.TrimSpace(event.data))
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("invalid endpoint %q: %w", event.data, err)
+		}
+		s.endpoint = endpoint.String()
+		return s, nil
+	}
+	cancel()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return nil, fmt.Errorf("event stream ended before the endpoint event")
+}
+
+func (s *sseSession) post(msg []byte) error {
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, s.endpoint, bytes.NewReader(msg))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range s.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *sseSession) Call(id int, method string, params interface{}) (json.RawMessage, error) {
+	msg, err := rpcMessage(id, method, params)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.post(msg); err != nil {
+		return nil, err
+	}
+	for event := range s.events {
+		if event.name != "" && event.name != "message" {
+			continue
+		}
+		if result, done, err := matchResponse([]byte(event.data), id); done {
+			return result, err
+		}
+	}
+	if s.ctx.Err() != nil {
+		return nil, s.ctx.Err()
+	}
+	return nil, fmt.Errorf("event stream closed")
+}
+
+func (s *sseSession) Notify(method string, params interface{}) error {
+	msg, err := rpcMessage(0, method, params)
+	if err != nil {
+		return err
+	}
+	return s.post(msg)
+}
+
+func (s *sseSession) Close() {
+	s.cancel()
+}
+
+// readEvents parses a text/event-stream body; the channel is closed at EOF
+// or when ctx is done
+func readEvents(ctx context.Context, body io.Reader) <-chan sseEvent {
+	events := make(chan sseEvent)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		var event sseEvent
+		var data []string
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if len(data) > 0 || event.name != "" {
+					event.data = strings.Join(data, "\n")
+					select {
+					case events <- event:
+					case <-ctx.Done():
+						return
+					}
+				}
+				event, data = sseEvent{}, nil
+			case strings.HasPrefix(line, ":"):
+				// 注释行
+			case strings.HasPrefix(line, "event:"):
+				event.name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+			case strings.HasPrefix(line, "data:"):
+				data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+			}
+		}
+		if len(data) > 0 {
+			event.data = strings.Join(data, "\n")
+			select {
+			case events <- event:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return events
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
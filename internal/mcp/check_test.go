@@ -0,0 +1,164 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServer answers initialize and tools/list over stdio, ignoring the
+// initialized notification, and logs a line to stdout first
+const fakeServer = `#!/bin/sh
+echo "starting"
+read line
+echo '{"jsonrpc":"2.0","method":"notifications/message","params":{}}'
+echo '{"jsonrpc":"2.0","id":1,"result":{"protocolVersion":"2025-03-26","capabilities":{"tools":{}},"serverInfo":{"name":"fake"}}}'
+read line
+read line
+echo '{"jsonrpc":"2.0","id":2,"result":{"tools":[{"name":"a"},{"name":"'"$FAKE_TOOL"'"}]}}'
+`
+
+func TestCheckServersStdio(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake server is a shell script")
+	}
+	dir := t.TempDir()
+	script := filepath.Join(dir, "server.sh")
+	if err := os.WriteFile(script, []byte(fakeServer), 0755); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	crash := filepath.Join(dir, "crash.sh")
+	if err := os.WriteFile(crash, []byte("#!/bin/sh\necho 'libfoo not found' >&2\nexit 1\n"), 0755); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	data := []byte(`{"mcpServers": {
+		"fake": {"command": "` + script + `", "env": {"FAKE_TOOL": "b"}},
+		"missing": {"command": "` + filepath.Join(dir, "nope") + `"},
+		"crash": {"command": "sh", "args": ["` + crash + `"]}
+	}}`)
+	results, err := CheckServers(data, "", nil, 5*time.Second)
+	if err != nil {
+		t.Fatalf("CheckServers: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("results = %+v", results)
+	}
+
+	crashed, fake, missing := results[0], results[1], results[2]
+	if !fake.OK() || fake.ProtocolVersion != "2025-03-26" || fake.ServerName != "fake" || fake.Tools != 2 {
+		t.Errorf("fake = %+v", fake)
+	}
+	if missing.OK() {
+		t.Errorf("missing binary reported OK")
+	}
+	if crashed.OK() || !strings.Contains(crashed.Err.Error(), "libfoo not found") {
+		t.Errorf("crash error should include stderr: %v", crashed.Err)
+	}
+
+	if _, err := CheckServers(data, "", []string{"unknown"}, time.Second); err == nil {
+		t.Errorf("expected error for unknown server")
+	}
+}
+
+// rpcReply answers the handshake requests of a check
+func rpcReply(body []byte) (string, bool) {
+	var req struct {
+		ID     *int   `json:"id"`
+		Method string `json:"method"`
+	}
+	json.Unmarshal(body, &req)
+	switch {
+	case req.ID == nil:
+		return "", false
+	case req.Method == "initialize":
+		return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":{"protocolVersion":"2025-06-18","capabilities":{"tools":{}},"serverInfo":{"name":"remote"}}}`, *req.ID), true
+	default:
+		return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":{"tools":[{"name":"x"}]}}`, *req.ID), true
+	}
+}
+
+func TestCheckServerHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		reply, ok := rpcReply(body)
+		if !ok {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		// tools/list 以事件流返回
+		if strings.Contains(reply, `"tools"`) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", reply)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, reply)
+	}))
+	defer srv.Close()
+
+	data := []byte(`{"mcpServers": {
+		"remote": {"type": "http", "url": "` + srv.URL + `", "headers": {"Authorization": "Bearer t"}},
+		"denied": {"url": "` + srv.URL + `"}
+	}}`)
+	results, err := CheckServers(data, "", nil, 5*time.Second)
+	if err != nil {
+		t.Fatalf("CheckServers: %v", err)
+	}
+	denied, remote := results[0], results[1]
+	if denied.OK() || !strings.Contains(denied.Err.Error(), "401") {
+		t.Errorf("denied = %+v", denied)
+	}
+	if !remote.OK() || remote.Transport != "http" || remote.Tools != 1 || remote.ProtocolVersion != "2025-06-18" {
+		t.Errorf("remote = %+v", remote)
+	}
+}
+
+func TestCheckServerSSE(t *testing.T) {
+	replies := make(chan string, 4)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sse", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "event: endpoint\ndata: /messages?session=1\n\n")
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case reply := <-replies:
+				fmt.Fprintf(w, "event: message\ndata: %s\n\n", reply)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+	mux.HandleFunc("/messages", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if reply, ok := rpcReply(body); ok {
+			replies <- reply
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	data := []byte(`{"mcpServers": {"legacy": {"type": "sse", "url": "` + srv.URL + `/sse"}}}`)
+	results, err := CheckServers(data, "", nil, 5*time.Second)
+	if err != nil {
+		t.Fatalf("CheckServers: %v", err)
+	}
+	if r := results[0]; !r.OK() || r.ServerName != "remote" || r.Tools != 1 {
+		t.Errorf("legacy = %+v", r)
+	}
+}
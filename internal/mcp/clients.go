@@ -0,0 +1,363 @@
+package mcp
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/yxuechao007/claude_sync/internal/jsondoc"
+)
+
+// ClientFormat describes how another MCP client stores its servers
+type ClientFormat struct {
+	Name       string
+	ServersKey string   // 顶层 key：mcpServers 或 servers（VS Code）
+	URLKey     string   // 远程 server 的地址字段：url 或 serverUrl（Windsurf）
+	WriteType  bool     // 是否写入 type 字段
+	Remote     bool     // 是否支持 http/sse server
+	EnvRef     string   // 环境变量引用格式，为空表示不支持引用
+	path       []string // 相对配置目录的默认配置文件路径
+	base       string   // home 或 appdata（按操作系统解析）
+}
+
+var clientFormats = map[string]ClientFormat{
+	"claude-desktop": {
+		Name: "claude-desktop", ServersKey: "mcpServers", URLKey: "url",
+		path: []string{"Claude", "claude_desktop_config.json"}, base: "appdata",
+	},
+	"cursor": {
+		Name: "cursor", ServersKey: "mcpServers", URLKey: "url", Remote: true, EnvRef: "${env:%s}",
+		path: []string{".cursor", "mcp.json"}, base: "home",
+	},
+	"vscode": {
+		Name: "vscode", ServersKey: "servers", URLKey: "url", WriteType: true, Remote: true, EnvRef: "${env:%s}",
+		path: []string{"Code", "User", "mcp.json"}, base: "appdata",
+	},
+	"windsurf": {
+		Name: "windsurf", ServersKey: "mcpServers", URLKey: "serverUrl", Remote: true, EnvRef: "${env:%s}",
+		path: []string{".codeium", "windsurf", "mcp_config.json"}, base: "home",
+	},
+}
+
+// ClientFormatNames returns the supported client formats, sorted
+func ClientFormatNames() []string {
+	names := make([]string, 0, len(clientFormats))
+	for name := range clientFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupClientFormat returns the format with the given name
+func LookupClientFormat(name string) (ClientFormat, error) {
+	format, ok := clientFormats[name]
+	if !ok {
+		return ClientFormat{}, fmt.Errorf("unknown format %q (supported: %s)", name, strings.Join(ClientFormatNames(), ", "))
+	}
+	return format, nil
+}
+
+// ConfigPath returns the client's user-level config file on this OS
+func (f ClientFormat) ConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	dir := home
+	if f.base == "appdata" {
+		switch runtime.GOOS {
+		case "darwin":
+			dir = filepath.Join(home, "Library", "Application Support")
+		case "windows":
+			if dir = os.Getenv("APPDATA"); dir == "" {
+				dir = filepath.Join(home, "AppData", "Roaming")
+			}
+		default:
+			if dir = os.Getenv("XDG_CONFIG_HOME"); dir == "" {
+				dir = filepath.Join(home, ".config")
+			}
+		}
+	}
+	return filepath.Join(append([]string{dir}, f.path...)...), nil
+}
+
+var (
+	// Claude Code 的 ${VAR} 与 ${VAR:-default}
+	claudeRefPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}`)
+	// Cursor、VS Code 和 Windsurf 的 ${env:VAR}
+	clientRefPattern = regexp.MustCompile(`\$\{env:([A-Za-z_][A-Za-z0-9_]*)\}`)
+)
+
+// ExportServers translates Claude Code servers to the client's schema.
+// Servers the client cannot run are skipped; warnings explain what was
+// skipped or lost in translation.
+func ExportServers(servers map[string]interface{}, f ClientFormat) (map[string]interface{}, []string) {
+	result := make(map[string]interface{}, len(servers))
+	var warnings []string
+	for _, name := range sortedKeys(servers) {
+		server, _ := servers[name].(map[string]interface{})
+		transport := serverTransport(server)
+		out := make(map[string]interface{})
+		ref := func(field string, v interface{}) interface{} {
+			s, ok := v.(string)
+			if !ok {
+				return v
+			}
+			converted, lost := exportRefs(s, f)
+			if lost != "" {
+				warnings = append(warnings, fmt.Sprintf("%s: %s %s", name, field, lost))
+			}
+			return converted
+		}
+
+		switch transport {
+		case "stdio":
+			out["command"] = ref("command", server["command"])
+			if args := stringValues(server["args"]); len(args) > 0 {
+				list := make([]interface{}, len(args))
+				for i, arg := range args {
+					list[i] = ref("args", arg)
+				}
+				out["args"] = list
+			}
+			if env := mapValues(server["env"], func(key string, v interface{}) interface{} { return ref("env."+key, v) }); env != nil {
+				out["env"] = env
+			}
+		case "http", "sse":
+			if !f.Remote {
+				warnings = append(warnings, fmt.Sprintf("%s: skipped, %s does not support %s servers", name, f.Name, transport))
+				continue
+			}
+			out[f.URLKey] = ref("url", server["url"])
+			if headers := mapValues(server["headers"], func(key string, v interface{}) interface{} { return ref("headers."+key, v) }); headers != nil {
+				out["headers"] = headers
+			}
+		default:
+			warnings = append(warnings, fmt.Sprintf("%s: skipped, unsupported transport %q", name, transport))
+			continue
+		}
+		if f.WriteType {
+			out["type"] = transport
+		}
+		result[name] = out
+	}
+	return result, warnings
+}
+
+// exportRefs rewrites ${VAR} references in the client's syntax. It returns
+// a description of what could not be translated, if anything.
+func exportRefs(s string, f ClientFormat) (string, string) {
+	if !claudeRefPattern.MatchString(s) {
+		return s, ""
+	}
+	if f.EnvRef == "" {
+		return s, fmt.Sprintf("contains ${VAR} references that %s does not expand", f.Name)
+	}
+	lost := ""
+	converted := claudeRefPattern.ReplaceAllStringFunc(s, func(m string) string {
+		parts := claudeRefPattern.FindStringSubmatch(m)
+		if parts[2] != "" {
+			lost = "loses the default value of ${" + parts[1] + "}"
+		}
+		return fmt.Sprintf(f.EnvRef, parts[1])
+	})
+	return converted, lost
+}
+
+// ImportServers reads the servers of a client config file and translates
+// them to Claude Code's schema
+func ImportServers(data []byte, f ClientFormat) (map[string]interface{}, []string, error) {
+	value, err := jsondoc.Parse(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s config: %w", f.Name, err)
+	}
+	root, ok := value.(*jsondoc.Object)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s config is not a JSON object", f.Name)
+	}
+	raw, _ := root.Get(f.ServersKey)
+	servers, _ := raw.(*jsondoc.Object)
+	if servers == nil {
+		return map[string]interface{}{}, nil, nil
+	}
+
+	result := make(map[string]interface{}, servers.Len())
+	var warnings []string
+	for _, name := range servers.Keys() {
+		raw, _ := servers.Get(name)
+		server, ok := raw.(*jsondoc.Object)
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("%s: skipped, not an object", name))
+			continue
+		}
+		get := func(key string) interface{} {
+			v, _ := server.Get(key)
+			return importRefs(plainValue(v), name, key, &warnings)
+		}
+
+		out := make(map[string]interface{})
+		endpoint, _ := get(f.URLKey).(string)
+		if endpoint == "" {
+			endpoint, _ = get("url").(string)
+		}
+		if endpoint != "" {
+			transport, _ := get("type").(string)
+			if transport != "http" && transport != "sse" {
+				transport = guessTransport(endpoint)
+			}
+			out["type"] = transport
+			out["url"] = endpoint
+			if headers, ok := get("headers").(map[string]interface{}); ok && len(headers) > 0 {
+				out["headers"] = headers
+			}
+		} else {
+			command, _ := get("command").(string)
+			if command == "" {
+				warnings = append(warnings, fmt.Sprintf("%s: skipped, neither command nor url", name))
+				continue
+			}
+			out["type"] = "stdio"
+			out["command"] = command
+			args, _ := get("args").([]interface{})
+			if args == nil {
+				args = []interface{}{}
+			}
+			out["args"] = args
+			if env, ok := get("env").(map[string]interface{}); ok && len(env) > 0 {
+				out["env"] = env
+			}
+			if v, ok := server.Get("envFile"); ok {
+				warnings = append(warnings, fmt.Sprintf("%s: envFile %v is not supported by Claude Code, set the variables in env", name, v))
+			}
+		}
+		result[name] = out
+	}
+	return result, warnings, nil
+}
+
+// guessTransport picks sse for legacy endpoints ending in /sse, since
+// Cursor and Windsurf do not record the transport
+func guessTransport(endpoint string) string {
+	if u, err := url.Parse(endpoint); err == nil && strings.HasSuffix(strings.TrimRight(u.Path, "/"), "/sse") {
+		return "sse"
+	}
+	return "http"
+}
+
+// importRefs rewrites ${env:VAR} references as ${VAR} in all strings of v
+// and warns about client-only variables such as ${input:...}
+func importRefs(v interface{}, server, field string, warnings *[]string) interface{} {
+	switch val := v.(type) {
+	case string:
+		converted := clientRefPattern.ReplaceAllString(val, "$${$1}")
+		if strings.Contains(converted, "${input:") || strings.Contains(converted, "${workspaceFolder") || strings.Contains(converted, "${userHome") {
+			*warnings = append(*warnings, fmt.Sprintf("%s: %s uses a client variable Claude Code cannot expand: %s", server, field, val))
+		}
+		return converted
+	case []interface{}:
+		for i, item := range val {
+			val[i] = importRefs(item, server, field, warnings)
+		}
+		return val
+	case map[string]interface{}:
+		for key, item := range val {
+			val[key] = importRefs(item, server, field+"."+key, warnings)
+		}
+		return val
+	}
+	return v
+}
+
+// plainValue converts ordered objects to plain maps
+func plainValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case *jsondoc.Object:
+		m := make(map[string]interface{}, val.Len())
+		for _, key := range val.Keys() {
+			item, _ := val.Get(key)
+			m[key] = plainValue(item)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(val))
+		for i, item := range val {
+			list[i] = plainValue(item)
+		}
+		return list
+	}
+	return v
+}
+
+func mapValues(v interface{}, convert func(key string, v interface{}) interface{}) map[string]interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) == 0 {
+		return nil
+	}
+	result := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		result[key] = convert(key, value)
+	}
+	return result
+}
+
+// MergeServers adds servers under the object at path of a JSON document,
+// keeping its layout. Servers with the same name are replaced only when
+// overwrite is set; otherwise differing ones are reported as skipped.
+func MergeServers(data []byte, path []string, servers map[string]interface{}, overwrite bool) (result []byte, merged, skipped []string, err error) {
+	doc, err := jsondoc.ParseDocument(data)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, name := range sortedKeys(servers) {
+		keyPath := append(append([]string(nil), path...), name)
+		if existing, ok := doc.Get(keyPath); ok {
+			if reflect.DeepEqual(normalizeNumbers(plainValue(existing)), normalizeNumbers(servers[name])) {
+				continue
+			}
+			if !overwrite {
+				skipped = append(skipped, name)
+				continue
+			}
+		}
+		if err := doc.Set(keyPath, servers[name]); err != nil {
+			return nil, nil, nil, err
+		}
+		merged = append(merged, name)
+	}
+	if len(merged) == 0 {
+		return data, nil, skipped, nil
+	}
+	result, err = doc.Bytes()
+	return result, merged, skipped, err
+}
+
+// normalizeNumbers turns json.Number values into their string form so
+// that documents decoded in different ways compare equal
+func normalizeNumbers(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for key, item := range val {
+			m[key] = normalizeNumbers(item)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(val))
+		for i, item := range val {
+			list[i] = normalizeNumbers(item)
+		}
+		return list
+	case fmt.Stringer:
+		return val.String()
+	case float64:
+		return fmt.Sprint(val)
+	}
+	return v
+}
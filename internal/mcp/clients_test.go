@@ -0,0 +1,166 @@
+package mcp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yxuechao007/claude_sync/internal/jsondoc"
+)
+
+func claudeServers() map[string]interface{} {
+	return map[string]interface{}{
+		"github": map[string]interface{}{
+			"type":    "stdio",
+			"command": "npx",
+			"args":    []interface{}{"-y", "@mcp/github"},
+			"env":     map[string]interface{}{"GITHUB_TOKEN": "${GITHUB_TOKEN}"},
+		},
+		"docs": map[string]interface{}{
+			"type":    "sse",
+			"url":     "https://docs.example.com/sse",
+			"headers": map[string]interface{}{"Authorization": "Bearer ${DOCS_TOKEN:-none}"},
+		},
+	}
+}
+
+func TestExportServers(t *testing.T) {
+	tests := []struct {
+		format   string
+		want     map[string]interface{}
+		warnings []string
+	}{
+		{
+			format: "vscode",
+			want: map[string]interface{}{
+				"github": map[string]interface{}{
+					"type": "stdio", "command": "npx", "args": []interface{}{"-y", "@mcp/github"},
+					"env": map[string]interface{}{"GITHUB_TOKEN": "${env:GITHUB_TOKEN}"},
+				},
+				"docs": map[string]interface{}{
+					"type": "sse", "url": "https://docs.example.com/sse",
+					"headers": map[string]interface{}{"Authorization": "Bearer ${env:DOCS_TOKEN}"},
+				},
+			},
+			warnings: []string{"docs: headers.Authorization loses the default value of ${DOCS_TOKEN}"},
+		},
+		{
+			format: "windsurf",
+			want: map[string]interface{}{
+				"github": map[string]interface{}{
+					"command": "npx", "args": []interface{}{"-y", "@mcp/github"},
+					"env": map[string]interface{}{"GITHUB_TOKEN": "${env:GITHUB_TOKEN}"},
+				},
+				"docs": map[string]interface{}{
+					"serverUrl": "https://docs.example.com/sse",
+					"headers":   map[string]interface{}{"Authorization": "Bearer ${env:DOCS_TOKEN}"},
+				},
+			},
+			warnings: []string{"docs: headers.Authorization loses the default value of ${DOCS_TOKEN}"},
+		},
+		{
+			format: "claude-desktop",
+			want: map[string]interface{}{
+				"github": map[string]interface{}{
+					"command": "npx", "args": []interface{}{"-y", "@mcp/github"},
+					"env": map[string]interface{}{"GITHUB_TOKEN": "${GITHUB_TOKEN}"},
+				},
+			},
+			warnings: []string{
+				"docs: skipped, claude-desktop does not support sse servers",
+				"github: env.GITHUB_TOKEN contains ${VAR} references that claude-desktop does not expand",
+			},
+		},
+	}
+	for _, tt := range tests {
+		format, err := LookupClientFormat(tt.format)
+		if err != nil {
+			t.Fatalf("LookupClientFormat: %v", err)
+		}
+		got, warnings := ExportServers(claudeServers(), format)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v\nwant %v", tt.format, got, tt.want)
+		}
+		if !reflect.DeepEqual(warnings, tt.warnings) {
+			t.Errorf("%s: warnings = %q\nwant %q", tt.format, warnings, tt.warnings)
+		}
+	}
+}
+
+func TestImportServers(t *testing.T) {
+	cursor := []byte(`{"mcpServers": {
+		"github": {"command": "npx", "args": ["-y", "@mcp/github"], "env": {"GITHUB_TOKEN": "${env:GITHUB_TOKEN}"}},
+		"docs": {"url": "https://docs.example.com/sse/"},
+		"api": {"url": "https://api.example.com/mcp", "headers": {"X-Key": "${input:key}"}}
+	}}`)
+	format, _ := LookupClientFormat("cursor")
+	got, warnings, err := ImportServers(cursor, format)
+	if err != nil {
+		t.Fatalf("ImportServers: %v", err)
+	}
+	want := map[string]interface{}{
+		"github": map[string]interface{}{
+			"type": "stdio", "command": "npx", "args": []interface{}{"-y", "@mcp/github"},
+			"env": map[string]interface{}{"GITHUB_TOKEN": "${GITHUB_TOKEN}"},
+		},
+		"docs": map[string]interface{}{"type": "sse", "url": "https://docs.example.com/sse/"},
+		"api": map[string]interface{}{
+			"type": "http", "url": "https://api.example.com/mcp",
+			"headers": map[string]interface{}{"X-Key": "${input:key}"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "${input:key}") {
+		t.Errorf("warnings = %q", warnings)
+	}
+
+	// VS Code 使用 servers 和显式 type，Windsurf 使用 serverUrl
+	vscode, _ := LookupClientFormat("vscode")
+	got, _, err = ImportServers([]byte(`{"inputs": [], "servers": {"docs": {"type": "sse", "url": "https://x/events"}}}`), vscode)
+	if err != nil || got["docs"].(map[string]interface{})["type"] != "sse" {
+		t.Errorf("vscode import = %v, %v", got, err)
+	}
+	windsurf, _ := LookupClientFormat("windsurf")
+	got, _, err = ImportServers([]byte(`{"mcpServers": {"docs": {"serverUrl": "https://x/mcp"}}}`), windsurf)
+	if err != nil || got["docs"].(map[string]interface{})["url"] != "https://x/mcp" {
+		t.Errorf("windsurf import = %v, %v", got, err)
+	}
+}
+
+func TestMergeServers(t *testing.T) {
+	data := []byte(`{
+  "theme": "dark",
+  "mcpServers": {
+    "github": {"command": "npx", "args": ["-y", "@mcp/github"]},
+    "old": {"command": "x"}
+  }
+}
+`)
+	servers := map[string]interface{}{
+		"github": map[string]interface{}{"command": "npx", "args": []interface{}{"-y", "@mcp/github"}},
+		"old":    map[string]interface{}{"command": "y"},
+		"new":    map[string]interface{}{"command": "z"},
+	}
+
+	out, merged, skipped, err := MergeServers(data, []string{"mcpServers"}, servers, false)
+	if err != nil {
+		t.Fatalf("MergeServers: %v", err)
+	}
+	if !reflect.DeepEqual(merged, []string{"new"}) || !reflect.DeepEqual(skipped, []string{"old"}) {
+		t.Fatalf("merged = %v, skipped = %v", merged, skipped)
+	}
+	if !strings.HasPrefix(string(out), "{\n  \"theme\": \"dark\",") {
+		t.Errorf("layout not kept:\n%s", out)
+	}
+
+	out, merged, _, err = MergeServers(data, []string{"mcpServers"}, servers, true)
+	if err != nil || !reflect.DeepEqual(merged, []string{"new", "old"}) {
+		t.Fatalf("overwrite merged = %v, %v", merged, err)
+	}
+	doc, _ := jsondoc.ParseDocument(out)
+	if v, _ := doc.Get([]string{"mcpServers", "old", "command"}); v != "y" {
+		t.Errorf("old not replaced: %s", out)
+	}
+}
@@ -0,0 +1,302 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/yxuechao007/claude_sync/internal/diff"
+	"github.com/yxuechao007/claude_sync/internal/fileutil"
+	"github.com/yxuechao007/claude_sync/internal/jsondoc"
+)
+
+// MCPJSONFile is the repository-level MCP config Claude Code reads from
+// the project root
+const MCPJSONFile = ".mcp.json"
+
+// ProjectRoot returns the nearest directory at or above dir that contains
+// .git, or dir itself outside a repository
+func ProjectRoot(dir string) string {
+	for current := dir; ; {
+		if _, err := os.Stat(filepath.Join(current, ".git")); err == nil {
+			return current
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return dir
+		}
+		current = parent
+	}
+}
+
+// StrippedSecret is a value replaced by an environment variable reference
+type StrippedSecret struct {
+	Server string
+	Field  string // 如 env.GITHUB_TOKEN 或 headers.Authorization
+	Var    string // 引用的环境变量名
+}
+
+var (
+	secretKeyPattern   = regexp.MustCompile(`(?i)(token|secret|key|passw(or)?d|pwd|credential|auth|cookie)`)
+	secretValuePattern = regexp.MustCompile(`^(gh[pousr]_|github_pat_|sk-|xox[abprs]-|glpat-|AKIA)[A-Za-z0-9_\-]+$`)
+	authSchemePattern  = regexp.MustCompile(`(?i)^(bearer|basic|token)\s+`)
+	envNamePattern     = regexp.MustCompile(`[^A-Za-z0-9]+`)
+)
+
+// StripSecrets returns a copy of servers in which secret env values and
+// headers are replaced by ${VAR} references, which Claude Code expands when
+// it loads .mcp.json. Env values keep their own name as the variable;
+// headers use <SERVER>_<HEADER>, or <SERVER>_TOKEN for an Authorization
+// scheme, which is kept. Values that already contain a reference are left
+// alone.
+func StripSecrets(servers map[string]interface{}) (map[string]interface{}, []StrippedSecret) {
+	var stripped []StrippedSecret
+	result := make(map[string]interface{}, len(servers))
+	for _, name := range sortedKeys(servers) {
+		server, ok := servers[name].(map[string]interface{})
+		if !ok {
+			result[name] = servers[name]
+			continue
+		}
+		copied := make(map[string]interface{}, len(server))
+		for key, value := range server {
+			copied[key] = value
+		}
+
+		if env, ok := server["env"].(map[string]interface{}); ok {
+			newEnv := make(map[string]interface{}, len(env))
+			for _, key := range sortedKeys(env) {
+				value, _ := env[key].(string)
+				if isSecret(key, value) {
+					newEnv[key] = "${" + key + "}"
+					stripped = append(stripped, StrippedSecret{Server: name, Field: "env." + key, Var: key})
+					continue
+				}
+				newEnv[key] = env[key]
+			}
+			copied["env"] = newEnv
+		}
+
+		if headers, ok := server["headers"].(map[string]interface{}); ok {
+			newHeaders := make(map[string]interface{}, len(headers))
+			for _, key := range sortedKeys(headers) {
+				value, _ := headers[key].(string)
+				if !isSecret(key, value) {
+					newHeaders[key] = headers[key]
+					continue
+				}
+				scheme := authSchemePattern.FindString(value)
+				suffix := key
+				if scheme != "" {
+					suffix = "token"
+				}
+				envVar := envName(name + "_" + suffix)
+				newHeaders[key] = scheme + "${" + envVar + "}"
+				stripped = append(stripped, StrippedSecret{Server: name, Field: "headers." + key, Var: envVar})
+			}
+			copied["headers"] = newHeaders
+		}
+		result[name] = copied
+	}
+	return result, stripped
+}
+
+func isSecret(key, value string) bool {
+	if value == "" || strings.Contains(value, "${") {
+		return false
+	}
+	return secretKeyPattern.MatchString(key) || secretValuePattern.MatchString(value)
+}
+
+func envName(s string) string {
+	return strings.ToUpper(strings.Trim(envNamePattern.ReplaceAllString(s, "_"), "_"))
+}
+
+// ApplyMCPToMCPJSON 将全局 MCP 配置写入各项目仓库根目录的 .mcp.json
+// 每个文件单独显示 diff 和确认；默认合并，Overwrite 时覆盖
+func ApplyMCPToMCPJSON(projectPaths []string, opts SyncOptions) error {
+	globalMCP, err := GetGlobalMCPServers()
+	if err != nil {
+		if opts.Silent && os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if len(globalMCP) == 0 {
+		if !opts.Silent {
+			fmt.Println("没有找到全局 MCP 配置")
+		}
+		return nil
+	}
+	if opts.Silent {
+		opts.AutoYes = true
+	}
+
+	seen := make(map[string]bool)
+	for _, projectPath := range projectPaths {
+		root := ProjectRoot(projectPath)
+		if seen[root] {
+			continue
+		}
+		seen[root] = true
+		if err := writeMCPJSON(root, globalMCP, &opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeMCPJSON(root string, globalMCP map[string]interface{}, opts *SyncOptions) error {
+	path := filepath.Join(root, MCPJSONFile)
+	data, snap, err := fileutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取 %s 失败: %w", path, err)
+	}
+	if !snap.Exists {
+		data = []byte("{}\n")
+	}
+	doc, err := jsondoc.ParseDocument(data)
+	if err != nil {
+		return fmt.Errorf("解析 %s 失败: %w", path, err)
+	}
+	current, err := readMCPServers(data)
+	if err != nil {
+		return fmt.Errorf("解析 %s 失败: %w", path, err)
+	}
+
+	desired := globalMCP
+	if !opts.Overwrite {
+		desired = mergeMCPServers(current, globalMCP)
+	}
+	var stripped []StrippedSecret
+	if opts.StripSecrets {
+		desired, stripped = StripSecrets(desired)
+	}
+	if reflect.DeepEqual(current, desired) {
+		if !opts.Silent {
+			fmt.Printf("%s 已是最新\n", path)
+		}
+		return nil
+	}
+
+	if err := doc.Set([]string{"mcpServers"}, desired); err != nil {
+		return fmt.Errorf("更新 %s 失败: %w", path, err)
+	}
+	newData, err := doc.Bytes()
+	if err != nil {
+		return fmt.Errorf("序列化配置失败: %w", err)
+	}
+	if !snap.Exists {
+		data = nil
+	}
+
+	if !opts.Silent {
+		diff.ShowDiff(path, string(data), string(newData))
+		if !opts.StripSecrets {
+			// 确认前提醒，用户可以在密钥写入准备提交的文件之前取消
+			if _, found := StripSecrets(desired); len(found) > 0 {
+				fmt.Printf("注意: %s 可能包含 %d 个密钥，提交前可用 --strip-secrets 替换为 ${ENV} 引用:\n", MCPJSONFile, len(found))
+				for _, s := range found {
+					fmt.Printf("  %s.%s\n", s.Server, s.Field)
+				}
+			}
+		}
+	}
+	apply, err := confirmChange(path, MCPJSONFile, string(newData), opts)
+	if err != nil || !apply {
+		return err
+	}
+	if err := fileutil.WriteFileIfUnchanged(path, newData, 0644, snap); err != nil {
+		return fmt.Errorf("写入 %s 失败: %w", path, err)
+	}
+
+	if !opts.Silent {
+		fmt.Printf("已将全局 MCP 配置写入: %s\n", path)
+		if len(stripped) > 0 {
+			fmt.Printf("以下密钥已替换为环境变量引用，请在使用该仓库的环境中设置:\n")
+			for _, s := range stripped {
+				fmt.Printf("  %s.%s → ${%s}\n", s.Server, s.Field, s.Var)
+			}
+		}
+	}
+	return nil
+}
+
+func readMCPServers(data []byte) (map[string]interface{}, error) {
+	var v struct {
+		MCPServers map[string]interface{} `json:"mcpServers"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	if v.MCPServers == nil {
+		v.MCPServers = make(map[string]interface{})
+	}
+	return v.MCPServers, nil
+}
+
+// ImportMCPJSON 将项目仓库根目录 .mcp.json 中的 server 导入 ~/.claude.json 的全局 mcpServers
+// 默认只添加全局缺失的 server，Overwrite 时覆盖同名 server；${ENV} 引用原样保留
+func ImportMCPJSON(projectPath string, opts SyncOptions) error {
+	source := filepath.Join(ProjectRoot(projectPath), MCPJSONFile)
+	sourceData, err := os.ReadFile(source)
+	if err != nil {
+		return fmt.Errorf("读取 %s 失败: %w", source, err)
+	}
+	servers, err := readMCPServers(sourceData)
+	if err != nil {
+		return fmt.Errorf("解析 %s 失败: %w", source, err)
+	}
+	if len(servers) == 0 {
+		if !opts.Silent {
+			fmt.Printf("%s 中没有 MCP server\n", source)
+		}
+		return nil
+	}
+
+	claudeJSONPath, err := ClaudeJSONPath()
+	if err != nil {
+		return fmt.Errorf("获取用户目录失败: %w", err)
+	}
+	data, snap, err := fileutil.ReadFile(claudeJSONPath)
+	if err != nil {
+		return fmt.Errorf("读取 ~/.claude.json 失败: %w", err)
+	}
+	if !snap.Exists {
+		data = []byte("{}\n")
+	}
+	newData, imported, skipped, err := MergeServers(data, []string{"mcpServers"}, servers, opts.Overwrite)
+	if err != nil {
+		return fmt.Errorf("更新 ~/.claude.json 失败: %w", err)
+	}
+	if !opts.Silent && len(skipped) > 0 {
+		fmt.Printf("全局已有同名但配置不同的 server，未导入（使用 --overwrite 覆盖）: %s\n", strings.Join(skipped, ", "))
+	}
+	if len(imported) == 0 {
+		if !opts.Silent {
+			fmt.Println("全局 MCP 配置已包含", source, "中的 server")
+		}
+		return nil
+	}
+
+	if opts.Silent {
+		opts.AutoYes = true
+	} else {
+		diff.ShowDiff(claudeJSONPath, string(data), string(newData))
+	}
+	apply, err := confirmChange(claudeJSONPath, "mcpServers", string(newData), &opts)
+	if err != nil || !apply {
+		return err
+	}
+	if err := fileutil.WriteFileIfUnchanged(claudeJSONPath, newData, 0644, snap); err != nil {
+		return fmt.Errorf("写入配置失败: %w", err)
+	}
+	if !opts.Silent {
+		fmt.Printf("已从 %s 导入 %d 个 MCP server: %s\n", source, len(imported), strings.Join(imported, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package mcp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStripSecrets(t *testing.T) {
+	servers := map[string]interface{}{
+		"github": map[string]interface{}{
+			"command": "npx",
+			"env": map[string]interface{}{
+				"GITHUB_PERSONAL_ACCESS_TOKEN": "ghp_abc123",
+				"LOG_LEVEL":                    "debug",
+				"UPSTREAM":                     "sk-live123",
+				"API_KEY":                      "${API_KEY}",
+			},
+		},
+		"linear-api": map[string]interface{}{
+			"url":     "https://mcp.linear.app/sse",
+			"headers": map[string]interface{}{"Authorization": "Bearer lin_123", "X-Team": "core"},
+		},
+	}
+
+	got, stripped := StripSecrets(servers)
+	wantStripped := []StrippedSecret{
+		{Server: "github", Field: "env.GITHUB_PERSONAL_ACCESS_TOKEN", Var: "GITHUB_PERSONAL_ACCESS_TOKEN"},
+		{Server: "github", Field: "env.UPSTREAM", Var: "UPSTREAM"},
+		{Server: "linear-api", Field: "headers.Authorization", Var: "LINEAR_API_TOKEN"},
+	}
+	if !reflect.DeepEqual(stripped, wantStripped) {
+		t.Fatalf("stripped = %+v\nwant %+v", stripped, wantStripped)
+	}
+	env := got["github"].(map[string]interface{})["env"].(map[string]interface{})
+	if env["GITHUB_PERSONAL_ACCESS_TOKEN"] != "${GITHUB_PERSONAL_ACCESS_TOKEN}" || env["LOG_LEVEL"] != "debug" || env["API_KEY"] != "${API_KEY}" {
+		t.Errorf("env = %v", env)
+	}
+	headers := got["linear-api"].(map[string]interface{})["headers"].(map[string]interface{})
+	if headers["Authorization"] != "Bearer ${LINEAR_API_TOKEN}" || headers["X-Team"] != "core" {
+		t.Errorf("headers = %v", headers)
+	}
+	// 原始配置不被修改
+	if servers["github"].(map[string]interface{})["env"].(map[string]interface{})["UPSTREAM"] != "sk-live123" {
+		t.Errorf("StripSecrets modified its input")
+	}
+}
+
+func TestMCPJSONRoundTrip(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	repo := filepath.Join(home, "code", "api")
+	sub := filepath.Join(repo, "internal")
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	claudeJSON := filepath.Join(home, ".claude.json")
+	if err := os.WriteFile(claudeJSON, []byte(`{"mcpServers": {"github": {"command": "npx", "env": {"GITHUB_TOKEN": "ghp_x"}}}}`), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	mcpJSON := filepath.Join(repo, MCPJSONFile)
+	if err := os.WriteFile(mcpJSON, []byte("{\n  \"mcpServers\": {\n    \"db\": {\"command\": \"pg-mcp\"}\n  }\n}\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	opts := SyncOptions{AutoYes: true, Silent: true, Target: TargetMCPJSON, StripSecrets: true}
+	if err := ApplyMCPToMCPJSON([]string{sub}, opts); err != nil {
+		t.Fatalf("ApplyMCPToMCPJSON: %v", err)
+	}
+	data, err := os.ReadFile(mcpJSON)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	servers, err := readMCPServers(data)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := map[string]interface{}{
+		"db":     map[string]interface{}{"command": "pg-mcp"},
+		"github": map[string]interface{}{"command": "npx", "env": map[string]interface{}{"GITHUB_TOKEN": "${GITHUB_TOKEN}"}},
+	}
+	if !reflect.DeepEqual(servers, want) {
+		t.Fatalf(".mcp.json servers = %v", servers)
+	}
+
+	if err := ImportMCPJSON(sub, SyncOptions{AutoYes: true, Silent: true}); err != nil {
+		t.Fatalf("ImportMCPJSON: %v", err)
+	}
+	data, err = os.ReadFile(claudeJSON)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var prefs struct {
+		MCPServers map[string]map[string]interface{} `json:"mcpServers"`
+	}
+	if err := json.Unmarshal(data, &prefs); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if prefs.MCPServers["db"]["command"] != "pg-mcp" {
+		t.Errorf("db not imported: %v", prefs.MCPServers)
+	}
+	// 全局已有的 github 不被 .mcp.json 中的 ${ENV} 引用覆盖
+	if env := prefs.MCPServers["github"]["env"].(map[string]interface{}); env["GITHUB_TOKEN"] != "ghp_x" {
+		t.Errorf("github overwritten without --overwrite: %v", env)
+	}
+}
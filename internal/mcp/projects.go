@@ -0,0 +1,450 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/yxuechao007/claude_sync/internal/config"
+	"github.com/yxuechao007/claude_sync/internal/jsondoc"
+)
+
+// ProjectRemap records where a project of another machine ended up on pull.
+// To is empty when the project was not written locally.
+type ProjectRemap struct {
+	From string
+	To   string
+}
+
+// ProjectMapper maps ~/.claude.json project paths of other machines to
+// project paths on this machine, by configured path prefixes or by git
+// remote URL
+type ProjectMapper struct {
+	mappings []config.ProjectMapping // To 已展开
+	// remotes 是其他设备 push 时记录的 项目路径 → git remote
+	remotes map[string]string
+	// localRemotes 是本机 git remote → 项目路径，按需计算
+	localRemotes map[string]string
+	matchRemote  bool
+}
+
+// NewProjectMapper builds a mapper. remotes holds the git remotes recorded
+// for the other machines' projects and is only used with matchRemote.
+func NewProjectMapper(mappings []config.ProjectMapping, remotes map[string]string, matchRemote bool) (*ProjectMapper, error) {
+	m := &ProjectMapper{remotes: remotes, matchRemote: matchRemote}
+	for _, mapping := range mappings {
+		to, err := config.ExpandPath(mapping.To)
+		if err != nil {
+			return nil, err
+		}
+		m.mappings = append(m.mappings, config.ProjectMapping{From: mapping.From, To: to})
+	}
+	// 最长前缀优先
+	sort.SliceStable(m.mappings, func(i, j int) bool {
+		return len(m.mappings[i].From) > len(m.mappings[j].From)
+	})
+	return m, nil
+}
+
+// Map returns the local path for a project path from another machine.
+// Paths that are already known locally or exist on disk map to themselves;
+// ok is false when no local project corresponds to path.
+func (m *ProjectMapper) Map(path string, localProjects map[string]interface{}) (string, bool) {
+	if _, ok := localProjects[path]; ok || dirExists(path) {
+		return path, true
+	}
+	for _, mapping := range m.mappings {
+		rest, ok := trimPathPrefix(path, mapping.From)
+		if !ok {
+			continue
+		}
+		mapped := mapping.To
+		if rest != "" {
+			mapped = filepath.Join(mapping.To, filepath.FromSlash(rest))
+		}
+		if _, known := localProjects[mapped]; known || dirExists(mapped) {
+			return mapped, true
+		}
+	}
+	if m.matchRemote {
+		if remote := m.remotes[path]; remote != "" {
+			if local, ok := m.localRemote(remote, localProjects); ok {
+				return local, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (m *ProjectMapper) localRemote(remote string, localProjects map[string]interface{}) (string, bool) {
+	if m.localRemotes == nil {
+		m.localRemotes = make(map[string]string)
+		paths := make([]string, 0, len(localProjects))
+		for path := range localProjects {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			if url := GitRemote(path); url != "" {
+				if _, dup := m.localRemotes[url]; !dup {
+					m.localRemotes[url] = path
+				}
+			}
+		}
+	}
+	local, ok := m.localRemotes[remote]
+	return local, ok
+}
+
+// trimPathPrefix returns the part of path below prefix, using / as separator
+func trimPathPrefix(path, prefix string) (string, bool) {
+	path = strings.ReplaceAll(path, `\`, "/")
+	prefix = strings.TrimRight(strings.ReplaceAll(prefix, `\`, "/"), "/")
+	if path == prefix {
+		return "", true
+	}
+	if !strings.HasPrefix(path, prefix+"/") {
+		return "", false
+	}
+	return path[len(prefix)+1:], true
+}
+
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// RemapProjects rewrites the "projects" keys of remote ~/.claude.json
+// content to local paths and drops projects that have no local
+// counterpart, so foreign paths are never injected into the local file.
+// local is the current local ~/.claude.json (may be empty).
+func RemapProjects(remoteData, localData []byte, m *ProjectMapper) ([]byte, []ProjectRemap, error) {
+	var remoteObj map[string]interface{}
+	if err := json.Unmarshal(remoteData, &remoteObj); err != nil {
+		return nil, nil, err
+	}
+	remoteProjects, ok := remoteObj["projects"].(map[string]interface{})
+	if !ok || len(remoteProjects) == 0 {
+		return remoteData, nil, nil
+	}
+
+	var localObj map[string]interface{}
+	if len(bytes.TrimSpace(localData)) > 0 {
+		if err := json.Unmarshal(localData, &localObj); err != nil {
+			return nil, nil, err
+		}
+	}
+	localProjects, _ := localObj["projects"].(map[string]interface{})
+
+	var remaps []ProjectRemap
+	projects := make(map[string]interface{})
+	for _, path := range sortedKeys(remoteProjects) {
+		mapped, ok := m.Map(path, localProjects)
+		if !ok {
+			remaps = append(remaps, ProjectRemap{From: path})
+			continue
+		}
+		if mapped != path {
+			remaps = append(remaps, ProjectRemap{From: path, To: mapped})
+			if _, exact := remoteProjects[mapped]; exact {
+				continue // 远端已有本机路径的条目，以它为准
+			}
+		}
+		if _, dup := projects[mapped]; !dup {
+			projects[mapped] = remoteProjects[path]
+		}
+	}
+	if len(remaps) == 0 {
+		return remoteData, nil, nil
+	}
+
+	if len(projects) > 0 {
+		remoteObj["projects"] = projects
+	} else {
+		delete(remoteObj, "projects")
+	}
+	result, err := jsondoc.MarshalIndent(remoteObj)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, remaps, nil
+}
+
+// KeepUnmappedProjects adds the projects of remote ~/.claude.json content
+// that have no counterpart on this machine to local content about to be
+// pushed, so a push does not erase the projects of other machines.
+// It returns the project paths it kept from remote.
+func KeepUnmappedProjects(localData, remoteData []byte, m *ProjectMapper) ([]byte, []string, error) {
+	if len(bytes.TrimSpace(remoteData)) == 0 {
+		return localData, nil, nil
+	}
+	source, err := jsondoc.ParseDocument(remoteData)
+	if err != nil {
+		return nil, nil, err
+	}
+	value, _ := source.Get([]string{"projects"})
+	remoteProjects, ok := value.(*jsondoc.Object)
+	if !ok || remoteProjects.Len() == 0 {
+		return localData, nil, nil
+	}
+
+	var localObj map[string]interface{}
+	if err := json.Unmarshal(localData, &localObj); err != nil {
+		return nil, nil, err
+	}
+	localProjects, _ := localObj["projects"].(map[string]interface{})
+	doc, err := jsondoc.ParseDocument(localData)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var kept []string
+	for _, path := range remoteProjects.Keys() {
+		if _, ok := m.Map(path, localProjects); ok {
+			continue
+		}
+		project, _ := remoteProjects.Get(path)
+		if err := doc.Set([]string{"projects", path}, project); err != nil {
+			return nil, nil, err
+		}
+		kept = append(kept, path)
+	}
+	if len(kept) == 0 {
+		return localData, nil, nil
+	}
+	result, err := doc.Bytes()
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, kept, nil
+}
+
+// ProjectRemotes returns the normalized git remote of every project in
+// ~/.claude.json content that is a git repository on this machine
+func ProjectRemotes(data []byte) map[string]string {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil
+	}
+	projects, _ := obj["projects"].(map[string]interface{})
+	var remotes map[string]string
+	for path := range projects {
+		if url := GitRemote(path); url != "" {
+			if remotes == nil {
+				remotes = make(map[string]string)
+			}
+			remotes[path] = url
+		}
+	}
+	return remotes
+}
+
+// GitRemote returns the normalized URL of the "origin" remote of the git
+// repository at dir (or its first remote), or "" when there is none.
+// It reads .git/config directly so scanning many projects stays fast.
+func GitRemote(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, ".git", "config"))
+	if err != nil {
+		return ""
+	}
+
+	var first, origin, section string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			section = line
+			continue
+		}
+		if !strings.HasPrefix(section, `[remote "`) {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(key) != "url" {
+			continue
+		}
+		url := NormalizeRemote(strings.TrimSpace(value))
+		if first == "" {
+			first = url
+		}
+		if section == `[remote "origin"]` && origin == "" {
+			origin = url
+		}
+	}
+	if origin != "" {
+		return origin
+	}
+	return first
+}
+
+// NormalizeRemote reduces the different spellings of a git remote to
+// host/path, e.g. git@github.com:org/repo.git and
+// https://user@github.com/org/repo both become github.com/org/repo
+func NormalizeRemote(url string) string {
+	url = strings.TrimSpace(url)
+	if i := strings.Index(url, "://"); i >= 0 {
+		url = url[i+3:]
+	} else if host, path, ok := strings.Cut(url, ":"); ok && !strings.Contains(host, "/") {
+		// scp 风格：git@github.com:org/repo
+		url = host + "/" + path
+	}
+	if at := strings.Index(url, "@"); at >= 0 && at < strings.Index(url+"/", "/") {
+		url = url[at+1:]
+	}
+	url = strings.TrimSuffix(strings.TrimRight(url, "/"), ".git")
+	host, path, _ := strings.Cut(url, "/")
+	if h, _, ok := strings.Cut(host, ":"); ok {
+		host = h // 去掉端口
+	}
+	return strings.ToLower(host) + "/" + path
+}
+
+// ClaudeJSONPath returns the path of ~/.claude.json
+func ClaudeJSONPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".claude.json"), nil
+}
+
+// ProjectInfo summarizes one entry of ~/.claude.json "projects"
+type ProjectInfo struct {
+	Path       string
+	Exists     bool     // 目录在本机是否存在
+	MCPServers []string // 项目级 mcpServers 名称
+}
+
+// ReadProjects lists the projects of ~/.claude.json content, sorted by path
+func ReadProjects(data []byte) ([]ProjectInfo, error) {
+	var prefs map[string]interface{}
+	if err := json.Unmarshal(data, &prefs); err != nil {
+		return nil, err
+	}
+	projects, _ := prefs["projects"].(map[string]interface{})
+
+	infos := make([]ProjectInfo, 0, len(projects))
+	for _, path := range sortedKeys(projects) {
+		info := ProjectInfo{Path: path, Exists: dirExists(path)}
+		if project, ok := projects[path].(map[string]interface{}); ok {
+			servers, _ := project["mcpServers"].(map[string]interface{})
+			info.MCPServers = sortedKeys(servers)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// ProjectConfig returns the raw config of one project
+func ProjectConfig(data []byte, path string) (interface{}, bool, error) {
+	doc, err := jsondoc.ParseDocument(data)
+	if err != nil {
+		return nil, false, err
+	}
+	value, ok := doc.Get([]string{"projects", path})
+	return value, ok, nil
+}
+
+// RemoveProjects deletes projects from ~/.claude.json content, keeping the
+// layout of the rest of the file. It returns the content and the number
+// of projects removed.
+func RemoveProjects(data []byte, paths []string) ([]byte, int, error) {
+	doc, err := jsondoc.ParseDocument(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	removed := 0
+	for _, path := range paths {
+		if doc.Delete([]string{"projects", path}) {
+			removed++
+		}
+	}
+	if removed == 0 {
+		return data, 0, nil
+	}
+	result, err := doc.Bytes()
+	if err != nil {
+		return nil, 0, err
+	}
+	return result, removed, nil
+}
+
+// ProjectTargets selects the projects global MCP servers are applied to
+type ProjectTargets struct {
+	All      bool     // 所有已知且目录存在的项目
+	Paths    []string // 指定的项目目录
+	Globs    []string // 按 glob 匹配已知项目，如 ~/code/*
+	Discover bool     // 同时把 glob 匹配到的磁盘上的 git 仓库作为目标
+}
+
+// ResolveProjects returns the absolute project paths selected by t, using
+// the projects of ~/.claude.json content, sorted and without duplicates
+func ResolveProjects(data []byte, t ProjectTargets) ([]string, error) {
+	known, err := ReadProjects(data)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string]bool)
+	if t.All {
+		for _, p := range known {
+			if p.Exists {
+				selected[p.Path] = true
+			}
+		}
+	}
+	for _, path := range t.Paths {
+		abs, err := absPath(path)
+		if err != nil {
+			return nil, err
+		}
+		if !dirExists(abs) {
+			return nil, fmt.Errorf("project directory %s does not exist", abs)
+		}
+		selected[abs] = true
+	}
+	for _, glob := range t.Globs {
+		pattern, err := absPath(glob)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", glob, err)
+		}
+		for _, p := range known {
+			if ok, _ := filepath.Match(pattern, p.Path); ok && p.Exists {
+				selected[p.Path] = true
+			}
+		}
+		if !t.Discover {
+			continue
+		}
+		matches, _ := filepath.Glob(pattern)
+		for _, match := range matches {
+			// .git 可能是目录，也可能是 worktree 的文件
+			if _, err := os.Stat(filepath.Join(match, ".git")); err == nil {
+				selected[match] = true
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(selected))
+	for path := range selected {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func absPath(path string) (string, error) {
+	expanded, err := config.ExpandPath(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(expanded)
+}
@@ -0,0 +1,246 @@
+package mcp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/yxuechao007/claude_sync/internal/config"
+)
+
+func writeGitConfig(t *testing.T, dir, url string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(dir, ".git"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	content := "[core]\n\tbare = false\n[remote \"origin\"]\n\turl = " + url + "\n"
+	if err := os.WriteFile(filepath.Join(dir, ".git", "config"), []byte(content), 0644); err != nil {
+		t.Fatalf("write git config: %v", err)
+	}
+}
+
+func TestRemapProjects(t *testing.T) {
+	home := t.TempDir()
+	api := filepath.Join(home, "src", "api")
+	web := filepath.Join(home, "work", "web")
+	for _, dir := range []string{api, web} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+	}
+	writeGitConfig(t, web, "git@github.com:acme/web.git")
+
+	remote := []byte(`{"projects": {
+		"/Users/alice/code/api": {"mcpServers": {"db": {"command": "pg"}}},
+		"/Users/alice/web": {"mcpServers": {"browser": {"command": "chrome"}}},
+		"/Users/alice/scratch": {"mcpServers": {"x": {}}}
+	}}`)
+	local := []byte(`{"projects": {"` + web + `": {}}}`)
+
+	mapper, err := NewProjectMapper(
+		[]config.ProjectMapping{{From: "/Users/alice/code", To: filepath.Join(home, "src")}},
+		map[string]string{"/Users/alice/web": "github.com/acme/web"},
+		true,
+	)
+	if err != nil {
+		t.Fatalf("NewProjectMapper: %v", err)
+	}
+
+	out, remaps, err := RemapProjects(remote, local, mapper)
+	if err != nil {
+		t.Fatalf("RemapProjects: %v", err)
+	}
+	wantRemaps := []ProjectRemap{
+		{From: "/Users/alice/code/api", To: api},
+		{From: "/Users/alice/scratch"},
+		{From: "/Users/alice/web", To: web},
+	}
+	if !reflect.DeepEqual(remaps, wantRemaps) {
+		t.Fatalf("remaps = %+v\nwant %+v", remaps, wantRemaps)
+	}
+
+	var got struct {
+		Projects map[string]interface{} `json:"projects"`
+	}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(got.Projects) != 2 || got.Projects[api] == nil || got.Projects[web] == nil {
+		t.Fatalf("projects = %v", got.Projects)
+	}
+}
+
+func TestRemapProjectsWithoutGitMatching(t *testing.T) {
+	remote := []byte(`{"projects": {"/Users/alice/web": {}}, "mcpServers": {}}`)
+	mapper, _ := NewProjectMapper(nil, map[string]string{"/Users/alice/web": "github.com/acme/web"}, false)
+
+	out, remaps, err := RemapProjects(remote, nil, mapper)
+	if err != nil {
+		t.Fatalf("RemapProjects: %v", err)
+	}
+	if len(remaps) != 1 || remaps[0].To != "" {
+		t.Fatalf("remaps = %+v", remaps)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if _, ok := got["projects"]; ok {
+		t.Fatalf("foreign project injected: %s", out)
+	}
+}
+
+func TestKeepUnmappedProjects(t *testing.T) {
+	home := t.TempDir()
+	api := filepath.Join(home, "src", "api")
+	if err := os.MkdirAll(api, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	remote := []byte(`{"projects": {
+		"/Users/alice/code/api": {"mcpServers": {"db": {"command": "old"}}},
+		"/Users/alice/scratch": {"mcpServers": {"x": {}}}
+	}}`)
+	local := []byte(`{"projects": {"` + api + `": {"mcpServers": {"db": {"command": "pg"}}}}}`)
+	mapper, _ := NewProjectMapper([]config.ProjectMapping{{From: "/Users/alice/code", To: filepath.Join(home, "src")}}, nil, false)
+
+	out, kept, err := KeepUnmappedProjects(local, remote, mapper)
+	if err != nil {
+		t.Fatalf("KeepUnmappedProjects: %v", err)
+	}
+	// 映射到本机的项目以本机为准，本机没有对应的项目保留 Gist 中的条目
+	if !reflect.DeepEqual(kept, []string{"/Users/alice/scratch"}) {
+		t.Fatalf("kept = %v", kept)
+	}
+	var got struct {
+		Projects map[string]interface{} `json:"projects"`
+	}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(got.Projects) != 2 || got.Projects[api] == nil || got.Projects["/Users/alice/scratch"] == nil {
+		t.Fatalf("projects = %v", got.Projects)
+	}
+}
+
+func TestNormalizeRemote(t *testing.T) {
+	for _, url := range []string{
+		"git@github.com:acme/web.git",
+		"https://github.com/acme/web",
+		"https://alice@GitHub.com/acme/web.git/",
+		"ssh://git@github.com:22/acme/web.git",
+	} {
+		if got := NormalizeRemote(url); got != "github.com/acme/web" {
+			t.Errorf("NormalizeRemote(%q) = %q", url, got)
+		}
+	}
+}
+
+func TestReadAndRemoveProjects(t *testing.T) {
+	existing := t.TempDir()
+	data := []byte(`{
+  "numStartups": 3,
+  "projects": {
+    "/nonexistent/old": {"mcpServers": {"b": {}, "a": {}}},
+    "` + existing + `": {"allowedTools": []}
+  },
+  "mcpServers": {}
+}
+`)
+
+	projects, err := ReadProjects(data)
+	if err != nil {
+		t.Fatalf("ReadProjects: %v", err)
+	}
+	want := []ProjectInfo{
+		{Path: "/nonexistent/old", MCPServers: []string{"a", "b"}},
+		{Path: existing, Exists: true, MCPServers: []string{}},
+	}
+	sort.Slice(want, func(i, j int) bool { return want[i].Path < want[j].Path })
+	if !reflect.DeepEqual(projects, want) {
+		t.Fatalf("projects = %+v\nwant %+v", projects, want)
+	}
+
+	updated, removed, err := RemoveProjects(data, []string{"/nonexistent/old", "/not/listed"})
+	if err != nil || removed != 1 {
+		t.Fatalf("RemoveProjects = %d, %v", removed, err)
+	}
+	wantData := `{
+  "numStartups": 3,
+  "projects": {
+    "` + existing + `": {
+      "allowedTools": []
+    }
+  },
+  "mcpServers": {}
+}
+`
+	if string(updated) != wantData {
+		t.Fatalf("updated:\n%s\nwant:\n%s", updated, wantData)
+	}
+}
+
+func TestApplyMCPToProjects(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	code := filepath.Join(home, "code")
+	api, web, fresh := filepath.Join(code, "api"), filepath.Join(code, "web"), filepath.Join(code, "fresh")
+	for _, dir := range []string{api, web, fresh} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+	}
+	writeGitConfig(t, fresh, "git@github.com:acme/fresh.git")
+
+	claudeJSON := `{
+  "mcpServers": {"db": {"command": "pg"}},
+  "projects": {
+    "` + api + `": {"mcpServers": {"local": {"command": "x"}}},
+    "` + web + `": {"mcpServers": {"db": {"command": "pg"}}},
+    "/gone/project": {}
+  }
+}
+`
+	path := filepath.Join(home, ".claude.json")
+	if err := os.WriteFile(path, []byte(claudeJSON), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	projects, err := ResolveProjects([]byte(claudeJSON), ProjectTargets{Globs: []string{"~/code/*"}, Discover: true})
+	if err != nil {
+		t.Fatalf("ResolveProjects: %v", err)
+	}
+	if want := []string{api, fresh, web}; !reflect.DeepEqual(projects, want) {
+		t.Fatalf("projects = %v, want %v", projects, want)
+	}
+	all, _ := ResolveProjects([]byte(claudeJSON), ProjectTargets{All: true})
+	if want := []string{api, web}; !reflect.DeepEqual(all, want) {
+		t.Fatalf("--all projects = %v, want %v", all, want)
+	}
+
+	if err := ApplyMCPToProjects(projects, SyncOptions{AutoYes: true, Silent: true}); err != nil {
+		t.Fatalf("ApplyMCPToProjects: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var got struct {
+		Projects map[string]struct {
+			MCPServers map[string]interface{} `json:"mcpServers"`
+		} `json:"projects"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	for _, dir := range projects {
+		if got.Projects[dir].MCPServers["db"] == nil {
+			t.Errorf("%s: db server not applied: %v", dir, got.Projects[dir].MCPServers)
+		}
+	}
+	if got.Projects[api].MCPServers["local"] == nil {
+		t.Errorf("merge dropped the project's own server")
+	}
+}
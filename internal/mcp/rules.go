@@ -0,0 +1,102 @@
+package mcp
+
+import (
+	"github.com/yxuechao007/claude_sync/internal/jsondoc"
+)
+
+// serverScopes returns the mcpServers paths of a document: the global one
+// and one per project
+func serverScopes(doc *jsondoc.Document) [][]string {
+	scopes := [][]string{ServersPath("")}
+	if value, ok := doc.Get([]string{"projects"}); ok {
+		if projects, ok := value.(*jsondoc.Object); ok {
+			for _, project := range projects.Keys() {
+				scopes = append(scopes, ServersPath(project))
+			}
+		}
+	}
+	return scopes
+}
+
+// RemoveServers deletes the picked servers from the global and every
+// project scope of ~/.claude.json content. It reports whether anything was
+// removed.
+func RemoveServers(data []byte, pick func(name string) bool) ([]byte, bool, error) {
+	return OverlayServers(data, nil, pick)
+}
+
+// OverlayServers replaces the picked servers of data with their versions in
+// other, scope by scope, and deletes the picked servers other does not
+// define. Scopes are the global mcpServers and the projects of data; other
+// may be nil to delete every picked server. It reports whether data
+// changed.
+func OverlayServers(data, other []byte, pick func(name string) bool) ([]byte, bool, error) {
+	doc, err := jsondoc.ParseDocument(data)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(other) == 0 {
+		other = []byte("{}")
+	}
+	source, err := jsondoc.ParseDocument(other)
+	if err != nil {
+		return nil, false, err
+	}
+
+	changed := false
+	for _, scope := range serverScopes(doc) {
+		var names []string
+		seen := make(map[string]bool)
+		for _, d := range []*jsondoc.Document{doc, source} {
+			value, _ := d.Get(scope)
+			servers, ok := value.(*jsondoc.Object)
+			if !ok {
+				continue
+			}
+			for _, name := range servers.Keys() {
+				if !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+		}
+		for _, name := range names {
+			if !pick(name) {
+				continue
+			}
+			path := append(append([]string(nil), scope...), name)
+			replacement, ok := source.Get(path)
+			if !ok {
+				if doc.Delete(path) {
+					changed = true
+				}
+				continue
+			}
+			current, exists := doc.Get(path)
+			if exists && sameJSON(current, replacement) {
+				continue
+			}
+			if err := doc.Set(path, replacement); err != nil {
+				return nil, false, err
+			}
+			changed = true
+		}
+	}
+	if !changed {
+		return data, false, nil
+	}
+	result, err := doc.Bytes()
+	if err != nil {
+		return nil, false, err
+	}
+	return result, true, nil
+}
+
+func sameJSON(a, b interface{}) bool {
+	left, err := jsondoc.Marshal(a, "")
+	if err != nil {
+		return false
+	}
+	right, err := jsondoc.Marshal(b, "")
+	return err == nil && string(left) == string(right)
+}
@@ -0,0 +1,298 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/yxuechao007/claude_sync/internal/diff"
+	"github.com/yxuechao007/claude_sync/internal/jsondoc"
+)
+
+// disabledKey is the per-project list Claude Code uses to turn servers off
+const disabledKey = "disabledMcpServers"
+
+// ServerOverride is a project that defines a server with the same name as
+// a global one
+type ServerOverride struct {
+	Project string
+	Changes []diff.JSONChange // 相对全局配置的差异，为空表示完全相同
+}
+
+// ServerInfo describes one MCP server name across ~/.claude.json
+type ServerInfo struct {
+	Name       string
+	Global     bool                   // 是否定义在全局 mcpServers 中
+	Config     map[string]interface{} // 全局配置；仅项目级时为第一个定义它的项目的配置
+	Overrides  []ServerOverride       // 定义了同名 server 的项目
+	DisabledIn []string               // 在 disabledMcpServers 中禁用了它的项目
+}
+
+// ListServers returns every MCP server name of ~/.claude.json content,
+// global servers first, each sorted by name
+func ListServers(data []byte) ([]ServerInfo, error) {
+	var prefs map[string]interface{}
+	if err := json.Unmarshal(data, &prefs); err != nil {
+		return nil, err
+	}
+	global, _ := prefs["mcpServers"].(map[string]interface{})
+	projects, _ := prefs["projects"].(map[string]interface{})
+
+	infos := make(map[string]*ServerInfo)
+	for name, server := range global {
+		config, _ := server.(map[string]interface{})
+		infos[name] = &ServerInfo{Name: name, Global: true, Config: config}
+	}
+	for _, path := range sortedKeys(projects) {
+		project, _ := projects[path].(map[string]interface{})
+		servers, _ := project["mcpServers"].(map[string]interface{})
+		for _, name := range sortedKeys(servers) {
+			config, _ := servers[name].(map[string]interface{})
+			info, ok := infos[name]
+			if !ok {
+				info = &ServerInfo{Name: name, Config: config}
+				infos[name] = info
+			}
+			override := ServerOverride{Project: path}
+			if info.Global {
+				changes, err := serverChanges(info.Config, config)
+				if err != nil {
+					return nil, err
+				}
+				override.Changes = changes
+			}
+			info.Overrides = append(info.Overrides, override)
+		}
+		for _, name := range stringValues(project[disabledKey]) {
+			if info, ok := infos[name]; ok {
+				info.DisabledIn = append(info.DisabledIn, path)
+			} else {
+				infos[name] = &ServerInfo{Name: name, DisabledIn: []string{path}}
+			}
+		}
+	}
+
+	list := make([]ServerInfo, 0, len(infos))
+	for _, info := range infos {
+		list = append(list, *info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Global != list[j].Global {
+			return list[i].Global
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list, nil
+}
+
+func serverChanges(global, project map[string]interface{}) ([]diff.JSONChange, error) {
+	oldData, err := json.Marshal(global)
+	if err != nil {
+		return nil, err
+	}
+	newData, err := json.Marshal(project)
+	if err != nil {
+		return nil, err
+	}
+	return diff.SemanticDiff(oldData, newData)
+}
+
+func stringValues(v interface{}) []string {
+	list, _ := v.([]interface{})
+	values := make([]string, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// ServerSummary renders a server config on one line, such as
+// "stdio: npx -y server" or "http: https://example.com/mcp"
+func ServerSummary(config map[string]interface{}) string {
+	if url, ok := config["url"].(string); ok {
+		transport, _ := config["type"].(string)
+		if transport == "" {
+			transport = "http"
+		}
+		return transport + ": " + url
+	}
+	command, _ := config["command"].(string)
+	parts := append([]string{command}, stringValues(config["args"])...)
+	return "stdio: " + strings.TrimSpace(strings.Join(parts, " "))
+}
+
+// ServersPath returns the key path of the global mcpServers when project is
+// empty, otherwise of the project's mcpServers
+func ServersPath(project string) []string {
+	if project == "" {
+		return []string{"mcpServers"}
+	}
+	return []string{"projects", project, "mcpServers"}
+}
+
+func scopeName(project string) string {
+	if project == "" {
+		return "global mcpServers"
+	}
+	return "project " + project
+}
+
+// ReadServers returns the servers of the global scope, or of one project
+// when project is set
+func ReadServers(data []byte, project string) (map[string]interface{}, error) {
+	var prefs map[string]interface{}
+	if err := json.Unmarshal(data, &prefs); err != nil {
+		return nil, err
+	}
+	servers, _ := prefs["mcpServers"].(map[string]interface{})
+	if project != "" {
+		projects, _ := prefs["projects"].(map[string]interface{})
+		projectConfig, _ := projects[project].(map[string]interface{})
+		servers, _ = projectConfig["mcpServers"].(map[string]interface{})
+	}
+	if servers == nil {
+		servers = make(map[string]interface{})
+	}
+	return servers, nil
+}
+
+// SelectServers returns the named servers, or all of them when names is
+// empty, failing on names that are not defined
+func SelectServers(servers map[string]interface{}, names []string) (map[string]interface{}, error) {
+	if len(names) == 0 {
+		return servers, nil
+	}
+	selected := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		server, ok := servers[name]
+		if !ok {
+			return nil, fmt.Errorf("MCP server %q not found", name)
+		}
+		selected[name] = server
+	}
+	return selected, nil
+}
+
+// GetServer returns the config of one server in the global or project scope
+func GetServer(data []byte, project, name string) (interface{}, bool, error) {
+	doc, err := jsondoc.ParseDocument(data)
+	if err != nil {
+		return nil, false, err
+	}
+	value, ok := doc.Get(append(ServersPath(project), name))
+	return value, ok, nil
+}
+
+// AddServer adds a server to the global or project scope. An existing
+// server with the same name is only replaced when replace is set.
+func AddServer(data []byte, project, name string, server map[string]interface{}, replace bool) ([]byte, error) {
+	doc, err := jsondoc.ParseDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	path := append(ServersPath(project), name)
+	if _, exists := doc.Get(path); exists && !replace {
+		return nil, fmt.Errorf("MCP server %q already exists in %s", name, scopeName(project))
+	}
+	if err := doc.Set(path, server); err != nil {
+		return nil, err
+	}
+	return doc.Bytes()
+}
+
+// RemoveServer deletes a server from the global or project scope
+func RemoveServer(data []byte, project, name string) ([]byte, error) {
+	doc, err := jsondoc.ParseDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	if !doc.Delete(append(ServersPath(project), name)) {
+		return nil, fmt.Errorf("MCP server %q not found in %s", name, scopeName(project))
+	}
+	return doc.Bytes()
+}
+
+// RenameServer renames a server in place. disabledMcpServers entries follow
+// the rename: in every project for a global server, otherwise only in the
+// given project.
+func RenameServer(data []byte, project, oldName, newName string) ([]byte, error) {
+	doc, err := jsondoc.ParseDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	value, _ := doc.Get(ServersPath(project))
+	servers, ok := value.(*jsondoc.Object)
+	if !ok {
+		return nil, fmt.Errorf("MCP server %q not found in %s", oldName, scopeName(project))
+	}
+	if _, exists := servers.Get(newName); exists {
+		return nil, fmt.Errorf("MCP server %q already exists in %s", newName, scopeName(project))
+	}
+	if !servers.Rename(oldName, newName) {
+		return nil, fmt.Errorf("MCP server %q not found in %s", oldName, scopeName(project))
+	}
+
+	projects := []string{project}
+	if project == "" {
+		value, _ := doc.Get([]string{"projects"})
+		if obj, ok := value.(*jsondoc.Object); ok {
+			projects = obj.Keys()
+		}
+	}
+	for _, p := range projects {
+		path := []string{"projects", p, disabledKey}
+		value, ok := doc.Get(path)
+		list, _ := value.([]interface{})
+		if !ok || list == nil {
+			continue
+		}
+		for i, item := range list {
+			if item == oldName {
+				list[i] = newName
+			}
+		}
+	}
+	return doc.Bytes()
+}
+
+// SetServerEnabled adds or removes name in the project's disabledMcpServers
+// list, which is how Claude Code turns a server off for one project. It
+// reports whether the content changed.
+func SetServerEnabled(data []byte, project, name string, enabled bool) ([]byte, bool, error) {
+	doc, err := jsondoc.ParseDocument(data)
+	if err != nil {
+		return nil, false, err
+	}
+	path := []string{"projects", project, disabledKey}
+	value, _ := doc.Get(path)
+	list, _ := value.([]interface{})
+
+	updated := make([]interface{}, 0, len(list)+1)
+	found := false
+	for _, item := range list {
+		if item == name {
+			found = true
+			if enabled {
+				continue
+			}
+		}
+		updated = append(updated, item)
+	}
+	if found != enabled {
+		return data, false, nil
+	}
+	if !enabled {
+		updated = append(updated, name)
+	}
+	if err := doc.Set(path, updated); err != nil {
+		return nil, false, err
+	}
+	result, err := doc.Bytes()
+	if err != nil {
+		return nil, false, err
+	}
+	return result, true, nil
+}
@@ -0,0 +1,162 @@
+package mcp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yxuechao007/claude_sync/internal/diff"
+)
+
+const serversJSON = `{
+  "mcpServers": {
+    "github": {"command": "npx", "args": ["-y", "@mcp/github"]},
+    "docs": {"type": "sse", "url": "https://docs.example.com/sse"}
+  },
+  "projects": {
+    "/code/api": {
+      "mcpServers": {"github": {"command": "npx", "args": ["-y", "@mcp/github"], "env": {"TOKEN": "x"}}},
+      "disabledMcpServers": ["docs"]
+    },
+    "/code/web": {
+      "mcpServers": {"github": {"command": "npx", "args": ["-y", "@mcp/github"]}, "local": {"command": "./run"}}
+    }
+  }
+}
+`
+
+func TestListServers(t *testing.T) {
+	servers, err := ListServers([]byte(serversJSON))
+	if err != nil {
+		t.Fatalf("ListServers: %v", err)
+	}
+	var names []string
+	for _, s := range servers {
+		names = append(names, s.Name)
+	}
+	if got := strings.Join(names, ","); got != "docs,github,local" {
+		t.Fatalf("names = %s", got)
+	}
+
+	docs, github, local := servers[0], servers[1], servers[2]
+	if len(docs.DisabledIn) != 1 || docs.DisabledIn[0] != "/code/api" {
+		t.Errorf("docs disabled in %v", docs.DisabledIn)
+	}
+	if got := ServerSummary(docs.Config); got != "sse: https://docs.example.com/sse" {
+		t.Errorf("docs summary = %q", got)
+	}
+	if len(github.Overrides) != 2 {
+		t.Fatalf("github overrides = %+v", github.Overrides)
+	}
+	api, web := github.Overrides[0], github.Overrides[1]
+	if len(api.Changes) != 1 || api.Changes[0].Path != "env" || api.Changes[0].Kind != diff.ChangeAdded {
+		t.Errorf("api changes = %+v", api.Changes)
+	}
+	if len(web.Changes) != 0 {
+		t.Errorf("web should match global: %+v", web.Changes)
+	}
+	if local.Global || len(local.Overrides) != 1 || ServerSummary(local.Config) != "stdio: ./run" {
+		t.Errorf("local = %+v", local)
+	}
+}
+
+func TestEditServers(t *testing.T) {
+	data := []byte(serversJSON)
+
+	if _, err := AddServer(data, "", "github", map[string]interface{}{"command": "gh"}, false); err == nil {
+		t.Fatalf("AddServer should refuse to replace without replace")
+	}
+	added, err := AddServer(data, "/code/new", "db", map[string]interface{}{"command": "pg"}, false)
+	if err != nil {
+		t.Fatalf("AddServer: %v", err)
+	}
+	if server, ok, _ := GetServer(added, "/code/new", "db"); !ok || server == nil {
+		t.Fatalf("added server not found")
+	}
+
+	renamed, err := RenameServer(data, "", "docs", "manual")
+	if err != nil {
+		t.Fatalf("RenameServer: %v", err)
+	}
+	out := string(renamed)
+	// 重命名保留原有位置，并同步更新 disabledMcpServers
+	if !strings.Contains(out, `"manual": {`) || strings.Index(out, `"github"`) > strings.Index(out, `"manual"`) {
+		t.Errorf("rename moved or lost the server:\n%s", out)
+	}
+	if !strings.Contains(out, `"disabledMcpServers": [
+        "manual"
+      ]`) {
+		t.Errorf("disabledMcpServers not renamed:\n%s", out)
+	}
+
+	removed, err := RemoveServer(data, "/code/web", "local")
+	if err != nil {
+		t.Fatalf("RemoveServer: %v", err)
+	}
+	if _, ok, _ := GetServer(removed, "/code/web", "local"); ok {
+		t.Errorf("server not removed")
+	}
+	if _, err := RemoveServer(data, "", "missing"); err == nil {
+		t.Errorf("RemoveServer of a missing server should fail")
+	}
+
+	enabled, changed, err := SetServerEnabled(data, "/code/api", "docs", true)
+	if err != nil || !changed || !strings.Contains(string(enabled), `"disabledMcpServers": []`) {
+		t.Fatalf("enable = %v, %v:\n%s", changed, err, enabled)
+	}
+	if _, changed, _ := SetServerEnabled(enabled, "/code/api", "docs", true); changed {
+		t.Errorf("enabling twice should be a no-op")
+	}
+	disabled, changed, err := SetServerEnabled(data, "/code/web", "github", false)
+	if err != nil || !changed {
+		t.Fatalf("disable = %v, %v", changed, err)
+	}
+	servers, _ := ListServers(disabled)
+	if got := servers[1].DisabledIn; len(got) != 1 || got[0] != "/code/web" {
+		t.Errorf("github disabled in %v", got)
+	}
+}
+
+func TestOverlayServers(t *testing.T) {
+	local := []byte(`{
+  "mcpServers": {
+    "github": {"command": "gh-local"},
+    "db": {"command": "db-local"},
+    "secret": {"command": "s"}
+  },
+  "projects": {
+    "/work/app": {"mcpServers": {"db": {"command": "db-project"}}}
+  }
+}
+`)
+	remote := []byte(`{"mcpServers": {"db": {"command": "db-remote"}, "extra": {"command": "x"}}}`)
+
+	out, changed, err := OverlayServers(local, remote, func(name string) bool { return name == "db" || name == "extra" })
+	if err != nil || !changed {
+		t.Fatalf("OverlayServers = %v, %v", changed, err)
+	}
+	global, err := ReadServers(out, "")
+	if err != nil {
+		t.Fatalf("ReadServers: %v", err)
+	}
+	for name, want := range map[string]string{"github": "gh-local", "db": "db-remote", "extra": "x"} {
+		server, _ := global[name].(map[string]interface{})
+		if server["command"] != want {
+			t.Errorf("%s = %v, want command %s", name, global[name], want)
+		}
+	}
+	// 远端没有该项目的 db，项目级条目被移除
+	if _, ok, _ := GetServer(out, "/work/app", "db"); ok {
+		t.Errorf("project db not removed:\n%s", out)
+	}
+
+	out, changed, err = RemoveServers(out, func(name string) bool { return name == "secret" })
+	if err != nil || !changed {
+		t.Fatalf("RemoveServers = %v, %v", changed, err)
+	}
+	if _, ok, _ := GetServer(out, "", "secret"); ok {
+		t.Errorf("secret not removed:\n%s", out)
+	}
+	if _, changed, _ := RemoveServers(out, func(string) bool { return false }); changed {
+		t.Error("RemoveServers changed content without picked servers")
+	}
+}
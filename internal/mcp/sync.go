@@ -3,20 +3,37 @@ package mcp
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/yxuechao007/claude_sync/internal/diff"
+	"github.com/yxuechao007/claude_sync/internal/fileutil"
+	"github.com/yxuechao007/claude_sync/internal/jsondoc"
+	"github.com/yxuechao007/claude_sync/internal/tui"
 )
 
 // MCPConflict 表示一个 MCP 配置冲突
 type MCPConflict struct {
+	Scope       string      // 所在位置，如 "mcpServers" 或 "projects[/path].mcpServers"
 	Key         string      // MCP server key
-	LocalValue  interface{} // 本地配置
-	RemoteValue interface{} // 远端配置
+	Field       string      // 冲突的 server 字段，如 "env"；空表示整个 server
+	LocalValue  interface{} // 本地配置，字段冲突时 nil 表示本地没有该字段
+	RemoteValue interface{} // 远端配置，字段冲突时 nil 表示远端没有该字段
+}
+
+// ErrReviewCancelled is returned when the user cancels the MCP conflict review
+var ErrReviewCancelled = errors.New("MCP conflict review cancelled")
+
+func (c MCPConflict) path() string {
+	if c.Field == "" {
+		return c.Key
+	}
+	return c.Key + "." + c.Field
 }
 
 // ConflictResolution 冲突解决策略
@@ -45,11 +62,19 @@ type Project struct {
 
 // SyncOptions MCP 同步选项
 type SyncOptions struct {
-	AutoYes   bool // 自动确认
-	Silent    bool // 静默模式：如果已同步则不输出任何内容
-	Overwrite bool // 覆盖项目 MCP 配置
+	AutoYes      bool   // 自动确认
+	Silent       bool   // 静默模式：如果已同步则不输出任何内容
+	Overwrite    bool   // 覆盖项目 MCP 配置
+	Target       string // 写入位置：TargetClaudeJSON（默认）或 TargetMCPJSON
+	StripSecrets bool   // 写入 .mcp.json 时把密钥替换为 ${ENV} 引用
 }
 
+// SyncOptions.Target 的取值
+const (
+	TargetClaudeJSON = "claude-json" // ~/.claude.json 中的 projects[path].mcpServers
+	TargetMCPJSON    = "mcp-json"    // 仓库根目录下提交到版本库的 .mcp.json
+)
+
 // SyncMCPToCurrentProject 将全局 MCP 配置同步到当前项目
 func SyncMCPToCurrentProject(autoYes bool, overwrite bool) error {
 	return SyncMCPToCurrentProjectWithOptions(SyncOptions{AutoYes: autoYes, Silent: false, Overwrite: overwrite})
@@ -62,20 +87,32 @@ func SyncMCPToCurrentProjectWithOptions(opts SyncOptions) error {
 	if err != nil {
 		return fmt.Errorf("获取当前目录失败: %w", err)
 	}
+	switch opts.Target {
+	case "", TargetClaudeJSON:
+		return ApplyMCPToProjects([]string{cwd}, opts)
+	case TargetMCPJSON:
+		return ApplyMCPToMCPJSON([]string{cwd}, opts)
+	}
+	return fmt.Errorf("未知的写入位置: %s", opts.Target)
+}
 
-	// 读取 ~/.claude.json
-	home, err := os.UserHomeDir()
+// ApplyMCPToProjects 将全局 MCP 配置同步到多个项目
+// 所有项目的修改合并为一次 diff 和确认，并一次写入 ~/.claude.json
+func ApplyMCPToProjects(projectPaths []string, opts SyncOptions) error {
+	claudeJSONPath, err := ClaudeJSONPath()
 	if err != nil {
 		return fmt.Errorf("获取用户目录失败: %w", err)
 	}
 
-	claudeJSONPath := filepath.Join(home, ".claude.json")
-	data, err := os.ReadFile(claudeJSONPath)
+	data, snap, err := fileutil.ReadFile(claudeJSONPath)
 	if err != nil {
-		if os.IsNotExist(err) && opts.Silent {
+		return fmt.Errorf("读取 ~/.claude.json 失败: %w", err)
+	}
+	if !snap.Exists {
+		if opts.Silent {
 			return nil // 静默模式下文件不存在时直接返回
 		}
-		return fmt.Errorf("读取 ~/.claude.json 失败: %w", err)
+		return fmt.Errorf("读取 ~/.claude.json 失败: %w", os.ErrNotExist)
 	}
 
 	var prefs map[string]interface{}
@@ -92,36 +129,36 @@ func SyncMCPToCurrentProjectWithOptions(opts SyncOptions) error {
 		return nil
 	}
 
-	// 获取或创建 projects
-	projects, ok := prefs["projects"].(map[string]interface{})
-	if !ok {
-		projects = make(map[string]interface{})
-		prefs["projects"] = projects
-	}
-
-	// 获取或创建当前项目配置
-	projectConfig, ok := projects[cwd].(map[string]interface{})
-	if !ok {
-		projectConfig = make(map[string]interface{})
-		projects[cwd] = projectConfig
+	// 只改写各项目的 mcpServers，其余内容保持原有的键顺序和格式
+	doc, err := jsondoc.ParseDocument(data)
+	if err != nil {
+		return fmt.Errorf("解析 ~/.claude.json 失败: %w", err)
 	}
 
-	// 获取项目当前的 mcpServers
-	projectMCP, _ := projectConfig["mcpServers"].(map[string]interface{})
-	if projectMCP == nil {
-		projectMCP = make(map[string]interface{})
-	}
+	projects, _ := prefs["projects"].(map[string]interface{})
+	var changedProjects []string
+	for _, projectPath := range projectPaths {
+		projectConfig, _ := projects[projectPath].(map[string]interface{})
+		projectMCP, _ := projectConfig["mcpServers"].(map[string]interface{})
+		if projectMCP == nil {
+			projectMCP = make(map[string]interface{})
+		}
 
-	desiredMCP := globalMCP
-	if !opts.Overwrite {
-		desiredMCP = mergeMCPServers(projectMCP, globalMCP)
+		desiredMCP := globalMCP
+		if !opts.Overwrite {
+			desiredMCP = mergeMCPServers(projectMCP, globalMCP)
+		}
+		if reflect.DeepEqual(projectMCP, desiredMCP) {
+			continue
+		}
+		if err := doc.Set([]string{"projects", projectPath, "mcpServers"}, desiredMCP); err != nil {
+			return fmt.Errorf("更新项目 %s 失败: %w", projectPath, err)
+		}
+		changedProjects = append(changedProjects, projectPath)
 	}
 
 	// 检查是否有变更
-	oldMCPJSON, _ := json.MarshalIndent(projectMCP, "", "  ")
-	newMCPJSON, _ := json.MarshalIndent(desiredMCP, "", "  ")
-
-	if string(oldMCPJSON) == string(newMCPJSON) {
+	if len(changedProjects) == 0 {
 		// 静默模式：已同步则不输出
 		if !opts.Silent {
 			fmt.Println("项目 MCP 配置已是最新")
@@ -129,61 +166,63 @@ func SyncMCPToCurrentProjectWithOptions(opts SyncOptions) error {
 		return nil
 	}
 
+	newData, err := doc.Bytes()
+	if err != nil {
+		return fmt.Errorf("序列化配置失败: %w", err)
+	}
+
 	// 静默模式下也需要更新，但使用 autoYes
 	if opts.Silent {
 		opts.AutoYes = true
 	}
 
-	// 显示 diff (非静默模式)
+	// 显示 diff (非静默模式)，所有项目合并为一次 diff
 	if !opts.Silent {
-		diff.ShowDiff(fmt.Sprintf("projects[%s].mcpServers", cwd), string(oldMCPJSON), string(newMCPJSON))
-	}
-
-	// 确认
-	result := diff.ConfirmChange("mcpServers", opts.AutoYes)
-	for {
-		switch result {
-		case diff.ConfirmYes, diff.ConfirmAll:
-			goto apply
-		case diff.ConfirmNo:
-			if !opts.Silent {
-				fmt.Println("已跳过 MCP 配置更新")
-			}
-			return nil
-		case diff.ConfirmQuit:
-			return fmt.Errorf("用户取消操作")
-		case diff.ConfirmPreview:
-			diff.ShowPreview("mcpServers", string(newMCPJSON))
-			result = diff.ConfirmChange("mcpServers", opts.AutoYes)
-		default:
-			if !opts.Silent {
-				fmt.Println("已跳过 MCP 配置更新")
+		if len(changedProjects) > 1 {
+			fmt.Printf("将更新 %d 个项目的 mcpServers:\n", len(changedProjects))
+			for _, projectPath := range changedProjects {
+				fmt.Printf("  %s\n", projectPath)
 			}
-			return nil
 		}
+		diff.ShowDiff(claudeJSONPath, string(data), string(newData))
 	}
 
-	// 应用更新
-apply:
-	projectConfig["mcpServers"] = desiredMCP
-	projects[cwd] = projectConfig
-
-	// 写回文件
-	newData, err := json.MarshalIndent(prefs, "", "  ")
-	if err != nil {
-		return fmt.Errorf("序列化配置失败: %w", err)
+	// 确认
+	apply, err := confirmChange(claudeJSONPath, "mcpServers", string(newData), &opts)
+	if err != nil || !apply {
+		return err
 	}
 
-	if err := os.WriteFile(claudeJSONPath, newData, 0644); err != nil {
+	// 原子写入，并检测 Claude Code 是否在此期间修改了文件
+	if err := fileutil.WriteFileIfUnchanged(claudeJSONPath, newData, 0644, snap); err != nil {
 		return fmt.Errorf("写入配置失败: %w", err)
 	}
 
 	if !opts.Silent {
-		fmt.Printf("已将全局 MCP 配置同步到项目: %s\n", cwd)
+		if len(changedProjects) == 1 {
+			fmt.Printf("已将全局 MCP 配置同步到项目: %s\n", changedProjects[0])
+		} else {
+			fmt.Printf("已将全局 MCP 配置同步到 %d 个项目\n", len(changedProjects))
+		}
 	}
 	return nil
 }
 
+// confirmChange 在 diff 显示后询问是否应用修改，选择全部确认时后续修改不再询问
+func confirmChange(path, label, newContent string, opts *SyncOptions) (bool, error) {
+	switch diff.Confirm(label, path, newContent, &opts.AutoYes) {
+	case diff.ConfirmYes:
+		return true, nil
+	case diff.ConfirmQuit:
+		return false, fmt.Errorf("用户取消操作")
+	default:
+		if !opts.Silent {
+			fmt.Println("已跳过 MCP 配置更新")
+		}
+		return false, nil
+	}
+}
+
 // GetGlobalMCPServers 获取全局 MCP 配置
 func GetGlobalMCPServers() (map[string]interface{}, error) {
 	home, err := os.UserHomeDir()
@@ -250,301 +289,213 @@ func mergeMCPServers(projectMCP, globalMCP map[string]interface{}) map[string]in
 	return merged
 }
 
-// MergeMCPOnPull 在 pull 时合并本地和远程的 MCP 配置（默认智能合并）
-func MergeMCPOnPull(localData, remoteData []byte) ([]byte, bool, error) {
-	return MergeMCPOnPullWithStrategy(localData, remoteData, "merge", true)
-}
-
-// MergeMCPOnPullWithStrategy 带策略的 MCP 配置合并
-// strategy: "remote"(使用远端), "local"(保留本地), "merge"(智能合并)
-func MergeMCPOnPullWithStrategy(localData, remoteData []byte, strategy string, autoYes bool) ([]byte, bool, error) {
-	// 如果策略是使用远端，直接返回远端数据
-	if strategy == "remote" {
-		return mergeMCPPreferRemote(localData, remoteData)
-	}
-
-	// 如果策略是保留本地，只添加远端新增项
-	if strategy == "local" {
-		return mergeMCPKeepLocal(localData, remoteData)
-	}
-
-	// 智能合并策略
-	return mergeMCPSmart(localData, remoteData, autoYes)
-}
-
-// mergeMCPPreferRemote 使用远端配置覆盖本地，但保留远端未包含的字段
-func mergeMCPPreferRemote(localData, remoteData []byte) ([]byte, bool, error) {
-	var localObj, remoteObj map[string]interface{}
-
-	if err := json.Unmarshal(localData, &localObj); err != nil {
-		return remoteData, true, nil
-	}
-	if err := json.Unmarshal(remoteData, &remoteObj); err != nil {
-		return localData, false, nil
-	}
-
-	changed := false
-	for key, value := range remoteObj {
-		if !reflect.DeepEqual(localObj[key], value) {
-			changed = true
-		}
-		localObj[key] = value
-	}
-
-	result, err := json.MarshalIndent(localObj, "", "  ")
-	if err != nil {
-		return nil, false, err
-	}
-
-	return result, changed, nil
+// ServerTable is one mcpServers object taking part in a pull merge
+type ServerTable struct {
+	Scope  string                 // 所在位置，如 "mcpServers" 或 "projects[/path].mcpServers"
+	Local  map[string]interface{} // 本地的 server，nil 表示本地没有该对象
+	Remote map[string]interface{} // 远端的 server，nil 表示远端没有该对象
 }
 
-// mergeMCPKeepLocal 保留本地配置，只添加远端新增项
-func mergeMCPKeepLocal(localData, remoteData []byte) ([]byte, bool, error) {
-	var localObj, remoteObj map[string]interface{}
-
-	if err := json.Unmarshal(localData, &localObj); err != nil {
-		return remoteData, true, nil
-	}
-	if err := json.Unmarshal(remoteData, &remoteObj); err != nil {
-		return localData, false, nil
-	}
-
-	changed := false
-
-	// 合并全局 mcpServers：只添加远端新增的
-	localMCP, _ := localObj["mcpServers"].(map[string]interface{})
-	remoteMCP, _ := remoteObj["mcpServers"].(map[string]interface{})
-	if localMCP == nil {
-		localMCP = make(map[string]interface{})
-	}
-
-	for key, value := range remoteMCP {
-		if _, exists := localMCP[key]; !exists {
-			localMCP[key] = value
-			changed = true
-		}
-	}
-	if len(localMCP) > 0 {
-		localObj["mcpServers"] = localMCP
-	}
-
-	// 合并 projects：对已有项目也合并其 mcpServers（修复：只添加缺失的 key）
-	localProjects, _ := localObj["projects"].(map[string]interface{})
-	remoteProjects, _ := remoteObj["projects"].(map[string]interface{})
-	if localProjects == nil {
-		localProjects = make(map[string]interface{})
-	}
-
-	for projectPath, remoteProject := range remoteProjects {
-		remoteProjectConfig, ok := remoteProject.(map[string]interface{})
-		if !ok {
+// MergeServerTables merges the local and remote servers of every table by
+// name and returns the merged tables in order.
+// strategy: "remote"(使用远端), "local"(保留本地，只添加远端新增的 server),
+// "merge"(两边新增的都保留，同名但配置不同的按字段统一询问；autoYes 时保留本地)
+// It returns ErrReviewCancelled when the user cancels the review.
+func MergeServerTables(tables []ServerTable, strategy string, autoYes bool) ([]map[string]interface{}, error) {
+	merged := make([]map[string]interface{}, len(tables))
+	var conflicts []MCPConflict
+	var targets []map[string]interface{}
+
+	for i, table := range tables {
+		if strategy == "remote" && table.Remote != nil {
+			merged[i] = table.Remote
 			continue
 		}
 
-		localProject, exists := localProjects[projectPath]
-		if !exists {
-			// 本地没有这个项目，直接添加
-			localProjects[projectPath] = remoteProject
-			changed = true
-		} else {
-			// 本地已有这个项目，合并其 mcpServers（只添加缺失的 key）
-			localProjectConfig, _ := localProject.(map[string]interface{})
-			if localProjectConfig == nil {
-				localProjectConfig = make(map[string]interface{})
-			}
-
-			localProjectMCP, _ := localProjectConfig["mcpServers"].(map[string]interface{})
-			remoteProjectMCP, _ := remoteProjectConfig["mcpServers"].(map[string]interface{})
-			if localProjectMCP == nil {
-				localProjectMCP = make(map[string]interface{})
-			}
-
-			for key, value := range remoteProjectMCP {
-				if _, keyExists := localProjectMCP[key]; !keyExists {
-					localProjectMCP[key] = value
-					changed = true
+		result := make(map[string]interface{}, len(table.Local)+len(table.Remote))
+		for key, value := range table.Local {
+			result[key] = value
+		}
+		for _, key := range sortedKeys(table.Remote) {
+			remoteValue := table.Remote[key]
+			localValue, exists := result[key]
+			if !exists {
+				// 本地没有，添加远端的
+				result[key] = remoteValue
+			} else if strategy == "merge" && !reflect.DeepEqual(localValue, remoteValue) {
+				// 冲突：同一个 server 但配置不同，按字段稍后统一解决
+				server, fields := serverConflicts(table.Scope, key, localValue, remoteValue)
+				result[key] = server
+				for _, c := range fields {
+					conflicts = append(conflicts, c)
+					targets = append(targets, result)
 				}
 			}
-			if len(localProjectMCP) > 0 {
-				localProjectConfig["mcpServers"] = localProjectMCP
-			}
-			localProjects[projectPath] = localProjectConfig
 		}
-	}
-	if len(localProjects) > 0 {
-		localObj["projects"] = localProjects
+		merged[i] = result
 	}
 
-	// 其他字段：只添加本地没有的
-	for key, value := range remoteObj {
-		if key == "mcpServers" || key == "projects" {
-			continue
+	// 统一解决冲突（自动模式下保留本地）
+	if !autoYes && len(conflicts) > 0 {
+		values, err := resolveConflicts(conflicts)
+		if err != nil {
+			return nil, err
 		}
-		if _, exists := localObj[key]; !exists {
-			localObj[key] = value
-			changed = true
-		}
-	}
-
-	result, err := json.MarshalIndent(localObj, "", "  ")
-	if err != nil {
-		return nil, false, err
-	}
-
-	return result, changed, nil
-}
-
-// mergeMCPSmart 智能合并，检测冲突并询问用户
-func mergeMCPSmart(localData, remoteData []byte, autoYes bool) ([]byte, bool, error) {
-	var localObj, remoteObj map[string]interface{}
-
-	if err := json.Unmarshal(localData, &localObj); err != nil {
-		return remoteData, true, nil
-	}
-	if err := json.Unmarshal(remoteData, &remoteObj); err != nil {
-		return localData, false, nil
-	}
-
-	changed := false
-	useRemoteForAll := false // 用户选择"全部使用远端"
-	useLocalForAll := false  // 用户选择"全部保留本地"
-
-	// 合并全局 mcpServers
-	localMCP, _ := localObj["mcpServers"].(map[string]interface{})
-	remoteMCP, _ := remoteObj["mcpServers"].(map[string]interface{})
-	if localMCP == nil {
-		localMCP = make(map[string]interface{})
-	}
-	if remoteMCP == nil {
-		remoteMCP = make(map[string]interface{})
-	}
-
-	for key, remoteValue := range remoteMCP {
-		localValue, exists := localMCP[key]
-		if !exists {
-			// 本地没有，添加远端的
-			localMCP[key] = remoteValue
-			changed = true
-		} else if !reflect.DeepEqual(localValue, remoteValue) {
-			// 冲突：同一个 key 但值不同
-			if autoYes || useLocalForAll {
-				// 自动模式或已选择全部保留本地，保留本地
+		for i, value := range values {
+			c := conflicts[i]
+			if c.Field == "" {
+				targets[i][c.Key] = value
 				continue
-			} else if useRemoteForAll {
-				// 已选择全部使用远端
-				localMCP[key] = remoteValue
-				changed = true
+			}
+			server := targets[i][c.Key].(map[string]interface{})
+			if value == nil {
+				delete(server, c.Field)
 			} else {
-				// 询问用户
-				choice := askConflictResolution("mcpServers", key, localValue, remoteValue)
-				switch choice {
-				case "remote":
-					localMCP[key] = remoteValue
-					changed = true
-				case "local":
-					// 保留本地，不变
-				case "remote_all":
-					localMCP[key] = remoteValue
-					changed = true
-					useRemoteForAll = true
-				case "local_all":
-					useLocalForAll = true
-				}
+				server[c.Field] = value
 			}
 		}
 	}
-	if len(localMCP) > 0 {
-		localObj["mcpServers"] = localMCP
+	return merged, nil
+}
+
+// serverConflicts splits a conflicting server into one conflict per field
+// whose value differs. It returns a copy of the local server to resolve the
+// fields into; servers that are not objects conflict as a whole.
+func serverConflicts(scope, name string, local, remote interface{}) (interface{}, []MCPConflict) {
+	localServer, ok1 := local.(map[string]interface{})
+	remoteServer, ok2 := remote.(map[string]interface{})
+	if !ok1 || !ok2 {
+		return local, []MCPConflict{{Scope: scope, Key: name, LocalValue: local, RemoteValue: remote}}
 	}
 
-	// 合并 projects
-	localProjects, _ := localObj["projects"].(map[string]interface{})
-	remoteProjects, _ := remoteObj["projects"].(map[string]interface{})
-	if localProjects == nil {
-		localProjects = make(map[string]interface{})
+	server := make(map[string]interface{}, len(localServer))
+	fields := make(map[string]interface{}, len(localServer)+len(remoteServer))
+	for field, value := range localServer {
+		server[field] = value
+		fields[field] = value
+	}
+	for field, value := range remoteServer {
+		fields[field] = value
 	}
 
-	for projectPath, remoteProject := range remoteProjects {
-		remoteProjectConfig, ok := remoteProject.(map[string]interface{})
-		if !ok {
+	var conflicts []MCPConflict
+	for _, field := range sortedKeys(fields) {
+		localValue, inLocal := localServer[field]
+		remoteValue, inRemote := remoteServer[field]
+		if inLocal == inRemote && reflect.DeepEqual(localValue, remoteValue) {
 			continue
 		}
+		conflicts = append(conflicts, MCPConflict{
+			Scope:       scope,
+			Key:         name,
+			Field:       field,
+			LocalValue:  localValue,
+			RemoteValue: remoteValue,
+		})
+	}
+	return server, conflicts
+}
 
-		localProject, exists := localProjects[projectPath]
-		var localProjectConfig map[string]interface{}
-		if exists {
-			localProjectConfig, _ = localProject.(map[string]interface{})
+// resolveConflicts 让用户为每个冲突选择最终值
+// 终端可用时使用全屏审阅界面，否则逐个询问；在审阅界面取消时返回 ErrReviewCancelled
+func resolveConflicts(conflicts []MCPConflict) ([]interface{}, error) {
+	entries := make([]tui.Entry, len(conflicts))
+	for i, c := range conflicts {
+		validate := validateJSON
+		if c.Field != "" {
+			// 字段内容为空表示删除该字段
+			validate = validateOptionalJSON
 		}
-		if localProjectConfig == nil {
-			localProjectConfig = make(map[string]interface{})
+		entries[i] = tui.Entry{
+			Title:    c.Scope + "." + c.path(),
+			Local:    conflictText(c.LocalValue),
+			Remote:   conflictText(c.RemoteValue),
+			Choice:   tui.ChoiceRemote,
+			Editable: true,
+			Validate: validate,
 		}
+	}
 
-		// 合并项目的 mcpServers
-		localProjectMCP, _ := localProjectConfig["mcpServers"].(map[string]interface{})
-		remoteProjectMCP, _ := remoteProjectConfig["mcpServers"].(map[string]interface{})
-		if localProjectMCP == nil {
-			localProjectMCP = make(map[string]interface{})
+	values := make([]interface{}, len(conflicts))
+	applied, err := tui.Review("MCP 配置冲突", entries)
+	if err == nil {
+		if !applied {
+			return nil, ErrReviewCancelled
 		}
-
-		for key, remoteValue := range remoteProjectMCP {
-			localValue, exists := localProjectMCP[key]
-			if !exists {
-				localProjectMCP[key] = remoteValue
-				changed = true
-			} else if !reflect.DeepEqual(localValue, remoteValue) {
-				if autoYes || useLocalForAll {
-					continue
-				} else if useRemoteForAll {
-					localProjectMCP[key] = remoteValue
-					changed = true
-				} else {
-					choice := askConflictResolution(fmt.Sprintf("projects[%s].mcpServers", projectPath), key, localValue, remoteValue)
-					switch choice {
-					case "remote":
-						localProjectMCP[key] = remoteValue
-						changed = true
-					case "local":
-						// 保留本地
-					case "remote_all":
-						localProjectMCP[key] = remoteValue
-						changed = true
-						useRemoteForAll = true
-					case "local_all":
-						useLocalForAll = true
-					}
+		for i, c := range conflicts {
+			values[i] = c.LocalValue
+			switch entries[i].Choice {
+			case tui.ChoiceRemote:
+				values[i] = c.RemoteValue
+			case tui.ChoiceEdited:
+				var edited interface{}
+				if strings.TrimSpace(entries[i].Edited) == "" {
+					values[i] = nil
+				} else if json.Unmarshal([]byte(entries[i].Edited), &edited) == nil {
+					values[i] = edited
 				}
 			}
 		}
+		return values, nil
+	}
 
-		if len(localProjectMCP) > 0 {
-			localProjectConfig["mcpServers"] = localProjectMCP
+	// 回退到逐个询问
+	useRemoteForAll := false // 用户选择"全部使用远端"
+	useLocalForAll := false  // 用户选择"全部保留本地"
+	for i, c := range conflicts {
+		values[i] = c.LocalValue
+		if useLocalForAll {
+			continue
+		}
+		if useRemoteForAll {
+			values[i] = c.RemoteValue
+			continue
+		}
+		switch AskConflictResolution(c.Scope, c.path(), c.LocalValue, c.RemoteValue) {
+		case "remote":
+			values[i] = c.RemoteValue
+		case "remote_all":
+			values[i] = c.RemoteValue
+			useRemoteForAll = true
+		case "local_all":
+			useLocalForAll = true
 		}
-		localProjects[projectPath] = localProjectConfig
 	}
+	return values, nil
+}
 
-	if len(localProjects) > 0 {
-		localObj["projects"] = localProjects
+// conflictText formats a conflicting value for the review, "" when absent
+func conflictText(v interface{}) string {
+	if v == nil {
+		return ""
 	}
+	data, _ := jsondoc.MarshalIndent(v)
+	return string(data)
+}
 
-	// 其他字段：用远程覆盖本地
-	for key, value := range remoteObj {
-		if key == "mcpServers" || key == "projects" {
-			continue
-		}
-		localObj[key] = value
+func validateOptionalJSON(content string) error {
+	if strings.TrimSpace(content) == "" {
+		return nil
 	}
+	return validateJSON(content)
+}
 
-	result, err := json.MarshalIndent(localObj, "", "  ")
-	if err != nil {
-		return nil, false, err
-	}
+func validateJSON(content string) error {
+	var v interface{}
+	return json.Unmarshal([]byte(content), &v)
+}
 
-	return result, changed, nil
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
-// askConflictResolution 询问用户如何解决冲突
-func askConflictResolution(context, key string, localValue, remoteValue interface{}) string {
+// AskConflictResolution 询问用户如何解决冲突
+func AskConflictResolution(context, key string, localValue, remoteValue interface{}) string {
 	localJSON, _ := json.MarshalIndent(localValue, "  ", "  ")
 	remoteJSON, _ := json.MarshalIndent(remoteValue, "  ", "  ")
 
@@ -579,9 +530,11 @@ func askConflictResolution(context, key string, localValue, remoteValue interfac
 	}
 }
 
-// MergeProjectMCPServersIntoGlobal merges per-project MCP servers into global MCP servers.
-// It does not modify local files; it only returns updated JSON content.
-func MergeProjectMCPServersIntoGlobal(data []byte) ([]byte, bool, error) {
+// PromoteProjectMCPServers copies the project servers for which promote
+// returns true into the global mcpServers, unless a global server with the
+// same name exists. Projects are visited in path order, so the first
+// project defining a name wins.
+func PromoteProjectMCPServers(data []byte, promote func(project, name string) bool) ([]byte, bool, error) {
 	var prefs map[string]interface{}
 	if err := json.Unmarshal(data, &prefs); err != nil {
 		return nil, false, err
@@ -598,8 +551,8 @@ func MergeProjectMCPServersIntoGlobal(data []byte) ([]byte, bool, error) {
 	}
 
 	changed := false
-	for _, project := range projects {
-		projectConfig, ok := project.(map[string]interface{})
+	for _, path := range sortedKeys(projects) {
+		projectConfig, ok := projects[path].(map[string]interface{})
 		if !ok {
 			continue
 		}
@@ -607,7 +560,11 @@ func MergeProjectMCPServersIntoGlobal(data []byte) ([]byte, bool, error) {
 		if len(projectMCP) == 0 {
 			continue
 		}
-		for key, value := range projectMCP {
+		for _, key := range sortedKeys(projectMCP) {
+			value := projectMCP[key]
+			if !promote(path, key) {
+				continue
+			}
 			if _, exists := globalMCP[key]; !exists {
 				globalMCP[key] = value
 				changed = true
@@ -620,7 +577,7 @@ func MergeProjectMCPServersIntoGlobal(data []byte) ([]byte, bool, error) {
 	}
 
 	prefs["mcpServers"] = globalMCP
-	merged, err := json.MarshalIndent(prefs, "", "  ")
+	merged, err := jsondoc.MarshalIndent(prefs)
 	if err != nil {
 		return nil, false, err
 	}
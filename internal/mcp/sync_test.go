@@ -2,6 +2,7 @@ package mcp
 
 import (
 	"encoding/json"
+	"reflect"
 	"testing"
 )
 
@@ -34,7 +35,7 @@ func TestMergeMCPServersEmptyProject(t *testing.T) {
 	}
 }
 
-func TestMergeProjectMCPServersIntoGlobal(t *testing.T) {
+func TestPromoteProjectMCPServersKeepsGlobal(t *testing.T) {
 	input := []byte(`{
   "mcpServers": {
     "global": {"url": "https://example.com"}
@@ -49,9 +50,9 @@ func TestMergeProjectMCPServersIntoGlobal(t *testing.T) {
   }
 }`)
 
-	merged, changed, err := MergeProjectMCPServersIntoGlobal(input)
+	merged, changed, err := PromoteProjectMCPServers(input, promoteAll)
 	if err != nil {
-		t.Fatalf("MergeProjectMCPServersIntoGlobal: %v", err)
+		t.Fatalf("PromoteProjectMCPServers: %v", err)
 	}
 	if !changed {
 		t.Fatalf("changed = false, want true")
@@ -66,14 +67,46 @@ func TestMergeProjectMCPServersIntoGlobal(t *testing.T) {
 	if servers["global"] == nil || servers["local"] == nil {
 		t.Fatalf("merged mcpServers = %v, want global and local", servers)
 	}
+	// 同名的全局 server 不被项目版本覆盖
+	if global, _ := servers["global"].(map[string]interface{}); global["url"] != "https://example.com" {
+		t.Fatalf("global = %v, want the global version kept", servers["global"])
+	}
+}
+
+func promoteAll(project, name string) bool { return true }
+
+func TestPromoteProjectMCPServersOnlyPromotesSelected(t *testing.T) {
+	input := []byte(`{
+  "projects": {
+    "/work/client": {"mcpServers": {"private": {"command": "p"}, "shared": {"command": "client"}}},
+    "/work/app": {"mcpServers": {"shared": {"command": "app"}}}
+  }
+}`)
+
+	merged, changed, err := PromoteProjectMCPServers(input, func(project, name string) bool { return name == "shared" })
+	if err != nil || !changed {
+		t.Fatalf("PromoteProjectMCPServers = %v, %v", changed, err)
+	}
+	var prefs map[string]interface{}
+	if err := json.Unmarshal(merged, &prefs); err != nil {
+		t.Fatalf("unmarshal merged: %v", err)
+	}
+	servers, _ := prefs["mcpServers"].(map[string]interface{})
+	if servers["private"] != nil {
+		t.Errorf("private server promoted: %v", servers)
+	}
+	// 多个项目定义同名 server 时按路径顺序取第一个
+	if shared, _ := servers["shared"].(map[string]interface{}); shared["command"] != "app" {
+		t.Errorf("shared = %v, want the /work/app version", servers["shared"])
+	}
 }
 
-func TestMergeProjectMCPServersIntoGlobalNoChange(t *testing.T) {
+func TestPromoteProjectMCPServersNoChange(t *testing.T) {
 	input := []byte(`{"mcpServers":{"only":"x"}}`)
 
-	merged, changed, err := MergeProjectMCPServersIntoGlobal(input)
+	merged, changed, err := PromoteProjectMCPServers(input, promoteAll)
 	if err != nil {
-		t.Fatalf("MergeProjectMCPServersIntoGlobal: %v", err)
+		t.Fatalf("PromoteProjectMCPServers: %v", err)
 	}
 	if changed {
 		t.Fatalf("changed = true, want false")
@@ -83,60 +116,84 @@ func TestMergeProjectMCPServersIntoGlobalNoChange(t *testing.T) {
 	}
 }
 
-func TestMergeMCPOnPullWithStrategyRemotePreservesLocalFields(t *testing.T) {
-	local := []byte(`{
-  "model": "local",
-  "other": "keep",
-  "mcpServers": {
-    "local": {"url": "https://local"},
-    "keep": {"url": "https://keep"}
-  },
-  "projects": {
-    "/work/a": {
-      "mcpServers": {
-        "project": {"url": "https://project"}
-      }
-    }
-  }
-}`)
-	remote := []byte(`{
-  "model": "remote",
-  "mcp": {"enabled": true},
-  "mcpServers": {
-    "local": {"url": "https://remote"}
-  }
-}`)
+func TestMergeServerTablesRemoteUsesRemoteTable(t *testing.T) {
+	tables := []ServerTable{
+		{
+			Scope:  "mcpServers",
+			Local:  map[string]interface{}{"local": "https://local", "keep": "https://keep"},
+			Remote: map[string]interface{}{"local": "https://remote"},
+		},
+		{
+			// 远端没有的表保留本地
+			Scope: `projects["/work/a"].mcpServers`,
+			Local: map[string]interface{}{"project": "https://project"},
+		},
+	}
 
-	merged, _, err := MergeMCPOnPullWithStrategy(local, remote, "remote", true)
-	if err != nil {
-		t.Fatalf("MergeMCPOnPullWithStrategy: %v", err)
+	merged, _ := MergeServerTables(tables, "remote", true)
+	if len(merged[0]) != 1 || merged[0]["local"] != "https://remote" {
+		t.Fatalf("global = %v, want only the remote server", merged[0])
+	}
+	if merged[1]["project"] != "https://project" {
+		t.Fatalf("project = %v, want local kept", merged[1])
+	}
+}
+
+func TestMergeServerTablesLocalAddsMissing(t *testing.T) {
+	merged, _ := MergeServerTables([]ServerTable{{
+		Scope:  "mcpServers",
+		Local:  map[string]interface{}{"a": "local"},
+		Remote: map[string]interface{}{"a": "remote", "b": "new"},
+	}}, "local", false)
+	if merged[0]["a"] != "local" || merged[0]["b"] != "new" {
+		t.Fatalf("merged = %v, want local a and remote b", merged[0])
 	}
+}
 
-	var prefs map[string]interface{}
-	if err := json.Unmarshal(merged, &prefs); err != nil {
-		t.Fatalf("unmarshal merged: %v", err)
+func TestMergeServerTablesMergeAutoYesKeepsLocalOnConflict(t *testing.T) {
+	tables := []ServerTable{
+		{
+			Scope:  "mcpServers",
+			Local:  map[string]interface{}{"a": map[string]interface{}{"url": "local"}},
+			Remote: map[string]interface{}{"a": map[string]interface{}{"url": "remote"}, "c": map[string]interface{}{"url": "new"}},
+		},
+		{
+			Scope:  `projects["/p"].mcpServers`,
+			Local:  map[string]interface{}{"b": map[string]interface{}{"url": "local"}},
+			Remote: map[string]interface{}{"b": map[string]interface{}{"url": "remote"}},
+		},
 	}
 
-	if prefs["model"] != "remote" {
-		t.Fatalf("model = %v, want remote", prefs["model"])
+	merged, _ := MergeServerTables(tables, "merge", true)
+	if merged[0]["a"].(map[string]interface{})["url"] != "local" {
+		t.Fatalf("mcpServers.a = %v, want local kept", merged[0]["a"])
 	}
-	if prefs["other"] != "keep" {
-		t.Fatalf("other = %v, want keep", prefs["other"])
+	if merged[0]["c"] == nil {
+		t.Fatalf("mcpServers.c missing after merge")
 	}
-	if prefs["mcp"] == nil {
-		t.Fatalf("mcp missing after merge")
+	if merged[1]["b"].(map[string]interface{})["url"] != "local" {
+		t.Fatalf("project server b = %v, want local kept", merged[1]["b"])
 	}
+}
 
-	servers, _ := prefs["mcpServers"].(map[string]interface{})
-	if servers == nil || servers["local"] == nil {
-		t.Fatalf("mcpServers.local missing after merge: %v", servers)
+func TestServerConflictsSplitsByField(t *testing.T) {
+	local := map[string]interface{}{"command": "npx", "env": map[string]interface{}{"TOKEN": "a"}, "cwd": "/tmp"}
+	remote := map[string]interface{}{"command": "npx", "env": map[string]interface{}{"TOKEN": "b"}, "args": []interface{}{"-y"}}
+
+	server, conflicts := serverConflicts("mcpServers", "github", local, remote)
+	var fields []string
+	for _, c := range conflicts {
+		fields = append(fields, c.Field)
 	}
-	if _, exists := servers["keep"]; exists {
-		t.Fatalf("mcpServers.keep should be removed on remote strategy: %v", servers)
+	// 只有值不同的字段冲突，一侧没有的字段也算冲突
+	if want := []string{"args", "cwd", "env"}; !reflect.DeepEqual(fields, want) {
+		t.Fatalf("fields = %v, want %v", fields, want)
 	}
-
-	projects, _ := prefs["projects"].(map[string]interface{})
-	if projects == nil || projects["/work/a"] == nil {
-		t.Fatalf("projects should be preserved: %v", projects)
+	if !reflect.DeepEqual(server, local) {
+		t.Fatalf("server = %v, want a copy of local", server)
+	}
+	server.(map[string]interface{})["cwd"] = "changed"
+	if local["cwd"] != "/tmp" {
+		t.Fatalf("resolving a field modified the local server")
 	}
 }
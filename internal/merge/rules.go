@@ -0,0 +1,443 @@
+// Package merge applies declarative per-path merge rules to JSON items.
+package merge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yxuechao007/claude_sync/internal/jsondoc"
+	"github.com/yxuechao007/claude_sync/internal/jsonpath"
+)
+
+// Strategy decides how the local and remote values at a path are combined
+type Strategy string
+
+const (
+	UnionArrays  Strategy = "union-arrays"     // 两边数组取并集，本地顺序在前
+	MapMergeKeys Strategy = "map-merge-by-key" // 两边对象按 key 合并，同名 key 使用远端
+	PreferLocal  Strategy = "prefer-local"     // 本地有值时使用本地
+	PreferRemote Strategy = "prefer-remote"    // 远端有值时使用远端
+	Ask          Strategy = "ask"              // 两边不同时询问
+	MaxNumber    Strategy = "max-number"       // 取较大的数字
+	SyncedSet    Strategy = "synced-set"       // 按条目记录增删历史的集合，删除也会同步
+	MCPServers   Strategy = "mcp-servers"      // MCP server 表：按 server 合并，冲突按 pull 的冲突策略处理
+	Hooks        Strategy = "hooks"            // Claude Code hooks：按 pull 的 hooks 策略合并
+)
+
+// Strategies lists every supported strategy
+var Strategies = []Strategy{UnionArrays, MapMergeKeys, PreferLocal, PreferRemote, Ask, MaxNumber, SyncedSet, MCPServers, Hooks}
+
+// ValidStrategy reports whether s names a supported strategy
+func ValidStrategy(s string) bool {
+	for _, strategy := range Strategies {
+		if string(strategy) == s {
+			return true
+		}
+	}
+	return false
+}
+
+// AskFunc is called by the ask strategy when local and remote differ.
+// It returns true to keep the local value.
+type AskFunc func(path string, local, remote interface{}) bool
+
+// SetFunc resolves a synced-set path from the local and remote arrays
+// (nil when absent) and returns the resulting array.
+type SetFunc func(path string, local, remote []interface{}) []interface{}
+
+// Value is the local and remote value at one path matched by a rule
+type Value struct {
+	Path     string
+	Local    interface{}
+	InLocal  bool
+	Remote   interface{}
+	InRemote bool
+}
+
+// CustomFunc implements a strategy for every path its rules match at once,
+// so that conflicts can be reviewed together. It returns the merged value
+// of each path; a nil value deletes the path.
+type CustomFunc func(values []Value) ([]interface{}, error)
+
+// Options carries the callbacks used by interactive and stateful strategies
+type Options struct {
+	Ask AskFunc // ask 策略的回调，为空时保留本地
+	Set SetFunc // synced-set 策略的回调，为空时按 union-arrays 处理
+	// Custom 实现 mcp-servers、hooks 等由调用方处理的策略；
+	// 未提供时 mcp-servers 按 map-merge-by-key、hooks 按 prefer-remote 处理
+	Custom map[Strategy]CustomFunc
+}
+
+// rule is a parsed merge_rules entry
+type rule struct {
+	pattern  string
+	path     jsonpath.Path
+	strategy Strategy
+}
+
+func parseRules(rules map[string]string) ([]rule, error) {
+	var parsed []rule
+	for pattern, strategy := range rules {
+		path, err := jsonpath.Parse(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid merge rule path: %w", err)
+		}
+		if !ValidStrategy(strategy) {
+			return nil, fmt.Errorf("invalid merge rule strategy %q for %s", strategy, pattern)
+		}
+		parsed = append(parsed, rule{pattern: pattern, path: path, strategy: Strategy(strategy)})
+	}
+	// 浅层路径先应用，更具体的路径可以覆盖其结果
+	sort.Slice(parsed, func(i, j int) bool {
+		if len(parsed[i].path) != len(parsed[j].path) {
+			return len(parsed[i].path) < len(parsed[j].path)
+		}
+		return parsed[i].pattern < parsed[j].pattern
+	})
+	return parsed, nil
+}
+
+// Apply combines the local file and the content pull is about to write
+// (remote) according to rules, returning the new content.
+// changed is false when no built-in strategy altered the remote content;
+// changes made by Custom callbacks are left for the caller to account for.
+func Apply(local, remote []byte, rules map[string]string, opts Options) ([]byte, bool, error) {
+	if len(rules) == 0 {
+		return remote, false, nil
+	}
+	parsed, err := parseRules(rules)
+	if err != nil {
+		return nil, false, err
+	}
+
+	localObj, err := decodeObject(local)
+	if err != nil {
+		// 本地文件不是合法 JSON 时不应用规则
+		return remote, false, nil
+	}
+	remoteObj, err := decodeObject(remote)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse remote JSON: %w", err)
+	}
+
+	changed, rewritten := false, false
+	customDone := make(map[Strategy]bool)
+	for _, r := range parsed {
+		if fn, ok := opts.Custom[r.strategy]; ok {
+			if customDone[r.strategy] {
+				continue
+			}
+			customDone[r.strategy] = true
+			// 同一策略的所有规则一起交给回调，冲突可以统一处理
+			custom, err := applyCustom(fn, r.strategy, parsed, localObj, remoteObj)
+			if err != nil {
+				return nil, false, err
+			}
+			rewritten = rewritten || custom
+			continue
+		}
+		for _, path := range expand(localObj, remoteObj, r.path) {
+			localValue, inLocal := lookup(localObj, path)
+			remoteValue, inRemote := lookup(remoteObj, path)
+
+			value, keep := resolve(r.strategy, joinPath(path), localValue, inLocal, remoteValue, inRemote, opts)
+			if !keep {
+				if inRemote {
+					remove(remoteObj, path)
+					changed = true
+				}
+				continue
+			}
+			if inRemote && equal(value, remoteValue) {
+				continue
+			}
+			set(remoteObj, path, value)
+			changed = true
+		}
+	}
+
+	if !changed && !rewritten {
+		return remote, false, nil
+	}
+	result, err := jsondoc.MarshalIndent(remoteObj)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to marshal merged JSON: %w", err)
+	}
+	return result, changed, nil
+}
+
+// applyCustom resolves every path of the rules using strategy through fn
+// and reports whether the remote object changed
+func applyCustom(fn CustomFunc, strategy Strategy, parsed []rule, localObj, remoteObj map[string]interface{}) (bool, error) {
+	var paths [][]string
+	var values []Value
+	seen := make(map[string]bool)
+	for _, r := range parsed {
+		if r.strategy != strategy {
+			continue
+		}
+		for _, path := range expand(localObj, remoteObj, r.path) {
+			id := strings.Join(path, "\x00")
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			localValue, inLocal := lookup(localObj, path)
+			remoteValue, inRemote := lookup(remoteObj, path)
+			paths = append(paths, path)
+			values = append(values, Value{Path: joinPath(path), Local: localValue, InLocal: inLocal, Remote: remoteValue, InRemote: inRemote})
+		}
+	}
+	if len(values) == 0 {
+		return false, nil
+	}
+
+	merged, err := fn(values)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", strategy, err)
+	}
+	if len(merged) != len(values) {
+		return false, fmt.Errorf("%s: got %d values for %d paths", strategy, len(merged), len(values))
+	}
+	changed := false
+	for i, path := range paths {
+		if merged[i] == nil {
+			if values[i].InRemote {
+				remove(remoteObj, path)
+				changed = true
+			}
+			continue
+		}
+		if values[i].InRemote && equal(merged[i], values[i].Remote) {
+			continue
+		}
+		set(remoteObj, path, merged[i])
+		changed = true
+	}
+	return changed, nil
+}
+
+// resolve returns the merged value at one path; keep=false deletes the path
+func resolve(strategy Strategy, path string, local interface{}, inLocal bool, remote interface{}, inRemote bool, opts Options) (interface{}, bool) {
+	if strategy == SyncedSet {
+		if opts.Set == nil {
+			strategy = UnionArrays
+		} else {
+			localArr, ok1 := local.([]interface{})
+			remoteArr, ok2 := remote.([]interface{})
+			if (inLocal && !ok1) || (inRemote && !ok2) {
+				// 不是数组时无法按集合处理
+				return remote, inRemote
+			}
+			return opts.Set(path, localArr, remoteArr), true
+		}
+	}
+
+	switch {
+	case !inLocal && !inRemote:
+		return nil, false
+	case !inLocal:
+		return remote, true
+	case !inRemote:
+		// 远端没有该值：只有明确偏好远端时才删除
+		return local, strategy != PreferRemote
+	}
+
+	switch strategy {
+	case PreferLocal:
+		return local, true
+	case PreferRemote:
+		return remote, true
+	case UnionArrays:
+		localArr, ok1 := local.([]interface{})
+		remoteArr, ok2 := remote.([]interface{})
+		if !ok1 || !ok2 {
+			return remote, true
+		}
+		return unionArrays(localArr, remoteArr), true
+	case MapMergeKeys, MCPServers:
+		localMap, ok1 := local.(map[string]interface{})
+		remoteMap, ok2 := remote.(map[string]interface{})
+		if !ok1 || !ok2 {
+			return remote, true
+		}
+		merged := make(map[string]interface{}, len(localMap)+len(remoteMap))
+		for k, v := range localMap {
+			merged[k] = v
+		}
+		for k, v := range remoteMap {
+			merged[k] = v
+		}
+		return merged, true
+	case MaxNumber:
+		l, ok1 := toFloat(local)
+		r, ok2 := toFloat(remote)
+		if !ok1 || !ok2 || r >= l {
+			return remote, true
+		}
+		return local, true
+	case Ask:
+		if equal(local, remote) || opts.Ask == nil {
+			return local, true
+		}
+		if opts.Ask(path, local, remote) {
+			return local, true
+		}
+		return remote, true
+	}
+	return remote, true
+}
+
+func unionArrays(local, remote []interface{}) []interface{} {
+	result := make([]interface{}, 0, len(local)+len(remote))
+	seen := make(map[string]bool)
+	for _, list := range [][]interface{}{local, remote} {
+		for _, v := range list {
+			key := canonical(v)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// expand lists the concrete paths matching pattern in either document
+func expand(local, remote map[string]interface{}, pattern jsonpath.Path) [][]string {
+	seen := make(map[string]bool)
+	var paths [][]string
+	var walk func(a, b map[string]interface{}, prefix []string, rest jsonpath.Path)
+	walk = func(a, b map[string]interface{}, prefix []string, rest jsonpath.Path) {
+		for _, key := range unionKeys(a, b) {
+			if !jsonpath.MatchSegment(rest[0], key) {
+				continue
+			}
+			path := append(append([]string{}, prefix...), key)
+			if len(rest) == 1 {
+				id := strings.Join(path, "\x00")
+				if !seen[id] {
+					seen[id] = true
+					paths = append(paths, path)
+				}
+				continue
+			}
+			childA, _ := a[key].(map[string]interface{})
+			childB, _ := b[key].(map[string]interface{})
+			walk(childA, childB, path, rest[1:])
+		}
+	}
+	walk(local, remote, nil, pattern)
+	return paths
+}
+
+func unionKeys(a, b map[string]interface{}) []string {
+	set := make(map[string]bool)
+	for k := range a {
+		set[k] = true
+	}
+	for k := range b {
+		set[k] = true
+	}
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func lookup(obj map[string]interface{}, path []string) (interface{}, bool) {
+	var current interface{} = obj
+	for _, key := range path {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = m[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// set writes value at path, creating missing parent objects
+func set(obj map[string]interface{}, path []string, value interface{}) {
+	current := obj
+	for _, key := range path[:len(path)-1] {
+		next, ok := current[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			current[key] = next
+		}
+		current = next
+	}
+	current[path[len(path)-1]] = value
+}
+
+func remove(obj map[string]interface{}, path []string) {
+	current := obj
+	for _, key := range path[:len(path)-1] {
+		next, ok := current[key].(map[string]interface{})
+		if !ok {
+			return
+		}
+		current = next
+	}
+	delete(current, path[len(path)-1])
+}
+
+func joinPath(path []string) string {
+	var sb strings.Builder
+	for i, key := range path {
+		if strings.ContainsAny(key, ".[]\"") || key == "" {
+			quoted, _ := json.Marshal(key)
+			sb.WriteString("[" + string(quoted) + "]")
+			continue
+		}
+		if i > 0 {
+			sb.WriteString(".")
+		}
+		sb.WriteString(key)
+	}
+	return sb.String()
+}
+
+func decodeObject(data []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var obj map[string]interface{}
+	if err := decoder.Decode(&obj); err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		obj = make(map[string]interface{})
+	}
+	return obj, nil
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := strconv.ParseFloat(string(n), 64)
+		return f, err == nil
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func canonical(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func equal(a, b interface{}) bool {
+	return canonical(a) == canonical(b)
+}
@@ -0,0 +1,167 @@
+package merge
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func applyRules(t *testing.T, local, remote string, rules map[string]string, ask AskFunc) map[string]interface{} {
+	t.Helper()
+	out, _, err := Apply([]byte(local), []byte(remote), rules, Options{Ask: ask})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal(out, &obj); err != nil {
+		t.Fatalf("unmarshal %s: %v", out, err)
+	}
+	return obj
+}
+
+func decodeJSON(t *testing.T, s string) map[string]interface{} {
+	t.Helper()
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &obj); err != nil {
+		t.Fatalf("unmarshal %s: %v", s, err)
+	}
+	return obj
+}
+
+func TestApplyStrategies(t *testing.T) {
+	local := `{
+		"permissions": {"allow": ["a", "b"]},
+		"servers": {"x": 1, "y": 2},
+		"model": "local-model",
+		"theme": "dark",
+		"counter": 7,
+		"localOnly": true
+	}`
+	remote := `{
+		"permissions": {"allow": ["b", "c"]},
+		"servers": {"y": 20, "z": 3},
+		"model": "remote-model",
+		"theme": "light",
+		"counter": 5
+	}`
+	rules := map[string]string{
+		"permissions.allow": "union-arrays",
+		"servers":           "map-merge-by-key",
+		"model":             "prefer-local",
+		"theme":             "prefer-remote",
+		"counter":           "max-number",
+		"localOnly":         "prefer-remote",
+	}
+
+	got := applyRules(t, local, remote, rules, nil)
+	want := decodeJSON(t, `{
+		"permissions": {"allow": ["a", "b", "c"]},
+		"servers": {"x": 1, "y": 20, "z": 3},
+		"model": "local-model",
+		"theme": "light",
+		"counter": 7
+	}`)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v\nwant %v", got, want)
+	}
+}
+
+func TestApplyAskAndWildcards(t *testing.T) {
+	local := `{"projects": {"/a": {"tools": ["x"]}, "/b": {"tools": ["y"]}}, "model": "l"}`
+	remote := `{"projects": {"/a": {"tools": ["z"]}}, "model": "r"}`
+	rules := map[string]string{
+		"projects.*.tools": "union-arrays",
+		"model":            "ask",
+	}
+
+	var asked []string
+	ask := func(path string, local, remote interface{}) bool {
+		asked = append(asked, path)
+		return false
+	}
+
+	got := applyRules(t, local, remote, rules, ask)
+	want := decodeJSON(t, `{"projects": {"/a": {"tools": ["x", "z"]}, "/b": {"tools": ["y"]}}, "model": "r"}`)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v\nwant %v", got, want)
+	}
+	if len(asked) != 1 || asked[0] != "model" {
+		t.Fatalf("asked = %v, want [model]", asked)
+	}
+}
+
+func TestApplyUnchanged(t *testing.T) {
+	remote := `{"permissions": {"allow": ["a"]}}`
+	out, changed, err := Apply([]byte(`{"permissions": {"allow": ["a"]}}`), []byte(remote), map[string]string{"permissions.allow": "union-arrays"}, Options{})
+	if err != nil || changed || string(out) != remote {
+		t.Fatalf("Apply = %s, %v, %v; want remote unchanged", out, changed, err)
+	}
+}
+
+func TestApplyRejectsUnknownStrategy(t *testing.T) {
+	if _, _, err := Apply([]byte(`{}`), []byte(`{}`), map[string]string{"a": "newest"}, Options{}); err == nil {
+		t.Fatalf("expected error for unknown strategy")
+	}
+}
+
+func TestApplySyncedSetUsesCallback(t *testing.T) {
+	var gotLocal, gotRemote []interface{}
+	set := func(path string, local, remote []interface{}) []interface{} {
+		if path != "permissions.deny" {
+			t.Fatalf("path = %q", path)
+		}
+		gotLocal, gotRemote = local, remote
+		return []interface{}{"b"}
+	}
+	rules := map[string]string{"permissions.deny": "synced-set"}
+	out, changed, err := Apply([]byte(`{"permissions": {"deny": ["a", "b"]}}`), []byte(`{"permissions": {}}`), rules, Options{Set: set})
+	if err != nil || !changed {
+		t.Fatalf("Apply = %v, %v", changed, err)
+	}
+	if len(gotLocal) != 2 || gotRemote != nil {
+		t.Fatalf("callback got local=%v remote=%v", gotLocal, gotRemote)
+	}
+	want := decodeJSON(t, `{"permissions": {"deny": ["b"]}}`)
+	if got := decodeJSON(t, string(out)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// 没有回调时退化为 union-arrays
+	obj := applyRules(t, `{"p": ["a"]}`, `{"p": ["b"]}`, map[string]string{"p": "synced-set"}, nil)
+	if !reflect.DeepEqual(obj["p"], []interface{}{"a", "b"}) {
+		t.Fatalf("fallback = %v", obj["p"])
+	}
+}
+
+func TestApplyCustomStrategyGetsAllPathsAtOnce(t *testing.T) {
+	calls := 0
+	custom := func(values []Value) ([]interface{}, error) {
+		calls++
+		if len(values) != 2 || values[0].Path != "mcpServers" || values[1].Path != "projects./p.mcpServers" {
+			t.Fatalf("values = %+v", values)
+		}
+		return []interface{}{values[0].Local, nil}, nil
+	}
+	rules := map[string]string{"mcpServers": "mcp-servers", "projects.*.mcpServers": "mcp-servers"}
+	local := `{"mcpServers": {"a": 1}, "projects": {"/p": {"mcpServers": {"b": 1}}}}`
+	remote := `{"mcpServers": {"a": 2}, "projects": {"/p": {"mcpServers": {"b": 2}}}}`
+
+	out, changed, err := Apply([]byte(local), []byte(remote), rules, Options{Custom: map[Strategy]CustomFunc{MCPServers: custom}})
+	if err != nil || calls != 1 {
+		t.Fatalf("Apply: calls=%d err=%v", calls, err)
+	}
+	// 回调的修改由调用方自己记录
+	if changed {
+		t.Fatalf("changed = true for custom strategy")
+	}
+	want := decodeJSON(t, `{"mcpServers": {"a": 1}, "projects": {"/p": {}}}`)
+	if got := decodeJSON(t, string(out)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// 没有回调时 mcp-servers 按 map-merge-by-key 处理
+	obj := applyRules(t, `{"m": {"a": 1}}`, `{"m": {"b": 2}}`, map[string]string{"m": "mcp-servers"}, nil)
+	if len(obj["m"].(map[string]interface{})) != 2 {
+		t.Fatalf("fallback = %v", obj["m"])
+	}
+}
@@ -0,0 +1,147 @@
+package mergetool
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// EnvVar overrides the merge tool configured in config.json
+const EnvVar = "CLAUDE_SYNC_MERGETOOL"
+
+// presets maps well-known tool names to git-style command templates.
+// $LOCAL, $BASE, $REMOTE and $MERGED are replaced with temp file paths.
+var presets = map[string]string{
+	"vimdiff":  `vim -f -d -c '4wincmd w | wincmd J' "$LOCAL" "$BASE" "$REMOTE" "$MERGED"`,
+	"nvimdiff": `nvim -d -c '4wincmd w | wincmd J' "$LOCAL" "$BASE" "$REMOTE" "$MERGED"`,
+	"meld":     `meld --output="$MERGED" "$LOCAL" "$BASE" "$REMOTE"`,
+	"kdiff3":   `kdiff3 --auto "$BASE" "$LOCAL" "$REMOTE" -o "$MERGED"`,
+	"opendiff": `opendiff "$LOCAL" "$REMOTE" -ancestor "$BASE" -merge "$MERGED"`,
+	"vscode":   `code --wait --merge "$REMOTE" "$LOCAL" "$BASE" "$MERGED"`,
+	"code":     `code --wait --merge "$REMOTE" "$LOCAL" "$BASE" "$MERGED"`,
+}
+
+// Resolve returns the merge tool to use: $CLAUDE_SYNC_MERGETOOL wins over
+// the configured value. An empty result means no tool is configured.
+func Resolve(configured string) string {
+	if tool := strings.TrimSpace(os.Getenv(EnvVar)); tool != "" {
+		return tool
+	}
+	return strings.TrimSpace(configured)
+}
+
+// Command returns the shell command template for a tool name or custom command
+func Command(tool string) string {
+	if preset, ok := presets[tool]; ok {
+		return preset
+	}
+	return tool
+}
+
+// Inputs are the three versions handed to the merge tool
+type Inputs struct {
+	Name   string // 用于临时文件名，如 settings.json
+	Local  string
+	Base   string
+	Remote string
+}
+
+// Run writes local/base/remote to temp files, runs the tool and returns the
+// content of the merged file. MERGED starts as a copy of LOCAL, and it is an
+// error if the tool exits without saving it.
+// The tool is run through the shell with LOCAL, BASE, REMOTE and MERGED
+// exported, so custom commands can use either "$LOCAL" or the env vars.
+func Run(tool string, in Inputs) (string, error) {
+	if tool == "" {
+		return "", fmt.Errorf("no merge tool configured, set %s or \"mergetool\" in config", EnvVar)
+	}
+
+	dir, err := os.MkdirTemp("", "claude_sync-merge-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Base(in.Name)
+	if name == "" || name == "." {
+		name = "content"
+	}
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+
+	paths := map[string]string{
+		"LOCAL":  filepath.Join(dir, stem+".LOCAL"+ext),
+		"BASE":   filepath.Join(dir, stem+".BASE"+ext),
+		"REMOTE": filepath.Join(dir, stem+".REMOTE"+ext),
+		"MERGED": filepath.Join(dir, name),
+	}
+	contents := map[string]string{
+		"LOCAL":  in.Local,
+		"BASE":   in.Base,
+		"REMOTE": in.Remote,
+		"MERGED": in.Local,
+	}
+	for key, path := range paths {
+		if err := os.WriteFile(path, []byte(contents[key]), 0600); err != nil {
+			return "", err
+		}
+	}
+	// 把 MERGED 的修改时间调早，工具保存后修改时间必然晚于它
+	written := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(paths["MERGED"], written, written); err != nil {
+		return "", err
+	}
+
+	cmd := shellCommand(Command(tool))
+	cmd.Env = os.Environ()
+	for key, path := range paths {
+		cmd.Env = append(cmd.Env, key+"="+path)
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("merge tool failed: %w", err)
+	}
+
+	info, err := os.Stat(paths["MERGED"])
+	if err != nil {
+		return "", fmt.Errorf("failed to read merged result: %w", err)
+	}
+	if !info.ModTime().After(written) {
+		return "", fmt.Errorf("merge tool exited without saving the merged result")
+	}
+	merged, err := os.ReadFile(paths["MERGED"])
+	if err != nil {
+		return "", fmt.Errorf("failed to read merged result: %w", err)
+	}
+	if hasConflictMarkers(merged) {
+		return "", fmt.Errorf("merged result still contains conflict markers")
+	}
+	return string(merged), nil
+}
+
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		// cmd.exe 使用 %VAR% 形式引用环境变量
+		for _, key := range []string{"LOCAL", "BASE", "REMOTE", "MERGED"} {
+			command = strings.ReplaceAll(command, "$"+key, "%"+key+"%")
+		}
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
+
+func hasConflictMarkers(data []byte) bool {
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if bytes.HasPrefix(line, []byte("<<<<<<< ")) || bytes.HasPrefix(line, []byte(">>>>>>> ")) {
+			return true
+		}
+	}
+	return false
+}
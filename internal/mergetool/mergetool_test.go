@@ -0,0 +1,67 @@
+package mergetool
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRunCustomCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	in := Inputs{Name: "settings.json", Local: "local\n", Base: "base\n", Remote: "remote\n"}
+	merged, err := Run(`cat "$LOCAL" "$REMOTE" > "$MERGED"`, in)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if merged != "local\nremote\n" {
+		t.Fatalf("merged = %q, want local+remote", merged)
+	}
+}
+
+func TestRunRejectsConflictMarkers(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	in := Inputs{Name: "settings.json", Local: "a", Base: "b", Remote: "c"}
+	_, err := Run(`printf '<<<<<<< LOCAL\na\n=======\nc\n>>>>>>> REMOTE\n' > "$MERGED"`, in)
+	if err == nil || !strings.Contains(err.Error(), "conflict markers") {
+		t.Fatalf("err = %v, want conflict marker error", err)
+	}
+}
+
+func TestRunFailingTool(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	if _, err := Run("exit 1", Inputs{Name: "x.json"}); err == nil {
+		t.Fatalf("expected error from failing tool")
+	}
+}
+
+func TestRunToolThatDoesNotSave(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	in := Inputs{Name: "settings.json", Local: "local\n", Base: "base\n", Remote: "remote\n"}
+	_, err := Run("true", in)
+	if err == nil || !strings.Contains(err.Error(), "without saving") {
+		t.Fatalf("err = %v, want unsaved result error", err)
+	}
+}
+
+func TestResolvePrefersEnv(t *testing.T) {
+	t.Setenv(EnvVar, "meld")
+	if got := Resolve("vimdiff"); got != "meld" {
+		t.Fatalf("Resolve = %q, want meld", got)
+	}
+	t.Setenv(EnvVar, "")
+	if got := Resolve("vimdiff"); got != "vimdiff" {
+		t.Fatalf("Resolve = %q, want vimdiff", got)
+	}
+}
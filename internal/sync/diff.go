@@ -3,6 +3,8 @@ package sync
 import (
 	"fmt"
 	"strings"
+
+	"github.com/yxuechao007/claude_sync/internal/diff"
 )
 
 // DiffResult represents the difference between local and remote
@@ -17,34 +19,22 @@ type DiffResult struct {
 	RemovedLines int
 }
 
-// SimpleDiff performs a simple line-by-line diff
+// SimpleDiff performs a line-based LCS diff between local and remote
+// Blank lines are not counted as changes
 func SimpleDiff(local, remote string) (added, removed int, changes []string) {
-	localLines := strings.Split(local, "\n")
-	remoteLines := strings.Split(remote, "\n")
-
-	localSet := make(map[string]bool)
-	for _, line := range localLines {
-		localSet[line] = true
-	}
-
-	remoteSet := make(map[string]bool)
-	for _, line := range remoteLines {
-		remoteSet[line] = true
-	}
-
-	// Lines in local but not in remote (added locally)
-	for _, line := range localLines {
-		if !remoteSet[line] && strings.TrimSpace(line) != "" {
-			added++
-			changes = append(changes, fmt.Sprintf("+ %s", line))
+	for _, line := range diff.LineDiff(diff.SplitLines(remote), diff.SplitLines(local)) {
+		if strings.TrimSpace(line.Text) == "" {
+			continue
 		}
-	}
-
-	// Lines in remote but not in local (removed locally)
-	for _, line := range remoteLines {
-		if !localSet[line] && strings.TrimSpace(line) != "" {
+		switch line.Kind {
+		case diff.OpInsert:
+			// Lines only in local (added locally)
+			added++
+			changes = append(changes, fmt.Sprintf("+ %s", line.Text))
+		case diff.OpDelete:
+			// Lines only in remote (removed locally)
 			removed++
-			changes = append(changes, fmt.Sprintf("- %s", line))
+			changes = append(changes, fmt.Sprintf("- %s", line.Text))
 		}
 	}
 
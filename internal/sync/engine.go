@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -13,9 +14,15 @@ import (
 	"github.com/yxuechao007/claude_sync/internal/archive"
 	"github.com/yxuechao007/claude_sync/internal/config"
 	"github.com/yxuechao007/claude_sync/internal/diff"
+	"github.com/yxuechao007/claude_sync/internal/fileutil"
 	"github.com/yxuechao007/claude_sync/internal/filter"
 	"github.com/yxuechao007/claude_sync/internal/gist"
+	"github.com/yxuechao007/claude_sync/internal/jsondoc"
+	"github.com/yxuechao007/claude_sync/internal/ledger"
 	"github.com/yxuechao007/claude_sync/internal/mcp"
+	"github.com/yxuechao007/claude_sync/internal/merge"
+	"github.com/yxuechao007/claude_sync/internal/mergetool"
+	"github.com/yxuechao007/claude_sync/internal/tui"
 )
 
 // SyncStatus represents the status of a sync item
@@ -39,6 +46,8 @@ type ItemStatus struct {
 	LocalPath  string
 	GistFile   string
 	Error      error
+	// Filtered 列出 push 未上传（或仅警告）的路径及原因
+	Filtered []FilteredPath
 }
 
 // Engine handles the sync operations
@@ -48,6 +57,28 @@ type Engine struct {
 	client        *gist.Client
 	autoYes       bool   // 自动确认所有修改
 	mergeStrategy string // 合并策略: "remote", "local", "merge"
+	hooksStrategy string // pull 的 hooks 策略: "overwrite", "keep", "merge"
+	mergeTool     string // 冲突时使用的外部三方合并工具，空表示不使用
+	// ruleMerged 记录本次 pull 中 merge_rules 修改了写入内容的条目
+	ruleMerged map[string]bool
+	// remoteLedger/syncedLedger 是 gist 中和上次同步时的集合增删历史（synced-set 规则使用）
+	remoteLedger  *ledger.Ledger
+	syncedLedger  *ledger.Ledger
+	ledgerChanged bool
+	// detector 检测设备特定内容；findings 记录本次读取本地内容时的检测结果
+	detector *filter.Detector
+	findings map[string][]filter.Finding
+	// filtered 记录本次读取本地内容时被过滤、排除或警告的路径
+	filtered map[string][]FilteredPath
+	// projectRemotes 是 gist 中记录的项目 git remote；projectRemaps 记录本次 pull 的项目路径映射
+	projectRemotes map[string]string
+	projectRemaps  []mcp.ProjectRemap
+	// keptProjects 记录 push 时保留的 Gist 中本机没有对应的项目
+	keptProjects map[string]bool
+	// snapshots 记录读取本地文件时的状态，写入前用于检测并发修改
+	snapshots map[string]fileutil.Snapshot
+	// warnings 记录不影响同步结果的失败
+	warnings []string
 }
 
 type syncDirection string
@@ -80,6 +111,11 @@ func (e *Engine) SetMergeStrategy(strategy string) {
 	e.mergeStrategy = strategy
 }
 
+// SetMergeTool 设置冲突时使用的外部合并工具（预设名或自定义命令）
+func (e *Engine) SetMergeTool(tool string) {
+	e.mergeTool = tool
+}
+
 // GetMergeStrategy 获取合并策略
 func (e *Engine) GetMergeStrategy() string {
 	if e.mergeStrategy == "" {
@@ -88,6 +124,15 @@ func (e *Engine) GetMergeStrategy() string {
 	return e.mergeStrategy
 }
 
+// Warnings returns the failures of the last pull that did not undo it
+func (e *Engine) Warnings() []string {
+	return e.warnings
+}
+
+func (e *Engine) warn(format string, args ...interface{}) {
+	e.warnings = append(e.warnings, fmt.Sprintf(format, args...))
+}
+
 // CheckFirstSyncWithLocalConfig 检查是否是首次同步且本地有配置
 func (e *Engine) CheckFirstSyncWithLocalConfig() (isFirstSync bool, hasLocalConfig bool) {
 	// 首次同步：state.Version = 0
@@ -140,10 +185,16 @@ func NewEngine(cfg *config.Config, token string) (*Engine, error) {
 		return nil, fmt.Errorf("failed to load state: %w", err)
 	}
 
+	detector, err := filter.NewDetector(cfg.LocalPatterns)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Engine{
-		cfg:    cfg,
-		state:  state,
-		client: gist.NewClient(token),
+		cfg:      cfg,
+		state:    state,
+		client:   gist.NewClient(token),
+		detector: detector,
 	}, nil
 }
 
@@ -170,6 +221,7 @@ func (e *Engine) getStatusWithRemote(remoteGist *gist.Gist) ([]ItemStatus, statu
 	}
 	meta, metaNeedsUpdate := ensureSyncMetaRepo(meta)
 	info.meta = meta
+	e.projectRemotes = meta.Projects
 	info.metaNeedsUpdate = metaNeedsUpdate
 	info.remoteVersion = meta.Version
 
@@ -336,13 +388,10 @@ func (e *Engine) calculateLocalHash(item config.SyncItem) (string, error) {
 	}
 
 	if shouldMergeProjectMCP(item, localPath) {
-		merged, changed, err := mcp.MergeProjectMCPServersIntoGlobal(data)
+		data, err = e.pushedMCPContent(data)
 		if err != nil {
 			return "", err
 		}
-		if changed {
-			data = merged
-		}
 	}
 
 	// Apply filter if configured
@@ -353,12 +402,10 @@ func (e *Engine) calculateLocalHash(item config.SyncItem) (string, error) {
 		}
 	}
 
-	// 对 settings 文件过滤包含本地内容的 hooks（与 push 保持一致）
-	if item.Name == "settings" {
-		filteredData, filteredTypes, err := filter.FilterLocalHooks(data)
-		if err == nil && len(filteredTypes) > 0 {
-			data = filteredData
-		}
+	// 按 local_actions 排除设备特定内容（与 push 保持一致）
+	data, _, err = e.localDetector().Apply(data, item.LocalActions)
+	if err != nil {
+		return "", err
 	}
 	if len(data) == 0 {
 		return "", nil
@@ -367,8 +414,41 @@ func (e *Engine) calculateLocalHash(item config.SyncItem) (string, error) {
 	return calculateHash(string(data)), nil
 }
 
+func (e *Engine) localDetector() *filter.Detector {
+	if e.detector == nil {
+		e.detector = filter.DefaultDetector()
+	}
+	return e.detector
+}
+
+func (e *Engine) recordFindings(name string, findings []filter.Finding) {
+	if e.findings == nil {
+		e.findings = make(map[string][]filter.Finding)
+	}
+	if len(findings) == 0 {
+		delete(e.findings, name)
+		return
+	}
+	e.findings[name] = findings
+}
+
+// ScanLocal checks every enabled item for machine-specific content without
+// contacting the gist
+func (e *Engine) ScanLocal() (map[string][]filter.Finding, error) {
+	e.findings = nil
+	for _, item := range e.cfg.GetEnabledItems() {
+		if _, _, err := e.getLocalContent(item); err != nil {
+			return nil, fmt.Errorf("%s: %w", item.Name, err)
+		}
+	}
+	return e.findings, nil
+}
+
 // Push uploads local content to the gist
 func (e *Engine) Push(dryRun bool, force bool) ([]ItemStatus, error) {
+	e.findings = nil
+	e.filtered = nil
+	e.keptProjects = nil
 	remoteGist, err := e.client.Get(e.cfg.GistID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get gist: %w", err)
@@ -377,6 +457,9 @@ func (e *Engine) Push(dryRun bool, force bool) ([]ItemStatus, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := e.loadLedgers(remoteGist); err != nil {
+		return nil, err
+	}
 
 	updates := make(map[string]string)
 	var results []ItemStatus
@@ -427,12 +510,45 @@ func (e *Engine) Push(dryRun bool, force bool) ([]ItemStatus, error) {
 			}
 
 			status.LocalHash = calculateHash(content)
+			if isClaudeJSON(*item) {
+				// 不从本机上传的 MCP server 和本机没有对应的项目保留 Gist 中的版本
+				remote := remoteGist.Files[item.GistFile].Content
+				content, err = e.keepRemoteMCPServers(content, remote)
+				if err == nil {
+					content, err = e.keepRemoteProjects(content, remote)
+				}
+				if err != nil {
+					status.Error = err
+					status.Status = StatusError
+					results = append(results, status)
+					continue
+				}
+			}
+
+			if err := e.recordLedgerChanges(*item, content, remoteGist); err != nil {
+				status.Error = err
+				status.Status = StatusError
+				results = append(results, status)
+				continue
+			}
+
+			status.RemoteHash = calculateHash(content)
 			updates[item.GistFile] = content
 			status.Status = StatusSynced
 			results = append(results, status)
 		}
 	}
 
+	// 未上传的条目也报告过滤内容，说明为什么这些路径不会出现在其他设备上
+	for i := range results {
+		if results[i].Status == StatusError {
+			continue
+		}
+		if item := e.findItem(results[i].Name); item != nil {
+			results[i].Filtered = e.filteredFor(*item)
+		}
+	}
+
 	if !dryRun && len(updates) > 0 {
 		meta := info.meta
 		if meta.Version < e.state.Version {
@@ -440,6 +556,7 @@ func (e *Engine) Push(dryRun bool, force bool) ([]ItemStatus, error) {
 		}
 		meta.Version = maxInt(meta.Version, info.remoteVersion) + 1
 		meta, _ = ensureSyncMetaRepo(meta)
+		meta.Projects = e.pushedProjectRemotes(meta.Projects, updates)
 
 		metaContent, err := marshalJSON(meta)
 		if err != nil {
@@ -447,6 +564,14 @@ func (e *Engine) Push(dryRun bool, force bool) ([]ItemStatus, error) {
 		}
 		updates[syncMetaFile] = string(metaContent)
 
+		if e.ledgerChanged {
+			ledgerContent, err := e.remoteLedger.Marshal()
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal ledger: %w", err)
+			}
+			updates[ledger.GistFile] = ledgerContent
+		}
+
 		if _, err := e.client.Update(e.cfg.GistID, updates); err != nil {
 			return nil, fmt.Errorf("failed to update gist: %w", err)
 		}
@@ -457,7 +582,7 @@ func (e *Engine) Push(dryRun bool, force bool) ([]ItemStatus, error) {
 			if status.Status == StatusSynced && status.LocalHash != "" {
 				e.state.Items[status.Name] = config.ItemState{
 					LocalHash:  status.LocalHash,
-					RemoteHash: status.LocalHash, // After push, remote = local
+					RemoteHash: status.RemoteHash, // 上传后的内容，可能保留了 Gist 中的 MCP server
 					LastSync:   &now,
 				}
 			}
@@ -467,6 +592,12 @@ func (e *Engine) Push(dryRun bool, force bool) ([]ItemStatus, error) {
 		if err := e.state.Save(); err != nil {
 			return nil, fmt.Errorf("failed to save state: %w", err)
 		}
+		e.recordBases(results, remoteGist, updates)
+		if e.ledgerChanged {
+			if err := ledger.SaveSynced(e.remoteLedger); err != nil {
+				return nil, fmt.Errorf("failed to save ledger: %w", err)
+			}
+		}
 	} else if !dryRun && len(updates) == 0 && info.metaNeedsUpdate {
 		meta := info.meta
 		if meta.Version < e.state.Version {
@@ -487,184 +618,7 @@ func (e *Engine) Push(dryRun bool, force bool) ([]ItemStatus, error) {
 
 // Pull downloads content from the gist to local
 func (e *Engine) Pull(dryRun bool, force bool) ([]ItemStatus, error) {
-	remoteGist, err := e.client.Get(e.cfg.GistID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get gist: %w", err)
-	}
-	statuses, info, err := e.getStatusWithRemote(remoteGist)
-	if err != nil {
-		return nil, err
-	}
-
-	var results []ItemStatus
-	appliedAny := false
-	keptLocal := make(map[string]string)
-
-	for _, status := range statuses {
-		item := e.findItem(status.Name)
-		if item == nil {
-			continue
-		}
-
-		// Check if we should pull
-		shouldPull := false
-		switch status.Status {
-		case StatusRemoteAhead:
-			shouldPull = true
-		case StatusConflict:
-			if force {
-				shouldPull = true
-			} else {
-				status.Error = fmt.Errorf("conflict detected, use --force to override")
-				results = append(results, status)
-				continue
-			}
-		case StatusSynced, StatusLocalAhead:
-			results = append(results, status)
-			continue
-		case StatusError:
-			results = append(results, status)
-			continue
-		}
-
-		if shouldPull {
-			remoteFile, exists := remoteGist.Files[item.GistFile]
-			if !exists {
-				results = append(results, status)
-				continue
-			}
-
-			if !dryRun {
-				if remoteFile.Content == "" && item.Type != "directory" {
-					results = append(results, status)
-					continue
-				}
-
-				preparedContent, skipWrite, err := e.prepareWriteContent(*item, remoteFile.Content)
-				if err != nil {
-					status.Error = err
-					status.Status = StatusError
-					results = append(results, status)
-					continue
-				}
-
-				// 读取本地当前内容用于 diff 显示
-				localPath, _ := config.ExpandPath(item.LocalPath)
-				var localContent string
-				if item.Type != "directory" {
-					if data, err := os.ReadFile(localPath); err == nil {
-						localContent = string(data)
-					}
-				}
-
-				// 显示 diff 并等待确认（仅对文件类型）
-				if item.Type != "directory" && localContent != "" && !skipWrite {
-					diff.ShowDiff(item.LocalPath, localContent, preparedContent)
-					result := diff.ConfirmChange(item.LocalPath, e.autoYes)
-
-					switch result {
-					case diff.ConfirmNo:
-						status.Status = StatusLocalAhead // 保持本地版本
-						keptLocal[status.Name] = status.RemoteHash
-						results = append(results, status)
-						continue
-					case diff.ConfirmQuit:
-						return results, fmt.Errorf("用户取消操作")
-					case diff.ConfirmAll:
-						e.autoYes = true
-					case diff.ConfirmPreview:
-						diff.ShowPreview(item.LocalPath, preparedContent)
-						// 再次确认
-						result = diff.ConfirmChange(item.LocalPath, e.autoYes)
-						if result == diff.ConfirmNo {
-							status.Status = StatusLocalAhead
-							keptLocal[status.Name] = status.RemoteHash
-							results = append(results, status)
-							continue
-						} else if result == diff.ConfirmQuit {
-							return results, fmt.Errorf("用户取消操作")
-						} else if result == diff.ConfirmAll {
-							e.autoYes = true
-						}
-					}
-				}
-
-				if !skipWrite {
-					if err := e.writeLocalContent(*item, preparedContent, true); err != nil {
-						status.Error = err
-						status.Status = StatusError
-						results = append(results, status)
-						continue
-					}
-					appliedAny = true
-				}
-
-				localHash, err := e.calculateLocalHash(*item)
-				if err != nil {
-					status.Error = err
-					status.Status = StatusError
-					results = append(results, status)
-					continue
-				}
-				status.LocalHash = localHash
-			}
-
-			if e.GetMergeStrategy() == "local" && status.LocalHash != status.RemoteHash {
-				status.Status = StatusLocalAhead
-				keptLocal[status.Name] = status.RemoteHash
-			} else {
-				status.Status = StatusSynced
-			}
-			results = append(results, status)
-		}
-	}
-
-	if !dryRun {
-		// Update state
-		now := time.Now()
-		for _, status := range results {
-			if status.Status == StatusSynced && status.RemoteHash != "" {
-				e.state.Items[status.Name] = config.ItemState{
-					LocalHash:  status.LocalHash,
-					RemoteHash: status.RemoteHash,
-					LastSync:   &now,
-				}
-			}
-		}
-		for name, remoteHash := range keptLocal {
-			e.state.Items[name] = config.ItemState{
-				LocalHash:  remoteHash,
-				RemoteHash: remoteHash,
-				LastSync:   &now,
-			}
-		}
-		e.state.LastSync = &now
-
-		// 始终同步本地 version 到远端 version（修复：即使内容没变也要同步 version）
-		// 这样可以避免后续本地改动被误判为"远端领先"
-		if info.effectiveRemoteVersion > e.state.Version {
-			e.state.Version = info.effectiveRemoteVersion
-		}
-
-		if err := e.state.Save(); err != nil {
-			return nil, fmt.Errorf("failed to save state: %w", err)
-		}
-
-		if appliedAny && (info.effectiveRemoteVersion > info.remoteVersion || info.metaNeedsUpdate) {
-			meta := info.meta
-			meta.Version = info.effectiveRemoteVersion
-			meta, _ = ensureSyncMetaRepo(meta)
-			metaContent, err := marshalJSON(meta)
-			if err != nil {
-				return nil, fmt.Errorf("failed to marshal sync meta: %w", err)
-			}
-			if _, err := e.client.Update(e.cfg.GistID, map[string]string{syncMetaFile: string(metaContent)}); err != nil {
-				return nil, fmt.Errorf("failed to update gist meta: %w", err)
-			}
-		}
-	}
-
-	return results, nil
+	return e.PullWithHooksStrategy(dryRun, force, "overwrite")
 }
 
 // getLocalContent reads the local content for an item
@@ -682,6 +636,13 @@ func (e *Engine) getLocalContent(item config.SyncItem) (string, bool, error) {
 		if content == "" {
 			return "", true, nil
 		}
+		// 目录按原样打包，设备特定内容只报告
+		findings, err := e.localDetector().ScanDir(localPath)
+		if err != nil {
+			return "", false, err
+		}
+		e.recordFindings(item.Name, findings)
+		e.recordFiltered(item.Name, findingPaths(findings))
 		return content, false, nil
 	}
 
@@ -697,31 +658,32 @@ func (e *Engine) getLocalContent(item config.SyncItem) (string, bool, error) {
 	}
 
 	if shouldMergeProjectMCP(item, localPath) {
-		merged, changed, err := mcp.MergeProjectMCPServersIntoGlobal(data)
+		data, err = e.pushedMCPContent(data)
 		if err != nil {
 			return "", false, err
 		}
-		if changed {
-			data = merged
-		}
 	}
 
 	// Apply filter if configured
+	var filtered []FilteredPath
 	if item.Filter != nil {
+		filtered, err = filterRemovals(item, data)
+		if err != nil {
+			return "", false, err
+		}
 		data, err = filter.FilterJSON(data, item.Filter)
 		if err != nil {
 			return "", false, err
 		}
 	}
 
-	// 对 settings 文件过滤包含本地内容的 hooks（push 时）
-	if item.Name == "settings" {
-		filteredData, filteredTypes, err := filter.FilterLocalHooks(data)
-		if err == nil && len(filteredTypes) > 0 {
-			data = filteredData
-			// 可以在这里记录被过滤的 hook 类型
-		}
+	// 检测设备特定内容，按 local_actions 排除或报告
+	data, findings, err := e.localDetector().Apply(data, item.LocalActions)
+	if err != nil {
+		return "", false, fmt.Errorf("local_actions of %s: %w", item.Name, err)
 	}
+	e.recordFindings(item.Name, findings)
+	e.recordFiltered(item.Name, append(filtered, findingPaths(findings)...))
 
 	if len(data) == 0 {
 		return "", true, nil
@@ -731,62 +693,118 @@ func (e *Engine) getLocalContent(item config.SyncItem) (string, bool, error) {
 }
 
 func (e *Engine) prepareWriteContent(item config.SyncItem, content string) (string, bool, error) {
-	strategy := e.GetMergeStrategy()
-	if item.Type == "directory" {
-		if strategy == "local" {
-			return "", true, nil
+	prepared, skip, err := e.prepareMergedContent(item, content)
+	if err != nil || skip || item.Type == "directory" {
+		return prepared, skip, err
+	}
+	if len(item.MergeRules) > 0 {
+		prepared, skip, err = e.applyMergeRules(item, prepared)
+		if err != nil || skip {
+			return prepared, skip, err
 		}
-		return content, false, nil
 	}
+	localPath, err := config.ExpandPath(item.LocalPath)
+	if err != nil {
+		return "", false, err
+	}
+	// 按本地文件的键顺序和缩进排版，使 diff 只包含真正改动的键
+	return string(e.keepLayout(localPath, []byte(prepared))), false, nil
+}
+
+// keepLayout lays out JSON content like the existing local file, so that
+// rewriting it only changes the keys whose values differ
+func (e *Engine) keepLayout(localPath string, content []byte) []byte {
+	existing, err := e.readLocalFile(localPath)
+	if err != nil || len(existing) == 0 {
+		return content
+	}
+	rewritten, err := jsondoc.Rewrite(existing, content)
+	if err != nil {
+		return content
+	}
+	return rewritten
+}
 
+// applyMergeRules applies the item's merge_rules between the local file and
+// the content pull is about to write
+func (e *Engine) applyMergeRules(item config.SyncItem, prepared string) (string, bool, error) {
 	localPath, err := config.ExpandPath(item.LocalPath)
 	if err != nil {
 		return "", false, err
 	}
+	existing, err := e.readLocalFile(localPath)
+	if err != nil || len(existing) == 0 {
+		return prepared, false, nil
+	}
 
-	// 对 claude-json 特殊处理：先过滤字段，再合并 MCP 配置
-	if item.Name == "claude-json" || filepath.Base(localPath) == ".claude.json" {
-		// 先应用 filter 过滤不需要的字段
-		if item.Filter != nil {
-			filtered, err := filter.FilterJSON([]byte(content), item.Filter)
-			if err == nil {
-				content = string(filtered)
-			}
+	merged, changed, err := merge.Apply(existing, []byte(prepared), item.MergeRules, merge.Options{
+		Ask: e.askMergeRule,
+		Set: e.pullSetFunc(item),
+		Custom: map[merge.Strategy]merge.CustomFunc{
+			merge.MCPServers: e.mergeMCPServers,
+			merge.Hooks:      e.mergeHooks,
+		},
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("merge_rules of %s: %w", item.Name, err)
+	}
+	if changed {
+		if e.ruleMerged == nil {
+			e.ruleMerged = make(map[string]bool)
 		}
+		e.ruleMerged[item.Name] = true
+	}
+	return string(merged), false, nil
+}
 
-		existing, err := os.ReadFile(localPath)
-		if err == nil && len(existing) > 0 {
-			// 使用与 writeLocalContent 一致的策略（修复：保证 diff 与实际写入一致）
-			merged, _, err := mcp.MergeMCPOnPullWithStrategy(existing, []byte(content), strategy, e.autoYes)
-			if err == nil {
-				content = string(merged)
-			}
-		}
-		return content, false, nil
+// askMergeRule resolves an "ask" merge rule; with -y the local value is kept
+func (e *Engine) askMergeRule(path string, local, remote interface{}) bool {
+	if e.autoYes {
+		return true
 	}
+	return mcp.AskConflictResolution("merge_rules", path, local, remote) != "remote"
+}
 
-	// 对于非过滤文件，根据策略决定是否保留本地
-	if item.Filter == nil {
+func (e *Engine) prepareMergedContent(item config.SyncItem, content string) (string, bool, error) {
+	strategy := e.GetMergeStrategy()
+	if item.Type == "directory" {
 		if strategy == "local" {
-			// 保留本地：如果本地文件存在，返回本地内容
-			existing, err := os.ReadFile(localPath)
-			if err == nil && len(existing) > 0 {
-				return string(existing), true, nil
-			}
+			return "", true, nil
 		}
-		// 使用远端或智能合并：直接返回远端内容
 		return content, false, nil
 	}
 
-	filtered, err := filter.FilterJSON([]byte(content), item.Filter)
+	localPath, err := config.ExpandPath(item.LocalPath)
 	if err != nil {
 		return "", false, err
 	}
-	content = string(filtered)
 
-	existing, err := os.ReadFile(localPath)
-	if err == nil {
-		// 根据策略处理（与 writeLocalContent 一致）
+	existing, readErr := e.readLocalFile(localPath)
+	if item.Filter == nil {
+		// 对于非过滤文件，根据策略决定是否保留本地
+		if strategy == "local" && readErr == nil && len(existing) > 0 {
+			return string(existing), true, nil
+		}
+	} else {
+		filtered, err := filter.FilterJSON([]byte(content), item.Filter)
+		if err != nil {
+			return "", false, err
+		}
+		content = string(filtered)
+	}
+
+	if shouldMergeProjectMCP(item, localPath) {
+		// 项目路径映射到本机，丢弃本机没有对应项目的条目
+		content, err = e.remapProjects(content, existing)
+		if err != nil {
+			return "", false, err
+		}
+		content = e.keepLocalMCPServers(content, existing)
+	}
+
+	// MCP server 和 hooks 由 merge_rules 中的 mcp-servers、hooks 策略合并
+	if item.Filter != nil && readErr == nil {
+		// 根据策略处理（与写入一致）
 		if strategy == "local" {
 			merged, err := filter.MergeJSONKeepLocal(existing, []byte(content), item.Filter)
 			if err != nil {
@@ -810,109 +828,59 @@ func shouldMergeProjectMCP(item config.SyncItem, localPath string) bool {
 	if item.Type != "file" {
 		return false
 	}
-	if item.Name == "claude-json" {
+	if item.MergeRules[config.ProjectMCPField] == string(merge.MCPServers) {
 		return true
 	}
 	return filepath.Base(localPath) == ".claude.json"
 }
 
-// writeLocalContent writes content to the local path
-func (e *Engine) writeLocalContent(item config.SyncItem, content string, prepared bool) error {
+// writeLocalContent writes already merged content to the local path
+func (e *Engine) writeLocalContent(item config.SyncItem, content string) error {
 	localPath, err := config.ExpandPath(item.LocalPath)
 	if err != nil {
 		return err
 	}
-
-	if prepared {
-		if item.Type == "directory" {
-			return archive.UnpackDirectory(content, localPath)
-		}
-		// Ensure parent directory exists
-		if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
-			return err
-		}
-		return os.WriteFile(localPath, []byte(content), 0644)
-	}
-
-	strategy := e.GetMergeStrategy()
-
 	if item.Type == "directory" {
-		if strategy == "local" {
-			return nil
-		}
 		return archive.UnpackDirectory(content, localPath)
 	}
+	return e.writeLocalFile(localPath, []byte(content))
+}
 
-	// 对 claude-json 特殊处理：先过滤字段，再合并 MCP 配置
-	if item.Name == "claude-json" || filepath.Base(localPath) == ".claude.json" {
-		// 先应用 filter 过滤不需要的字段（修复：防止远端手动添加的字段被写回本地）
-		if item.Filter != nil {
-			filtered, err := filter.FilterJSON([]byte(content), item.Filter)
-			if err == nil {
-				content = string(filtered)
-			}
-		}
-
-		existing, err := os.ReadFile(localPath)
-		if err == nil && len(existing) > 0 {
-			// 根据策略处理
-			merged, _, err := mcp.MergeMCPOnPullWithStrategy(existing, []byte(content), strategy, e.autoYes)
-			if err == nil {
-				content = string(merged)
-			}
-		}
-	} else if item.Filter != nil {
-		// For other files with filters, we need to merge
-		filtered, err := filter.FilterJSON([]byte(content), item.Filter)
-		if err != nil {
-			return err
-		}
-		content = string(filtered)
-
-		existing, err := os.ReadFile(localPath)
-		if err == nil {
-			// 根据策略处理
-			if strategy == "remote" {
-				// 使用远端，但保留本地未同步的字段
-				merged, err := filter.MergeJSON(existing, []byte(content), item.Filter)
-				if err != nil {
-					return err
-				}
-				content = string(merged)
-			} else if strategy == "local" {
-				// 保留本地，只添加远端新增的字段
-				merged, err := filter.MergeJSONKeepLocal(existing, []byte(content), item.Filter)
-				if err != nil {
-					return err
-				}
-				content = string(merged)
-			} else {
-				// 智能合并
-				merged, err := filter.MergeJSON(existing, []byte(content), item.Filter)
-				if err != nil {
-					return err
-				}
-				content = string(merged)
-			}
-		}
-	} else {
-		// 对于非过滤文件，根据策略决定是否保留本地（修复：--keep-local 对非过滤文件生效）
-		if strategy == "local" {
-			existing, err := os.ReadFile(localPath)
-			if err == nil && len(existing) > 0 {
-				// 保留本地：直接返回，不写入
-				return nil
-			}
-		}
-		// 使用远端或智能合并：继续写入
+// readLocalFile reads a local file and remembers its snapshot so that
+// writeLocalFile can detect concurrent modification (e.g. by Claude Code)
+func (e *Engine) readLocalFile(localPath string) ([]byte, error) {
+	data, snap, err := fileutil.ReadFile(localPath)
+	if err != nil {
+		return nil, err
 	}
+	if e.snapshots == nil {
+		e.snapshots = make(map[string]fileutil.Snapshot)
+	}
+	if _, seen := e.snapshots[localPath]; !seen {
+		e.snapshots[localPath] = snap
+	}
+	if !snap.Exists {
+		return nil, os.ErrNotExist
+	}
+	return data, nil
+}
 
-	// Ensure parent directory exists
-	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+// writeLocalFile atomically writes a local file, refusing to clobber
+// changes made after the file was read
+func (e *Engine) writeLocalFile(localPath string, data []byte) error {
+	data = e.keepLayout(localPath, data)
+	snap, ok := e.snapshots[localPath]
+	if !ok {
+		return fileutil.WriteFile(localPath, data, 0644)
+	}
+	if err := fileutil.WriteFileIfUnchanged(localPath, data, 0644, snap); err != nil {
+		if errors.Is(err, fileutil.ErrModified) {
+			return fmt.Errorf("%s changed on disk while syncing (is Claude Code running?), please retry", localPath)
+		}
 		return err
 	}
-
-	return os.WriteFile(localPath, []byte(content), 0644)
+	delete(e.snapshots, localPath)
+	return nil
 }
 
 // findItem finds a sync item by name
@@ -936,6 +904,7 @@ type HooksWarning struct {
 	ItemName     string
 	LocalMatches []string
 	HookTypes    []string
+	LocalHooks   []string // 包含本地内容的 hook 条目
 }
 
 // CheckRemoteHooksForLocalContent 检查远程配置中的 hooks 是否包含本地特定内容
@@ -948,8 +917,8 @@ func (e *Engine) CheckRemoteHooksForLocalContent() ([]HooksWarning, error) {
 	var warnings []HooksWarning
 
 	for _, item := range e.cfg.GetEnabledItems() {
-		// 只检查可能包含 hooks 的文件
-		if item.Name != "settings" {
+		// 只检查按 hooks 策略合并的文件
+		if !hasMergeStrategy(item, merge.Hooks) {
 			continue
 		}
 
@@ -958,7 +927,7 @@ func (e *Engine) CheckRemoteHooksForLocalContent() ([]HooksWarning, error) {
 			continue
 		}
 
-		analysis, err := filter.AnalyzeHooks([]byte(remoteFile.Content))
+		analysis, err := e.localDetector().AnalyzeHooks([]byte(remoteFile.Content))
 		if err != nil {
 			continue
 		}
@@ -968,6 +937,7 @@ func (e *Engine) CheckRemoteHooksForLocalContent() ([]HooksWarning, error) {
 				ItemName:     item.Name,
 				LocalMatches: analysis.LocalMatches,
 				HookTypes:    analysis.HookTypes,
+				LocalHooks:   analysis.LocalHooks,
 			})
 		}
 	}
@@ -977,6 +947,9 @@ func (e *Engine) CheckRemoteHooksForLocalContent() ([]HooksWarning, error) {
 
 // PullWithHooksStrategy 带有 hooks 策略的 pull
 // hooksStrategy: "overwrite" - 覆盖本地 hooks, "keep" - 保留本地 hooks, "merge" - 智能合并
+//
+// Pull 是事务性的：先为所有条目准备好写入内容，统一展示 diff 并确认一次，
+// 然后一起写入本地文件和 state；任何一步失败都会回滚到 pull 之前的状态。
 func (e *Engine) PullWithHooksStrategy(dryRun bool, force bool, hooksStrategy string) ([]ItemStatus, error) {
 	remoteGist, err := e.client.Get(e.cfg.GistID)
 	if err != nil {
@@ -986,10 +959,18 @@ func (e *Engine) PullWithHooksStrategy(dryRun bool, force bool, hooksStrategy st
 	if err != nil {
 		return nil, err
 	}
+	if err := e.loadLedgers(remoteGist); err != nil {
+		return nil, err
+	}
 
 	var results []ItemStatus
-	appliedAny := false
-	keptLocal := make(map[string]string)
+	pulled := make(map[string]bool)
+	merged := make(map[string]bool) // 合并结果与远端不同，需要再 push
+	e.ruleMerged = make(map[string]bool)
+	e.hooksStrategy = hooksStrategy
+	e.warnings = nil
+	tx := &pullTransaction{}
+	defer tx.cleanup()
 
 	for _, status := range statuses {
 		item := e.findItem(status.Name)
@@ -998,152 +979,601 @@ func (e *Engine) PullWithHooksStrategy(dryRun bool, force bool, hooksStrategy st
 		}
 
 		// Check if we should pull
-		shouldPull := false
 		switch status.Status {
 		case StatusRemoteAhead:
-			shouldPull = true
 		case StatusConflict:
-			if force {
-				shouldPull = true
-			} else {
+			if !force && (e.mergeTool == "" || item.Type == "directory") {
 				status.Error = fmt.Errorf("conflict detected, use --force to override")
 				results = append(results, status)
 				continue
 			}
-		case StatusSynced, StatusLocalAhead:
+		default:
 			results = append(results, status)
 			continue
-		case StatusError:
+		}
+
+		remoteFile, exists := remoteGist.Files[item.GistFile]
+		if !exists {
 			results = append(results, status)
 			continue
 		}
 
-		if shouldPull {
-			remoteFile, exists := remoteGist.Files[item.GistFile]
-			if !exists {
+		if status.Status == StatusConflict && !force {
+			// 冲突的文件条目交给外部合并工具解决
+			if dryRun {
+				results = append(results, status)
+				continue
+			}
+			staged, resolved, err := e.stageMergedItem(*item, remoteFile.Content)
+			if err != nil {
+				status.Error = err
+				status.Status = StatusError
 				results = append(results, status)
 				continue
 			}
+			if staged != nil {
+				tx.stage(*staged)
+			}
+			if resolved != remoteFile.Content {
+				merged[status.Name] = true
+			}
+			pulled[status.Name] = true
+			results = append(results, status)
+			continue
+		}
 
-			if !dryRun {
-				content := remoteFile.Content
-
-				// 对 settings 文件应用 hooks 策略
-				if item.Name == "settings" && hooksStrategy != "overwrite" {
-					localPath, _ := config.ExpandPath(item.LocalPath)
-					localData, err := os.ReadFile(localPath)
-					if err == nil {
-						if hooksStrategy == "keep" {
-							// 保留本地 hooks
-							content, err = e.mergeKeepLocalHooks(localData, []byte(content))
-							if err != nil {
-								status.Error = err
-								status.Status = StatusError
-								results = append(results, status)
-								continue
-							}
-						} else if hooksStrategy == "merge" {
-							// 智能合并：只覆盖不含本地内容的 hooks
-							merged, err := filter.MergeHooksSelectively(localData, []byte(content), true)
-							if err != nil {
-								status.Error = err
-								status.Status = StatusError
-								results = append(results, status)
-								continue
-							}
-							content = string(merged)
-						}
-					}
-				}
+		if dryRun {
+			status.Status = e.pulledStatus(status)
+			results = append(results, status)
+			continue
+		}
 
-				if content == "" && item.Type != "directory" {
-					results = append(results, status)
-					continue
-				}
+		staged, skip, err := e.stagePullItem(*item, remoteFile.Content)
+		if errors.Is(err, mcp.ErrReviewCancelled) {
+			// 与取消 pull 审阅一致：不写入任何文件
+			return results, fmt.Errorf("用户取消操作，未修改任何本地文件")
+		}
+		if err != nil {
+			status.Error = err
+			status.Status = StatusError
+			results = append(results, status)
+			continue
+		}
+		if skip {
+			results = append(results, status)
+			continue
+		}
+		if staged != nil {
+			tx.stage(*staged)
+		}
+		pulled[status.Name] = true
+		results = append(results, status)
+	}
 
-				preparedContent, skipWrite, err := e.prepareWriteContent(*item, content)
-				if err != nil {
-					status.Error = err
-					status.Status = StatusError
-					results = append(results, status)
-					continue
-				}
+	if dryRun {
+		return results, nil
+	}
 
-				if !skipWrite {
-					if err := e.writeLocalContent(*item, preparedContent, true); err != nil {
-						status.Error = err
-						status.Status = StatusError
-						results = append(results, status)
-						continue
-					}
-					appliedAny = true
-				}
+	kept := make(map[string]bool)
+	if len(tx.writes) > 0 {
+		accepted, keptByUser, ok := e.confirmStagedWrites(tx.writes)
+		if !ok {
+			return results, fmt.Errorf("用户取消操作，未修改任何本地文件")
+		}
+		tx.writes = accepted
+		kept = keptByUser
+	}
 
-				localHash, err := e.calculateLocalHash(*item)
-				if err != nil {
-					status.Error = err
-					status.Status = StatusError
-					results = append(results, status)
-					continue
-				}
-				status.LocalHash = localHash
+	if err := tx.commit(e); err != nil {
+		return nil, fmt.Errorf("pull failed: %w", err)
+	}
+
+	// 写入后重新计算本地 hash
+	for i := range results {
+		status := &results[i]
+		if !pulled[status.Name] {
+			continue
+		}
+		item := e.findItem(status.Name)
+		localHash, err := e.calculateLocalHash(*item)
+		if err != nil {
+			return nil, fmt.Errorf("pull failed: %w", tx.abort(err))
+		}
+		status.LocalHash = localHash
+		if kept[status.Name] || merged[status.Name] || e.ruleMerged[status.Name] {
+			status.Status = StatusLocalAhead
+		} else {
+			status.Status = e.pulledStatus(*status)
+		}
+	}
+
+	// Update state
+	previousState := cloneState(e.state)
+	now := time.Now()
+	for _, status := range results {
+		if status.Status == StatusSynced && status.RemoteHash != "" {
+			e.state.Items[status.Name] = config.ItemState{
+				LocalHash:  status.LocalHash,
+				RemoteHash: status.RemoteHash,
+				LastSync:   &now,
 			}
+		} else if status.Status == StatusLocalAhead && pulled[status.Name] {
+			// 保留本地或合并：把远端视为已同步，避免下次被判定为远端领先
+			e.state.Items[status.Name] = config.ItemState{
+				LocalHash:  status.RemoteHash,
+				RemoteHash: status.RemoteHash,
+				LastSync:   &now,
+			}
+		}
+	}
+	e.state.LastSync = &now
 
-			if e.GetMergeStrategy() == "local" && status.LocalHash != status.RemoteHash {
-				status.Status = StatusLocalAhead
-				keptLocal[status.Name] = status.RemoteHash
-			} else {
-				status.Status = StatusSynced
+	// 始终同步本地 version 到远端 version（修复：即使内容没变也要同步 version）
+	// 这样可以避免后续本地改动被误判为"远端领先"
+	if info.effectiveRemoteVersion > e.state.Version {
+		e.state.Version = info.effectiveRemoteVersion
+	}
+
+	if err := e.state.Save(); err != nil {
+		*e.state = previousState
+		return nil, fmt.Errorf("pull failed: %w", tx.abort(fmt.Errorf("failed to save state: %w", err)))
+	}
+
+	// 本地文件和 state 已经提交，之后的失败只作为警告报告
+	e.recordBases(results, remoteGist, nil)
+	if e.ledgerChanged {
+		// 记录本次同步时的远端 ledger，下次据此识别本地的增删
+		if err := ledger.SaveSynced(e.remoteLedger); err != nil {
+			e.warn("failed to save ledger: %v", err)
+		}
+	}
+
+	appliedAny := len(tx.writes) > 0
+	if appliedAny && (info.effectiveRemoteVersion > info.remoteVersion || info.metaNeedsUpdate) {
+		meta := info.meta
+		meta.Version = info.effectiveRemoteVersion
+		meta, _ = ensureSyncMetaRepo(meta)
+		metaContent, err := marshalJSON(meta)
+		if err == nil {
+			_, err = e.client.Update(e.cfg.GistID, map[string]string{syncMetaFile: string(metaContent)})
+		}
+		if err != nil {
+			// 下次 pull 或 push 会再次更新 meta
+			e.warn("pulled files are written, but updating the gist meta failed: %v", err)
+		}
+	}
+
+	return results, nil
+}
+
+// recordBases stores the gist content of every synced item as its
+// last-synced base, used by 'claude_sync diff --base'.
+// updates overrides remote content for files that were just pushed.
+func (e *Engine) recordBases(results []ItemStatus, remoteGist *gist.Gist, updates map[string]string) {
+	for _, status := range results {
+		if status.Status != StatusSynced || status.Error != nil {
+			continue
+		}
+		content, ok := updates[status.GistFile]
+		if !ok {
+			remoteFile, exists := remoteGist.Files[status.GistFile]
+			if !exists {
+				continue
 			}
-			results = append(results, status)
+			content = remoteFile.Content
 		}
+		// base 只用于 diff 展示，写入失败不影响同步结果
+		config.SaveBase(status.Name, content)
 	}
+}
 
-	if !dryRun {
-		// Update state
-		now := time.Now()
-		for _, status := range results {
-			if status.Status == StatusSynced && status.RemoteHash != "" {
-				e.state.Items[status.Name] = config.ItemState{
-					LocalHash:  status.LocalHash,
-					RemoteHash: status.RemoteHash,
-					LastSync:   &now,
+// stagePullItem prepares the content pull would write for one item.
+// It returns nil when there is nothing to write (e.g. keep-local), and
+// skip=true when the remote file is empty and the item should be left alone.
+func (e *Engine) stagePullItem(item config.SyncItem, content string) (*stagedWrite, bool, error) {
+	localPath, err := config.ExpandPath(item.LocalPath)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if content == "" && item.Type != "directory" {
+		return nil, true, nil
+	}
+
+	preparedContent, skipWrite, err := e.prepareWriteContent(item, content)
+	if err != nil {
+		return nil, false, err
+	}
+	if skipWrite {
+		return nil, false, nil
+	}
+	return e.newStagedWrite(item, localPath, preparedContent), false, nil
+}
+
+// newStagedWrite records the current local content next to the content
+// to write, so the change can be shown as a diff before it is applied
+func (e *Engine) newStagedWrite(item config.SyncItem, localPath, content string) *stagedWrite {
+	var oldContent string
+	if item.Type != "directory" {
+		if data, err := e.readLocalFile(localPath); err == nil {
+			oldContent = string(data)
+		}
+	}
+	return &stagedWrite{
+		item:       item,
+		localPath:  localPath,
+		oldContent: oldContent,
+		newContent: content,
+	}
+}
+
+// stageMergedItem runs the external merge tool on a conflicting file item
+// and stages the resolved content. The tool sees the content push would
+// upload (LOCAL), the gist content (REMOTE) and the last-synced base (BASE).
+// The resolved content is returned so the caller can tell whether the item
+// still differs from the remote.
+func (e *Engine) stageMergedItem(item config.SyncItem, remoteContent string) (*stagedWrite, string, error) {
+	local, _, err := e.getLocalContent(item)
+	if err != nil {
+		return nil, "", err
+	}
+	base, _, err := config.LoadBase(item.Name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	fmt.Printf("\n使用合并工具解决冲突: %s\n", item.Name)
+	resolved, err := mergetool.Run(e.mergeTool, mergetool.Inputs{
+		Name:   item.GistFile,
+		Local:  local,
+		Base:   base,
+		Remote: remoteContent,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if item.Filter != nil || strings.HasSuffix(item.GistFile, ".json") {
+		if !json.Valid([]byte(resolved)) {
+			return nil, "", fmt.Errorf("merged result for %s is not valid JSON", item.Name)
+		}
+	}
+
+	// 合并结果就是最终内容：不再应用 merge_rules，只保留未同步的本地字段
+	localPath, err := config.ExpandPath(item.LocalPath)
+	if err != nil {
+		return nil, "", err
+	}
+	previous := e.mergeStrategy
+	e.mergeStrategy = "remote"
+	prepared, _, err := e.prepareMergedContent(item, resolved)
+	e.mergeStrategy = previous
+	if err != nil {
+		return nil, "", err
+	}
+	prepared = string(e.keepLayout(localPath, []byte(prepared)))
+	return e.newStagedWrite(item, localPath, prepared), resolved, nil
+}
+
+// confirmStagedWrites 统一展示所有待写入的变更，并只确认一次
+// 返回最终要写入的内容，以及用户选择保留本地的条目
+func (e *Engine) confirmStagedWrites(writes []stagedWrite) ([]stagedWrite, map[string]bool, bool) {
+	if e.autoYes {
+		return writes, nil, true
+	}
+
+	if accepted, kept, ok, err := e.reviewStagedWrites(writes); err == nil {
+		return accepted, kept, ok
+	}
+
+	// 终端不可用时回退到逐行确认
+	showAll := func() {
+		for _, w := range writes {
+			if w.item.Type == "directory" {
+				diff.ShowDirectoryChange(w.item.LocalPath)
+				continue
+			}
+			if w.oldContent == w.newContent {
+				continue
+			}
+			diff.ShowDiff(w.item.LocalPath, w.oldContent, w.newContent)
+		}
+	}
+	showAll()
+
+	for {
+		switch diff.ConfirmChange(fmt.Sprintf("%d 个条目", len(writes)), false) {
+		case diff.ConfirmYes, diff.ConfirmAll:
+			return writes, nil, true
+		case diff.ConfirmPreview:
+			for _, w := range writes {
+				if w.item.Type != "directory" {
+					diff.ShowPreview(w.item.LocalPath, w.newContent)
 				}
 			}
+		default:
+			return nil, nil, false
 		}
-		for name, remoteHash := range keptLocal {
-			e.state.Items[name] = config.ItemState{
-				LocalHash:  remoteHash,
-				RemoteHash: remoteHash,
-				LastSync:   &now,
+	}
+}
+
+// reviewStagedWrites 使用全屏界面选择远端、本地或手动编辑的内容；
+// JSON 文件按顶层键逐个审阅，其他条目整体审阅
+func (e *Engine) reviewStagedWrites(writes []stagedWrite) ([]stagedWrite, map[string]bool, bool, error) {
+	if !tui.Available() {
+		return nil, nil, false, tui.ErrUnavailable
+	}
+
+	var entries []tui.Entry
+	owners := make([]int, 0, len(writes)) // entries[i] 属于 writes[owners[i]]
+	keyed := make(map[int]bool)           // 按键审阅的条目
+	for i, w := range writes {
+		title := fmt.Sprintf("%s (%s)", w.item.Name, w.item.LocalPath)
+		if w.item.Type != "directory" {
+			if changes, ok := changedJSONKeys(w.oldContent, w.newContent); ok && len(changes) > 0 {
+				for _, c := range changes {
+					entries = append(entries, tui.Entry{
+						Title:    title + ": " + c.key,
+						Local:    c.local,
+						Remote:   c.remote,
+						Choice:   tui.ChoiceRemote,
+						Editable: true,
+						Validate: validateKeyJSON,
+					})
+					owners = append(owners, i)
+				}
+				keyed[i] = true
+				continue
 			}
 		}
-		e.state.LastSync = &now
 
-		// 始终同步本地 version 到远端 version（修复：即使内容没变也要同步 version）
-		if info.effectiveRemoteVersion > e.state.Version {
-			e.state.Version = info.effectiveRemoteVersion
+		entry := tui.Entry{
+			Title:    title,
+			Local:    w.oldContent,
+			Remote:   w.newContent,
+			Choice:   tui.ChoiceRemote,
+			Editable: w.item.Type != "directory",
+		}
+		if w.item.Type == "directory" {
+			local, _, err := e.getLocalContent(w.item)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			files, err := diffArchives(local, w.newContent, true)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			entry.Local, entry.Remote = describeFileChanges(files)
+		} else if diff.IsJSON([]byte(w.newContent)) {
+			entry.Validate = func(content string) error {
+				var v interface{}
+				return json.Unmarshal([]byte(content), &v)
+			}
 		}
+		entries = append(entries, entry)
+		owners = append(owners, i)
+	}
 
-		if err := e.state.Save(); err != nil {
-			return nil, fmt.Errorf("failed to save state: %w", err)
+	applied, err := tui.Review("审阅 pull 变更", entries)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if !applied {
+		return nil, nil, false, nil
+	}
+
+	var accepted []stagedWrite
+	kept := make(map[string]bool)
+	for i, w := range writes {
+		var choices []tui.Entry
+		for j, owner := range owners {
+			if owner == i {
+				choices = append(choices, entries[j])
+			}
 		}
 
-		if appliedAny && (info.effectiveRemoteVersion > info.remoteVersion || info.metaNeedsUpdate) {
-			meta := info.meta
-			meta.Version = info.effectiveRemoteVersion
-			meta, _ = ensureSyncMetaRepo(meta)
-			metaContent, err := marshalJSON(meta)
+		if keyed[i] {
+			content, keepLocal, err := applyKeyChoices(w.oldContent, w.newContent, choices)
 			if err != nil {
-				return nil, fmt.Errorf("failed to marshal sync meta: %w", err)
+				return nil, nil, false, fmt.Errorf("%s: %w", w.item.Name, err)
 			}
-			if _, err := e.client.Update(e.cfg.GistID, map[string]string{syncMetaFile: string(metaContent)}); err != nil {
-				return nil, fmt.Errorf("failed to update gist meta: %w", err)
+			if keepLocal {
+				kept[w.item.Name] = true
+				continue
 			}
+			w.newContent = content
+			accepted = append(accepted, w)
+			continue
+		}
+
+		switch choices[0].Choice {
+		case tui.ChoiceLocal:
+			kept[w.item.Name] = true
+		case tui.ChoiceEdited:
+			w.newContent = choices[0].Edited
+			accepted = append(accepted, w)
+		default:
+			accepted = append(accepted, w)
 		}
 	}
+	return accepted, kept, true, nil
+}
 
-	return results, nil
+// keyChange is a top-level key whose value pull would change
+type keyChange struct {
+	key           string
+	local, remote string // 格式化后的值，"" 表示该侧没有这个键
+}
+
+// changedJSONKeys lists the top-level keys that differ between the local
+// JSON object and the content pull would write. ok is false when either
+// side is not a JSON object, e.g. for a new file.
+func changedJSONKeys(oldContent, newContent string) ([]keyChange, bool) {
+	if strings.TrimSpace(oldContent) == "" {
+		return nil, false
+	}
+	oldDoc, err := jsondoc.ParseDocument([]byte(oldContent))
+	if err != nil {
+		return nil, false
+	}
+	newDoc, err := jsondoc.ParseDocument([]byte(newContent))
+	if err != nil {
+		return nil, false
+	}
+
+	keys := newDoc.Root().Keys()
+	for _, key := range oldDoc.Root().Keys() {
+		if _, ok := newDoc.Root().Get(key); !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	var changes []keyChange
+	for _, key := range keys {
+		oldValue, inOld := oldDoc.Root().Get(key)
+		newValue, inNew := newDoc.Root().Get(key)
+		local, remote := keyText(oldValue, inOld), keyText(newValue, inNew)
+		if inOld == inNew && local == remote {
+			continue
+		}
+		changes = append(changes, keyChange{key: key, local: local, remote: remote})
+	}
+	return changes, true
+}
+
+// applyKeyChoices applies the per-key review choices to the content pull
+// would write. keepLocal is true when every key kept its local value.
+func applyKeyChoices(oldContent, newContent string, choices []tui.Entry) (string, bool, error) {
+	doc, err := jsondoc.ParseDocument([]byte(newContent))
+	if err != nil {
+		return "", false, err
+	}
+	changes, _ := changedJSONKeys(oldContent, newContent)
+
+	keepLocal := true
+	for i, c := range changes {
+		value := choices[i].Value()
+		if choices[i].Choice == tui.ChoiceRemote {
+			keepLocal = false
+			continue
+		}
+		if choices[i].Choice == tui.ChoiceEdited {
+			keepLocal = false
+		}
+		if strings.TrimSpace(value) == "" {
+			doc.Delete([]string{c.key})
+			continue
+		}
+		parsed, err := jsondoc.Parse([]byte(value))
+		if err != nil {
+			return "", false, fmt.Errorf("invalid JSON for %s: %w", c.key, err)
+		}
+		if err := doc.Set([]string{c.key}, parsed); err != nil {
+			return "", false, err
+		}
+	}
+	if keepLocal {
+		return "", true, nil
+	}
+	result, err := doc.Bytes()
+	if err != nil {
+		return "", false, err
+	}
+	return string(result), false, nil
+}
+
+func keyText(v interface{}, ok bool) string {
+	if !ok {
+		return ""
+	}
+	data, err := jsondoc.MarshalIndent(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// validateKeyJSON accepts a JSON value, or nothing to remove the key
+func validateKeyJSON(content string) error {
+	if strings.TrimSpace(content) == "" {
+		return nil
+	}
+	var v interface{}
+	return json.Unmarshal([]byte(content), &v)
+}
+
+// describeFileChanges 把目录内的文件变化拼成两侧文本，便于并排显示
+func describeFileChanges(files []FileChange) (string, string) {
+	var local, remote strings.Builder
+	for _, f := range files {
+		header := fmt.Sprintf("== %s ==\n", f.Path)
+		local.WriteString(header)
+		remote.WriteString(header)
+		if f.Binary {
+			local.WriteString("(binary file)\n")
+			remote.WriteString("(binary file)\n")
+			continue
+		}
+		if f.Kind != diff.ChangeAdded {
+			local.WriteString(f.OldContent + "\n")
+		}
+		remote.WriteString(f.NewContent + "\n")
+	}
+	return local.String(), remote.String()
+}
+
+// pulledStatus returns the status of an item after its remote content was applied
+func (e *Engine) pulledStatus(status ItemStatus) SyncStatus {
+	if e.GetMergeStrategy() == "local" && status.LocalHash != status.RemoteHash {
+		return StatusLocalAhead
+	}
+	return StatusSynced
+}
+
+// mergeHooks implements the hooks merge rule with the pull's hooks strategy:
+// overwrite keeps only the local device-specific entries push never
+// uploads, keep keeps the local hooks and merge merges them entry by entry
+func (e *Engine) mergeHooks(values []merge.Value) ([]interface{}, error) {
+	merged := make([]interface{}, len(values))
+	for i, v := range values {
+		local := hooksDocument(v.Local, v.InLocal)
+		remote := hooksDocument(v.Remote, v.InRemote)
+
+		var result []byte
+		var err error
+		switch e.hooksStrategy {
+		case "keep":
+			var kept string
+			kept, err = e.mergeKeepLocalHooks(local, remote)
+			result = []byte(kept)
+		case "merge":
+			// 按条目取并集，跳过远端含本地内容的 hook
+			result, err = e.localDetector().MergeHooksSelectively(local, remote, true)
+		default:
+			result, err = e.localDetector().KeepLocalHookEntries(local, remote)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var obj map[string]interface{}
+		if err := json.Unmarshal(result, &obj); err != nil {
+			return nil, fmt.Errorf("failed to parse merged hooks: %w", err)
+		}
+		merged[i] = obj["hooks"]
+	}
+	return merged, nil
+}
+
+// hooksDocument wraps a hooks value into a settings document
+func hooksDocument(value interface{}, ok bool) []byte {
+	if !ok {
+		return []byte("{}")
+	}
+	data, err := json.Marshal(map[string]interface{}{"hooks": value})
+	if err != nil {
+		return []byte("{}")
+	}
+	return data
 }
 
 // mergeKeepLocalHooks 合并配置但保留本地 hooks
@@ -1170,7 +1600,7 @@ func (e *Engine) mergeKeepLocalHooks(local, remote []byte) (string, error) {
 		localObj["hooks"] = localHooks
 	}
 
-	result, err := json.MarshalIndent(localObj, "", "  ")
+	result, err := jsondoc.MarshalIndent(localObj)
 	if err != nil {
 		return "", err
 	}
@@ -1,12 +1,20 @@
 package sync
 
 import (
+	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/yxuechao007/claude_sync/internal/config"
 	"github.com/yxuechao007/claude_sync/internal/gist"
+	"github.com/yxuechao007/claude_sync/internal/ledger"
+	"github.com/yxuechao007/claude_sync/internal/tui"
 )
 
 func TestCalculateLocalHashEmptyFile(t *testing.T) {
@@ -113,9 +121,10 @@ func TestCalculateLocalHashFiltersLocalHooks(t *testing.T) {
 
 	engine := &Engine{}
 	item := config.SyncItem{
-		Name:      "settings",
-		LocalPath: path,
-		Type:      "file",
+		Name:         "settings",
+		LocalPath:    path,
+		Type:         "file",
+		LocalActions: config.DefaultSettingsLocalActions(),
 	}
 
 	hash, err := engine.calculateLocalHash(item)
@@ -129,6 +138,88 @@ func TestCalculateLocalHashFiltersLocalHooks(t *testing.T) {
 	}
 }
 
+func TestGetLocalContentRecordsFilteredPaths(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "settings.json")
+	data := `{
+		"model": "opus",
+		"env": {"TOKEN": "t"},
+		"hooks": {"Stop": [{"hooks": [{"command": "/Users/me/bin/notify"}]}]},
+		"statusLine": {"command": "~/bin/status"}
+	}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	engine := &Engine{}
+	item := config.SyncItem{
+		Name:         "settings",
+		LocalPath:    path,
+		Type:         "file",
+		Filter:       &config.FilterConfig{ExcludeFields: []string{"env"}},
+		LocalActions: config.DefaultSettingsLocalActions(),
+	}
+	if _, _, err := engine.getLocalContent(item); err != nil {
+		t.Fatalf("getLocalContent: %v", err)
+	}
+
+	want := []FilteredPath{
+		{Path: "env", Action: FilterFiltered, Reason: "exclude_fields: env"},
+		{Path: "hooks.Stop[0].hooks[0].command", Action: FilterExcluded, Reason: `machine-specific "/Users/me/" (macos-home)`},
+		{Path: "statusLine.command", Action: FilterWarned, Reason: `machine-specific "~/" (tilde-path)`},
+	}
+	got := engine.filteredFor(item)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("filtered = %+v\nwant %+v", got, want)
+	}
+
+	out, err := json.Marshal(ItemStatus{Name: "settings", Status: StatusError, Error: errors.New("boom"), Filtered: want[:1]})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if !strings.Contains(string(out), `"error":"boom"`) || !strings.Contains(string(out), `"action":"filtered"`) {
+		t.Fatalf("json = %s", out)
+	}
+}
+
+func TestFormatFilteredGroupsByReason(t *testing.T) {
+	var paths []FilteredPath
+	for _, key := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		paths = append(paths, FilteredPath{Path: key, Action: FilterFiltered, Reason: "not in include_fields"})
+	}
+	paths = append(paths, FilteredPath{Path: "x", Action: FilterExcluded, Reason: "r"})
+
+	want := []string{
+		"filtered a, b, c, d, e and 2 more (not in include_fields)",
+		"excluded x (r)",
+	}
+	if got := FormatFiltered(paths); !reflect.DeepEqual(got, want) {
+		t.Fatalf("FormatFiltered = %q\nwant %q", got, want)
+	}
+}
+
+func TestPrepareWriteContentKeepsLocalLayout(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "settings.json")
+	local := "{\n  \"model\": \"opus\",\n  \"hooks\": {\n    \"Stop\": \"a && b\"\n  },\n  \"cleanupPeriodDays\": 30\n}\n"
+	if err := os.WriteFile(path, []byte(local), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	engine := &Engine{mergeStrategy: "remote"}
+	item := config.SyncItem{Name: "settings", LocalPath: path, Type: "file"}
+	remote := `{"cleanupPeriodDays": 30, "hooks": {"Stop": "a \u0026\u0026 b"}, "model": "sonnet"}`
+
+	content, skip, err := engine.prepareWriteContent(item, remote)
+	if err != nil || skip {
+		t.Fatalf("prepareWriteContent: skip=%v err=%v", skip, err)
+	}
+	want := strings.Replace(local, "opus", "sonnet", 1)
+	if content != want {
+		t.Fatalf("content:\n%s\nwant:\n%s", content, want)
+	}
+}
+
 func TestPrepareWriteContentKeepLocalSkipsWrite(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "config.json")
@@ -154,3 +245,425 @@ func TestPrepareWriteContentKeepLocalSkipsWrite(t *testing.T) {
 		t.Fatalf("prepared = %s, want %s", prepared, `{"a":1}`)
 	}
 }
+
+func TestPrepareWriteContentAppliesMergeRules(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "settings.json")
+	local := `{"permissions":{"allow":["Bash(ls)","Read"]},"env":{"A":"1"}}`
+	if err := os.WriteFile(path, []byte(local), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	engine := &Engine{mergeStrategy: "merge", autoYes: true, remoteLedger: ledger.New(), syncedLedger: ledger.New()}
+	item := config.SyncItem{
+		Name:       "settings",
+		LocalPath:  path,
+		Type:       "file",
+		Filter:     &config.FilterConfig{ExcludeFields: []string{"env"}},
+		MergeRules: config.DefaultSettingsMergeRules(),
+	}
+
+	prepared, skipWrite, err := engine.prepareWriteContent(item, `{"permissions":{"allow":["Read","WebFetch"]}}`)
+	if err != nil || skipWrite {
+		t.Fatalf("prepareWriteContent: skip=%v err=%v", skipWrite, err)
+	}
+
+	var got struct {
+		Permissions struct {
+			Allow []string `json:"allow"`
+		} `json:"permissions"`
+		Env map[string]string `json:"env"`
+	}
+	if err := json.Unmarshal([]byte(prepared), &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := []string{"Bash(ls)", "Read", "WebFetch"}
+	if strings.Join(got.Permissions.Allow, ",") != strings.Join(want, ",") {
+		t.Fatalf("allow = %v, want %v", got.Permissions.Allow, want)
+	}
+	if got.Env["A"] != "1" {
+		t.Fatalf("local env lost: %v", got.Env)
+	}
+	if !engine.ruleMerged["settings"] {
+		t.Fatalf("ruleMerged not recorded")
+	}
+}
+
+func TestStageMergedItemSkipsMergeRules(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	path := filepath.Join(dir, "settings.json")
+	if err := os.WriteFile(path, []byte(`{"model":"opus","env":{"A":"1"}}`), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	engine := &Engine{
+		mergeStrategy: "merge",
+		mergeTool:     `printf '{"model":"sonnet"}' > "$MERGED"`,
+		remoteLedger:  ledger.New(),
+		syncedLedger:  ledger.New(),
+	}
+	item := config.SyncItem{
+		Name:       "settings",
+		LocalPath:  path,
+		GistFile:   "settings.json",
+		Type:       "file",
+		Filter:     &config.FilterConfig{ExcludeFields: []string{"env"}},
+		MergeRules: map[string]string{"model": "prefer-local"},
+	}
+
+	staged, _, err := engine.stageMergedItem(item, `{"model":"haiku"}`)
+	if err != nil {
+		t.Fatalf("stageMergedItem: %v", err)
+	}
+	// 合并工具的结果不再经过 prefer-local 规则，被排除的本地字段仍保留
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(staged.newContent), &got); err != nil {
+		t.Fatalf("unmarshal %s: %v", staged.newContent, err)
+	}
+	if got["model"] != "sonnet" {
+		t.Fatalf("model = %v, want the merge tool result", got["model"])
+	}
+	if env, _ := got["env"].(map[string]interface{}); env["A"] != "1" {
+		t.Fatalf("local env lost: %v", got["env"])
+	}
+}
+
+func TestPrepareWriteContentPropagatesSetRemovals(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "settings.json")
+	local := `{"permissions":{"allow":["Bash(rm:*)","Read","Edit"]}}`
+	if err := os.WriteFile(path, []byte(local), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	key := ledger.SetKey("settings", "permissions.allow")
+	lastSync := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	synced := ledger.New()
+	synced.Record(key, "Bash(rm:*)", ledger.OpAdd, "laptop", lastSync)
+	synced.Record(key, "Read", ledger.OpAdd, "laptop", lastSync)
+	remote := synced.Clone()
+	remote.Record(key, "Bash(rm:*)", ledger.OpRemove, "desktop", lastSync.Add(time.Hour))
+
+	engine := &Engine{mergeStrategy: "merge", autoYes: true, remoteLedger: remote, syncedLedger: synced}
+	item := config.SyncItem{
+		Name:       "settings",
+		LocalPath:  path,
+		Type:       "file",
+		MergeRules: config.DefaultSettingsMergeRules(),
+	}
+
+	prepared, _, err := engine.prepareWriteContent(item, `{"permissions":{"allow":["Read"]}}`)
+	if err != nil {
+		t.Fatalf("prepareWriteContent: %v", err)
+	}
+	var got struct {
+		Permissions struct {
+			Allow []string `json:"allow"`
+		} `json:"permissions"`
+	}
+	if err := json.Unmarshal([]byte(prepared), &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	// 远端删除的条目被移除，本地新增但未 push 的条目保留
+	want := []string{"Read", "Edit"}
+	if strings.Join(got.Permissions.Allow, ",") != strings.Join(want, ",") {
+		t.Fatalf("allow = %v, want %v", got.Permissions.Allow, want)
+	}
+	if remote.Entries(key)["Edit"] != nil {
+		t.Fatalf("unpushed local add leaked into the remote ledger")
+	}
+}
+
+func TestMCPServerRulesOnPushAndPull(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".claude.json")
+	local := `{
+  "mcpServers": {
+    "github": {"command": "gh"},
+    "vault": {"command": "vault-local"},
+    "shared": {"command": "shared-local"}
+  },
+  "projects": {
+    "/work/app": {"mcpServers": {"scratch": {"command": "scratch"}}}
+  }
+}
+`
+	if err := os.WriteFile(path, []byte(local), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	engine := &Engine{cfg: &config.Config{MCPServers: map[string]config.MCPServerRule{
+		"vault":   {Sync: config.MCPSyncNever},
+		"shared":  {Sync: config.MCPSyncPullOnly},
+		"scratch": {Sync: config.MCPSyncNever},
+	}}}
+	item := config.SyncItem{Name: "claude-json", LocalPath: path, GistFile: "claude.json", Type: "file"}
+
+	content, _, err := engine.getLocalContent(item)
+	if err != nil {
+		t.Fatalf("getLocalContent: %v", err)
+	}
+	if strings.Contains(content, "vault") || strings.Contains(content, "shared") || strings.Contains(content, "scratch") {
+		t.Fatalf("excluded servers pushed:\n%s", content)
+	}
+	if hash, _ := engine.calculateLocalHash(item); hash != calculateHash(content) {
+		t.Error("calculateLocalHash disagrees with the pushed content")
+	}
+
+	// pull-only 的 server 保留 Gist 中的版本，never 的 server 从 Gist 中移除
+	remote := `{"mcpServers": {"vault": {"command": "old"}, "shared": {"command": "shared-remote"}}}`
+	upload, err := engine.keepRemoteMCPServers(content, remote)
+	if err != nil {
+		t.Fatalf("keepRemoteMCPServers: %v", err)
+	}
+	if !strings.Contains(upload, "shared-remote") || strings.Contains(upload, "vault") {
+		t.Fatalf("upload:\n%s", upload)
+	}
+
+	// pull 时不覆盖本地的 never server
+	pulled := engine.keepLocalMCPServers(`{"mcpServers": {"github": {"command": "gh"}, "vault": {"command": "old"}}}`, []byte(local))
+	if !strings.Contains(pulled, "vault-local") {
+		t.Fatalf("pulled:\n%s", pulled)
+	}
+}
+
+func TestGetLocalContentKeepsProjectMCPServersLocal(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".claude.json")
+	local := `{
+  "mcpServers": {"github": {"command": "gh"}},
+  "projects": {
+    "/work/client": {"mcpServers": {"client-db": {"command": "db"}}},
+    "/work/team": {"mcpServers": {"team-docs": {"command": "docs"}}}
+  }
+}
+`
+	if err := os.WriteFile(path, []byte(local), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	cfg := config.DefaultConfig("")
+	item := *cfg.FindItem("claude-json")
+	item.LocalPath = path
+	engine := &Engine{cfg: cfg}
+
+	content, _, err := engine.getLocalContent(item)
+	if err != nil {
+		t.Fatalf("getLocalContent: %v", err)
+	}
+	if strings.Contains(content, "client-db") || strings.Contains(content, "team-docs") {
+		t.Fatalf("project servers promoted by default:\n%s", content)
+	}
+
+	// 按项目选择提升
+	cfg.PromoteMCPProjects = []string{"/work/team"}
+	if content, _, err = engine.getLocalContent(item); err != nil {
+		t.Fatalf("getLocalContent: %v", err)
+	}
+	if strings.Contains(content, "client-db") || !strings.Contains(content, "team-docs") {
+		t.Fatalf("content:\n%s", content)
+	}
+
+	// 作为项目条目同步，不提升到全局
+	cfg.PromoteMCPProjects = nil
+	if err := cfg.SetMCPProjectServers(config.MCPProjectProject); err != nil {
+		t.Fatalf("SetMCPProjectServers: %v", err)
+	}
+	item = *cfg.FindItem("claude-json")
+	item.LocalPath = path
+	if content, _, err = engine.getLocalContent(item); err != nil {
+		t.Fatalf("getLocalContent: %v", err)
+	}
+	var prefs struct {
+		MCPServers map[string]interface{}            `json:"mcpServers"`
+		Projects   map[string]map[string]interface{} `json:"projects"`
+	}
+	if err := json.Unmarshal([]byte(content), &prefs); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(prefs.MCPServers) != 1 || prefs.Projects["/work/client"]["mcpServers"] == nil {
+		t.Fatalf("content:\n%s", content)
+	}
+}
+
+func TestPrepareWriteContentMergeRulesSelectMCPAndHooksMerge(t *testing.T) {
+	dir := t.TempDir()
+	// 条目名和文件名都不是内置的，行为只由 merge_rules 决定
+	profile := filepath.Join(dir, "profile.json")
+	local := `{"model":"opus","mcpServers":{"mine":{"command":"a"},"shared":{"command":"local"}}}`
+	if err := os.WriteFile(profile, []byte(local), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	engine := &Engine{mergeStrategy: "merge", autoYes: true}
+	item := config.SyncItem{
+		Name:       "work-profile",
+		LocalPath:  profile,
+		Type:       "file",
+		Filter:     &config.FilterConfig{IncludeFields: []string{"model", "mcpServers"}},
+		MergeRules: map[string]string{"mcpServers": "mcp-servers"},
+	}
+
+	prepared, _, err := engine.prepareWriteContent(item, `{"model":"sonnet","mcpServers":{"shared":{"command":"remote"},"new":{"command":"b"}}}`)
+	if err != nil {
+		t.Fatalf("prepareWriteContent: %v", err)
+	}
+	var got struct {
+		Model      string                       `json:"model"`
+		MCPServers map[string]map[string]string `json:"mcpServers"`
+	}
+	if err := json.Unmarshal([]byte(prepared), &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if got.Model != "sonnet" || got.MCPServers["mine"] == nil || got.MCPServers["new"] == nil || got.MCPServers["shared"]["command"] != "local" {
+		t.Fatalf("prepared = %s", prepared)
+	}
+
+	hooksFile := filepath.Join(dir, "team-settings.json")
+	if err := os.WriteFile(hooksFile, []byte(`{"hooks":{"Stop":[{"hooks":[{"type":"command","command":"say local"}]}]}}`), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	engine.hooksStrategy = "keep"
+	item = config.SyncItem{Name: "team", LocalPath: hooksFile, Type: "file", MergeRules: map[string]string{"hooks": "hooks"}}
+	prepared, _, err = engine.prepareWriteContent(item, `{"model":"x","hooks":{"Stop":[{"hooks":[{"type":"command","command":"say remote"}]}]}}`)
+	if err != nil {
+		t.Fatalf("prepareWriteContent: %v", err)
+	}
+	if !strings.Contains(prepared, "say local") || strings.Contains(prepared, "say remote") || !strings.Contains(prepared, `"x"`) {
+		t.Fatalf("hooks not kept:\n%s", prepared)
+	}
+}
+
+func TestPushKeepsUnmappedRemoteProjects(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".claude.json")
+	item := config.SyncItem{Name: "claude-json", LocalPath: path, GistFile: "claude.json", Type: "file", Enabled: true}
+	engine := &Engine{
+		cfg:            &config.Config{SyncItems: []config.SyncItem{item}},
+		projectRemotes: map[string]string{"/Users/alice/web": "github.com/acme/web", "/Users/alice/old": "github.com/acme/old"},
+	}
+
+	local := `{"projects": {"` + dir + `": {"mcpServers": {}}}}`
+	remote := `{"projects": {"/Users/alice/web": {"mcpServers": {"browser": {"command": "chrome"}}}}}`
+	content, err := engine.keepRemoteProjects(local, remote)
+	if err != nil {
+		t.Fatalf("keepRemoteProjects: %v", err)
+	}
+	if !strings.Contains(content, "/Users/alice/web") || !strings.Contains(content, "chrome") {
+		t.Fatalf("other machine's project erased:\n%s", content)
+	}
+
+	// 只保留仍在 Gist 中的项目的 git remote
+	remotes := engine.pushedProjectRemotes(engine.projectRemotes, map[string]string{"claude.json": content})
+	want := map[string]string{"/Users/alice/web": "github.com/acme/web"}
+	if !reflect.DeepEqual(remotes, want) {
+		t.Fatalf("remotes = %v, want %v", remotes, want)
+	}
+}
+
+func TestApplyKeyChoicesPerKey(t *testing.T) {
+	old := `{"model": "opus", "env": {"A": "1"}, "theme": "dark"}`
+	updated := `{"model": "sonnet", "env": {"A": "2"}, "extra": true}`
+
+	changes, ok := changedJSONKeys(old, updated)
+	if !ok {
+		t.Fatalf("changedJSONKeys: not JSON objects")
+	}
+	var keys []string
+	for _, c := range changes {
+		keys = append(keys, c.key)
+	}
+	if want := []string{"model", "env", "extra", "theme"}; !reflect.DeepEqual(keys, want) {
+		t.Fatalf("keys = %v, want %v", keys, want)
+	}
+
+	// model 用远端，env 保留本地，extra 手动删除，theme 保留本地
+	choices := []tui.Entry{
+		{Local: changes[0].local, Remote: changes[0].remote, Choice: tui.ChoiceRemote},
+		{Local: changes[1].local, Remote: changes[1].remote, Choice: tui.ChoiceLocal},
+		{Local: changes[2].local, Remote: changes[2].remote, Choice: tui.ChoiceEdited, Edited: ""},
+		{Local: changes[3].local, Remote: changes[3].remote, Choice: tui.ChoiceLocal},
+	}
+	content, keepLocal, err := applyKeyChoices(old, updated, choices)
+	if err != nil || keepLocal {
+		t.Fatalf("applyKeyChoices: keepLocal=%v err=%v", keepLocal, err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(content), &got); err != nil {
+		t.Fatalf("unmarshal %s: %v", content, err)
+	}
+	want := map[string]interface{}{"model": "sonnet", "env": map[string]interface{}{"A": "1"}, "theme": "dark"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("content = %v, want %v", got, want)
+	}
+
+	for i := range choices {
+		choices[i].Choice = tui.ChoiceLocal
+	}
+	if _, keepLocal, _ := applyKeyChoices(old, updated, choices); !keepLocal {
+		t.Fatalf("keepLocal = false when every key kept local")
+	}
+}
+
+func TestPrepareWriteContentRemoteMCPServersPreservesLocalFields(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".claude.json")
+	local := `{
+  "model": "local",
+  "other": "keep",
+  "mcpServers": {
+    "local": {"url": "https://local"},
+    "keep": {"url": "https://keep"}
+  },
+  "projects": {
+    "/work/a": {
+      "mcpServers": {
+        "project": {"url": "https://project"}
+      }
+    }
+  }
+}`
+	if err := os.WriteFile(path, []byte(local), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	remote := `{
+  "model": "remote",
+  "mcp": {"enabled": true},
+  "mcpServers": {
+    "local": {"url": "https://remote"}
+  }
+}`
+
+	engine := &Engine{mergeStrategy: "remote", autoYes: true}
+	item := config.SyncItem{
+		Name:       "claude-json",
+		LocalPath:  path,
+		Type:       "file",
+		Filter:     &config.FilterConfig{IncludeFields: []string{"model", "mcp", "mcpServers", config.ProjectMCPField}},
+		MergeRules: config.DefaultClaudeJSONMergeRules(),
+	}
+	prepared, _, err := engine.prepareWriteContent(item, remote)
+	if err != nil {
+		t.Fatalf("prepareWriteContent: %v", err)
+	}
+
+	var prefs map[string]interface{}
+	if err := json.Unmarshal([]byte(prepared), &prefs); err != nil {
+		t.Fatalf("unmarshal %s: %v", prepared, err)
+	}
+	if prefs["model"] != "remote" || prefs["other"] != "keep" || prefs["mcp"] == nil {
+		t.Fatalf("prepared = %s", prepared)
+	}
+	servers, _ := prefs["mcpServers"].(map[string]interface{})
+	if servers == nil || servers["local"] == nil {
+		t.Fatalf("mcpServers.local missing after merge: %v", servers)
+	}
+	if _, exists := servers["keep"]; exists {
+		t.Fatalf("mcpServers.keep should be removed on remote strategy: %v", servers)
+	}
+	projects, _ := prefs["projects"].(map[string]interface{})
+	if projects == nil || projects["/work/a"] == nil {
+		t.Fatalf("projects should be preserved: %v", projects)
+	}
+}
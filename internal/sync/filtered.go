@@ -0,0 +1,140 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/yxuechao007/claude_sync/internal/config"
+	"github.com/yxuechao007/claude_sync/internal/filter"
+)
+
+// Actions reported in ItemStatus.Filtered
+const (
+	FilterFiltered = "filtered" // 不在 include_fields 中或命中 exclude_fields，未上传
+	FilterExcluded = "excluded" // 设备特定内容，local_actions 为 exclude，未上传
+	FilterWarned   = "warned"   // 设备特定内容，照常上传
+)
+
+// FilteredPath is a part of a local item that push left out or flagged
+type FilteredPath struct {
+	Path   string `json:"path"`
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+}
+
+// String formats a filtered path for display
+func (f FilteredPath) String() string {
+	return fmt.Sprintf("%s %s (%s)", f.Action, f.Path, f.Reason)
+}
+
+// MarshalJSON renders the status with the error as a message
+func (s ItemStatus) MarshalJSON() ([]byte, error) {
+	out := struct {
+		Name       string         `json:"name"`
+		Status     SyncStatus     `json:"status"`
+		LocalHash  string         `json:"local_hash,omitempty"`
+		RemoteHash string         `json:"remote_hash,omitempty"`
+		LocalPath  string         `json:"local_path"`
+		GistFile   string         `json:"gist_file"`
+		Error      string         `json:"error,omitempty"`
+		Filtered   []FilteredPath `json:"filtered,omitempty"`
+	}{
+		Name:       s.Name,
+		Status:     s.Status,
+		LocalHash:  s.LocalHash,
+		RemoteHash: s.RemoteHash,
+		LocalPath:  s.LocalPath,
+		GistFile:   s.GistFile,
+		Filtered:   s.Filtered,
+	}
+	if s.Error != nil {
+		out.Error = s.Error.Error()
+	}
+	return json.Marshal(out)
+}
+
+// filterRemovals describes the values item.Filter drops from data
+func filterRemovals(item config.SyncItem, data []byte) ([]FilteredPath, error) {
+	removals, err := filter.FilterRemovals(data, item.Filter)
+	if err != nil {
+		return nil, err
+	}
+	var paths []FilteredPath
+	for _, r := range removals {
+		paths = append(paths, FilteredPath{Path: r.Path, Action: FilterFiltered, Reason: r.Reason})
+	}
+	return paths, nil
+}
+
+// findingPaths describes machine-specific findings, dropping ignored ones
+func findingPaths(findings []filter.Finding) []FilteredPath {
+	var paths []FilteredPath
+	for _, f := range findings {
+		action := FilterWarned
+		switch f.Action {
+		case filter.ActionExclude:
+			action = FilterExcluded
+		case filter.ActionIgnore:
+			continue
+		}
+		reason := fmt.Sprintf("machine-specific %q (%s)", f.Match, f.Pattern)
+		paths = append(paths, FilteredPath{Path: f.Path, Action: action, Reason: reason})
+	}
+	return paths
+}
+
+func (e *Engine) recordFiltered(name string, paths []FilteredPath) {
+	if e.filtered == nil {
+		e.filtered = make(map[string][]FilteredPath)
+	}
+	// 没有过滤内容时也记录，表示本次已读取过该条目
+	e.filtered[name] = paths
+}
+
+// filteredFor returns what push leaves out of item, reading the local
+// content when it has not been read during this push
+func (e *Engine) filteredFor(item config.SyncItem) []FilteredPath {
+	if _, ok := e.filtered[item.Name]; !ok {
+		if _, _, err := e.getLocalContent(item); err != nil {
+			return nil
+		}
+	}
+	return e.filtered[item.Name]
+}
+
+// maxFilteredPaths limits the paths shown per reason by FormatFiltered
+const maxFilteredPaths = 5
+
+// FormatFiltered groups filtered paths by action and reason for display,
+// one line per group
+func FormatFiltered(paths []FilteredPath) []string {
+	type group struct {
+		action, reason string
+		paths          []string
+	}
+	var groups []*group
+	index := make(map[string]*group)
+	for _, p := range paths {
+		key := p.Action + "\x00" + p.Reason
+		g, ok := index[key]
+		if !ok {
+			g = &group{action: p.Action, reason: p.Reason}
+			index[key] = g
+			groups = append(groups, g)
+		}
+		g.paths = append(g.paths, p.Path)
+	}
+
+	lines := make([]string, 0, len(groups))
+	for _, g := range groups {
+		shown := g.paths
+		more := ""
+		if len(shown) > maxFilteredPaths {
+			more = fmt.Sprintf(" and %d more", len(shown)-maxFilteredPaths)
+			shown = shown[:maxFilteredPaths]
+		}
+		lines = append(lines, fmt.Sprintf("%s %s%s (%s)", g.action, strings.Join(shown, ", "), more, g.reason))
+	}
+	return lines
+}
@@ -0,0 +1,345 @@
+package sync
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yxuechao007/claude_sync/internal/archive"
+	"github.com/yxuechao007/claude_sync/internal/config"
+	"github.com/yxuechao007/claude_sync/internal/diff"
+	"github.com/yxuechao007/claude_sync/internal/gist"
+)
+
+// DiffTarget selects which two versions of an item are compared
+type DiffTarget string
+
+const (
+	// DiffPull compares local content with what pull would write
+	DiffPull DiffTarget = "pull"
+	// DiffRemote compares remote content with what push would upload
+	DiffRemote DiffTarget = "remote"
+	// DiffBase compares the last-synced content with what push would upload
+	DiffBase DiffTarget = "base"
+	// DiffRevision compares a gist revision with what push would upload
+	DiffRevision DiffTarget = "revision"
+)
+
+// FileChange is a change to one file inside a directory archive
+type FileChange struct {
+	Path       string
+	Kind       diff.ChangeKind
+	OldContent string
+	NewContent string
+	Binary     bool
+}
+
+// ItemDiff holds the two sides of a diff for one sync item
+type ItemDiff struct {
+	Name       string
+	LocalPath  string
+	Type       string
+	OldLabel   string
+	NewLabel   string
+	OldContent string
+	NewContent string
+	Files      []FileChange // 仅目录类型
+	Missing    string       // 无法比较时的原因
+}
+
+// Diff computes diffs for the named item (or all enabled items when name is empty)
+// rev is only used with DiffRevision.
+func (e *Engine) Diff(name string, target DiffTarget, rev string) ([]ItemDiff, error) {
+	var items []config.SyncItem
+	if name == "" {
+		items = e.cfg.GetEnabledItems()
+	} else {
+		item := e.findItem(name)
+		if item == nil {
+			return nil, fmt.Errorf("unknown sync item: %s", name)
+		}
+		items = []config.SyncItem{*item}
+	}
+
+	var remoteGist *gist.Gist
+	var err error
+	switch target {
+	case DiffPull, DiffRemote:
+		remoteGist, err = e.client.Get(e.cfg.GistID)
+	case DiffRevision:
+		if rev == "" {
+			return nil, fmt.Errorf("revision is required")
+		}
+		remoteGist, err = e.client.GetRevision(e.cfg.GistID, rev)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gist: %w", err)
+	}
+	return e.diffItems(items, target, rev, remoteGist)
+}
+
+// diffItems computes the diffs of items against a fetched gist
+func (e *Engine) diffItems(items []config.SyncItem, target DiffTarget, rev string, remoteGist *gist.Gist) ([]ItemDiff, error) {
+	if err := e.loadLedgers(remoteGist); err != nil {
+		return nil, err
+	}
+	e.loadProjectRemotes(remoteGist)
+
+	// pull 只写入远端领先（或冲突时强制覆盖）的条目，预览使用相同的状态判断
+	var pullStatus map[string]SyncStatus
+	if target == DiffPull {
+		statuses, _, err := e.getStatusWithRemote(remoteGist)
+		if err != nil {
+			return nil, err
+		}
+		pullStatus = make(map[string]SyncStatus, len(statuses))
+		for _, status := range statuses {
+			pullStatus[status.Name] = status.Status
+		}
+	}
+
+	// 预览不应触发交互式冲突询问；冲突时与 pull -y 一样保留本地
+	autoYes := e.autoYes
+	e.autoYes = true
+	defer func() { e.autoYes = autoYes }()
+
+	var diffs []ItemDiff
+	for _, item := range items {
+		if status, ok := pullStatus[item.Name]; ok && status != StatusRemoteAhead && status != StatusConflict {
+			diffs = append(diffs, ItemDiff{
+				Name:      item.Name,
+				LocalPath: item.LocalPath,
+				Type:      item.Type,
+				OldLabel:  "local",
+				NewLabel:  "pull",
+				Missing:   notPulledReason(status),
+			})
+			continue
+		}
+		d, err := e.diffItem(item, target, rev, remoteGist)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", item.Name, err)
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs, nil
+}
+
+// notPulledReason explains why pull leaves an item with status alone
+func notPulledReason(status SyncStatus) string {
+	switch status {
+	case StatusSynced:
+		return "not pulled (in sync)"
+	case StatusLocalAhead:
+		return "not pulled (local ahead)"
+	case StatusNew:
+		return "not pulled (not in gist yet)"
+	}
+	return fmt.Sprintf("not pulled (%s)", status)
+}
+
+func (e *Engine) diffItem(item config.SyncItem, target DiffTarget, rev string, remoteGist *gist.Gist) (ItemDiff, error) {
+	d := ItemDiff{Name: item.Name, LocalPath: item.LocalPath, Type: item.Type}
+
+	localPath, err := config.ExpandPath(item.LocalPath)
+	if err != nil {
+		return d, err
+	}
+
+	if target == DiffPull {
+		d.OldLabel = "local"
+		d.NewLabel = "pull"
+		remoteFile, exists := remoteGist.Files[item.GistFile]
+		if !exists {
+			d.Missing = "remote file does not exist"
+			return d, nil
+		}
+
+		if item.Type == "directory" {
+			local, _, err := e.getLocalContent(item)
+			if err != nil {
+				return d, err
+			}
+			prepared, skip, err := e.prepareWriteContent(item, remoteFile.Content)
+			if err != nil {
+				return d, err
+			}
+			if skip {
+				prepared = ""
+			}
+			// 解包时会保留本地已有但归档中没有的文件
+			d.Files, err = diffArchives(local, prepared, true)
+			return d, err
+		}
+
+		if data, err := e.readLocalFile(localPath); err == nil {
+			d.OldContent = string(data)
+		}
+		d.NewContent = d.OldContent
+		if remoteFile.Content == "" {
+			return d, nil
+		}
+		prepared, skip, err := e.prepareWriteContent(item, remoteFile.Content)
+		if err != nil {
+			return d, err
+		}
+		if !skip {
+			d.NewContent = prepared
+		}
+		return d, nil
+	}
+
+	local, _, err := e.getLocalContent(item)
+	if err != nil {
+		return d, err
+	}
+	d.NewLabel = "local"
+
+	var old string
+	switch target {
+	case DiffRemote, DiffRevision:
+		d.OldLabel = "remote"
+		if target == DiffRevision {
+			d.OldLabel = "rev " + rev
+		}
+		remoteFile, exists := remoteGist.Files[item.GistFile]
+		if !exists {
+			d.Missing = "file does not exist in " + d.OldLabel
+			return d, nil
+		}
+		old = remoteFile.Content
+	case DiffBase:
+		d.OldLabel = "base"
+		base, ok, err := config.LoadBase(item.Name)
+		if err != nil {
+			return d, err
+		}
+		if !ok {
+			d.Missing = "no last-synced base recorded yet"
+			return d, nil
+		}
+		old = base
+	default:
+		return d, fmt.Errorf("unknown diff target: %s", target)
+	}
+
+	if item.Type == "directory" {
+		d.Files, err = diffArchives(old, local, false)
+		return d, err
+	}
+	d.OldContent = old
+	d.NewContent = local
+	return d, nil
+}
+
+// diffArchives lists per-file changes between two encoded directory archives.
+// With overlay, files only in old are kept (as UnpackDirectory does).
+func diffArchives(oldEncoded, newEncoded string, overlay bool) ([]FileChange, error) {
+	oldFiles, err := archive.ReadArchive(oldEncoded)
+	if err != nil {
+		return nil, err
+	}
+	newFiles, err := archive.ReadArchive(newEncoded)
+	if err != nil {
+		return nil, err
+	}
+	if overlay {
+		for path, content := range oldFiles {
+			if _, ok := newFiles[path]; !ok {
+				newFiles[path] = content
+			}
+		}
+	}
+
+	paths := make(map[string]bool)
+	for path := range oldFiles {
+		paths[path] = true
+	}
+	for path := range newFiles {
+		paths[path] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	var changes []FileChange
+	for _, path := range sorted {
+		oldContent, inOld := oldFiles[path]
+		newContent, inNew := newFiles[path]
+		change := FileChange{
+			Path:       path,
+			OldContent: string(oldContent),
+			NewContent: string(newContent),
+			Binary:     isBinary(oldContent) || isBinary(newContent),
+		}
+		switch {
+		case !inOld:
+			change.Kind = diff.ChangeAdded
+		case !inNew:
+			change.Kind = diff.ChangeRemoved
+		case string(oldContent) != string(newContent):
+			change.Kind = diff.ChangeModified
+		default:
+			continue
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+func isBinary(data []byte) bool {
+	return !utf8.Valid(data) || strings.ContainsRune(string(data), 0)
+}
+
+// HasChanges reports whether the diff contains any difference
+func (d ItemDiff) HasChanges() bool {
+	if d.Missing != "" {
+		return false
+	}
+	if d.Type == "directory" {
+		return len(d.Files) > 0
+	}
+	return d.OldContent != d.NewContent
+}
+
+// FormatItemDiff renders an item diff for display
+func FormatItemDiff(d ItemDiff, mode diff.Mode, color bool) string {
+	var sb strings.Builder
+	header := fmt.Sprintf("=== %s (%s) %s → %s ===", d.Name, d.LocalPath, d.OldLabel, d.NewLabel)
+	if color {
+		header = GetStatusColor(StatusRemoteAhead) + header + ColorReset
+	}
+	sb.WriteString(header + "\n")
+
+	if d.Missing != "" {
+		sb.WriteString("  " + d.Missing + "\n")
+		return sb.String()
+	}
+	if !d.HasChanges() {
+		sb.WriteString("  no changes\n")
+		return sb.String()
+	}
+
+	if d.Type != "directory" {
+		sb.WriteString(diff.RenderDiff(d.OldContent, d.NewContent, mode, color))
+		return sb.String()
+	}
+
+	for _, f := range d.Files {
+		symbol := map[diff.ChangeKind]string{
+			diff.ChangeAdded:    "+",
+			diff.ChangeRemoved:  "-",
+			diff.ChangeModified: "~",
+		}[f.Kind]
+		sb.WriteString(fmt.Sprintf("%s %s\n", symbol, f.Path))
+		if f.Binary {
+			sb.WriteString("  (binary file)\n")
+			continue
+		}
+		sb.WriteString(diff.RenderDiff(f.OldContent, f.NewContent, mode, color))
+	}
+	return sb.String()
+}
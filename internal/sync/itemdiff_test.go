@@ -0,0 +1,130 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yxuechao007/claude_sync/internal/archive"
+	"github.com/yxuechao007/claude_sync/internal/config"
+	"github.com/yxuechao007/claude_sync/internal/diff"
+	"github.com/yxuechao007/claude_sync/internal/gist"
+)
+
+func packFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("write file: %v", err)
+		}
+	}
+	encoded, err := archive.PackDirectory(dir)
+	if err != nil {
+		t.Fatalf("pack: %v", err)
+	}
+	return encoded
+}
+
+func TestDiffArchivesListsFileChanges(t *testing.T) {
+	oldArchive := packFiles(t, map[string]string{
+		"a.md":     "same",
+		"b.md":     "old",
+		"gone.md":  "x",
+		"sub/c.md": "c",
+	})
+	newArchive := packFiles(t, map[string]string{
+		"a.md":     "same",
+		"b.md":     "new",
+		"sub/c.md": "c",
+		"sub/d.md": "d",
+	})
+
+	changes, err := diffArchives(oldArchive, newArchive, false)
+	if err != nil {
+		t.Fatalf("diffArchives: %v", err)
+	}
+
+	got := make(map[string]diff.ChangeKind)
+	for _, c := range changes {
+		got[c.Path] = c.Kind
+	}
+	want := map[string]diff.ChangeKind{
+		"b.md":     diff.ChangeModified,
+		"gone.md":  diff.ChangeRemoved,
+		"sub/d.md": diff.ChangeAdded,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("changes = %v, want %v", got, want)
+	}
+	for path, kind := range want {
+		if got[path] != kind {
+			t.Fatalf("change[%s] = %q, want %q", path, got[path], kind)
+		}
+	}
+}
+
+func TestDiffArchivesOverlayKeepsLocalFiles(t *testing.T) {
+	local := packFiles(t, map[string]string{"local-only.md": "keep"})
+	remote := packFiles(t, map[string]string{"remote.md": "new"})
+
+	changes, err := diffArchives(local, remote, true)
+	if err != nil {
+		t.Fatalf("diffArchives: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Path != "remote.md" || changes[0].Kind != diff.ChangeAdded {
+		t.Fatalf("changes = %+v, want only remote.md added", changes)
+	}
+}
+
+func TestDiffPullSkipsItemsPullLeavesAlone(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	write := func(name, content string) string {
+		path := filepath.Join(home, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("write file: %v", err)
+		}
+		return path
+	}
+	items := []config.SyncItem{
+		{Name: "synced", LocalPath: write("synced.json", `{"a":1}`), GistFile: "synced.json", Enabled: true, Type: "file"},
+		{Name: "ahead", LocalPath: write("ahead.json", `{"a":"new"}`), GistFile: "ahead.json", Enabled: true, Type: "file"},
+		{Name: "behind", LocalPath: write("behind.json", `{"a":"old"}`), GistFile: "behind.json", Enabled: true, Type: "file"},
+	}
+	engine := &Engine{
+		cfg: &config.Config{SyncItems: items},
+		state: &config.SyncState{
+			Version: 2,
+			Items: map[string]config.ItemState{
+				"synced": {LocalHash: calculateHash(`{"a":1}`), RemoteHash: calculateHash(`{"a":1}`)},
+				"ahead":  {LocalHash: calculateHash(`{"a":"old"}`), RemoteHash: calculateHash(`{"a":"old"}`)},
+				"behind": {LocalHash: calculateHash(`{"a":"old"}`), RemoteHash: calculateHash(`{"a":"old"}`)},
+			},
+		},
+	}
+	remoteGist := &gist.Gist{Files: map[string]gist.GistFile{
+		"synced.json": {Content: `{"a":1}`},
+		"ahead.json":  {Content: `{"a":"old"}`},
+		"behind.json": {Content: `{"a":"new"}`},
+		syncMetaFile:  {Content: `{"version":2,"repo":"` + config.RepoURL + `"}`},
+	}}
+
+	diffs, err := engine.diffItems(items, DiffPull, "", remoteGist)
+	if err != nil {
+		t.Fatalf("diffItems: %v", err)
+	}
+	if diffs[0].Missing != "not pulled (in sync)" || diffs[1].Missing != "not pulled (local ahead)" {
+		t.Fatalf("missing = %q, %q", diffs[0].Missing, diffs[1].Missing)
+	}
+	if diffs[1].HasChanges() {
+		t.Fatalf("local-ahead item reported as a pull change")
+	}
+	if !diffs[2].HasChanges() || diffs[2].NewContent != `{"a":"new"}` {
+		t.Fatalf("remote-ahead diff = %+v", diffs[2])
+	}
+}
@@ -0,0 +1,136 @@
+package sync
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/yxuechao007/claude_sync/internal/config"
+	"github.com/yxuechao007/claude_sync/internal/gist"
+	"github.com/yxuechao007/claude_sync/internal/ledger"
+	"github.com/yxuechao007/claude_sync/internal/merge"
+)
+
+// syncedSetRules returns the item's merge rules using the synced-set strategy
+func syncedSetRules(item config.SyncItem) map[string]string {
+	var rules map[string]string
+	for path, strategy := range item.MergeRules {
+		if strategy == string(merge.SyncedSet) {
+			if rules == nil {
+				rules = make(map[string]string)
+			}
+			rules[path] = strategy
+		}
+	}
+	return rules
+}
+
+// loadLedgers reads the shared ledger from the gist and the local copy
+// recorded at the last sync
+func (e *Engine) loadLedgers(remoteGist *gist.Gist) error {
+	content := ""
+	if remoteGist != nil {
+		if file, ok := remoteGist.Files[ledger.GistFile]; ok {
+			content = file.Content
+		}
+	}
+	remote, err := ledger.Parse(content)
+	if err != nil {
+		return err
+	}
+	synced, err := ledger.LoadSynced()
+	if err != nil {
+		return err
+	}
+	e.remoteLedger, e.syncedLedger = remote, synced
+	e.ledgerChanged = false
+	return nil
+}
+
+// device names this machine in the ledger history
+func (e *Engine) device() string {
+	if e.cfg == nil {
+		return "unknown"
+	}
+	return e.cfg.Device()
+}
+
+// ensureLedgers lazily loads empty ledgers for callers that did not fetch them
+func (e *Engine) ensureLedgers() {
+	if e.remoteLedger == nil || e.syncedLedger == nil {
+		if err := e.loadLedgers(nil); err != nil {
+			e.remoteLedger, e.syncedLedger = ledger.New(), ledger.New()
+		}
+	}
+}
+
+// pullSetFunc resolves synced-set paths on pull: the remote ledger plus the
+// local adds/removes made since the last sync decide which entries remain.
+func (e *Engine) pullSetFunc(item config.SyncItem) merge.SetFunc {
+	e.ensureLedgers()
+	return func(path string, local, remote []interface{}) []interface{} {
+		key := ledger.SetKey(item.Name, path)
+		localValues, remoteValues := ledger.Strings(local), ledger.Strings(remote)
+
+		// 远端数组中 ledger 未记录的条目视为已存在（旧版本客户端写入）
+		e.remoteLedger.Bootstrap(key, remoteValues)
+		e.ledgerChanged = true
+
+		// 本地尚未 push 的增删只参与本次结果，不写入 synced ledger
+		merged := e.remoteLedger.Clone()
+		merged.Apply(e.syncedLedger, key, localValues, e.device(), time.Now().UTC())
+
+		var result []interface{}
+		for _, value := range merged.Present(key, localValues, remoteValues) {
+			result = append(result, value)
+		}
+		return appendNonStrings(result, local, remote)
+	}
+}
+
+// recordLedgerChanges records the local adds/removes of an item's synced-set
+// paths into the remote ledger before push
+func (e *Engine) recordLedgerChanges(item config.SyncItem, content string, remoteGist *gist.Gist) error {
+	rules := syncedSetRules(item)
+	if len(rules) == 0 {
+		return nil
+	}
+	e.ensureLedgers()
+
+	remoteContent := "{}"
+	if file, ok := remoteGist.Files[item.GistFile]; ok && json.Valid([]byte(file.Content)) {
+		remoteContent = file.Content
+	}
+
+	now := time.Now().UTC()
+	record := func(path string, local, remote []interface{}) []interface{} {
+		key := ledger.SetKey(item.Name, path)
+		e.remoteLedger.Bootstrap(key, ledger.Strings(remote))
+		e.remoteLedger.Apply(e.syncedLedger, key, ledger.Strings(local), e.device(), now)
+		e.ledgerChanged = true
+		return local
+	}
+	_, _, err := merge.Apply([]byte(content), []byte(remoteContent), rules, merge.Options{Set: record})
+	return err
+}
+
+// appendNonStrings keeps array elements the ledger cannot track (non-strings)
+func appendNonStrings(result []interface{}, lists ...[]interface{}) []interface{} {
+	seen := make(map[string]bool)
+	for _, list := range lists {
+		for _, v := range list {
+			if _, ok := v.(string); ok {
+				continue
+			}
+			data, _ := json.Marshal(v)
+			if seen[string(data)] {
+				continue
+			}
+			seen[string(data)] = true
+			result = append(result, v)
+		}
+	}
+	if result == nil {
+		result = []interface{}{}
+	}
+	return result
+}
@@ -11,6 +11,8 @@ import (
 	"time"
 
 	"github.com/yxuechao007/claude_sync/internal/config"
+	"github.com/yxuechao007/claude_sync/internal/jsondoc"
+	"github.com/yxuechao007/claude_sync/internal/merge"
 )
 
 var mcpKeys = []string{"mcp", "mcpServers"}
@@ -149,7 +151,7 @@ func (e *Engine) SyncMCPOnInit() error {
 	}
 
 	for _, write := range writes {
-		if err := e.writeLocalContent(write.item, write.content, true); err != nil {
+		if err := e.writeLocalContent(write.item, write.content); err != nil {
 			return fmt.Errorf("failed to write %s: %w", write.item.LocalPath, err)
 		}
 	}
@@ -180,7 +182,7 @@ func (e *Engine) SyncMCPOnInit() error {
 
 func isMCPItem(item config.SyncItem) bool {
 	base := filepath.Base(item.LocalPath)
-	if item.Name == "settings" || item.Name == "claude-json" {
+	if hasMergeStrategy(item, merge.MCPServers) {
 		return true
 	}
 	if base == "settings.json" || base == ".claude.json" {
@@ -215,7 +217,7 @@ func parseJSONMap(data []byte) (map[string]interface{}, error) {
 }
 
 func marshalJSON(v interface{}) ([]byte, error) {
-	return json.MarshalIndent(v, "", "  ")
+	return jsondoc.MarshalIndent(v)
 }
 
 func cloneJSONMap(src map[string]interface{}) (map[string]interface{}, error) {
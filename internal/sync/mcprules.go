@@ -0,0 +1,112 @@
+package sync
+
+import (
+	"github.com/yxuechao007/claude_sync/internal/config"
+	"github.com/yxuechao007/claude_sync/internal/mcp"
+	"github.com/yxuechao007/claude_sync/internal/merge"
+)
+
+// hasMergeStrategy reports whether one of the item's merge_rules uses strategy
+func hasMergeStrategy(item config.SyncItem, strategy merge.Strategy) bool {
+	for _, s := range item.MergeRules {
+		if s == string(strategy) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeMCPServers implements the mcp-servers merge rule: every matched
+// server table is merged by server name with the pull's conflict strategy,
+// and the conflicting fields of all tables are reviewed together
+func (e *Engine) mergeMCPServers(values []merge.Value) ([]interface{}, error) {
+	tables := make([]mcp.ServerTable, len(values))
+	for i, v := range values {
+		local, _ := v.Local.(map[string]interface{})
+		remote, _ := v.Remote.(map[string]interface{})
+		tables[i] = mcp.ServerTable{Scope: v.Path, Local: local, Remote: remote}
+	}
+
+	resolved, err := mcp.MergeServerTables(tables, e.GetMergeStrategy(), e.autoYes)
+	if err != nil {
+		return nil, err
+	}
+	merged := make([]interface{}, len(values))
+	for i, table := range resolved {
+		merged[i] = table
+		if tables[i].Local == nil && tables[i].Remote == nil {
+			// 不是对象时无法按 server 合并，沿用写入内容
+			merged[i] = values[i].Remote
+			if !values[i].InRemote {
+				merged[i] = values[i].Local
+			}
+		}
+	}
+	return merged, nil
+}
+
+// mcpPolicy returns the mcp_servers rules, none when there is no config
+func (e *Engine) mcpPolicy() config.MCPServerPolicy {
+	if e.cfg == nil {
+		return config.MCPServerPolicy{}
+	}
+	return e.cfg.MCPServerPolicy()
+}
+
+// pushedMCPContent copies the project MCP servers that are opted in to
+// promotion into the global ones and drops the servers whose local version
+// must not be uploaded according to the mcp_servers rules. Other project
+// servers stay project entries.
+func (e *Engine) pushedMCPContent(data []byte) ([]byte, error) {
+	policy := e.mcpPolicy()
+
+	promoted, changed, err := mcp.PromoteProjectMCPServers(data, policy.Promote)
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		data = promoted
+	}
+	if policy.Empty() {
+		return data, nil
+	}
+	stripped, _, err := mcp.RemoveServers(data, func(name string) bool { return !policy.Push(name) })
+	if err != nil {
+		return nil, err
+	}
+	return stripped, nil
+}
+
+// keepRemoteMCPServers puts the gist's version of servers that are not
+// pushed from this machine back into the upload, so that pull-only servers
+// and servers of other machines survive the push. sync: never servers stay
+// removed.
+func (e *Engine) keepRemoteMCPServers(content, remote string) (string, error) {
+	policy := e.mcpPolicy()
+	if policy.Empty() {
+		return content, nil
+	}
+	kept, _, err := mcp.OverlayServers([]byte(content), []byte(remote), func(name string) bool {
+		return !policy.Push(name) && !policy.Strip(name)
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(kept), nil
+}
+
+// keepLocalMCPServers replaces the servers that are not pulled onto this
+// machine with their local versions in pulled ~/.claude.json content
+func (e *Engine) keepLocalMCPServers(content string, existing []byte) string {
+	policy := e.mcpPolicy()
+	if policy.Empty() {
+		return content
+	}
+	kept, _, err := mcp.OverlayServers([]byte(content), existing, func(name string) bool {
+		return !policy.Pull(name)
+	})
+	if err != nil {
+		return content
+	}
+	return string(kept)
+}
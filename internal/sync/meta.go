@@ -12,6 +12,8 @@ const syncMetaFile = "claude_sync.meta.json"
 type syncMeta struct {
 	Version int    `json:"version"`
 	Repo    string `json:"repo,omitempty"`
+	// Projects 记录 push 设备上 ~/.claude.json 各项目的 git remote，用于跨设备匹配项目
+	Projects map[string]string `json:"projects,omitempty"`
 }
 
 func readSyncMeta(content string) (syncMeta, error) {
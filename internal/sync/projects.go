@@ -0,0 +1,112 @@
+package sync
+
+import (
+	"fmt"
+
+	"github.com/yxuechao007/claude_sync/internal/config"
+	"github.com/yxuechao007/claude_sync/internal/gist"
+	"github.com/yxuechao007/claude_sync/internal/mcp"
+)
+
+// loadProjectRemotes reads the git remotes recorded for the projects in the
+// gist, used to match projects across machines
+func (e *Engine) loadProjectRemotes(remoteGist *gist.Gist) {
+	e.projectRemotes = nil
+	if remoteGist == nil {
+		return
+	}
+	if metaFile, ok := remoteGist.Files[syncMetaFile]; ok {
+		if meta, err := readSyncMeta(metaFile.Content); err == nil {
+			e.projectRemotes = meta.Projects
+		}
+	}
+}
+
+// projectMapper maps project paths of other machines to this machine
+func (e *Engine) projectMapper() (*mcp.ProjectMapper, error) {
+	var mappings []config.ProjectMapping
+	matchRemote := false
+	if e.cfg != nil {
+		mappings = e.cfg.ProjectMappings
+		matchRemote = e.cfg.MatchGitRemote
+	}
+	return mcp.NewProjectMapper(mappings, e.projectRemotes, matchRemote)
+}
+
+// remapProjects maps the per-project entries of pulled ~/.claude.json
+// content to local project paths, dropping projects unknown on this machine
+func (e *Engine) remapProjects(content string, existing []byte) (string, error) {
+	mapper, err := e.projectMapper()
+	if err != nil {
+		return "", fmt.Errorf("failed to map projects: %w", err)
+	}
+	remapped, remaps, err := mcp.RemapProjects([]byte(content), existing, mapper)
+	if err != nil {
+		return "", fmt.Errorf("failed to map projects: %w", err)
+	}
+	e.projectRemaps = remaps
+	return string(remapped), nil
+}
+
+// keepRemoteProjects keeps the gist's projects that this machine does not
+// map in pushed ~/.claude.json content, and remembers them so their git
+// remotes stay recorded
+func (e *Engine) keepRemoteProjects(content, remote string) (string, error) {
+	mapper, err := e.projectMapper()
+	if err != nil {
+		return "", fmt.Errorf("failed to map projects: %w", err)
+	}
+	kept, paths, err := mcp.KeepUnmappedProjects([]byte(content), []byte(remote), mapper)
+	if err != nil {
+		return "", fmt.Errorf("failed to keep remote projects: %w", err)
+	}
+	for _, path := range paths {
+		if e.keptProjects == nil {
+			e.keptProjects = make(map[string]bool)
+		}
+		e.keptProjects[path] = true
+	}
+	return string(kept), nil
+}
+
+// ProjectRemaps returns how pulled projects were mapped to local paths
+// during the last pull; entries with an empty To were skipped
+func (e *Engine) ProjectRemaps() []mcp.ProjectRemap {
+	return e.projectRemaps
+}
+
+// pushedProjectRemotes returns the git remotes to record for the projects
+// in pushed claude-json content: this machine's remotes plus the recorded
+// ones of the projects kept from the gist. The recorded remotes stay as they
+// are when no ~/.claude.json content is pushed.
+func (e *Engine) pushedProjectRemotes(recorded map[string]string, updates map[string]string) map[string]string {
+	for _, item := range e.cfg.GetEnabledItems() {
+		if !isClaudeJSON(item) {
+			continue
+		}
+		content, ok := updates[item.GistFile]
+		if !ok {
+			continue
+		}
+		remotes := mcp.ProjectRemotes([]byte(content))
+		for path, url := range recorded {
+			if !e.keptProjects[path] {
+				continue
+			}
+			if remotes == nil {
+				remotes = make(map[string]string)
+			}
+			remotes[path] = url
+		}
+		return remotes
+	}
+	return recorded
+}
+
+func isClaudeJSON(item config.SyncItem) bool {
+	localPath, err := config.ExpandPath(item.LocalPath)
+	if err != nil {
+		return false
+	}
+	return shouldMergeProjectMCP(item, localPath)
+}
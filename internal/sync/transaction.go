@@ -0,0 +1,159 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/yxuechao007/claude_sync/internal/config"
+	"github.com/yxuechao007/claude_sync/internal/fileutil"
+)
+
+// stagedWrite is one prepared local write waiting to be committed
+type stagedWrite struct {
+	item       config.SyncItem
+	localPath  string
+	oldContent string // 本地当前内容，用于 diff
+	newContent string // 准备写入的内容
+}
+
+// backup holds what was on disk before a staged write was applied
+type backup struct {
+	path    string
+	isDir   bool
+	existed bool
+	content []byte
+	dirCopy string // 目录备份的临时位置
+}
+
+// pullTransaction stages writes for several items and applies them
+// all-or-nothing: if any write fails the earlier ones are rolled back
+type pullTransaction struct {
+	writes  []stagedWrite
+	backups []backup
+}
+
+func (tx *pullTransaction) stage(w stagedWrite) {
+	tx.writes = append(tx.writes, w)
+}
+
+// commit applies all staged writes, restoring every target on failure
+func (tx *pullTransaction) commit(e *Engine) error {
+	for _, w := range tx.writes {
+		b, err := takeBackup(w.localPath, w.item.Type == "directory")
+		if err != nil {
+			return tx.abort(fmt.Errorf("failed to back up %s: %w", w.item.LocalPath, err))
+		}
+		tx.backups = append(tx.backups, b)
+
+		if err := e.writeLocalContent(w.item, w.newContent); err != nil {
+			return tx.abort(fmt.Errorf("failed to write %s: %w", w.item.LocalPath, err))
+		}
+	}
+	return nil
+}
+
+// abort rolls back and returns err annotated with the rollback outcome
+func (tx *pullTransaction) abort(err error) error {
+	if rbErr := tx.rollback(); rbErr != nil {
+		return fmt.Errorf("%w; rollback incomplete: %v", err, rbErr)
+	}
+	return fmt.Errorf("%w (local changes rolled back)", err)
+}
+
+// rollback restores all targets touched so far, newest first.
+// A target that cannot be restored keeps its previous content in a backup
+// whose path is part of the returned error.
+func (tx *pullTransaction) rollback() error {
+	var errs []error
+	for i := len(tx.backups) - 1; i >= 0; i-- {
+		b := &tx.backups[i]
+		if err := b.restore(); err != nil {
+			errs = append(errs, b.keep(err))
+		}
+	}
+	tx.cleanup()
+	return errors.Join(errs...)
+}
+
+// cleanup removes temporary directory backups
+func (tx *pullTransaction) cleanup() {
+	for _, b := range tx.backups {
+		if b.dirCopy != "" {
+			os.RemoveAll(b.dirCopy)
+		}
+	}
+	tx.backups = nil
+}
+
+func takeBackup(path string, isDir bool) (backup, error) {
+	b := backup{path: path, isDir: isDir}
+	if !isDir {
+		data, snap, err := fileutil.ReadFile(path)
+		if err != nil {
+			return b, err
+		}
+		b.existed = snap.Exists
+		b.content = data
+		return b, nil
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return b, nil
+		}
+		return b, err
+	}
+	b.existed = true
+	tmp, err := os.MkdirTemp("", "claude_sync-backup-*")
+	if err != nil {
+		return b, err
+	}
+	b.dirCopy = tmp
+	if err := fileutil.CopyDir(path, tmp); err != nil {
+		os.RemoveAll(tmp)
+		return b, err
+	}
+	return b, nil
+}
+
+// keep preserves the previous content of a target that could not be
+// restored and describes where it is
+func (b *backup) keep(err error) error {
+	if !b.existed {
+		return fmt.Errorf("failed to remove %s: %w", b.path, err)
+	}
+	if b.isDir {
+		// 不再清理临时备份，留给用户手动恢复
+		kept := b.dirCopy
+		b.dirCopy = ""
+		return fmt.Errorf("failed to restore %s (previous content kept in %s): %w", b.path, kept, err)
+	}
+	saved, saveErr := fileutil.Backup(b.path, b.content)
+	if saveErr != nil {
+		return fmt.Errorf("failed to restore %s: %w; %v", b.path, err, saveErr)
+	}
+	return fmt.Errorf("failed to restore %s (previous content saved to %s): %w", b.path, saved, err)
+}
+
+func (b backup) restore() error {
+	if !b.existed {
+		return os.RemoveAll(b.path)
+	}
+	if b.isDir {
+		return fileutil.ReplaceDir(b.path, func(staging string) error {
+			return fileutil.CopyDir(b.dirCopy, staging)
+		})
+	}
+	return fileutil.WriteFile(b.path, b.content, 0644)
+}
+
+// cloneState returns a copy of the sync state for rollback
+func cloneState(s *config.SyncState) config.SyncState {
+	clone := *s
+	clone.Items = make(map[string]config.ItemState, len(s.Items))
+	for name, item := range s.Items {
+		clone.Items[name] = item
+	}
+	return clone
+}
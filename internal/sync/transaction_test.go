@@ -0,0 +1,113 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/yxuechao007/claude_sync/internal/config"
+)
+
+func TestPullTransactionRollsBackOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	settingsPath := filepath.Join(dir, "settings.json")
+	if err := os.WriteFile(settingsPath, []byte(`{"a":"old"}`), 0600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	// 父路径是普通文件，写入必然失败
+	blocker := filepath.Join(dir, "blocker")
+	if err := os.WriteFile(blocker, []byte("x"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	badPath := filepath.Join(blocker, "claude.json")
+
+	tx := &pullTransaction{}
+	tx.stage(stagedWrite{
+		item:       config.SyncItem{Name: "settings", LocalPath: settingsPath, Type: "file"},
+		localPath:  settingsPath,
+		newContent: `{"a":"new"}`,
+	})
+	tx.stage(stagedWrite{
+		item:       config.SyncItem{Name: "claude-json", LocalPath: badPath, Type: "file"},
+		localPath:  badPath,
+		newContent: `{}`,
+	})
+
+	if err := tx.commit(&Engine{}); err == nil {
+		t.Fatalf("expected commit error, got nil")
+	}
+
+	data, err := os.ReadFile(settingsPath)
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	if string(data) != `{"a":"old"}` {
+		t.Fatalf("settings = %s, want rolled back to %s", data, `{"a":"old"}`)
+	}
+	info, _ := os.Stat(settingsPath)
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestPullTransactionRollbackRemovesNewFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "CLAUDE.md")
+
+	tx := &pullTransaction{}
+	tx.stage(stagedWrite{
+		item:       config.SyncItem{Name: "memory", LocalPath: path, Type: "file"},
+		localPath:  path,
+		newContent: "# memory",
+	})
+
+	if err := tx.commit(&Engine{}); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	tx.rollback()
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("file should be removed after rollback, stat err = %v", err)
+	}
+}
+
+func TestPullTransactionRollbackReportsUnrestoredFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "settings.json")
+	if err := os.WriteFile(path, []byte(`{"a":"old"}`), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	tx := &pullTransaction{}
+	tx.stage(stagedWrite{
+		item:       config.SyncItem{Name: "settings", LocalPath: path, Type: "file"},
+		localPath:  path,
+		newContent: `{"a":"new"}`,
+	})
+	if err := tx.commit(&Engine{}); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	// 目标被替换成非空目录，无法恢复
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(path, "x"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	err := tx.rollback()
+	if err == nil {
+		t.Fatalf("expected rollback error, got nil")
+	}
+	match := regexp.MustCompile(`previous content saved to (\S+)\)`).FindStringSubmatch(err.Error())
+	if match == nil {
+		t.Fatalf("error does not name the backup: %v", err)
+	}
+	data, readErr := os.ReadFile(match[1])
+	if readErr != nil || string(data) != `{"a":"old"}` {
+		t.Fatalf("backup = %q, %v", data, readErr)
+	}
+}
@@ -0,0 +1,366 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yxuechao007/claude_sync/internal/diff"
+)
+
+const (
+	colorRed     = "\033[31m"
+	colorGreen   = "\033[32m"
+	colorYellow  = "\033[33m"
+	colorCyan    = "\033[36m"
+	colorGray    = "\033[90m"
+	colorReverse = "\033[7m"
+	colorReset   = "\033[0m"
+)
+
+// Choice 表示用户对一个条目的选择
+type Choice int
+
+const (
+	ChoiceRemote Choice = iota // 使用远端
+	ChoiceLocal                // 保留本地
+	ChoiceEdited               // 使用手动编辑的内容
+)
+
+// Entry 是界面中可审阅的一个条目（同步项或 MCP server）
+type Entry struct {
+	Title    string // 列表中显示的名称
+	Local    string // 本地内容
+	Remote   string // 远端内容
+	Choice   Choice
+	Edited   string             // Choice 为 ChoiceEdited 时的内容
+	Editable bool               // 是否允许手动编辑
+	Validate func(string) error // 校验编辑结果，可为 nil
+}
+
+// Value 返回根据选择得到的最终内容
+func (e Entry) Value() string {
+	switch e.Choice {
+	case ChoiceLocal:
+		return e.Local
+	case ChoiceEdited:
+		return e.Edited
+	default:
+		return e.Remote
+	}
+}
+
+// Review 显示全屏审阅界面，用户可以逐个条目选择本地、远端或手动编辑，
+// 然后一次性应用。返回 false 表示用户取消。
+// 不在终端中运行时返回 ErrUnavailable，调用方应回退到逐行提示。
+func Review(title string, entries []Entry) (bool, error) {
+	if !Available() {
+		return false, ErrUnavailable
+	}
+	t, err := openTerminal()
+	if err != nil {
+		return false, err
+	}
+	defer t.leave()
+
+	s := &reviewState{title: title, entries: entries}
+	for {
+		s.draw(t)
+		key, err := t.readKey()
+		if err != nil {
+			return false, err
+		}
+
+		switch {
+		case key.Name == "up" || key.Rune == 'k':
+			s.move(-1)
+		case key.Name == "down" || key.Rune == 'j':
+			s.move(1)
+		case key.Name == "pgdn" || key.Rune == ' ':
+			s.scroll += 10
+		case key.Name == "pgup" || key.Rune == 'b':
+			s.scroll -= 10
+		case key.Rune == 'l':
+			entries[s.cursor].Choice = ChoiceLocal
+			s.move(1)
+		case key.Rune == 'r':
+			entries[s.cursor].Choice = ChoiceRemote
+			s.move(1)
+		case key.Rune == 'L':
+			setAll(entries, ChoiceLocal)
+		case key.Rune == 'R':
+			setAll(entries, ChoiceRemote)
+		case key.Rune == 'e':
+			s.edit(t)
+		case key.Rune == 'a' || key.Name == "enter":
+			return true, nil
+		case key.Rune == 'q' || key.Name == "esc":
+			return false, nil
+		}
+		if s.scroll < 0 {
+			s.scroll = 0
+		}
+	}
+}
+
+func setAll(entries []Entry, choice Choice) {
+	for i := range entries {
+		entries[i].Choice = choice
+	}
+}
+
+type reviewState struct {
+	title   string
+	entries []Entry
+	cursor  int
+	scroll  int    // diff 区域的滚动偏移
+	message string // 底部提示信息
+}
+
+func (s *reviewState) move(delta int) {
+	next := s.cursor + delta
+	if next < 0 || next >= len(s.entries) {
+		return
+	}
+	s.cursor = next
+	s.scroll = 0
+}
+
+// edit 暂时离开全屏界面，用 $EDITOR 编辑当前条目
+func (s *reviewState) edit(t *terminal) {
+	entry := &s.entries[s.cursor]
+	if !entry.Editable {
+		s.message = "该条目不支持手动编辑"
+		return
+	}
+
+	t.leave()
+	edited, err := editInEditor(entry.Value())
+	t.enter()
+	if err != nil {
+		s.message = fmt.Sprintf("编辑失败: %v", err)
+		return
+	}
+	if entry.Validate != nil {
+		if err := entry.Validate(edited); err != nil {
+			s.message = fmt.Sprintf("编辑内容无效: %v", err)
+			return
+		}
+	}
+	entry.Edited = edited
+	entry.Choice = ChoiceEdited
+	s.message = "已使用编辑后的内容"
+}
+
+func editInEditor(content string) (string, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	tmp, err := os.CreateTemp("", "claude_sync-edit-*.json")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	tmp.Close()
+
+	parts := strings.Fields(editor)
+	cmd := exec.Command(parts[0], append(parts[1:], tmp.Name())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (s *reviewState) draw(t *terminal) {
+	rows, cols := t.size()
+	var lines []string
+
+	lines = append(lines, fmt.Sprintf("%s %s (%d/%d) %s", colorReverse, s.title, s.cursor+1, len(s.entries), colorReset))
+
+	// 列表区域最多占屏幕的三分之一
+	listHeight := len(s.entries)
+	if max := rows / 3; listHeight > max {
+		listHeight = max
+	}
+	if listHeight < 1 {
+		listHeight = 1
+	}
+	start := s.cursor - listHeight/2
+	if start+listHeight > len(s.entries) {
+		start = len(s.entries) - listHeight
+	}
+	if start < 0 {
+		start = 0
+	}
+	for i := start; i < start+listHeight && i < len(s.entries); i++ {
+		entry := s.entries[i]
+		marker := "  "
+		if i == s.cursor {
+			marker = "> "
+		}
+		line := marker + choiceTag(entry.Choice) + " " + entry.Title
+		line = fit(line, cols)
+		if i == s.cursor {
+			line = colorReverse + line + colorReset
+		}
+		lines = append(lines, line)
+	}
+
+	half := (cols - 3) / 2
+	lines = append(lines, colorCyan+pad(" 本地", half)+" │ "+pad(" 远端 / 选择结果", half)+colorReset)
+
+	entry := s.entries[s.cursor]
+	right := entry.Remote
+	if entry.Choice == ChoiceEdited {
+		right = entry.Edited
+	}
+	diffRows := diff.SideBySide(diff.LineDiff(diff.SplitLines(entry.Local), diff.SplitLines(right)))
+
+	diffHeight := rows - len(lines) - 2
+	if s.scroll > len(diffRows)-1 {
+		s.scroll = len(diffRows) - 1
+	}
+	if s.scroll < 0 {
+		s.scroll = 0
+	}
+	for i := s.scroll; i < len(diffRows) && i < s.scroll+diffHeight; i++ {
+		lines = append(lines, renderRow(diffRows[i], half))
+	}
+	for len(lines) < rows-2 {
+		lines = append(lines, "")
+	}
+
+	lines = append(lines, colorGray+fit(s.message, cols)+colorReset)
+	lines = append(lines, colorGray+fit("↑/↓ 选择  l 本地  r 远端  e 编辑  L/R 全部本地/远端  PgUp/PgDn 滚动  a 应用  q 取消", cols)+colorReset)
+
+	t.out.WriteString("\033[H\033[2J")
+	t.out.WriteString(strings.Join(lines, "\r\n"))
+	t.out.Flush()
+	s.message = ""
+}
+
+func renderRow(row diff.SideBySideRow, width int) string {
+	left, right := pad("", width), pad("", width)
+	leftColor, rightColor := colorGray, colorGray
+	if row.Left != nil {
+		left = pad(expandTabs(row.Left.Text), width)
+		if row.Left.Kind == diff.OpDelete {
+			leftColor = colorRed
+		}
+	}
+	if row.Right != nil {
+		right = pad(expandTabs(row.Right.Text), width)
+		if row.Right.Kind == diff.OpInsert {
+			rightColor = colorGreen
+		}
+	}
+	if row.Left != nil && row.Right != nil && row.Left.Kind == diff.OpEqual {
+		leftColor, rightColor = "", ""
+	}
+	return leftColor + left + colorReset + " │ " + rightColor + right + colorReset
+}
+
+func choiceTag(c Choice) string {
+	switch c {
+	case ChoiceLocal:
+		return colorYellow + "[本地]" + colorReset
+	case ChoiceEdited:
+		return colorCyan + "[编辑]" + colorReset
+	default:
+		return colorGreen + "[远端]" + colorReset
+	}
+}
+
+// fit 截断到指定显示宽度，ANSI 颜色序列不计入宽度
+func fit(s string, width int) string {
+	if displayWidth(s) <= width {
+		return s
+	}
+	var sb strings.Builder
+	w := 0
+	inEscape := false
+	for _, r := range s {
+		if r == 27 || inEscape {
+			inEscape = r != 'm'
+			sb.WriteRune(r)
+			continue
+		}
+		rw := runeWidth(r)
+		if w+rw > width-1 {
+			break
+		}
+		sb.WriteRune(r)
+		w += rw
+	}
+	sb.WriteString("…" + colorReset)
+	return sb.String()
+}
+
+// pad 截断或补齐到指定显示宽度
+func pad(s string, width int) string {
+	s = fit(s, width)
+	if w := displayWidth(s); w < width {
+		s += strings.Repeat(" ", width-w)
+	}
+	return s
+}
+
+func expandTabs(s string) string {
+	return strings.ReplaceAll(s, "\t", "    ")
+}
+
+func displayWidth(s string) int {
+	w := 0
+	inEscape := false
+	for _, r := range s {
+		if r == 27 {
+			inEscape = true
+			continue
+		}
+		if inEscape {
+			if r == 'm' {
+				inEscape = false
+			}
+			continue
+		}
+		w += runeWidth(r)
+	}
+	return w
+}
+
+// runeWidth 粗略估计字符的显示宽度（CJK 等全角字符占两列）
+func runeWidth(r rune) int {
+	if r < utf8.RuneSelf {
+		return 1
+	}
+	switch {
+	case r >= 0x1100 && r <= 0x115F,
+		r >= 0x2E80 && r <= 0xA4CF,
+		r >= 0xAC00 && r <= 0xD7A3,
+		r >= 0xF900 && r <= 0xFAFF,
+		r >= 0xFE30 && r <= 0xFE4F,
+		r >= 0xFF00 && r <= 0xFF60,
+		r >= 0xFFE0 && r <= 0xFFE6:
+		return 2
+	}
+	return 1
+}
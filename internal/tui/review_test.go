@@ -0,0 +1,37 @@
+package tui
+
+import "testing"
+
+func TestPadHandlesWideAndColoredText(t *testing.T) {
+	cases := []struct {
+		input string
+		width int
+		want  int
+	}{
+		{input: "abc", width: 6, want: 6},
+		{input: "本地配置", width: 6, want: 6},
+		{input: colorGreen + "[远端]" + colorReset + " mcpServers.github", width: 10, want: 10},
+	}
+
+	for _, tc := range cases {
+		got := displayWidth(pad(tc.input, tc.width))
+		if got != tc.want {
+			t.Fatalf("displayWidth(pad(%q, %d)) = %d, want %d", tc.input, tc.width, got, tc.want)
+		}
+	}
+}
+
+func TestEntryValue(t *testing.T) {
+	entry := Entry{Local: "l", Remote: "r", Edited: "e"}
+	if entry.Value() != "r" {
+		t.Fatalf("default Value = %q, want r", entry.Value())
+	}
+	entry.Choice = ChoiceLocal
+	if entry.Value() != "l" {
+		t.Fatalf("local Value = %q, want l", entry.Value())
+	}
+	entry.Choice = ChoiceEdited
+	if entry.Value() != "e" {
+		t.Fatalf("edited Value = %q, want e", entry.Value())
+	}
+}
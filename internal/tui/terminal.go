@@ -0,0 +1,143 @@
+package tui
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ErrUnavailable 表示当前环境无法使用全屏界面（非终端、禁用或缺少 stty）
+var ErrUnavailable = errors.New("interactive terminal UI unavailable")
+
+// Available 判断是否可以使用全屏界面
+// 设置环境变量 CLAUDE_SYNC_NO_TUI=1 可强制使用逐行提示
+func Available() bool {
+	if os.Getenv("CLAUDE_SYNC_NO_TUI") != "" {
+		return false
+	}
+	if !isCharDevice(os.Stdin) || !isCharDevice(os.Stdout) {
+		return false
+	}
+	_, err := exec.LookPath("stty")
+	return err == nil
+}
+
+func isCharDevice(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// terminal 封装 raw 模式下的输入输出
+type terminal struct {
+	saved  string
+	reader *bufio.Reader
+	out    *bufio.Writer
+}
+
+func openTerminal() (*terminal, error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, ErrUnavailable
+	}
+	t := &terminal{
+		saved:  strings.TrimSpace(saved),
+		reader: bufio.NewReader(os.Stdin),
+		out:    bufio.NewWriter(os.Stdout),
+	}
+	if err := t.enter(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// enter 进入 raw 模式并切换到备用屏幕
+func (t *terminal) enter() error {
+	if _, err := stty("raw", "-echo"); err != nil {
+		return ErrUnavailable
+	}
+	t.out.WriteString("\033[?1049h\033[?25l")
+	return t.out.Flush()
+}
+
+// leave 恢复终端状态
+func (t *terminal) leave() {
+	t.out.WriteString("\033[?25h\033[?1049l")
+	t.out.Flush()
+	stty(t.saved)
+}
+
+// size 返回终端的行数和列数
+func (t *terminal) size() (int, int) {
+	out, err := stty("size")
+	if err == nil {
+		fields := strings.Fields(out)
+		if len(fields) == 2 {
+			rows, err1 := strconv.Atoi(fields[0])
+			cols, err2 := strconv.Atoi(fields[1])
+			if err1 == nil && err2 == nil && rows > 0 && cols > 0 {
+				return rows, cols
+			}
+		}
+	}
+	return 24, 80
+}
+
+// Key 表示一次按键
+type Key struct {
+	Rune rune
+	Name string // "up", "down", "pgup", "pgdn", "enter", "esc"
+}
+
+// readKey 读取一个按键，解析常见的转义序列
+func (t *terminal) readKey() (Key, error) {
+	r, _, err := t.reader.ReadRune()
+	if err != nil {
+		return Key{}, err
+	}
+	switch r {
+	case '\r', '\n':
+		return Key{Name: "enter"}, nil
+	case 3: // Ctrl-C
+		return Key{Rune: 'q'}, nil
+	case 27:
+		if t.reader.Buffered() == 0 {
+			return Key{Name: "esc"}, nil
+		}
+		next, _, _ := t.reader.ReadRune()
+		if next != '[' {
+			return Key{Name: "esc"}, nil
+		}
+		code, _, _ := t.reader.ReadRune()
+		switch code {
+		case 'A':
+			return Key{Name: "up"}, nil
+		case 'B':
+			return Key{Name: "down"}, nil
+		case '5', '6':
+			t.reader.ReadRune() // 结尾的 '~'
+			if code == '5' {
+				return Key{Name: "pgup"}, nil
+			}
+			return Key{Name: "pgdn"}, nil
+		}
+		return Key{Name: "esc"}, nil
+	}
+	return Key{Rune: r}, nil
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("stty %s: %w", strings.Join(args, " "), err)
+	}
+	return string(out), nil
+}